@@ -37,6 +37,8 @@ const (
     versionExpireMessage       = "你当前的游戏版本过老，请更新客户端"
     deskCardNotEnoughMessage   = "金币不足"
     inRoomPlayerNowMessage     = "你当前正在房间中"
+    watchForbiddenMessage      = "当前房间不允许观战"
+    watchFullMessage           = "当前房间观战人数已满"
 )
 
 //错误码
@@ -48,6 +50,8 @@ const (
     eCreateVersionExpire  = 1005
     eDeskCardNotEnough    = 1006
     ePlayerNotInDesk      = 1007
+    eWatchForbidden       = 1008
+    eWatchFull            = 1009
 )
 
 type Behavior int
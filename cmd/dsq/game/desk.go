@@ -2,7 +2,6 @@ package game
 
 import (
 	"fmt"
-	"math/rand"
 	"strings"
 	"sync/atomic"
 	"time"
@@ -15,6 +14,8 @@ import (
 	"github.com/lonng/nanoserver/cmd/dsq/protocol"
 	"github.com/lonng/nanoserver/pkg/async"
 	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/shuffle"
+	"github.com/lonng/nanoserver/pkg/watch"
 	"github.com/pborman/uuid"
 	log "github.com/sirupsen/logrus"
 )
@@ -34,6 +35,8 @@ type Desk struct {
 	prepare     *prepareContext           //准备相关状态
 	opts        *protocol.DeskOptions     //房间选项
 	latestEnter *protocol.PlayerEnterDesk //最新的进入状态
+	watchers    *watch.Group              //观战组播通道, 不允许观战时为nil
+	spectators  map[int64]*Player         //观战玩家
 	logger      *log.Entry
 }
 
@@ -49,6 +52,9 @@ func NewDesk(roomNo RoomNumber, opts *protocol.DeskOptions) *Desk {
 		prepare:  newPrepareContext(),
 		logger:   log.WithField(fieldDesk, roomNo),
 		opts:     opts,
+
+		watchers:   newWatchGroup(opts),
+		spectators: map[int64]*Player{},
 	}
 	return d
 }
@@ -136,7 +142,7 @@ func (d *Desk) syncDeskStatus() {
 			IP:       p.ip,
 		})
 	}
-	d.group.Broadcast("onPlayerEnter", d.latestEnter)
+	d.broadcast("onPlayerEnter", d.latestEnter)
 }
 
 // 如果是重新进入 isReJoin: true
@@ -202,8 +208,10 @@ func (d *Desk) start() {
 	d.setStatus(DeskStatusDuanPai)              //发牌
 	var totalPlayerCount = d.totalPlayerCount() // 玩家数量
 
+	shuffler := shuffle.NewRandom() // 本局的洗牌器, 保存种子可以重建本局的阵营和棋盘
+
 	//随机出0、1 0则第一个玩家是红方 1则第二个玩家是红方 红方先开始
-	d.curIndex = rand.Intn(totalPlayerCount) + 1
+	d.curIndex = shuffler.Intn(totalPlayerCount) + 1
 	d.logger.Info("d.curIndex", d.curIndex)
 
 	if d.curIndex == 1 {
@@ -214,15 +222,13 @@ func (d *Desk) start() {
 		d.players[1].camp = 1 //红方
 	}
 
-	d.gameCtx.Ready()
+	d.gameCtx.Ready(shuffler)
+	d.logger.Infof("洗牌种子=%s", shuffler.Seed())
 	d.logger.Debugf("玩家数量=%d, 所有麻将=%v", totalPlayerCount)
 	d.logger.Debugf("游戏开局, 麻将数量=%d 所有麻将: %v", len(d.gameCtx.Origin), d.gameCtx.Origin)
 
-	duan := &protocol.DuanPai{Pieces: d.gameCtx.Current, Camps: []protocol.CampInfo{}}
-	for _, p := range d.players {
-		duan.Camps = append(duan.Camps, protocol.CampInfo{Uid: p.Uid(), Name: p.name, HeadUrl: p.head, Camp: p.camp})
-	}
-	d.group.Broadcast("onDuanPai", duan)
+	duan := &protocol.DuanPai{Pieces: d.pieces(), Camps: d.camps()}
+	d.broadcast("onDuanPai", duan)
 }
 
 // 理牌状态之后开始游戏
@@ -355,7 +361,7 @@ func (d *Desk) hint(p *Player) {
 	msg := &protocol.RoundInfo{Uid: p.Uid(), Camp: p.camp, TimeStamp: time.Now().Unix()}
 	d.lastHintUid = p.Uid()
 	d.logger.Debugf("玩家最后提示: Hint=%+v", msg)
-	d.group.Broadcast("onHintPlayer", msg)
+	d.broadcast("onHintPlayer", msg)
 }
 
 func (d *Desk) getPlayerByCamp(camp int) *Player {
@@ -382,7 +388,7 @@ func (d *Desk) gameResult(msg *protocol.GameResult) {
 	d.logger.Debugf("本场游戏结束结算数据: %#v", msg)
 
 	//发送单场统计
-	err := d.group.Broadcast("onGameEnd", msg)
+	err := d.broadcast("onGameEnd", msg)
 	if err != nil {
 		log.Error(err)
 	}
@@ -424,6 +430,7 @@ func (d *Desk) destroy() {
 	}
 
 	// 释放desk资源
+	d.closeWatchers()
 	d.group.Close()
 	d.prepare.reset()
 
@@ -588,7 +595,7 @@ func (d *Desk) onOpenPiece(s *session.Session, index int) error {
 	//s.Response(&protocol.PieceOpenResponse{Code: 0, Index: index, Piece: piece})
 
 	//翻牌广播
-	d.group.Broadcast("onOpenPiece", &protocol.PieceOpenNotify{Uid: s.UID(), Index: index, Piece: piece})
+	d.broadcast("onOpenPiece", &protocol.PieceOpenNotify{Uid: s.UID(), Index: index, Piece: piece})
 
 	//翻牌通知
 	p.chOperation <- &protocol.OpChoosed{
@@ -634,7 +641,7 @@ func (d *Desk) onMovePiece(s *session.Session, msg *protocol.PieceMoveRequest) e
 	//响应广播操作
 	//s.Response(&protocol.PieceMoveResponse{Code: ret, Pieces: d.gameCtx.Current})
 	if bMove {
-		d.group.Broadcast("onMovePiece", &protocol.PieceMoveNotify{Uid: s.UID(), IndexSrc: msg.IndexSrc, IndexDest: msg.IndexDest})
+		d.broadcast("onMovePiece", &protocol.PieceMoveNotify{Uid: s.UID(), IndexSrc: msg.IndexSrc, IndexDest: msg.IndexDest})
 	}
 
 	//移动通知
@@ -676,7 +683,7 @@ func (d *Desk) onEatPiece(s *session.Session, msg *protocol.PieceEatRequest) err
 
 	//s.Response(&protocol.PieceEatResponse{Code: ret, Pieces: d.gameCtx.Current})
 	if ret != 0 {
-		d.group.Broadcast("onEatPiece", &protocol.PieceEatNotify{Uid: s.UID(), Code: ret, IndexSrc: msg.IndexSrc, IndexDest: msg.IndexDest})
+		d.broadcast("onEatPiece", &protocol.PieceEatNotify{Uid: s.UID(), Code: ret, IndexSrc: msg.IndexSrc, IndexDest: msg.IndexDest})
 	}
 
 	//吃牌通知
@@ -92,6 +92,10 @@ func (manager *DeskManager) onPlayerDisconnect(s *session.Session) error {
 	}
 	p.logger.Debug("DeskManager.onPlayerDisconnect: 玩家网络断开")
 
+	if p.watching != nil {
+		p.watching.watcherLeave(p)
+	}
+
 	// 移除session
 	p.removeSession()
 
@@ -317,6 +321,7 @@ func (manager *DeskManager) CreateDesk(s *session.Session, data *protocol.Create
 	d.createdAt = time.Now().Unix()
 	d.creator = s.UID()
 	d.gameCtx.Init()
+	leaveWatching(s)
 
 	//房间创建者自动join
 	if err := d.playerJoin(s, false); err != nil {
@@ -362,6 +367,7 @@ func (manager *DeskManager) Join(s *session.Session, data *protocol.JoinDeskRequ
 		return s.Response(deskPlayerNumEnough)
 	}
 
+	leaveWatching(s)
 	if err := d.playerJoin(s, false); err != nil {
 		d.logger.Errorf("玩家加入房间失败，UID=%d, Error=%s", s.UID(), err.Error())
 	}
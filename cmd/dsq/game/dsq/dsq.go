@@ -2,13 +2,9 @@ package dsq
 
 import (
 	"fmt"
-	"math/rand"
-	"time"
-)
 
-func init() {
-	rand.Seed(time.Now().Unix())
-}
+	"github.com/lonng/nanoserver/pkg/shuffle"
+)
 
 // 棋子id定义
 //红色： 8 象 7 狮 6虎 5豹 4狼 3狗 2猫 1鼠   蓝色： 16 象 15 狮 14虎 13豹 12狼 11狗 10猫 9鼠  0吃掉的值 -1是没有翻开的值
@@ -19,6 +15,7 @@ type (
 	Dsq struct {
 		Origin  []int
 		Current []int
+		Seed    shuffle.Seed // 洗牌种子, 用于重建棋盘
 	}
 )
 
@@ -40,13 +37,10 @@ func (self *Dsq) Init() {
 	}
 }
 
-//发牌洗牌
-func (self *Dsq) Ready() {
-	s := rand.New(rand.NewSource(time.Now().Unix()))
-	for i := range self.Origin {
-		j := s.Intn(chessCount)
-		self.Origin[i], self.Origin[j] = self.Origin[j], self.Origin[i]
-	}
+//发牌洗牌, 相同种子的洗牌器总是得到相同的棋盘
+func (self *Dsq) Ready(s *shuffle.Shuffler) {
+	self.Seed = s.Seed()
+	s.Ints(self.Origin)
 }
 
 // 输出整个棋盘
@@ -11,6 +11,7 @@ import (
     "github.com/lonng/nano"
     "github.com/lonng/nano/component"
     "github.com/lonng/nano/serialize/json"
+    "github.com/lonng/nanoserver/pkg/secure"
     log "github.com/sirupsen/logrus"
     "github.com/spf13/viper"
 )
@@ -73,9 +74,10 @@ func Startup() {
 
     // 加密管道
     c := newCrypto()
+    nano.Register(c.Handler(), component.WithName(secure.Name))
     pipeline := nano.NewPipeline()
-    pipeline.Inbound().PushBack(c.inbound)
-    pipeline.Outbound().PushBack(c.outbound)
+    pipeline.Inbound().PushBack(c.Inbound)
+    pipeline.Outbound().PushBack(c.Outbound)
 
     //json作为传输协议
 
@@ -83,5 +85,5 @@ func Startup() {
     nano.SetSerializer(json.NewSerializer())
     addr := fmt.Sprintf(":%d", viper.GetInt("game-server.port"))
     nano.SetCheckOriginFunc(func(_ *http.Request) bool { return true })
-    nano.ListenWS(addr) //nano.WithPipeline(pipeline)
+    nano.ListenWS(addr, nano.WithPipeline(pipeline))
 }
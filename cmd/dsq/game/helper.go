@@ -23,6 +23,10 @@ func verifyOptions(opts *protocol.DeskOptions) bool {
     if opts.Mode != ModeBiSai && opts.Mode != ModeRoom {
         return false
     }
+
+    if opts.WatchDelay < 0 || opts.WatchDelay > maxWatchDelay {
+        return false
+    }
     return true
 }
 
@@ -19,6 +19,7 @@ type Player struct {
 	camp        int              // 当前玩家在桌上的阵营 1 红色 2蓝色
 	session     *session.Session // 玩家session
 	desk        *Desk            // 当前桌
+	watching    *Desk            // 正在观战的房间
 	logger      *log.Entry       // 日志
 	chOperation chan *protocol.OpChoosed
 }
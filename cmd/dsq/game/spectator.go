@@ -0,0 +1,156 @@
+package game
+
+import (
+	"time"
+
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/cmd/dsq/protocol"
+	"github.com/lonng/nanoserver/pkg/watch"
+)
+
+// 观战: 棋盘上翻开的棋子对所有人可见, 观战者使用单独的组播通道, 不占用座位
+
+const (
+	maxWatchers   = 20  // 每个房间最多观战人数
+	maxWatchDelay = 300 // 观战最大延迟, 单位: 秒
+)
+
+// 房间允许观战时创建观战分组
+func newWatchGroup(opts *protocol.DeskOptions) *watch.Group {
+	if !opts.Watch {
+		return nil
+	}
+	return watch.New(time.Duration(opts.WatchDelay)*time.Second, maxWatchers)
+}
+
+// 向牌桌上的玩家和观战者广播
+func (d *Desk) broadcast(route string, v interface{}) error {
+	if d.watchers != nil {
+		d.watchers.Broadcast(route, v)
+	}
+	return d.group.Broadcast(route, v)
+}
+
+// 当前棋盘的副本, 延迟推送时棋盘可能已经变化
+func (d *Desk) pieces() []int {
+	return append([]int{}, d.gameCtx.Current...)
+}
+
+func (d *Desk) camps() []protocol.CampInfo {
+	camps := []protocol.CampInfo{}
+	for _, p := range d.players {
+		camps = append(camps, protocol.CampInfo{Uid: p.Uid(), Name: p.name, HeadUrl: p.head, Camp: p.camp})
+	}
+	return camps
+}
+
+func (d *Desk) watcherJoin(p *Player) error {
+	s := p.session
+	if err := d.watchers.Add(s); err != nil {
+		return err
+	}
+	p.watching = d
+	d.spectators[p.Uid()] = p
+	p.logger.Infof("玩家开始观战: 房号=%s 观战人数=%d", d.roomNo, d.watchers.Count())
+
+	// 进入时同步完整的牌桌数据, 和观战消息使用相同的延迟
+	d.watchers.Push(s, "onDeskBasicInfo", &protocol.DeskBasicInfo{
+		DeskID: string(d.roomNo),
+		Title:  d.title(),
+		Desc:   d.desc(true),
+		Mode:   d.opts.Mode,
+	})
+	if d.latestEnter != nil {
+		d.watchers.Push(s, "onPlayerEnter", d.latestEnter)
+	}
+	if status := d.status(); status != DeskStatusCreate && status != DeskStatusCleaned {
+		d.watchers.Push(s, "onWatchSync", &protocol.WatchSync{
+			Status: status,
+			Pieces: d.pieces(),
+			Camps:  d.camps(),
+			CurUid: d.lastHintUid,
+		})
+	}
+	return nil
+}
+
+func (d *Desk) watcherLeave(p *Player) {
+	if s := p.session; s != nil && d.watchers != nil {
+		d.watchers.Leave(s)
+	}
+	p.watching = nil
+	delete(d.spectators, p.Uid())
+	p.logger.Info("玩家退出观战")
+}
+
+// 房间解散时结束所有观战
+func (d *Desk) closeWatchers() {
+	if d.watchers == nil {
+		return
+	}
+	for _, p := range d.spectators {
+		p.watching = nil
+	}
+	d.spectators = map[int64]*Player{}
+	d.watchers.Close()
+}
+
+// 加入房间前退出观战
+func leaveWatching(s *session.Session) {
+	p, err := playerWithSession(s)
+	if err != nil || p.watching == nil {
+		return
+	}
+	p.watching.watcherLeave(p)
+}
+
+// 观战房间
+func (manager *DeskManager) Watch(s *session.Session, data *protocol.WatchDeskRequest) error {
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+	if p.desk != nil {
+		return s.Response(&protocol.WatchDeskResponse{Code: eReentryDesk, Error: inRoomPlayerNowMessage})
+	}
+
+	d, ok := manager.desk(RoomNumber(data.DeskNo))
+	if !ok || d.isDestroy() {
+		return s.Response(&protocol.WatchDeskResponse{Code: eDeskNotFoundResponse, Error: deskNotFoundMessage})
+	}
+	if d.watchers == nil {
+		return s.Response(&protocol.WatchDeskResponse{Code: eWatchForbidden, Error: watchForbiddenMessage})
+	}
+
+	// 切换观战的房间
+	if p.watching != nil && p.watching != d {
+		p.watching.watcherLeave(p)
+	}
+
+	if err := d.watcherJoin(p); err != nil {
+		if err == watch.ErrWatchFull {
+			return s.Response(&protocol.WatchDeskResponse{Code: eWatchFull, Error: watchFullMessage})
+		}
+		return s.Response(&protocol.WatchDeskResponse{Code: FAIL, Error: err.Error()})
+	}
+
+	return s.Response(&protocol.WatchDeskResponse{
+		Code:  SUC,
+		Delay: d.opts.WatchDelay,
+		TableInfo: protocol.TableInfo{
+			DeskNo:    string(d.roomNo),
+			CreatedAt: d.createdAt,
+			Creator:   d.creator,
+			Title:     d.title(),
+			Desc:      d.desc(true),
+			Status:    d.status(),
+			Mode:      d.opts.Mode,
+		},
+	})
+}
+
+// 退出观战
+func (manager *DeskManager) Unwatch(s *session.Session, _ []byte) error {
+	leaveWatching(s)
+	return s.Response(protocol.SuccessMessage)
+}
@@ -41,7 +41,9 @@ type SyncDesk struct {
 }
 
 type DeskOptions struct {
-	Mode int `json:"mode"`
+	Mode       int  `json:"mode"`
+	Watch      bool `json:"watch"`      // 是否允许观战
+	WatchDelay int  `json:"watchDelay"` // 观战延迟, 单位: 秒
 }
 
 type CreateDeskRequest struct {
@@ -121,6 +123,14 @@ type DuanPai struct {
 	Camps  []CampInfo `json:"camps"`  //阵营
 }
 
+// 观战者进入时同步的棋盘数据, 棋盘上只有翻开的棋子
+type WatchSync struct {
+	Status int32      `json:"status"`
+	Pieces []int      `json:"pieces"` //棋盘
+	Camps  []CampInfo `json:"camps"`  //阵营
+	CurUid int64      `json:"curUid"` //当前操作的玩家
+}
+
 type RoundInfo struct {
 	Uid       int64 `json:"uid"`       //提示的玩家
 	Camp      int   `json:"camp"`      //当前出牌的阵营
@@ -64,6 +64,17 @@ type JoinDeskResponse struct {
 	TableInfo TableInfo `json:"tableInfo"`
 }
 
+type WatchDeskRequest struct {
+	DeskNo string `json:"deskId"`
+}
+
+type WatchDeskResponse struct {
+	Code      int       `json:"code"`
+	Error     string    `json:"error"`
+	Delay     int       `json:"delay"` //观战延迟, 单位: 秒
+	TableInfo TableInfo `json:"tableInfo"`
+}
+
 type DestoryDeskRequest struct {
 	DeskNo string `json:"deskId"`
 }
@@ -0,0 +1,46 @@
+package game
+
+import (
+    "fmt"
+    "strings"
+
+    "github.com/lonng/nano/session"
+    "github.com/lonng/nanoserver/db"
+    "github.com/lonng/nanoserver/db/model"
+    "github.com/lonng/nanoserver/protocol"
+    "github.com/spf13/viper"
+)
+
+var tokenSecret []byte // 登录凭证签名密钥, 和web服务器使用同一个配置
+
+func setupToken() {
+    secret := viper.GetString("token.secret")
+    if secret == "" {
+        logger.Fatal("没有配置登录凭证的签名密钥token.secret, 请使用随机生成的密钥")
+    }
+    tokenSecret = []byte(secret)
+}
+
+// 验证web登录时签发的凭证, 玩家信息以数据库为准, 不再信任客户端上传的uid和昵称等信息
+func authenticate(token string) (*model.User, error) {
+    u, _, err := db.VerifyToken(token, tokenSecret)
+    if err != nil {
+        return nil, err
+    }
+    return u, nil
+}
+
+// 玩家的昵称、头像和性别, 三方账号使用三方平台的信息, 游客使用默认信息
+func profile(u *model.User) (name, head string, sex int) {
+    if t, err := db.QueryThirdAccountByUid(u.Id); err == nil {
+        return t.ThirdName, t.HeadUrl, t.Sex
+    }
+    return fmt.Sprintf("G%d", u.Id), protocol.GuestHeadUrl, 1
+}
+
+func remoteIP(s *session.Session) string {
+    if parts := strings.Split(s.RemoteAddr().String(), ":"); len(parts) > 0 {
+        return parts[0]
+    }
+    return ""
+}
@@ -0,0 +1,269 @@
+package game
+
+import (
+    "encoding/json"
+    "sync"
+    "time"
+
+    "github.com/lonng/nano"
+    "github.com/lonng/nanoserver/cmd/mahjong/game/history"
+    "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
+    "github.com/lonng/nanoserver/db"
+    "github.com/lonng/nanoserver/db/model"
+    "github.com/lonng/nanoserver/pkg/async"
+    "github.com/lonng/nanoserver/pkg/constant"
+    "github.com/lonng/nanoserver/pkg/room"
+    "github.com/lonng/nanoserver/protocol"
+    log "github.com/sirupsen/logrus"
+)
+
+// 牌桌检查点: 每局开始和结束时保存房间信息、座位、分数和场统计, 服务器重启后根据检查点
+// 重建牌桌, 玩家通过UnCompleteDesk/ReConnect/ReJoin重新进入房间.
+// 重启时正在进行的一局作废, 所有玩家重新准备后重新开始这一局, 不会重复扣除房卡.
+
+// 检查点按顺序写入数据库, 保证房间解散后删除检查点不会被之前的保存覆盖.
+// 数据库较慢时每个房间只保留最新的一次写入, 保存和删除都不会阻塞牌桌
+var checkpoints = &checkpointQueue{
+    pending: map[string]func(){},
+    notify:  make(chan struct{}, 1),
+}
+
+type checkpointQueue struct {
+    sync.Mutex
+    pending map[string]func() // 房号 -> 最新的写入
+    order   []string          // 等待写入的房号, 按照第一次加入的顺序
+    notify  chan struct{}
+}
+
+// 加入写入队列, 同一个房间还没有写入的检查点直接被替换
+func (q *checkpointQueue) put(no string, fn func()) {
+    q.Lock()
+    if _, ok := q.pending[no]; !ok {
+        q.order = append(q.order, no)
+    }
+    q.pending[no] = fn
+    q.Unlock()
+
+    select {
+    case q.notify <- struct{}{}:
+    default:
+    }
+}
+
+func (q *checkpointQueue) next() (func(), bool) {
+    q.Lock()
+    defer q.Unlock()
+
+    if len(q.order) == 0 {
+        return nil, false
+    }
+    no := q.order[0]
+    q.order = q.order[1:]
+    fn := q.pending[no]
+    delete(q.pending, no)
+    return fn, true
+}
+
+type playerCheckpoint struct {
+    Uid   int64  `json:"uid"`
+    Name  string `json:"name"`
+    Head  string `json:"head"`
+    IP    string `json:"ip"`
+    Sex   int    `json:"sex"`
+    Score int    `json:"score"`
+    Robot int    `json:"robot"` // 机器人难度, 真实玩家为0
+}
+
+type deskCheckpoint struct {
+    DeskNo     string                `json:"deskNo"`
+    DeskID     int64                 `json:"deskId"`
+    ClubID     int64                 `json:"clubId"`
+    Creator    int64                 `json:"creator"`
+    CreatedAt  int64                 `json:"createdAt"`
+    Opts       *protocol.DeskOptions `json:"opts"`
+    Round      uint32                `json:"round"` // 已经完成的局数
+    BankerTurn int                   `json:"bankerTurn"`
+    Players    []playerCheckpoint    `json:"players"`
+    MatchStats history.MatchStats    `json:"matchStats"`
+}
+
+func startCheckpointWriter() {
+    go func() {
+        for range checkpoints.notify {
+            for fn, ok := checkpoints.next(); ok; fn, ok = checkpoints.next() {
+                fn()
+            }
+        }
+    }()
+}
+
+// 保存检查点, round为已经完成的局数
+func (d *Desk) checkpoint(round uint32) {
+    // 还没有开始的房间没有扣除房卡, 不需要恢复
+    if d.deskID == 0 {
+        return
+    }
+
+    c := &deskCheckpoint{
+        DeskNo:     d.roomNo.String(),
+        DeskID:     d.deskID,
+        ClubID:     d.clubId,
+        Creator:    d.creator,
+        CreatedAt:  d.createdAt,
+        Opts:       d.opts,
+        Round:      round,
+        BankerTurn: d.bankerTurn,
+        MatchStats: d.matchStats,
+    }
+    for _, p := range d.players {
+        pc := playerCheckpoint{
+            Uid:   p.Uid(),
+            Name:  p.name,
+            Head:  p.head,
+            IP:    p.ip,
+            Sex:   p.sex,
+            Score: p.score,
+        }
+        if p.isRobot() {
+            pc.Robot = p.robot.level
+        }
+        c.Players = append(c.Players, pc)
+    }
+
+    data, err := json.Marshal(c)
+    if err != nil {
+        d.logger.Errorf("序列化牌桌检查点错误: %v", err)
+        return
+    }
+
+    m := &model.DeskCheckpoint{
+        DeskNo:    c.DeskNo,
+        DeskId:    c.DeskID,
+        Round:     int(round),
+        Data:      string(data),
+        UpdatedAt: time.Now().Unix(),
+    }
+    logger := d.logger
+    checkpoints.put(c.DeskNo, func() {
+        if err := db.SaveDeskCheckpoint(m); err != nil {
+            logger.Errorf("保存牌桌检查点错误: %v", err)
+        }
+    })
+}
+
+// 房间解散后删除检查点
+func (d *Desk) removeCheckpoint() {
+    if d.deskID == 0 {
+        return
+    }
+
+    no, logger := d.roomNo.String(), d.logger
+    checkpoints.put(no, func() {
+        if err := db.DeleteDeskCheckpoint(no); err != nil {
+            logger.Errorf("删除牌桌检查点错误: %v", err)
+        }
+    })
+}
+
+// 服务器启动后从检查点恢复牌桌, 数据库由web服务器初始化, 需要等待初始化完成
+func (manager *DeskManager) recoverDesks() {
+    async.Run(func() {
+        <-db.Ready()
+        list, err := db.QueryDeskCheckpoints()
+        if err != nil {
+            logger.Errorf("读取牌桌检查点错误: %v", err)
+            return
+        }
+        if len(list) < 1 {
+            return
+        }
+
+        nano.Invoke(func() {
+            for i := range list {
+                manager.restoreDesk(&list[i])
+            }
+            logger.Infof("从检查点恢复房间完成, 房间数量: %d", len(manager.desks))
+        })
+    })
+}
+
+func (manager *DeskManager) restoreDesk(m *model.DeskCheckpoint) {
+    c := &deskCheckpoint{}
+    if err := json.Unmarshal([]byte(m.Data), c); err != nil {
+        logger.Errorf("解析牌桌检查点错误: 房号=%s Error=%v", m.DeskNo, err)
+        return
+    }
+
+    no := room.Number(c.DeskNo)
+    if _, ok := manager.desk(no); ok {
+        logger.Warnf("房间已经存在, 忽略检查点: 房号=%s", no)
+        return
+    }
+    if c.Opts == nil || len(c.Players) != c.Opts.Mode {
+        logger.Errorf("牌桌检查点数据不完整: 房号=%s", no)
+        return
+    }
+
+    d := NewDesk(no, c.Opts, c.ClubID)
+    d.deskID = c.DeskID
+    d.creator = c.Creator
+    d.createdAt = c.CreatedAt
+    d.round = c.Round
+    d.bankerTurn = c.BankerTurn
+    d.isFirstRound = false
+    d.setStatus(constant.DeskStatusCleaned)
+    if c.MatchStats != nil {
+        d.matchStats = c.MatchStats
+    }
+
+    for _, pc := range c.Players {
+        d.players = append(d.players, restorePlayer(pc))
+    }
+    for i, p := range d.players {
+        uid := p.Uid()
+        p.setDesk(d, i)
+        d.roundStats[uid] = &history.Record{}
+
+        // 机器人直接准备, 真实玩家重新进入房间前为离线状态
+        if p.isRobot() {
+            d.prepare.ready(uid)
+        } else {
+            d.dissolve.updateOnlineStatus(uid, false)
+        }
+    }
+
+    manager.setDesk(no, d)
+    d.logger.Infof("从检查点恢复房间: 已完成局数=%d/%d 玩家数量=%d", d.round, d.opts.MaxRound, len(d.players))
+}
+
+// 恢复玩家数据, 玩家可能在恢复之前已经重新登录
+func restorePlayer(c playerCheckpoint) *Player {
+    if c.Robot > 0 {
+        reserveRobotUid(c.Uid)
+        p := newRobotWithUid(c.Uid, c.Robot)
+        p.name = c.Name
+        p.score = c.Score
+        return p
+    }
+
+    p, ok := defaultPlayerManager.player(c.Uid)
+    if !ok {
+        p = &Player{
+            uid:  c.Uid,
+            name: c.Name,
+            head: c.Head,
+            ip:   c.IP,
+            sex:  c.Sex,
+            ctx:  &mahjong.Context{Uid: c.Uid},
+
+            logger: log.WithField(fieldPlayer, c.Uid),
+
+            chOperation: make(chan *protocol.OpChoosed, 1),
+        }
+        p.ctx.Reset()
+        defaultPlayerManager.setPlayer(c.Uid, p)
+        p.syncCoinFromDB()
+    }
+    p.score = c.Score
+    return p
+}
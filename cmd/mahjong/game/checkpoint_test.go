@@ -0,0 +1,22 @@
+package game
+
+import "testing"
+
+func TestCheckpointQueue(t *testing.T) {
+    q := &checkpointQueue{pending: map[string]func(){}, notify: make(chan struct{}, 1)}
+
+    got := []string{}
+    q.put("1", func() { got = append(got, "save 1") })
+    q.put("2", func() { got = append(got, "save 2") })
+    q.put("1", func() { got = append(got, "remove 1") }) // 替换还没有写入的保存
+
+    for fn, ok := q.next(); ok; fn, ok = q.next() {
+        fn()
+    }
+    if len(got) != 2 || got[0] != "remove 1" || got[1] != "save 2" {
+        t.Fatalf("unexpected writes: %v", got)
+    }
+    if len(q.notify) != 1 {
+        t.Fatal("expect writer notified")
+    }
+}
@@ -1,11 +1,13 @@
 package game
 
 import (
+    "github.com/lonng/nanoserver/db/model"
     "github.com/lonng/nanoserver/protocol"
 
     "github.com/lonng/nanoserver/db"
     "github.com/lonng/nanoserver/pkg/async"
 
+    "github.com/lonng/nano"
     "github.com/lonng/nano/component"
     "github.com/lonng/nano/session"
 )
@@ -29,3 +31,117 @@ func (c *ClubManager) ApplyClub(s *session.Session, payload *protocol.ApplyClubR
     })
     return nil
 }
+
+// 同意申请，通知申请的玩家
+func (c *ClubManager) Approve(s *session.Session, payload *protocol.ClubMemberRequest) error {
+    mid := s.MID()
+    logger.Debugf("同意加入俱乐部申请，操作者=%d，俱乐部ID=%d，UID=%d", s.UID(), payload.ClubId, payload.Uid)
+    async.Run(func() {
+        club, err := db.ApproveClub(s.UID(), payload.ClubId, payload.Uid)
+        if err != nil {
+            s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+            return
+        }
+        s.ResponseMID(mid, &protocol.SuccessResponse)
+        pushClubNotify(payload.Uid, club, protocol.ClubNotifyApproved)
+    })
+    return nil
+}
+
+// 拒绝申请，通知申请的玩家
+func (c *ClubManager) Reject(s *session.Session, payload *protocol.ClubMemberRequest) error {
+    mid := s.MID()
+    logger.Debugf("拒绝加入俱乐部申请，操作者=%d，俱乐部ID=%d，UID=%d", s.UID(), payload.ClubId, payload.Uid)
+    async.Run(func() {
+        club, err := db.RejectClub(s.UID(), payload.ClubId, payload.Uid)
+        if err != nil {
+            s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+            return
+        }
+        s.ResponseMID(mid, &protocol.SuccessResponse)
+        pushClubNotify(payload.Uid, club, protocol.ClubNotifyRejected)
+    })
+    return nil
+}
+
+// 踢出成员，通知被踢出的玩家
+func (c *ClubManager) Kick(s *session.Session, payload *protocol.ClubMemberRequest) error {
+    mid := s.MID()
+    logger.Infof("踢出俱乐部成员，操作者=%d，俱乐部ID=%d，UID=%d", s.UID(), payload.ClubId, payload.Uid)
+    async.Run(func() {
+        club, err := db.KickClub(s.UID(), payload.ClubId, payload.Uid)
+        if err != nil {
+            s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+            return
+        }
+        s.ResponseMID(mid, &protocol.SuccessResponse)
+        pushClubNotify(payload.Uid, club, protocol.ClubNotifyKicked)
+    })
+    return nil
+}
+
+// 退出俱乐部或者取消申请
+func (c *ClubManager) Leave(s *session.Session, payload *protocol.ApplyClubRequest) error {
+    mid := s.MID()
+    logger.Infof("玩家退出俱乐部，UID=%d，俱乐部ID=%d", s.UID(), payload.ClubId)
+    async.Run(func() {
+        if err := db.LeaveClub(s.UID(), payload.ClubId); err != nil {
+            s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+            return
+        }
+        s.ResponseMID(mid, &protocol.SuccessResponse)
+    })
+    return nil
+}
+
+// 部长设置或者取消管理员
+func (c *ClubManager) SetRole(s *session.Session, payload *protocol.ClubRoleRequest) error {
+    mid := s.MID()
+    logger.Infof("设置俱乐部成员角色，操作者=%d，俱乐部ID=%d，UID=%d，角色=%d", s.UID(), payload.ClubId, payload.Uid, payload.Role)
+    async.Run(func() {
+        if err := db.SetClubRole(s.UID(), payload.ClubId, payload.Uid, payload.Role); err != nil {
+            s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+            return
+        }
+        s.ResponseMID(mid, &protocol.SuccessResponse)
+    })
+    return nil
+}
+
+// 成员列表
+func (c *ClubManager) MemberList(s *session.Session, payload *protocol.ApplyClubRequest) error {
+    return c.members(s, payload.ClubId, model.UserClubStatusAgree)
+}
+
+// 申请列表，只有管理员可以查看
+func (c *ClubManager) ApplyList(s *session.Session, payload *protocol.ApplyClubRequest) error {
+    return c.members(s, payload.ClubId, model.UserClubStatusApply)
+}
+
+func (c *ClubManager) members(s *session.Session, clubId int64, status int) error {
+    mid := s.MID()
+    async.Run(func() {
+        list, err := db.ClubMembers(s.UID(), clubId, status)
+        if err != nil {
+            s.ResponseMID(mid, &protocol.ErrorResponse{Code: errorCode, Error: err.Error()})
+            return
+        }
+        s.ResponseMID(mid, &protocol.ClubMemberListResponse{Data: list})
+    })
+    return nil
+}
+
+// 通知在线的玩家，玩家列表只能在逻辑线程中访问
+func pushClubNotify(uid int64, club *model.Club, typ int) {
+    nano.Invoke(func() {
+        p, ok := defaultPlayerManager.player(uid)
+        if !ok || p.session == nil {
+            return
+        }
+        p.session.Push(protocol.RouteClubNotify, &protocol.ClubNotify{
+            ClubId: club.ClubId,
+            Name:   club.Name,
+            Type:   typ,
+        })
+    })
+}
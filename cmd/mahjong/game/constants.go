@@ -6,12 +6,16 @@ const (
     ScoreChangeTypeAnGang ScoreChangeType = iota + 1
     ScoreChangeTypeBaGang
     ScoreChangeTypeHu
+    ScoreChangeTypeChaJiao // 查大叫
+    ScoreChangeTypeHuaZhu  // 查花猪
 )
 
 var scoreChangeTypeDesc = [...]string{
-    ScoreChangeTypeAnGang: "下雨",
-    ScoreChangeTypeBaGang: "刮风",
-    ScoreChangeTypeHu:     "胡",
+    ScoreChangeTypeAnGang:  "下雨",
+    ScoreChangeTypeBaGang:  "刮风",
+    ScoreChangeTypeHu:      "胡",
+    ScoreChangeTypeChaJiao: "查大叫",
+    ScoreChangeTypeHuaZhu:  "查花猪",
 }
 
 const (
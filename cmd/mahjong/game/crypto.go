@@ -1,41 +1,30 @@
 package game
 
 import (
-    "encoding/base64"
-    "fmt"
-
-    "github.com/lonng/nano"
-    "github.com/lonng/nano/session"
-    "github.com/xxtea/xxtea-go/xxtea"
+    "github.com/lonng/nanoserver/pkg/secure"
+    "github.com/spf13/viper"
 )
 
-var xxteaKey = []byte("7AEC4MA152BQE9HWQ7KB")
-
-type Crypto struct {
-    key []byte
-}
-
-func newCrypto() *Crypto {
-    return &Crypto{xxteaKey}
-}
+// 连接加密, 新版本客户端通过secure.Exchange协商每个连接的密钥, 老版本客户端使用配置的旧加密方式
+func newCrypto() *secure.Cipher {
+    key := viper.GetString("crypto.private-key")
+    // 私钥必须固定, 否则每次重启后客户端内置的公钥都会失效, 可以使用secure.GenerateKey生成
+    if key == "" {
+        logger.Fatal("没有配置服务器私钥crypto.private-key, 请使用secure.GenerateKey生成后写入配置文件")
+    }
 
-func (c *Crypto) inbound(s *session.Session, msg nano.Message) error {
-    out, err := base64.StdEncoding.DecodeString(string(msg.Data))
+    legacy, err := secure.NewLegacy(viper.GetString("crypto.legacy"), viper.GetString("crypto.legacy-key"))
     if err != nil {
-        logger.Errorf("Inbound Error=%s, In=%s", err.Error(), string(msg.Data))
-        return err
+        logger.Fatalf("无效的旧加密方式配置: %v", err)
     }
-
-    out = xxtea.Decrypt(out, c.key)
-    if out == nil {
-        return fmt.Errorf("decrypt error=%s", err.Error())
+    if legacy == nil {
+        logger.Info("不支持老版本客户端的加密方式")
     }
-    msg.Data = out
-    return nil
-}
 
-func (c *Crypto) outbound(s *session.Session, msg nano.Message) error {
-    out := xxtea.Encrypt(msg.Data, c.key)
-    msg.Data = []byte(base64.StdEncoding.EncodeToString(out))
-    return nil
+    c, err := secure.New(key, legacy)
+    if err != nil {
+        logger.Fatalf("无效的服务器私钥配置: %v", err)
+    }
+    logger.Infof("服务器公钥: %s", c.PublicKey())
+    return c
 }
@@ -3,8 +3,8 @@ package game
 import (
     "encoding/json"
     "fmt"
-    "math/rand"
     "sort"
+    "strconv"
     "strings"
     "sync/atomic"
     "time"
@@ -19,6 +19,8 @@ import (
     "github.com/lonng/nanoserver/pkg/constant"
     "github.com/lonng/nanoserver/pkg/errutil"
     "github.com/lonng/nanoserver/pkg/room"
+    "github.com/lonng/nanoserver/pkg/shuffle"
+    "github.com/lonng/nanoserver/pkg/watch"
     "github.com/lonng/nanoserver/protocol"
     "github.com/pborman/uuid"
     log "github.com/sirupsen/logrus"
@@ -43,6 +45,7 @@ type Desk struct {
     roomNo    room.Number           // 房间号
     deskID    int64                 // desk表的pk
     opts      *protocol.DeskOptions // 房间选项
+    rule      mahjong.RuleSet       // 规则集
     state     constant.DeskStatus   // 状态
     round     uint32                // 第n局
     creator   int64                 // 创建玩家UID
@@ -51,6 +54,9 @@ type Desk struct {
     group     *nano.Group // 组播通道
     die       chan struct{}
 
+    watchers   *watch.Group      // 观战组播通道, 不允许观战时为nil
+    spectators map[int64]*Player // 观战玩家
+
     allTiles      mahjong.Mahjong //所有麻将
     bankerTurn    int             //庄家方位
     curTurn       int             //当前方位
@@ -65,12 +71,14 @@ type Desk struct {
     roundStats   history.RoundStats           //单局分值变化统计
     matchStats   history.MatchStats           //场分值变化统计
 
-    wonPlayers map[int64]bool //是否胡牌
-    paoPlayer  int64          //炮手
-    isMakerSet bool           // 当局第一次设置庄家
+    wonPlayers map[int64]bool       //是否胡牌
+    huRecords  []*protocol.HuRecord //本局所有胡牌记录, 按胡牌顺序
+    paoPlayer  int64                //炮手
+    isMakerSet bool                 // 当局第一次设置庄家
 
     dissolve *dissolveContext // 解散相关状态(改状态只可能只逻辑线程中更新, 不会并发)
     prepare  *prepareContext  // 准备相关状态
+    exchange *exchangeContext // 换三张相关状态
     dice     *dice            // 骰子
 
     lastTileId    int   //最后一张出牌
@@ -83,6 +91,11 @@ type Desk struct {
 }
 
 func NewDesk(roomNo room.Number, opts *protocol.DeskOptions, clubId int64) *Desk {
+    rule, ok := mahjong.RuleSetByName(opts.Rule)
+    if !ok {
+        rule, _ = mahjong.RuleSetByName(mahjong.DefaultRuleSet)
+    }
+
     d := &Desk{
         clubId:  clubId,
         state:   constant.DeskStatusCreate,
@@ -91,12 +104,17 @@ func NewDesk(roomNo room.Number, opts *protocol.DeskOptions, clubId int64) *Desk
         group:   nano.NewGroup(uuid.New()),
         die:     make(chan struct{}),
 
+        watchers:   newWatchGroup(opts),
+        spectators: map[int64]*Player{},
+
         wonPlayers:   map[int64]bool{},
+        huRecords:    []*protocol.HuRecord{},
         isNewRound:   true,
         isFirstRound: true,
         knownTiles:   map[int]int{},
         scoreChanges: map[int64][]*scoreChangeInfo{},
         opts:         opts,
+        rule:         rule,
         bankerTurn:   turnUnknown,
         roundStats:   make(history.RoundStats),
         matchStats:   make(history.MatchStats),
@@ -108,6 +126,7 @@ func NewDesk(roomNo room.Number, opts *protocol.DeskOptions, clubId int64) *Desk
     }
 
     d.dissolve = newDissolveContext(d)
+    d.exchange = newExchangeContext(d)
 
     return d
 }
@@ -119,11 +138,7 @@ func (d *Desk) totalPlayerCount() int {
 
 // 麻将数量
 func (d *Desk) totalTileCount() int {
-    if d.opts.Mode == 4 {
-        return 108
-    } else {
-        return 72
-    }
+    return d.rule.TileCount(d.totalPlayerCount())
 }
 
 func (d *Desk) save() error {
@@ -223,10 +238,15 @@ func (d *Desk) syncDeskStatus() {
             Offline:  !d.dissolve.isOnline(uid),
         })
     }
-    d.group.Broadcast("onPlayerEnter", d.latestEnter)
+    d.broadcast("onPlayerEnter", d.latestEnter)
 }
 
 func (d *Desk) checkStart() {
+    if isDraining() {
+        d.logger.Info("服务器正在停服，不能开始游戏")
+        return
+    }
+
     s := d.status()
     if (s != constant.DeskStatusCreate) && (s != constant.DeskStatusCleaned) {
         d.logger.Infof("当前房间状态不对，不能开始游戏，当前状态=%s", s.String())
@@ -266,7 +286,7 @@ func (d *Desk) roundScoreForUid(uid int64) (huScore int, fengScore int, yuScore
     for _, s := range sc {
         d.logger.Debugf("玩家流水: UID=%d, 流水信息=%s", uid, s.String())
         switch s.typ {
-        case ScoreChangeTypeHu:
+        case ScoreChangeTypeHu, ScoreChangeTypeChaJiao, ScoreChangeTypeHuaZhu:
             huScore += s.score
         case ScoreChangeTypeAnGang:
             yuScore += s.score
@@ -295,7 +315,7 @@ func (d *Desk) title() string {
 
 // 描述, 参数表示是否显示额外选项
 func (d *Desk) desc(detail bool) string {
-    desc := []string{}
+    desc := []string{d.rule.Title()}
     zimo := "自摸加番"
     opts := d.opts
     if opts.Zimo == "di" {
@@ -325,6 +345,16 @@ func (d *Desk) desc(detail bool) string {
         }
     }
 
+    if opts.Xueliu {
+        desc = append(desc, "血流成河")
+    }
+    if opts.Exchange && opts.Mode == 4 {
+        desc = append(desc, "换三张")
+    }
+    if opts.Chajiao {
+        desc = append(desc, "查大叫")
+    }
+
     return strings.Join(desc, " ")
 }
 
@@ -336,19 +366,21 @@ func (d *Desk) start() {
     var (
         totalPlayerCount = d.totalPlayerCount() // 玩家数量
         totalTileCount   = d.totalTileCount()   // 麻将数量
+        shuffler         = shuffle.NewRandom()  // 本局的洗牌器, 保存种子可以重建本局的牌墙和骰子
     )
 
     //第一局,随机庄,以后每局的庄家是上一局第一个和牌者或者点双响炮者
     if d.isFirstRound {
         d.isFirstRound = false
-        d.loseCoin()
-        d.bankerTurn = rand.Intn(totalPlayerCount)
+        d.bankerTurn = shuffler.Intn(totalPlayerCount)
 
-        //只有第一局才创建桌子
+        //只有第一局才创建桌子, 保存之后才有房间ID
         if err := d.save(); err != nil {
             d.logger.Error(err)
         }
+        d.loseCoin()
     }
+    d.checkpoint(d.round - 1)
     d.curTurn = d.bankerTurn
     // 桌面基本信息
     basic := &protocol.DeskBasicInfo{
@@ -358,23 +390,22 @@ func (d *Desk) start() {
         Mode:   d.opts.Mode,
     }
 
-    d.group.Broadcast("onDeskBasicInfo", basic)
-    allTiles := mahjong.New(totalTileCount)
-    d.logger.Debugf("麻将数量=%d, 玩家数量=%d, 所有麻将=%v", totalTileCount, totalPlayerCount, allTiles)
+    d.broadcast("onDeskBasicInfo", basic)
+    allTiles := d.rule.Tiles(totalPlayerCount, shuffler)
+    d.logger.Debugf("麻将数量=%d, 玩家数量=%d, 种子=%s, 所有麻将=%v", totalTileCount, totalPlayerCount, shuffler.Seed(), allTiles)
 
+    // 发牌使用牌墙最前面的牌, 庄家多一张牌
+    hands := d.rule.Deal(allTiles, totalPlayerCount, d.bankerTurn)
     info := make([]protocol.DuanPaiInfo, totalPlayerCount)
+    d.nextTileIndex = 0
     for i, p := range d.players {
         info[i] = protocol.DuanPaiInfo{
             Uid:    p.Uid(),
-            OnHand: make([]int, 13),
+            OnHand: hands[i],
+            Count:  len(hands[i]),
         }
-        nextIndex := (i + 1) * 13
-        copy(info[i].OnHand, allTiles[i*13:nextIndex])
-        d.nextTileIndex = nextIndex
+        d.nextTileIndex += len(hands[i])
     }
-    //庄家多一张牌
-    info[d.bankerTurn].OnHand = append(info[d.bankerTurn].OnHand, allTiles[d.nextTileIndex])
-    d.nextTileIndex++
 
     d.allTiles = make(mahjong.Mahjong, len(allTiles))
     for i, id := range allTiles {
@@ -389,17 +420,24 @@ func (d *Desk) start() {
 
     for turn, player := range d.players {
         player.duanPai(info[turn].OnHand)
+        // 机器人不需要齐牌
+        if player.isRobot() {
+            d.prepare.sorted(player.Uid())
+        }
     }
 
     // 骰子
-    d.dice.random()
+    d.dice.random(shuffler)
     duan := &protocol.DuanPai{
         MarkerID:    info[d.bankerTurn].Uid, //庄的账号ID
         Dice1:       d.dice.dice1,
         Dice2:       d.dice.dice2,
         AccountInfo: info,
     }
-    d.group.Broadcast("onDuanPai", duan)
+    // 每个玩家只能收到自己的手牌, 完整数据只保存到快照
+    d.multicastView("onDuanPai", func(viewer int64) interface{} {
+        return duanPaiView(duan, viewer)
+    })
 
     //d.bankerTurn = turnUnknown //使用完毕,清空以便下一局使用
     name4 := "/"
@@ -417,6 +455,8 @@ func (d *Desk) start() {
         d.latestEnter,
         duan,
     )
+    d.snapshot.SetSeed(shuffler.Seed())
+    d.snapshot.SetRule(d.rule.Name())
 }
 
 func (d *Desk) qiPaiFinished(uid int64) error {
@@ -436,29 +476,169 @@ func (d *Desk) qiPaiFinished(uid int64) error {
 
     d.setStatus(constant.DeskStatusQiPai)
 
+    // 四人模式可以选择先换三张再定缺
+    if d.opts.Exchange && d.totalPlayerCount() == 4 {
+        d.startExchange()
+        return nil
+    }
+
+    d.startDingQue()
+    return nil
+}
+
+// 开始定缺, 不需要定缺时直接开始游戏
+func (d *Desk) startDingQue() {
     // 三人不需要定缺
-    if d.opts.Mode == ModeTrios {
+    if !d.rule.NeedQue(d.totalPlayerCount()) {
         go d.play()
     } else {
         for _, p := range d.players {
             que := p.selectDefaultQue()
+            if p.isRobot() {
+                d.dingQue(p, que)
+                continue
+            }
             p.session.Push("onDingQueHint", protocol.DingQue{que})
         }
     }
+}
+
+// 开始换三张, 机器人和托管玩家直接使用默认选择
+func (d *Desk) startExchange() {
+    d.setStatus(constant.DeskStatusExchange)
+    d.exchange.reset()
+    d.exchange.start(exchangeTimeout)
+
+    for _, p := range d.players {
+        tiles := p.defaultExchange()
+        if p.isRobot() || p.isTrustee() {
+            d.exchange.pick(p.Uid(), tiles)
+            continue
+        }
+        if p.session == nil {
+            continue
+        }
+        p.session.Push("onExchangeHint", &protocol.ExchangeHint{
+            TileIDs: tiles,
+            Timeout: d.exchange.restTime(),
+        })
+    }
+
+    d.checkExchange()
+}
+
+// 玩家选择换出的三张牌
+func (d *Desk) exchangeTiles(p *Player, ids []int) error {
+    if d.status() != constant.DeskStatusExchange {
+        return errutil.ErrIllegalDeskStatus
+    }
+
+    uid := p.Uid()
+    if d.exchange.hasPicked(uid) {
+        p.logger.Debug("玩家已经选择了换三张")
+        return nil
+    }
+
+    if !p.canExchange(ids) {
+        return ErrIllegalExchange
+    }
+
+    d.exchange.pick(uid, ids)
+    p.logger.Infof("玩家换三张，换出=%v", ids)
+    d.broadcast("onExchangePicked", &protocol.ExchangePicked{Uid: uid})
+
+    d.checkExchange()
     return nil
 }
 
-// 定缺
-func (d *Desk) dingQue(p *Player, que int) {
-    p.ctx.Que = que
-    p.logger.Infof("玩家定缺，缺=%d", que)
+// 换三张超时, 没有选择的玩家使用默认选择
+func (d *Desk) exchangeTimeout() {
+    if d.status() != constant.DeskStatusExchange {
+        return
+    }
 
-    // 等待所有人齐牌
     for _, p := range d.players {
-        if p.ctx.Que < 1 {
+        if !d.exchange.hasPicked(p.Uid()) {
+            p.logger.Info("玩家换三张超时，使用默认选择")
+            d.exchange.pick(p.Uid(), p.defaultExchange())
+        }
+    }
+
+    d.checkExchange()
+}
+
+// 所有人都选择完毕后按照骰子决定的方向换牌
+func (d *Desk) checkExchange() {
+    for _, p := range d.players {
+        if !d.exchange.hasPicked(p.Uid()) {
             return
         }
     }
+    d.exchange.stop()
+
+    playerCount := d.totalPlayerCount()
+    direction := exchangeDirection(d.dice.dice1, d.dice.dice2)
+    d.exchange.direction = direction
+
+    // 先移除所有玩家换出的牌, 再加入换入的牌
+    received := make([]mahjong.Tiles, playerCount)
+    for turn, p := range d.players {
+        out := d.exchange.picks[p.Uid()]
+        for _, id := range out {
+            mahjong.RemoveId(&p.onHand, id)
+        }
+        received[exchangeTarget(direction, turn, playerCount)] = out
+    }
+
+    for turn, p := range d.players {
+        in := received[turn]
+        for _, id := range in {
+            p.onHand = append(p.onHand, mahjong.TileFromID(id))
+        }
+
+        // 庄家的最后一张牌可能被换出, 使用换入的最后一张牌作为新上手
+        if turn == d.bankerTurn {
+            p.ctx.NewDrawingID = in[len(in)-1]
+        }
+
+        result := &protocol.ExchangeResult{
+            Uid:       p.Uid(),
+            Direction: direction,
+            Out:       d.exchange.picks[p.Uid()],
+            In:        in,
+        }
+        d.snapshot.PushExchange(result)
+
+        p.logger.Infof("玩家换三张完成，方向=%d 换出=%v 换入=%v", direction, result.Out, result.In)
+        if p.session != nil {
+            p.session.Push("onExchange", result)
+        }
+    }
+
+    d.setStatus(constant.DeskStatusQiPai)
+    d.startDingQue()
+}
+
+// 定缺, 只能在齐牌(或者换三张完成)之后开始游戏之前定缺
+func (d *Desk) dingQue(p *Player, que int) error {
+    if d.status() != constant.DeskStatusQiPai {
+        d.logger.Debugf("当前牌桌状态: %s", d.status().String())
+        return errutil.ErrIllegalDeskStatus
+    }
+
+    // 所有人定缺后已经开始游戏, 忽略重复的定缺
+    if d.allQue() {
+        p.logger.Debug("所有玩家已经定缺")
+        return nil
+    }
+
+    p.ctx.Que = que
+    p.logger.Infof("玩家定缺，缺=%d", que)
+
+    // 等待所有人定缺
+    if !d.allQue() {
+        return nil
+    }
 
     // 通知所有客户端
     ques := make([]protocol.QueItem, d.totalPlayerCount())
@@ -466,9 +646,19 @@ func (d *Desk) dingQue(p *Player, que int) {
         ques[i] = protocol.QueItem{Uid: p.Uid(), Que: p.ctx.Que}
     }
 
-    d.group.Broadcast("onDingQue", ques)
+    d.broadcast("onDingQue", ques)
 
     go d.play()
+    return nil
+}
+
+func (d *Desk) allQue() bool {
+    for _, p := range d.players {
+        if p.ctx.Que < 1 {
+            return false
+        }
+    }
+    return true
 }
 
 func (d *Desk) nextTurn() {
@@ -499,6 +689,11 @@ func (d *Desk) isRoundOver() bool {
         return true
     }
 
+    //血流成河: 胡牌后继续游戏, 直到牌墙摸完
+    if d.opts.Xueliu {
+        return false
+    }
+
     //只剩下一个人没有和牌结算
     return len(d.wonPlayers) == d.totalPlayerCount()-1
 }
@@ -529,8 +724,8 @@ MAIN_LOOP:
             curPlayer = d.currentPlayer()
         }
 
-        // 跳过胡牌玩家
-        if d.wonPlayers[curPlayer.Uid()] {
+        // 跳过胡牌玩家, 血流成河模式下胡牌玩家继续摸牌
+        if d.wonPlayers[curPlayer.Uid()] && !d.opts.Xueliu {
             continue
         }
 
@@ -562,6 +757,7 @@ MAIN_LOOP:
         switch action {
         case protocol.OptypeHu:
             d.wonPlayers[curPlayer.Uid()] = true
+            d.keepPlaying(curPlayer)
             continue
 
         case protocol.OptypeBaGang:
@@ -626,7 +822,7 @@ MAIN_LOOP:
         }
 
         // 记录出牌
-        if typ == protocol.OptypeGang || typ == protocol.OptypePeng || typ == protocol.OptypeHu {
+        if typ == protocol.OptypeGang || typ == protocol.OptypePeng || typ == protocol.OptypeChi || typ == protocol.OptypeHu {
             curPlayer.chupai = curPlayer.chupai[:len(curPlayer.chupai)-1]
         }
 
@@ -654,8 +850,8 @@ MAIN_LOOP:
             goto GANG
         }
 
-        // 碰牌
-        if typ == protocol.OptypePeng {
+        // 碰牌, 吃牌后同样需要出牌
+        if typ == protocol.OptypePeng || typ == protocol.OptypeChi {
             goto PENG
         }
     }
@@ -680,8 +876,8 @@ func (d *Desk) allLosers(win *Player) []int64 {
     loser := []int64{}
     for _, u := range d.players {
         uid := u.Uid()
-        //跳过自己与已和玩家
-        if uid == win.Uid() || d.wonPlayers[uid] {
+        //跳过自己与已和玩家, 血流成河模式下已和玩家同样需要输分
+        if uid == win.Uid() || (d.wonPlayers[uid] && !d.opts.Xueliu) {
             continue
         }
         loser = append(loser, uid)
@@ -778,8 +974,9 @@ func (d *Desk) chiPai(tileId int) int {
 
     // 检查有没有玩家要碰、杠、胡
     checkTurn := d.curTurn
-    winOps := map[int]bool{}                                // 某个方位是否可以胡这张牌
-    pgOps := turnOp{turn: illegalTurn, op: []protocol.Op{}} // 牌桌同时只可能有一个人能碰杠
+    winOps := map[int]bool{}                                 // 某个方位是否可以胡这张牌
+    pgOps := turnOp{turn: illegalTurn, op: []protocol.Op{}}  // 牌桌同时只可能有一个人能碰杠
+    chiOps := turnOp{turn: illegalTurn, op: []protocol.Op{}} // 只有下家可以吃, 可能有多种组合
     for {
         // 从下家开始检查, 一直检查到自己
         checkTurn++
@@ -791,8 +988,8 @@ func (d *Desk) chiPai(tileId int) int {
         // 当前检查玩家
         checkPlayer := d.players[checkTurn]
 
-        //已经和牌 跳过
-        if d.wonPlayers[checkPlayer.Uid()] {
+        //已经和牌 跳过, 血流成河模式下胡牌玩家还可以继续胡
+        if d.wonPlayers[checkPlayer.Uid()] && !d.opts.Xueliu {
             continue
         }
 
@@ -815,6 +1012,10 @@ func (d *Desk) chiPai(tileId int) int {
                 pgOps.turn = checkTurn
                 pgOps.op = []protocol.Op{{Type: protocol.OptypePeng, TileIDs: []int{tileId}}}
 
+            case protocol.OptypeChi:
+                chiOps.turn = checkTurn
+                chiOps.op = append(chiOps.op, op)
+
             case protocol.OptypeHu:
                 // 当前打牌玩家的上家
                 preTurn := d.curTurn - 1
@@ -871,6 +1072,7 @@ func (d *Desk) chiPai(tileId int) int {
 
     d.logger.Debugf("可以胡牌的玩家: %+v", winOps)
     d.logger.Debugf("可以碰杠的玩家: %+v", pgOps)
+    d.logger.Debugf("可以吃的玩家: %+v", chiOps)
 
     // 是否有人胡牌，一炮多响
     paoCount := 0
@@ -938,6 +1140,7 @@ func (d *Desk) chiPai(tileId int) int {
         losers := []Loser{{uid: chuPlayer.Uid(), score: score}}
 
         d.scoreChangeForHu(player, losers, tileId, protocol.HuTypeDianPao)
+        d.keepPlaying(player)
     }
 
     //点炮
@@ -948,32 +1151,45 @@ func (d *Desk) chiPai(tileId int) int {
         return protocol.OptypeHu
     }
 
-    if pgOps.turn == illegalTurn {
-        return protocol.OptypePass
+    // 无人胡牌, 按照碰杠 > 吃的优先级依次通知玩家
+    // 如果玩家可以碰杠胡, 前面已经发送了碰杠提示, 但是未选择胡
+    // 如果碰杠的玩家同时可以吃, 并且之前没有提示过, 将吃的提示一起发送过去
+    claims := []turnOp{}
+    if pgOps.turn != illegalTurn {
+        claims = append(claims, pgOps)
     }
-
-    // 无人胡牌, 则通知可以碰杠的玩家, 如果玩家可以碰杠胡, 前面已经发送了碰杠提示, 但是未选择胡
-    player := d.players[pgOps.turn]
-    isPeng, isGang, isDissolve := player.pengOrGang(tileId, pgOps.op, winOps[pgOps.turn])
-    if isDissolve {
-        return deskDissolved
+    if chiOps.turn != illegalTurn {
+        if chiOps.turn == pgOps.turn && !winOps[pgOps.turn] {
+            claims[0].op = append(claims[0].op, chiOps.op...)
+        } else {
+            claims = append(claims, chiOps)
+        }
     }
 
-    d.logger.Debugf("玩家碰杠结果: 碰=%t 杠=%t", isPeng, isGang)
-    if !isPeng && !isGang {
-        return protocol.OptypePass
-    }
+    for i, claim := range claims {
+        player := d.players[claim.turn]
+        hasHint := i == 0 && claim.turn == pgOps.turn && winOps[claim.turn]
+        typ, isDissolve := player.claim(tileId, claim.op, hasHint)
+        if isDissolve {
+            return deskDissolved
+        }
 
-    d.curTurn = pgOps.turn
+        d.logger.Debugf("玩家吃碰杠结果: 方位=%d 操作=%d", claim.turn, typ)
+        if typ == protocol.OptypePass {
+            continue
+        }
 
-    //点杠只可能是自己手中已有3张的(引风)下雨,即另一种明杠
-    if isGang {
-        // 客户端显示杠牌流水
-        d.scoreChangeForGang(player, []int64{chuPlayer.Uid()}, tileId, true)
-        return protocol.OptypeGang
+        d.curTurn = claim.turn
+
+        //点杠只可能是自己手中已有3张的(引风)下雨,即另一种明杠
+        if typ == protocol.OptypeGang {
+            // 客户端显示杠牌流水
+            d.scoreChangeForGang(player, []int64{chuPlayer.Uid()}, tileId, true)
+        }
+        return typ
     }
 
-    return protocol.OptypePeng
+    return protocol.OptypePass
 }
 
 // 检查有没有玩家抢杠, 第二个参数表示房间是否解散
@@ -996,8 +1212,8 @@ func (d *Desk) qiangGang(tid int) (bool, bool) {
         }
         nextPlayer := d.players[nextTurn]
 
-        //已经和牌 跳过
-        if d.wonPlayers[nextPlayer.Uid()] {
+        //已经和牌 跳过, 血流成河模式下胡牌玩家还可以继续胡
+        if d.wonPlayers[nextPlayer.Uid()] && !d.opts.Xueliu {
             continue
         }
 
@@ -1030,6 +1246,7 @@ func (d *Desk) qiangGang(tid int) (bool, bool) {
         score := nextPlayer.scoring()
         losers := []Loser{{uid: chuPlayer.Uid(), score: score}}
         d.scoreChangeForHu(nextPlayer, losers, tid, protocol.HuTypeDianPao)
+        d.keepPlaying(nextPlayer)
 
         //切换当前玩家
         d.curTurn = nextPlayer.turn
@@ -1049,6 +1266,24 @@ func (d *Desk) qiangGang(tid int) (bool, bool) {
     return false, false
 }
 
+// 血流成河: 胡的牌从手牌中移出, 玩家继续游戏, 但是手牌不能再改变
+func (d *Desk) keepPlaying(p *Player) {
+    if !d.opts.Xueliu {
+        return
+    }
+
+    id := p.ctx.WinningID
+    mahjong.RemoveId(&p.onHand, id)
+    p.huTiles = append(p.huTiles, mahjong.TileFromID(id))
+
+    // 本次胡牌的状态不影响下一次胡牌
+    p.ctx.IsGangShangHua = false
+    p.ctx.IsGangShangPao = false
+    p.ctx.IsQiangGangHu = false
+
+    p.logger.Debugf("血流成河, 玩家继续游戏: 胡牌=%+v 手牌=%+v", p.huTiles, p.handTiles())
+}
+
 func (d *Desk) nobodyWin() bool {
     for _, ok := range d.wonPlayers {
         if ok {
@@ -1084,6 +1319,7 @@ func (d *Desk) roundOverTilesForPlayer(p *Player) *protocol.HandTilesInfo {
         Tiles:  sps,
         HuPai:  winTileID,
         IsTing: d.wonPlayers[uid] || p.isTing(),
+        HuPais: p.huTiles.Ids(),
     }
 
     return tiles
@@ -1117,77 +1353,23 @@ func (d *Desk) roundOverHelper() *protocol.RoundOverStats {
         HandTiles:   []*protocol.HandTilesInfo{},
         ScoreChange: []protocol.GameEndScoreChange{},
         Stats:       []*protocol.RoundStats{},
+        HuRecords:   d.huRecords,
     }
 
     if d.status() == constant.DeskStatusCleaned {
         return overStats
     }
 
-    playerCount := d.totalPlayerCount()
-
-    // 无叫玩家需要赔付给有叫玩家, 并且无叫的玩家之前所有刮风下雨积分全部清零
-    pei := map[int64]struct{}{}
-    ting := map[int64]struct{}{}
     for _, p := range d.players {
-        uid := p.Uid()
-        tiles := d.roundOverTilesForPlayer(p)
-
-        overStats.HandTiles = append(overStats.HandTiles, tiles)
-
-        // 只有一个人没有和牌，不赔叫
-        if len(d.wonPlayers) == playerCount-1 {
-            continue
-        }
-
-        if !d.wonPlayers[uid] {
-            // 没有胡牌, 并且没叫
-            if !tiles.IsTing {
-                pei[uid] = struct{}{}
-            } else {
-                ting[uid] = struct{}{}
-            }
-        }
+        overStats.HandTiles = append(overStats.HandTiles, d.roundOverTilesForPlayer(p))
     }
 
-    // 是否需要查叫: 牌桌的牌全部摸完, 并且还有人没胡牌
-    // 有人有叫有人没叫
-    if len(pei) > 0 {
-        // 要赔叫的人, 之前的所有刮风下雨清零
-        for uid := range pei {
-            if changes, ok := d.scoreChanges[uid]; ok {
-                for i := range changes {
-                    c := changes[i]
-                    // 清空正的刮风下雨积分(负分是输给别人的, 不能清空)
-                    if c.score > 0 && (c.typ == ScoreChangeTypeBaGang || c.typ == ScoreChangeTypeAnGang) {
-                        c.score = 0
-                    }
-                }
-            }
-        }
-        for _, changes := range d.scoreChanges {
-            // 清除其他玩家的输分
-            for i := range changes {
-                change := changes[i]
-                winner := change.uid
-                // 如果赢家要赔付, 则清0不赔付
-                if _, ok := pei[winner]; ok && change.score < 0 && (change.typ == ScoreChangeTypeBaGang || change.typ == ScoreChangeTypeAnGang) {
-                    change.score = 0
-                }
-            }
-        }
-
-        // 给有叫的人赔叫, 按最大的番数赔
-        // 有可能剩下两个人都没叫，不需要赔其他人，只需要清空刮风下雨都积分即可
-        for uid := range ting {
-            if p, err := d.playerWithId(uid); err == nil {
-                score, index := p.maxTingScore()
-                losers := []Loser{}
-                for loser := range pei {
-                    losers = append(losers, Loser{loser, score})
-                }
-                d.scoreChangeForHu(p, losers, index, protocol.HuTypePei)
-            }
-        }
+    // 流局结算: 开启查叫选项时, 牌墙摸完并且正常结束时查花猪、查大叫、退税, 否则按默认规则查叫
+    settleDesc := map[int64][]string{}
+    if !d.opts.Chajiao {
+        d.chaJiao()
+    } else if d.noMoreTile() && d.status() == constant.DeskStatusRoundOver {
+        settleDesc = d.settleNoMoreTile()
     }
 
     // 总结算分数
@@ -1205,6 +1387,9 @@ func (d *Desk) roundOverHelper() *protocol.RoundOverStats {
                 stats.Desc = strings.Join(p.ctx.Desc, " ")
             }
         }
+        if desc := settleDesc[uid]; len(desc) > 0 {
+            stats.Desc = strings.TrimSpace(stats.Desc + " " + strings.Join(desc, " "))
+        }
 
         sc := protocol.GameEndScoreChange{Uid: uid, Score: total, Remain: p.score}
         overStats.ScoreChange = append(overStats.ScoreChange, sc)
@@ -1244,8 +1429,9 @@ func (d *Desk) roundOver() {
     d.logger.Debugf("本轮游戏结束, 状态=%s 结算数据=%#v", status.String(), stats)
     //round over
     if status == constant.DeskStatusRoundOver && !isMaxRound {
-        d.group.Broadcast("onRoundEnd", stats)
+        d.broadcast("onRoundEnd", stats)
         d.clean()
+        d.checkpoint(d.round)
     } else {
         //最后一局以及中断统计的GameEnd与场结算一起发送
         d.finalSettlement(isMaxRound, stats)
@@ -1271,6 +1457,7 @@ func (d *Desk) clean() {
     d.allTiles = mahjong.Mahjong{}
     d.nextTileIndex = 0
     d.wonPlayers = map[int64]bool{}
+    d.huRecords = []*protocol.HuRecord{}
 
     d.lastChuPaiUid = illegalTile
     d.lastHintUid = illegalTile
@@ -1282,11 +1469,15 @@ func (d *Desk) clean() {
 
     d.dissolve.reset()
     d.prepare.reset()
+    d.exchange.reset()
 
     //重置玩家状态
     for _, p := range d.players {
         d.roundStats[p.Uid()] = &history.Record{}
         p.reset()
+        if p.isRobot() {
+            d.prepare.ready(p.Uid())
+        }
     }
 }
 
@@ -1401,7 +1592,7 @@ func (d *Desk) finalSettlement(isNormalFinished bool, ge *protocol.RoundOverStat
     }
 
     //发送单场统计
-    err := d.group.Broadcast("onGameEnd", ddr)
+    err := d.broadcast("onGameEnd", ddr)
     if err != nil {
         log.Error(err)
     }
@@ -1459,6 +1650,8 @@ func (d *Desk) destroy() {
 
     // 标记为销毁
     d.setStatus(constant.DeskStatusDestory)
+    d.removeCheckpoint()
+    d.closeWatchers()
 
     d.logger.Info("销毁房间")
     for i := range d.players {
@@ -1476,6 +1669,7 @@ func (d *Desk) destroy() {
     d.group.Close()
     d.prepare.reset()
     d.dissolve.reset()
+    d.exchange.reset()
     d.wonPlayers = nil
     d.snapshot = nil
     d.knownTiles = nil
@@ -1540,7 +1734,7 @@ func (d *Desk) scoreChangeForGang(winner *Player, loserPlayers []int64, tileID i
 
     }
 
-    d.group.Broadcast("onGangScoreChange", gsc)
+    d.broadcast("onGangScoreChange", gsc)
     d.scoreChangeHelper(winner.Uid(), losers, typ, tileID)
     d.snapshot.PushGangScoreChange(gsc)
 }
@@ -1560,7 +1754,7 @@ func (d *Desk) maxScoreCutter(point int) int {
 
 func (d *Desk) scoreChangeForHu(winner *Player, losers []Loser, tileID int, huType protocol.HuPaiType) {
     for _, l := range losers {
-        d.logger.Debugf("scoreChangeForHu 赢家=%d 输家=%d 分值=%d 类型=%d 牌=%s",
+        d.logger.Debugf("scoreChangeForHu 赢家=%d 输家=%d 分值=%d 类型=%d 牌=%d",
             winner.Uid(), l.uid, l.score, huType, mahjong.IndexFromID(tileID))
     }
 
@@ -1625,8 +1819,25 @@ func (d *Desk) scoreChangeForHu(winner *Player, losers []Loser, tileID int, huTy
     // 分值变化统计
     d.scoreChangeHelper(winUid, losers, ScoreChangeTypeHu, tileID)
 
+    // 查叫赔付不是真正的胡牌, 不记录
+    if huType != protocol.HuTypePei {
+        record := &protocol.HuRecord{
+            Uid:       winUid,
+            HuPai:     tileID,
+            HuPaiType: huType,
+            Losers:    []int64{},
+            FanNum:    winner.ctx.Fan,
+            Desc:      strings.Join(winner.ctx.Desc, " "),
+            Score:     hsc.TotalWinScore,
+        }
+        for _, l := range losers {
+            record.Losers = append(record.Losers, l.uid)
+        }
+        d.huRecords = append(d.huRecords, record)
+    }
+
     d.snapshot.PushHuScoreChange(hsc)
-    d.group.Broadcast("onHuScoreChange", hsc)
+    d.broadcast("onHuScoreChange", hsc)
 }
 
 //桌上的最后一张牌
@@ -1713,11 +1924,24 @@ func (d *Desk) applyDissolve(uid int64) {
     d.dissolve.reset()
     d.dissolve.setUidStatus(uid, true, ApplyDissolve)
 
+    // 机器人总是同意解散
+    for _, p := range d.players {
+        if p.isRobot() {
+            d.dissolve.setUidStatus(p.Uid(), true, AgreeRequest)
+        }
+    }
+
     d.group.Broadcast("onDissolveAgreement", &protocol.DissolveResponse{
         DissolveUid:    uid,
         DissolveStatus: d.collectDissolveStatus(),
         RestTime:       applyDissolveRestTime,
     })
+
+    if d.dissolve.agreeCount() >= d.totalPlayerCount() {
+        d.logger.Debug("所有玩家同意解散, 即将解散")
+        d.dissolve.stop()
+        d.doDissolve()
+    }
 }
 
 // 收集本桌玩家的解散状态
@@ -1865,10 +2089,26 @@ func (d *Desk) loseCoin() {
         ConsumeAt: time.Now().Unix(),
     }
 
+    change := &db.CoinChange{
+        Account: db.LedgerAccountUser,
+        Id:      d.creator,
+        Amount:  -int64(cardCount),
+        Reason:  db.LedgerReasonConsume,
+        Ref:     strconv.FormatInt(d.deskID, 10),
+        Key:     fmt.Sprintf("consume:%s:%d", d.roomNo, d.createdAt),
+        Records: []interface{}{consume},
+        // 创建房间时已经检查过房卡, 开局后必须扣除, 期间房卡被用掉时允许透支, 否则会免费开局
+        Overdraft: true,
+    }
+
     // 俱乐部房间
     if d.clubId > 0 {
+        change.Account = db.LedgerAccountClub
+        change.Id = d.clubId
         async.Run(func() {
-            db.ClubLoseBalance(d.clubId, int64(cardCount), consume)
+            if _, err := db.ChangeBalance(change); err != nil {
+                d.logger.Errorf("扣除俱乐部房卡错误, Error=%v Payload=%+v", err, change)
+            }
         })
     } else {
         p, err := d.playerWithId(d.creator)
@@ -1876,6 +2116,6 @@ func (d *Desk) loseCoin() {
             d.logger.Errorf("扣除玩家房卡错误，没有找到玩家，CreatorID=%d", d.creator)
             return
         }
-        p.loseCoin(int64(cardCount), consume)
+        p.loseCoin(change)
     }
 }
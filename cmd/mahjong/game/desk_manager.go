@@ -2,9 +2,9 @@ package game
 
 import (
     "fmt"
-    "strings"
     "time"
 
+    "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
     "github.com/lonng/nanoserver/db"
     "github.com/lonng/nanoserver/pkg/async"
     "github.com/lonng/nanoserver/pkg/constant"
@@ -42,9 +42,13 @@ const (
     versionExpireMessage       = "你当前的游戏版本过老，请更新客户端，地址: http://fir.im/tand"
     deskCardNotEnoughMessage   = "房卡不足"
     clubCardNotEnoughMessage   = "俱乐部房卡不足"
+    loginTokenMessage          = "登录已过期, 请重新登录"
 )
 
-var ErrModeCannotQue = errors.New("当前不为4人模式，不能定缺")
+var (
+    ErrModeCannotQue   = errors.New("当前玩法不需要定缺")
+    ErrIllegalExchange = errors.New("换三张必须是手牌中三张同花色的牌")
+)
 
 var (
     deskNotFoundResponse = &protocol.JoinDeskResponse{Code: errutil.YXDeskNotFound, Error: deskNotFoundMessage}
@@ -73,11 +77,14 @@ func NewDeskManager() *DeskManager {
 }
 
 func (manager *DeskManager) AfterInit() {
+    startCheckpointWriter()
+    manager.recoverDesks()
+
     session.Lifetime.OnClosed(func(s *session.Session) {
         // Fixed: 玩家WIFI切换到4G网络不断开, 重连时，将UID设置为illegalSessionUid
         if s.UID() > 0 {
             if err := manager.onPlayerDisconnect(s); err != nil {
-                logger.Errorf("玩家退出: UID=%d, Error=%s", s.UID, err.Error())
+                logger.Errorf("玩家退出: UID=%d, Error=%s", s.UID(), err.Error())
             }
         }
     })
@@ -128,6 +135,10 @@ func (manager *DeskManager) onPlayerDisconnect(s *session.Session) error {
     }
     p.logger.Debug("DeskManager.onPlayerDisconnect: 玩家网络断开")
 
+    if p.watching != nil {
+        p.watching.watcherLeave(p)
+    }
+
     // 移除session
     p.removeSession()
 
@@ -196,11 +207,30 @@ func (manager *DeskManager) UnCompleteDesk(s *session.Session, _ []byte) error {
 
 // 网络断开后, 重新连接网络
 func (manager *DeskManager) ReConnect(s *session.Session, req *protocol.ReConnect) error {
-    uid := req.Uid
+    // 查询数据库不能阻塞逻辑线程
+    async.Run(func() {
+        u, err := authenticate(req.Token)
+        if err != nil {
+            logger.Warnf("玩家重新连接服务器, 登录凭证验证失败: UID=%d, Error=%v", req.Uid, err)
+            s.Close()
+            return
+        }
+        name, head, sex := profile(u)
+
+        // 玩家数据只能在逻辑线程中修改
+        nano.Invoke(func() {
+            manager.reConnect(s, u.Id, name, head, sex)
+        })
+    })
+    return nil
+}
 
+// 凭证验证通过后绑定session, 替换玩家之前的session
+func (manager *DeskManager) reConnect(s *session.Session, uid int64, name, head string, sex int) {
     // 绑定UID
     if err := s.Bind(uid); err != nil {
-        return err
+        logger.Errorf("玩家重新连接服务器, 绑定UID失败: UID=%d, Error=%v", uid, err)
+        return
     }
 
     logger.Infof("玩家重新连接服务器: UID=%d", uid)
@@ -209,11 +239,7 @@ func (manager *DeskManager) ReConnect(s *session.Session, req *protocol.ReConnec
     p, ok := defaultPlayerManager.player(uid)
     if !ok {
         logger.Infof("玩家之前用户信息已被清除，重新初始化用户信息: UID=%d", uid)
-        ip := ""
-        if parts := strings.Split(s.RemoteAddr().String(), ":"); len(parts) > 0 {
-            ip = parts[0]
-        }
-        p = newPlayer(s, uid, req.Name, req.HeadUrl, ip, req.Sex)
+        p = newPlayer(s, uid, name, head, remoteIP(s), sex)
         defaultPlayerManager.setPlayer(uid, p)
     } else {
         logger.Infof("玩家之前用户信息存在服务器上，替换session: UID=%d", uid)
@@ -233,8 +259,6 @@ func (manager *DeskManager) ReConnect(s *session.Session, req *protocol.ReConnec
             d.group.Leave(prevSession)
         }
     }
-
-    return nil
 }
 
 // 网络断开后, 如果ReConnect后发现当前正在房间中, 则重新进入, 桌号是之前的桌号
@@ -363,12 +387,27 @@ func (manager *DeskManager) DingQue(s *session.Session, msg *protocol.DingQue) e
         return nil
     }
 
-    if d.opts.Mode != ModeFours {
+    if !d.rule.NeedQue(d.totalPlayerCount()) {
         return ErrModeCannotQue
     }
 
-    d.dingQue(p, que)
-    return nil
+    return d.dingQue(p, que)
+}
+
+// 换三张
+func (manager *DeskManager) Exchange(s *session.Session, msg *protocol.ExchangeRequest) error {
+    p, err := playerWithSession(s)
+    if err != nil {
+        return err
+    }
+
+    d := p.desk
+    if d == nil {
+        p.logger.Debug("玩家不在房间内")
+        return nil
+    }
+
+    return d.exchangeTiles(p, msg.TileIDs)
 }
 
 // Exit 处理玩家退出, 客户端会在房间人没有满的情况下发送DeskManager.Exit消息, 如果人满, 或游戏
@@ -443,6 +482,66 @@ func (manager *DeskManager) OpChoose(s *session.Session, msg *protocol.OpChooseR
     return nil
 }
 
+// 房主向等待中的牌桌添加机器人
+func (manager *DeskManager) AddRobot(s *session.Session, msg *protocol.AddRobotRequest) error {
+    p, err := playerWithSession(s)
+    if err != nil {
+        return err
+    }
+
+    d := p.desk
+    if d == nil || d.isDestroy() {
+        return s.Response(&protocol.AddRobotResponse{Code: errorCode, Error: deskNotFoundMessage})
+    }
+    if d.creator != s.UID() {
+        return s.Response(&protocol.AddRobotResponse{Code: errorCode, Error: "只有房主才能添加机器人"})
+    }
+    if d.status() != constant.DeskStatusCreate {
+        return s.Response(&protocol.AddRobotResponse{Code: errorCode, Error: "牌局已经开始, 不能添加机器人"})
+    }
+
+    level := msg.Level
+    if level < RobotEasy || level > RobotHard {
+        level = RobotNormal
+    }
+
+    rest := d.totalPlayerCount() - len(d.players)
+    count := msg.Count
+    if count < 1 || count > rest {
+        count = rest
+    }
+    if count < 1 {
+        return s.Response(&protocol.AddRobotResponse{Code: errorCode, Error: deskPlayerNumEnoughMessage})
+    }
+
+    for i := 0; i < count; i++ {
+        d.robotJoin(level)
+    }
+
+    if err := s.Response(&protocol.AddRobotResponse{}); err != nil {
+        return err
+    }
+
+    d.syncDeskStatus()
+    d.checkStart()
+    return nil
+}
+
+// 玩家取消托管
+func (manager *DeskManager) CancelTrustee(s *session.Session, _ []byte) error {
+    p, err := playerWithSession(s)
+    if err != nil {
+        return err
+    }
+
+    if p.desk == nil {
+        return nil
+    }
+
+    p.setTrustee(false)
+    return nil
+}
+
 func (manager *DeskManager) Ready(s *session.Session, _ []byte) error {
     p, err := playerWithSession(s)
     if err != nil {
@@ -497,6 +596,9 @@ func (manager *DeskManager) CreateDesk(s *session.Session, data *protocol.Create
     if p.desk != nil {
         return s.Response(reentryDesk)
     }
+    if isDraining() {
+        return s.Response(maintenanceCreate)
+    }
     if forceUpdate && data.Version != version {
         return s.Response(createVersionExpire)
     }
@@ -507,10 +609,9 @@ func (manager *DeskManager) CreateDesk(s *session.Session, data *protocol.Create
         return errutil.ErrIllegalParameter
     }
 
-    // 四人模式，默认可以平胡
-    if data.DeskOpts.Mode == ModeFours {
-        data.DeskOpts.Pinghu = true
-    }
+    // 规则集修正选项, 比如四人模式默认可以平胡
+    rule, _ := mahjong.RuleSetByName(data.DeskOpts.Rule)
+    rule.Normalize(data.DeskOpts)
 
     // TODO: 测试只打一轮
     //data.DeskOpts.MaxRound = 1
@@ -532,6 +633,7 @@ func (manager *DeskManager) CreateDesk(s *session.Session, data *protocol.Create
     d := NewDesk(no, data.DeskOpts, data.ClubId)
     d.createdAt = time.Now().Unix()
     d.creator = s.UID()
+    leaveWatching(s)
     //房间创建者自动join
     if err := d.playerJoin(s, false); err != nil {
         return nil
@@ -561,6 +663,9 @@ func (manager *DeskManager) Join(s *session.Session, data *protocol.JoinDeskRequ
     if forceUpdate && data.Version != version {
         return s.Response(joinVersionExpire)
     }
+    if isDraining() {
+        return s.Response(maintenanceJoin)
+    }
 
     dn := room.Number(data.DeskNo)
     d, ok := manager.desk(dn)
@@ -583,6 +688,7 @@ func (manager *DeskManager) Join(s *session.Session, data *protocol.JoinDeskRequ
         }
     }
 
+    leaveWatching(s)
     if err := d.playerJoin(s, false); err != nil {
         d.logger.Errorf("玩家加入房间失败，UID=%d, Error=%s", s.UID(), err.Error())
     }
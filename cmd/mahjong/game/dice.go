@@ -1,6 +1,6 @@
 package game
 
-import "math/rand"
+import "github.com/lonng/nanoserver/pkg/shuffle"
 
 type dice struct {
     dice1 int
@@ -11,6 +11,6 @@ func newDice() *dice {
     return &dice{}
 }
 
-func (d *dice) random() {
-    d.dice1, d.dice2 = rand.Intn(6)+1, rand.Intn(6)+1
+func (d *dice) random(s *shuffle.Shuffler) {
+    d.dice1, d.dice2 = s.Intn(6)+1, s.Intn(6)+1
 }
@@ -0,0 +1,94 @@
+package game
+
+import (
+    "time"
+
+    "github.com/lonng/nano"
+    "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
+)
+
+// 换三张方向
+const (
+    ExchangeClockwise        = 1 // 顺时针, 换给下家
+    ExchangeCounterClockwise = 2 // 逆时针, 换给上家
+    ExchangeAcross           = 3 // 换给对家
+)
+
+// 换三张状态记录
+type exchangeContext struct {
+    desk      *Desk                   // 牌桌
+    picks     map[int64]mahjong.Tiles // 玩家选择换出的牌
+    direction int                     // 换牌方向
+    deadline  time.Time               // 超时时间
+    timer     *nano.Timer             // 超时后使用默认选择
+}
+
+func newExchangeContext(desk *Desk) *exchangeContext {
+    return &exchangeContext{
+        desk:  desk,
+        picks: map[int64]mahjong.Tiles{},
+    }
+}
+
+func (e *exchangeContext) reset() {
+    e.stop()
+    e.picks = map[int64]mahjong.Tiles{}
+    e.direction = 0
+}
+
+func (e *exchangeContext) start(timeout time.Duration) {
+    e.deadline = time.Now().Add(timeout)
+    e.timer = nano.NewAfterTimer(timeout, func() {
+        e.timer = nil
+        e.desk.exchangeTimeout()
+    })
+}
+
+func (e *exchangeContext) stop() {
+    if e.timer != nil {
+        e.timer.Stop()
+        e.timer = nil
+    }
+}
+
+// 剩余时间(秒)
+func (e *exchangeContext) restTime() int {
+    rest := int(time.Until(e.deadline) / time.Second)
+    if rest < 0 {
+        rest = 0
+    }
+    return rest
+}
+
+func (e *exchangeContext) pick(uid int64, tiles mahjong.Tiles) {
+    e.picks[uid] = tiles
+}
+
+func (e *exchangeContext) hasPicked(uid int64) bool {
+    _, ok := e.picks[uid]
+    return ok
+}
+
+// 根据骰子点数决定换牌方向
+func exchangeDirection(dice1, dice2 int) int {
+    switch (dice1 + dice2) % 3 {
+    case 0:
+        return ExchangeAcross
+    case 1:
+        return ExchangeClockwise
+    default:
+        return ExchangeCounterClockwise
+    }
+}
+
+// 换牌的目标方位
+func exchangeTarget(direction, turn, playerCount int) int {
+    switch direction {
+    case ExchangeClockwise:
+        return (turn + 1) % playerCount
+    case ExchangeCounterClockwise:
+        return (turn + playerCount - 1) % playerCount
+    default:
+        return (turn + playerCount/2) % playerCount
+    }
+}
@@ -8,7 +8,9 @@ import (
     "time"
 
     "github.com/lonng/nano"
-    "github.com/lonng/nano/serialize/json"
+    "github.com/lonng/nano/component"
+    "github.com/lonng/nanoserver/pkg/secure"
+    "github.com/lonng/nanoserver/pkg/serialize"
     log "github.com/sirupsen/logrus"
     "github.com/spf13/viper"
 )
@@ -20,6 +22,8 @@ var (
     logger      = log.WithField("component", "game")
 )
 
+var serializer *serialize.Serializer // 消息序列化, 灰度期间按客户端协商的格式发送
+
 // SetCardConsume 设置房卡消耗数量
 func SetCardConsume(cfg string) {
     for _, c := range strings.Split(cfg, ",") {
@@ -61,6 +65,9 @@ func Startup() {
     csm := viper.GetString("core.consume")
     SetCardConsume(csm)
     forceUpdate = viper.GetBool("update.force")
+    setupTrustee()
+    setupDrain(viper.GetInt("core.drain"))
+    setupToken()
 
     logger.Infof("当前游戏服务器版本: %s, 是否强制更新: %t, 当前心跳时间间隔: %d秒", version, forceUpdate, heartbeat)
     logger.Info("game service starup")
@@ -70,13 +77,23 @@ func Startup() {
     nano.Register(defaultDeskManager)
     nano.Register(new(ClubManager))
 
-    // 加密管道
+    // 消息格式
+    s, err := serialize.New(viper.GetString("core.serializer"))
+    if err != nil {
+        logger.Fatalf("无效的消息格式配置: %s", viper.GetString("core.serializer"))
+    }
+    serializer = s
+    logger.Infof("当前消息格式: %s", serializer.Mode())
+
+    // 加密管道, 发送时先选择客户端协商的格式再加密
     c := newCrypto()
+    nano.Register(c.Handler(), component.WithName(secure.Name))
     pipeline := nano.NewPipeline()
-    pipeline.Inbound().PushBack(c.inbound)
-    pipeline.Outbound().PushBack(c.outbound)
+    pipeline.Inbound().PushBack(c.Inbound)
+    pipeline.Outbound().PushBack(serializer.Outbound)
+    pipeline.Outbound().PushBack(c.Outbound)
 
-    nano.SetSerializer(json.NewSerializer())
+    nano.SetSerializer(serializer)
     addr := fmt.Sprintf(":%d", viper.GetInt("game-server.port"))
     nano.Listen(addr, nano.WithPipeline(pipeline))
     //Listen listens on the TCP network address addr and then calls Serve with handler to handle requests on incoming connections
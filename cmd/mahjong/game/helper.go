@@ -4,6 +4,7 @@ import (
     "runtime"
     "strings"
 
+    "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
     "github.com/lonng/nanoserver/pkg/errutil"
     "github.com/lonng/nanoserver/protocol"
 
@@ -28,6 +29,14 @@ func verifyOptions(opts *protocol.DeskOptions) bool {
         return false
     }
 
+    if _, ok := mahjong.RuleSetByName(opts.Rule); !ok {
+        return false
+    }
+
+    if opts.WatchDelay < 0 || opts.WatchDelay > maxWatchDelay {
+        return false
+    }
+
     return true
 }
 
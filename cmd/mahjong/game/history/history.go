@@ -7,6 +7,7 @@ import (
 
 	"github.com/lonng/nanoserver/db"
 	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/shuffle"
 	"github.com/lonng/nanoserver/protocol"
 )
 
@@ -15,6 +16,11 @@ type SnapShot struct {
 	BasicInfo *protocol.DeskBasicInfo   `json:"basicInfo"`
 	DuanPai   *protocol.DuanPai         `json:"duanPai"`
 	End       *protocol.RoundOverStats  `json:"end"`
+	Seed      shuffle.Seed              `json:"seed"` // 洗牌种子, 用于重建牌墙和骰子
+	Rule      string                    `json:"rule"` // 规则集名字, 用于计算牌墙数量
+
+	// 换三张, 每个玩家换出和换入的牌
+	Exchange []*protocol.ExchangeResult `json:"exchange"`
 
 	// 如果在此遇到了gang操作就去GangScoreChanges中按序拿数据,
 	// 如果遇到了hu就去HuScoreChanges中拿数据,
@@ -59,10 +65,22 @@ func New(deskID int64, mode int, name0, name1, name2, name3 string, basic *proto
 	}
 }
 
+func (h *History) SetSeed(seed shuffle.Seed) {
+	h.Seed = seed
+}
+
+func (h *History) SetRule(rule string) {
+	h.Rule = rule
+}
+
 func (h *History) PushAction(op *protocol.OpTypeDo) {
 	h.Do = append(h.Do, op)
 }
 
+func (h *History) PushExchange(e *protocol.ExchangeResult) {
+	h.Exchange = append(h.Exchange, e)
+}
+
 func (h *History) PushGangScoreChange(g *protocol.GangPaiScoreChange) error {
 	h.GangScoreChanges = append(h.GangScoreChanges, g)
 	return nil
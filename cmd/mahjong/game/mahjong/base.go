@@ -166,8 +166,8 @@ func Multiple(ctx *Context, onHand, pongKong Indexes) int {
 }
 
 // 返回听牌最大番数
-func MaxMultiple(opts *protocol.DeskOptions, onHand, pongKong Indexes) (multiple int, index int) {
-	tings := TingTiles(onHand)
+func MaxMultiple(rule RuleSet, opts *protocol.DeskOptions, onHand, pongKong Indexes) (multiple int, index int) {
+	tings := rule.TingTiles(onHand)
 	index = IllegalIndex
 	multiple = -1
 	for _, idx := range tings {
@@ -177,7 +177,7 @@ func MaxMultiple(opts *protocol.DeskOptions, onHand, pongKong Indexes) (multiple
 
 		ctx := &Context{NewOtherDiscardID: idx, Opts: opts}
 
-		if m := Multiple(ctx, handTiles, pongKong); m > multiple {
+		if m := rule.Multiple(ctx, handTiles, pongKong); m > multiple {
 			index = idx
 			multiple = m
 		}
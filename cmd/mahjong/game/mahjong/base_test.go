@@ -9,7 +9,7 @@ func _TestBase_CanWinBySelfDrawing(t *testing.T) {
 	t.SkipNow()
 	tables := []int{4, 6, 15, 15, 7, 4, 7, 6, 17, 17, 18, 18, 16, 16}
 
-	if CanZimo(tables) != true {
+	if !CanHu(tables[:13], tables[13]) {
 		t.FailNow()
 	}
 }
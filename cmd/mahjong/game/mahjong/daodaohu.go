@@ -0,0 +1,70 @@
+package mahjong
+
+import (
+	"fmt"
+
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// 倒倒胡: 不定缺, 没有牌型番, 点炮可以平胡, 只计算杠上花、杠上炮、抢杠胡、海底和根
+type daodaohu struct {
+	xuezhan
+}
+
+func init() {
+	Register(&daodaohu{xuezhan: xuezhan{indexes: suitIndexes()}})
+}
+
+func (r *daodaohu) Name() string {
+	return "daodaohu"
+}
+
+func (r *daodaohu) Title() string {
+	return "倒倒胡"
+}
+
+func (r *daodaohu) Normalize(opts *protocol.DeskOptions) {
+	opts.Pinghu = true
+	opts.Menqing = false
+	opts.Jiangdui = false
+	opts.Jiaxin = false
+	opts.Pengpeng = false
+	opts.Yaojiu = false
+}
+
+func (r *daodaohu) NeedQue(players int) bool {
+	return false
+}
+
+func (r *daodaohu) Multiple(ctx *Context, onHand, pongKong Indexes) int {
+	if len(onHand)%3 != 2 {
+		panic("error tile count")
+	}
+
+	ctx.Desc = []string{}
+	multiple := 0
+
+	if ctx.IsLastTile {
+		multiple++
+		ctx.Desc = append(ctx.Desc, "海底")
+	}
+	if ctx.IsGangShangHua {
+		multiple++
+		ctx.Desc = append(ctx.Desc, "杠上花")
+	}
+	if ctx.IsGangShangPao {
+		multiple++
+		ctx.Desc = append(ctx.Desc, "杠上炮")
+	}
+	if ctx.IsQiangGangHu {
+		multiple++
+		ctx.Desc = append(ctx.Desc, "抢杠胡")
+	}
+
+	if count := gangCount(NewStats(onHand, pongKong)); count > 0 {
+		multiple += count
+		ctx.Desc = append(ctx.Desc, fmt.Sprintf("根x%d", count))
+	}
+
+	return multiple
+}
@@ -10,7 +10,7 @@ func NewStats(indexes ...Indexes) *Stats {
 	return ts
 }
 
-//是否是清一色
+//是否是清一色, 有字牌不是清一色
 func isQingYiSe(ms *Stats) bool {
 	var flag byte
 
@@ -19,7 +19,9 @@ func isQingYiSe(ms *Stats) bool {
 			continue
 		}
 
-		if i > 20 {
+		if i > MaxSuitIndex {
+			return false
+		} else if i > 20 {
 			flag |= 1 << 2
 		} else if i > 10 {
 			flag |= 1 << 1
@@ -83,6 +85,9 @@ func is258(ms *Stats) bool {
 		if v == 0 {
 			continue
 		}
+		if index > MaxSuitIndex {
+			return false
+		}
 
 		switch mod := index % 10; mod {
 		case 2, 5, 8:
@@ -94,12 +99,15 @@ func is258(ms *Stats) bool {
 	return true
 }
 
-// 胡牌时, 所有牌没有1和9
+// 胡牌时, 所有牌没有1和9, 字牌也不是中张
 func isZhongzhang(ms *Stats) bool {
 	for index, v := range ms {
 		if v == 0 {
 			continue
 		}
+		if index > MaxSuitIndex {
+			return false
+		}
 
 		if mod := index % 10; mod == 1 || mod == 9 {
 			return false
@@ -116,7 +124,7 @@ func isJiaxin(ctx *Context, onHand Indexes) bool {
 	}
 
 	// 5,15,25
-	if index%10 != 5 {
+	if index > MaxSuitIndex || index%10 != 5 {
 		return false
 	}
 
@@ -184,6 +192,9 @@ func isYJ(onHand, pongkong Indexes) bool {
 		if count < 3 {
 			continue
 		}
+		if index > MaxSuitIndex {
+			return false
+		}
 		if m := index % 10; m != 1 && m != 9 {
 			return false
 		}
@@ -226,6 +237,9 @@ func isYJ(onHand, pongkong Indexes) bool {
 		if count < 3 {
 			continue
 		}
+		if index > MaxSuitIndex {
+			return false
+		}
 
 		m := index % 10
 		// 有不是1/9的刻子，不可能是幺九
@@ -244,6 +258,9 @@ func isYJ(onHand, pongkong Indexes) bool {
 		if count != 2 {
 			continue
 		}
+		if index > MaxSuitIndex {
+			return false
+		}
 		m := index % 10
 		if m != 1 && m != 9 {
 			return false
@@ -271,10 +288,7 @@ func CanHu(onHand Indexes, discard int) bool {
 
 func IsTing(onHand Indexes) bool {
 	clone := make(Indexes, len(onHand)+1)
-	for i := 0; i <= MaxTileIndex; i++ {
-		if i%10 == 0 {
-			continue
-		}
+	for _, i := range playableIndexes {
 		copy(clone, onHand)
 		clone[len(onHand)] = i
 		if CheckWin(clone) {
@@ -286,18 +300,5 @@ func IsTing(onHand Indexes) bool {
 
 // 传入一副牌，返回所有的听牌
 func TingTiles(onHand Indexes) Indexes {
-	clone := make(Indexes, len(onHand)+1)
-	rts := make(Indexes, 0)
-	for i := 0; i <= MaxTileIndex; i++ {
-		if i%10 == 0 {
-			continue
-		}
-		copy(clone, onHand)
-		clone[len(onHand)] = i
-		if CheckWin(clone) {
-			rts = append(rts, i)
-		}
-	}
-
-	return rts
+	return tingTiles(playableIndexes, onHand, CheckWin)
 }
@@ -46,21 +46,21 @@ func BenchmarkIndexes_UnusedCount(b *testing.B) {
 }
 
 func TestIndexes_Unused(t *testing.T) {
-	var indexes = Indexes{2, 3, 87, 5, 2, 2, 2, 1, 74, 29, 39, 56, 23, 91}
+	var indexes = Indexes{1, 2, 2, 3, 4, 5, 7}
 	var ret, count = indexes.UnmarkedSequence()
 	if count != 3 {
 		t.Fatalf("unexpect count: %d", count)
 	}
-	if !reflect.DeepEqual(ret, [3]byte{2, 3, 87}) {
+	if !reflect.DeepEqual(ret, [3]IndexInfo{{1, 0}, {2, 1}, {3, 3}}) {
 		t.Fatalf("expece equal: %+v", ret)
 	}
 
-	indexes.Mark(1, 2)
+	indexes.Mark(0, 1, 3)
 	ret, count = indexes.UnmarkedSequence()
-	if count != 3 {
+	if count != 1 {
 		t.Fatalf("unexpect count: %d", count)
 	}
-	if !reflect.DeepEqual(ret, [3]byte{2, 5, 2}) {
+	if ret[0] != (IndexInfo{2, 2}) {
 		t.Fatalf("expece equal: %+v", ret)
 	}
 
@@ -69,7 +69,7 @@ func TestIndexes_Unused(t *testing.T) {
 	if count != 3 {
 		t.Fatalf("unexpect count: %d", count)
 	}
-	if !reflect.DeepEqual(ret, [3]byte{2, 3, 87}) {
+	if !reflect.DeepEqual(ret, [3]IndexInfo{{1, 0}, {2, 1}, {3, 3}}) {
 		t.Fatalf("expece equal: %+v", ret)
 	}
 }
@@ -5,13 +5,21 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/lonng/nanoserver/pkg/shuffle"
 )
 
 //每种花色(条,筒)最多9种牌型,但牌是没有0点的共计 9+9
 // 1-9: 条
 // 11-19: 筒
 // 21-29: 万
-const MaxTileIndex = 29
+// 31-37: 字牌(东南西北中发白)
+// 41-48: 花牌(春夏秋冬梅兰竹菊)
+const (
+	MaxSuitIndex  = 29 // 序数牌最大索引
+	MaxHonorIndex = 37 // 字牌最大索引
+	MaxTileIndex  = 48 // 所有麻将最大索引
+)
 
 type Mahjong []*Tile
 
@@ -35,12 +43,8 @@ func (m Mahjong) String() string {
 	return strings.Join(res, " ")
 }
 
-func (m Mahjong) Shuffle() {
-	s := rand.New(rand.NewSource(time.Now().Unix()))
-	for i := range m {
-		j := s.Intn(len(m))
-		m[i], m[j] = m[j], m[i]
-	}
+func (m Mahjong) Shuffle(s *shuffle.Shuffler) {
+	s.Shuffle(len(m), m.Swap)
 }
 
 func (m Mahjong) Sort() {
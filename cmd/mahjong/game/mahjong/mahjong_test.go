@@ -15,3 +15,49 @@ func TestNew(t *testing.T) {
 		}
 	}
 }
+
+func TestHonorAndFlower(t *testing.T) {
+	cases := []struct {
+		id    int
+		index int
+		name  string
+	}{
+		{id: 0, index: 1, name: "1条"},
+		{id: 107, index: 29, name: "9万"},
+		{id: 108, index: IndexEast, name: "东"},
+		{id: 127, index: IndexRed, name: "中"},
+		{id: 135, index: IndexWhite, name: "白"},
+		{id: 136, index: IndexSpring, name: "春"},
+		{id: 143, index: MaxTileIndex, name: "菊"},
+	}
+
+	for _, c := range cases {
+		tile := TileFromID(c.id)
+		if tile.Index != c.index || IndexFromID(c.id) != c.index || tile.String() != c.name {
+			t.Fatalf("id: %d, expect: %d(%s), got: %d(%s)", c.id, c.index, c.name, tile.Index, tile.String())
+		}
+		if from := TileFromIndex(c.index); from == nil || from.String() != c.name {
+			t.Fatalf("index: %d, expect: %s, got: %v", c.index, c.name, from)
+		}
+	}
+
+	for _, idx := range []int{0, 10, 30, 38, 40, 49} {
+		if TileFromIndex(idx) != nil {
+			t.Fatalf("index: %d, expect illegal", idx)
+		}
+	}
+
+	onHand := Indexes{IndexEast, IndexEast, IndexEast, IndexRed, IndexRed, 1, 2, 3, 11, 12, 13, 21, 22}
+	tings := TingTiles(onHand)
+	if len(tings) != 1 || tings[0] != 23 {
+		t.Fatalf("unexpect tings: %v", tings)
+	}
+
+	onHand = Indexes{IndexEast, IndexEast, IndexEast, IndexRed, IndexRed, 1, 2, 3, 11, 12, 13, 21, 22, 23}
+	if !CheckWin(onHand) || isQingYiSe(NewStats(onHand)) {
+		t.Fatalf("unexpect result: %v", onHand)
+	}
+	if CheckWin(Indexes{IndexEast, IndexSouth, IndexWest, IndexRed, IndexRed, 1, 2, 3, 11, 12, 13, 21, 22, 23}) {
+		t.Fatal("honors can not be sequence")
+	}
+}
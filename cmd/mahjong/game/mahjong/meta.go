@@ -3,9 +3,8 @@ package mahjong
 import (
 	"bytes"
 	"fmt"
-	"math/rand"
-	"time"
 
+	"github.com/lonng/nanoserver/pkg/shuffle"
 	"github.com/lonng/nanoserver/protocol"
 )
 
@@ -16,22 +15,19 @@ const (
 
 type Tiles []int //麻将内部表示(即72张牌的id号列表)
 
-func (m Tiles) Shuffle() {
-	s := rand.New(rand.NewSource(time.Now().Unix()))
-	for i := range m {
-		j := s.Intn(len(m))
-		m[i], m[j] = m[j], m[i]
-	}
+func (m Tiles) Shuffle(s *shuffle.Shuffler) {
+	s.Ints(m)
 }
 
-func New(count int) Tiles {
+// 创建洗好的麻将, 相同种子的洗牌器总是得到相同的结果
+func New(count int, s *shuffle.Shuffler) Tiles {
 	tiles := make(Tiles, count)
 
 	for i := range tiles {
 		tiles[i] = i
 	}
 
-	tiles.Shuffle()
+	tiles.Shuffle(s)
 	return tiles
 }
 
@@ -70,7 +66,7 @@ func (ms *Stats) FromIndex(tiles ...Indexes) {
 }
 
 func (ms *Stats) CountWithIndex(idx int) int {
-	if idx < 0 || idx%10 == 0 || idx > MaxTileIndex {
+	if !IsValidIndex(idx) {
 		return IllegalIndex
 	}
 	fmt.Println("CountWithIndex", idx, ms)
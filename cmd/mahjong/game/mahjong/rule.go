@@ -0,0 +1,108 @@
+package mahjong
+
+import (
+	"sort"
+
+	"github.com/lonng/nanoserver/pkg/shuffle"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+const DefaultRuleSet = "xuezhan" // 默认玩法: 四川血战到底
+
+// 规则集, 不同地区的玩法需要实现这个接口
+type RuleSet interface {
+	Name() string  // 规则名字, 对应DeskOptions.Rule
+	Title() string // 显示名字
+
+	// 牌桌选项修正, 创建房间时调用
+	Normalize(opts *protocol.DeskOptions)
+
+	TileCount(players int) int                     // 麻将数量
+	Tiles(players int, s *shuffle.Shuffler) Tiles  // 洗好的牌墙, 相同的种子得到相同的牌墙
+	Deal(tiles Tiles, players, banker int) []Tiles // 发牌, 庄家多一张
+	NeedQue(players int) bool                      // 是否需要定缺
+	AllowOp(op int) bool                           // 是否允许碰/杠/胡等操作
+
+	Indexes() Indexes                                    // 牌型集合, 用于计算听牌
+	CheckWin(onHand Indexes) bool                        // 是否胡牌
+	TingTiles(onHand Indexes) Indexes                    // 所有的听牌
+	Multiple(ctx *Context, onHand, pongKong Indexes) int // 番数
+}
+
+var ruleSets = map[string]RuleSet{}
+
+// 注册规则集, 只能在init中调用
+func Register(rule RuleSet) {
+	ruleSets[rule.Name()] = rule
+}
+
+// 根据名字获取规则集, 名字为空时返回默认规则集
+func RuleSetByName(name string) (RuleSet, bool) {
+	if name == "" {
+		name = DefaultRuleSet
+	}
+	rule, ok := ruleSets[name]
+	return rule, ok
+}
+
+// 所有已经注册的规则集名字
+func RuleSetNames() []string {
+	names := make([]string, 0, len(ruleSets))
+	for name := range ruleSets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// 按顺序发牌, 每人13张, 庄家多一张, 返回每个玩家的手牌
+func deal(tiles Tiles, players, banker int) []Tiles {
+	hands := make([]Tiles, players)
+	next := 0
+	for i := range hands {
+		hands[i] = make(Tiles, 13)
+		copy(hands[i], tiles[next:next+13])
+		next += 13
+	}
+	hands[banker] = append(hands[banker], tiles[next])
+	return hands
+}
+
+// 在牌型集合中依次尝试, 返回所有可以胡的牌
+func tingTiles(indexes Indexes, onHand Indexes, checkWin func(Indexes) bool) Indexes {
+	clone := make(Indexes, len(onHand)+1)
+	rts := make(Indexes, 0)
+	for _, i := range indexes {
+		copy(clone, onHand)
+		clone[len(onHand)] = i
+		if checkWin(clone) {
+			rts = append(rts, i)
+		}
+	}
+
+	return rts
+}
+
+// 可以组成胡牌的牌型集合: 序数牌和字牌, 花牌不参与胡牌
+var playableIndexes = append(suitIndexes(), honorIndexes()...)
+
+// 三种花色的牌型集合
+func suitIndexes() Indexes {
+	indexes := Indexes{}
+	for i := 0; i <= MaxSuitIndex; i++ {
+		if i%10 == 0 {
+			continue
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
+
+// 字牌的牌型集合
+func honorIndexes() Indexes {
+	indexes := Indexes{}
+	for i := IndexEast; i <= MaxHonorIndex; i++ {
+		indexes = append(indexes, i)
+	}
+	return indexes
+}
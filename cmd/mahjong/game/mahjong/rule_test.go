@@ -0,0 +1,86 @@
+package mahjong
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lonng/nanoserver/pkg/shuffle"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func TestRuleSetByName(t *testing.T) {
+	for _, name := range []string{"", DefaultRuleSet, "daodaohu", "tuidaohu"} {
+		if _, ok := RuleSetByName(name); !ok {
+			t.Fatalf("rule set not found: %s", name)
+		}
+	}
+	if _, ok := RuleSetByName("unknown"); ok {
+		t.Fatal("unexpected rule set: unknown")
+	}
+}
+
+func TestRuleSetDeal(t *testing.T) {
+	for _, name := range RuleSetNames() {
+		rule, _ := RuleSetByName(name)
+		for _, players := range []int{3, 4} {
+			tiles := rule.Tiles(players, shuffle.NewRandom())
+			if len(tiles) != rule.TileCount(players) {
+				t.Fatalf("%s: expect %d tiles, got: %d", name, rule.TileCount(players), len(tiles))
+			}
+
+			hands := rule.Deal(tiles, players, 1)
+			for i, hand := range hands {
+				expect := 13
+				if i == 1 {
+					expect = 14
+				}
+				if len(hand) != expect {
+					t.Fatalf("%s: expect %d tiles for player %d, got: %d", name, expect, i, len(hand))
+				}
+			}
+		}
+	}
+}
+
+func TestRuleSetTilesWithSeed(t *testing.T) {
+	seed := shuffle.NewSeed()
+	for _, name := range RuleSetNames() {
+		rule, _ := RuleSetByName(name)
+		a := rule.Tiles(4, shuffle.New(seed))
+		b := rule.Tiles(4, shuffle.New(seed))
+		if !reflect.DeepEqual(a, b) {
+			t.Fatalf("%s: same seed %d, different tiles: %v %v", name, seed, a, b)
+		}
+	}
+}
+
+func TestRuleSetMultiple(t *testing.T) {
+	onHand := Indexes{1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 6, 7, 7}
+	xz, _ := RuleSetByName(DefaultRuleSet)
+	ddh, _ := RuleSetByName("daodaohu")
+
+	ctx := &Context{Opts: &protocol.DeskOptions{}}
+	if m := xz.Multiple(ctx, onHand, nil); m < 1 {
+		t.Fatalf("xuezhan: expect multiple > 0, got: %d", m)
+	}
+	if m := ddh.Multiple(ctx, onHand, nil); m != 0 {
+		t.Fatalf("daodaohu: expect multiple 0, got: %d", m)
+	}
+}
+
+func TestRuleSetTuidaohu(t *testing.T) {
+	rule, _ := RuleSetByName("tuidaohu")
+	if !rule.AllowOp(protocol.OptypeChi) {
+		t.Fatal("tuidaohu: expect chi allowed")
+	}
+	if xz, _ := RuleSetByName(DefaultRuleSet); xz.AllowOp(protocol.OptypeChi) {
+		t.Fatal("xuezhan: unexpected chi allowed")
+	}
+
+	// 1万2万3万 东东东 南南南 白白白 中
+	onHand := Indexes{21, 22, 23, 31, 31, 31, 32, 32, 32, 37, 37, 37, 35}
+	tings := rule.TingTiles(onHand)
+	if len(tings) != 1 || tings[0] != 35 {
+		t.Fatalf("tuidaohu: expect ting 35, got: %v", tings)
+	}
+}
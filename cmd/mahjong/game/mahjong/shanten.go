@@ -0,0 +1,115 @@
+package mahjong
+
+// 向听数计算, 供机器人选择出牌使用
+
+type shantenSearch struct {
+	counts [MaxTileIndex + 1]int
+	need   int // 需要的面子数
+	pair   int // 是否已经选定将
+	best   int
+}
+
+// 计算向听数: 0表示已经听牌, -1表示已经胡牌, 手牌数量需要是3n+1或3n+2
+func Shanten(onHand Indexes) int {
+	s := &shantenSearch{need: len(onHand) / 3, best: 8}
+	for _, idx := range onHand {
+		s.counts[idx]++
+	}
+
+	// 七对只在门清时成立
+	if len(onHand) >= 13 {
+		pairs := 0
+		for _, c := range s.counts {
+			if c >= 2 {
+				pairs++
+			}
+		}
+		s.best = 6 - pairs
+	}
+
+	// 一般型: 先不选将, 然后依次尝试每一个对子作为将
+	s.dfs(1, 0, 0)
+	s.pair = 1
+	for i := 1; i <= MaxTileIndex; i++ {
+		if s.counts[i] < 2 {
+			continue
+		}
+		s.counts[i] -= 2
+		s.dfs(1, 0, 0)
+		s.counts[i] += 2
+	}
+
+	return s.best
+}
+
+// m: 面子数, t: 搭子数
+func (s *shantenSearch) dfs(i, m, t int) {
+	c := &s.counts
+	for i <= MaxTileIndex && c[i] == 0 {
+		i++
+	}
+
+	if i > MaxTileIndex {
+		if m+t > s.need {
+			t = s.need - m
+		}
+		if v := 2*(s.need-m) - t - s.pair; v < s.best {
+			s.best = v
+		}
+		return
+	}
+
+	// 刻子
+	if c[i] >= 3 {
+		c[i] -= 3
+		s.dfs(i, m+1, t)
+		c[i] += 3
+	}
+
+	// 字牌和花牌不能组成顺子和搭子
+	chain := i <= MaxSuitIndex
+
+	// 顺子
+	if chain && i%10 <= 7 && c[i+1] > 0 && c[i+2] > 0 {
+		c[i]--
+		c[i+1]--
+		c[i+2]--
+		s.dfs(i, m+1, t)
+		c[i]++
+		c[i+1]++
+		c[i+2]++
+	}
+
+	// 面子和搭子已经足够时, 再拆搭子没有意义
+	if m+t < s.need {
+		// 对子
+		if c[i] >= 2 {
+			c[i] -= 2
+			s.dfs(i, m, t+1)
+			c[i] += 2
+		}
+
+		// 两面、边张
+		if chain && i%10 <= 8 && c[i+1] > 0 {
+			c[i]--
+			c[i+1]--
+			s.dfs(i, m, t+1)
+			c[i]++
+			c[i+1]++
+		}
+
+		// 嵌张
+		if chain && i%10 <= 7 && c[i+2] > 0 {
+			c[i]--
+			c[i+2]--
+			s.dfs(i, m, t+1)
+			c[i]++
+			c[i+2]++
+		}
+	}
+
+	// 孤张
+	c[i]--
+	s.dfs(i, m, t)
+	c[i]++
+}
@@ -0,0 +1,28 @@
+package mahjong
+
+import (
+	"testing"
+)
+
+func TestShanten(t *testing.T) {
+	cases := []struct {
+		indexes Indexes
+		result  int
+	}{
+		{indexes: Indexes{1, 1, 1, 2, 3, 4, 5, 6, 7, 8, 9, 9, 9, 9}, result: -1},
+		{indexes: Indexes{1, 1, 2, 2, 3, 3, 3, 3, 4, 4, 5, 5, 7, 7}, result: -1},
+		{indexes: Indexes{1, 1, 1, 2, 3, 4, 5, 6, 7, 8, 9, 9, 9}, result: 0},
+		{indexes: Indexes{1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 7, 7, 29}, result: 0},
+		{indexes: Indexes{1, 2, 3, 4, 5, 6, 11, 12, 13, 21, 23, 25, 29}, result: 1},
+		{indexes: Indexes{1, 4, 7, 11, 14, 17, 21, 24, 27, 9, 19, 29, 5}, result: 4},
+		{indexes: Indexes{1, 2, 3, 11, 11, 11, 21, 22}, result: 0},
+		{indexes: Indexes{1, 2, 3, 11, 11, 11, 21, 22, 23, 5, 5}, result: -1},
+		{indexes: Indexes{31, 31, 31, 35, 37, 1, 2, 3, 11, 12, 13, 21, 22}, result: 1},
+	}
+
+	for _, c := range cases {
+		if r := Shanten(c.indexes); r != c.result {
+			t.Fatalf("expect: %v, got: %v, indexes: %v", c.result, r, c.indexes)
+		}
+	}
+}
@@ -4,25 +4,92 @@ import (
 	"fmt"
 )
 
-var tileNames = []string{"条", "筒", "万"}
+// 花色
+const (
+	SuitTiao   = 0 // 条
+	SuitTong   = 1 // 筒
+	SuitWan    = 2 // 万
+	SuitHonor  = 3 // 字牌
+	SuitFlower = 4 // 花牌
+)
+
+// 麻将ID: 序数牌和字牌每种4张, 花牌每种1张, 已有的ID保持不变
+const (
+	SuitTileCount   = 108                            // 条筒万
+	HonorTileCount  = 28                             // 东南西北中发白
+	FlowerTileCount = 8                              // 春夏秋冬梅兰竹菊
+	honorIDBase     = SuitTileCount                  // 第一张字牌的ID
+	flowerIDBase    = SuitTileCount + HonorTileCount // 第一张花牌的ID
+)
+
+// 字牌和花牌的索引
+const (
+	IndexEast   = 31 // 东
+	IndexSouth  = 32 // 南
+	IndexWest   = 33 // 西
+	IndexNorth  = 34 // 北
+	IndexRed    = 35 // 红中
+	IndexGreen  = 36 // 发财
+	IndexWhite  = 37 // 白板
+	IndexSpring = 41 // 春, 依次为夏秋冬梅兰竹菊
+)
+
+var (
+	tileNames   = []string{"条", "筒", "万"}
+	honorNames  = []string{"东", "南", "西", "北", "中", "发", "白"}
+	flowerNames = []string{"春", "夏", "秋", "冬", "梅", "兰", "竹", "菊"}
+)
 
 type Tile struct {
 	Id    int
 	Suit  int //花色
-	Rank  int //点数
-	Index int //索引(1~9, 11~19)
+	Rank  int //点数, 字牌和花牌为序号(从1开始)
+	Index int //索引(1~9, 11~19, 21~29, 31~37, 41~48)
 }
 
 func (t *Tile) String() string {
+	switch t.Suit {
+	case SuitHonor:
+		return honorNames[t.Rank-1]
+	case SuitFlower:
+		return flowerNames[t.Rank-1]
+	}
 	return fmt.Sprintf("%d%s", t.Rank, tileNames[t.Suit])
 }
 
+// 是否是字牌
+func (t *Tile) IsHonor() bool {
+	return t.Suit == SuitHonor
+}
+
+// 是否是花牌
+func (t *Tile) IsFlower() bool {
+	return t.Suit == SuitFlower
+}
+
+// 索引是否合法
+func IsValidIndex(idx int) bool {
+	switch {
+	case idx <= 0 || idx%10 == 0:
+		return false
+	case idx <= MaxHonorIndex:
+		return idx <= MaxSuitIndex || idx > 30
+	default:
+		return idx > 40 && idx <= MaxTileIndex
+	}
+}
+
+// 是否是序数牌的索引
+func IsSuitIndex(idx int) bool {
+	return idx > 0 && idx <= MaxSuitIndex && idx%10 != 0
+}
+
 func (t *Tile) Equals(other *Tile) bool {
 	return t.Index == other.Index
 }
 
 func TileFromIndex(idx int) *Tile {
-	if idx < 0 || idx > MaxTileIndex || idx%10 == 0 {
+	if !IsValidIndex(idx) {
 		return nil
 	}
 
@@ -34,9 +101,15 @@ func TileFromIndex(idx int) *Tile {
 }
 
 func IndexFromID(id int) int {
-	if id < 0 {
+	if id < 0 || id >= flowerIDBase+FlowerTileCount {
 		panic(fmt.Errorf("ilegal tile id: %d", id))
 	}
+	if id >= flowerIDBase {
+		return IndexSpring + id - flowerIDBase
+	}
+	if id >= honorIDBase {
+		return IndexEast + (id-honorIDBase)/4
+	}
 	var (
 		tmp = id / 4
 		h   = tmp / 9
@@ -48,11 +121,15 @@ func IndexFromID(id int) int {
 }
 
 //id: 0~3 -> 1条  4~7 -> 2条 ...
-//0~35 =>条 36~71 =>筒
+//0~35 =>条 36~71 =>筒 72~107 =>万 108~135 =>字牌 136~143 =>花牌
 func TileFromID(id int) *Tile {
-	if id < 0 {
+	if id < 0 || id >= flowerIDBase+FlowerTileCount {
 		panic("illegal tile id")
 	}
+	if id >= honorIDBase {
+		index := IndexFromID(id)
+		return &Tile{Suit: index / 10, Rank: index % 10, Index: index, Id: id}
+	}
 
 	var (
 		tmp = id / 4
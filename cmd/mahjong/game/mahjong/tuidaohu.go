@@ -0,0 +1,39 @@
+package mahjong
+
+import (
+	"github.com/lonng/nanoserver/pkg/shuffle"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// 推倒胡: 136张(条筒万和字牌), 可以吃碰杠, 不定缺, 番数计算同倒倒胡
+type tuidaohu struct {
+	daodaohu
+}
+
+func init() {
+	Register(&tuidaohu{daodaohu{xuezhan{indexes: playableIndexes}}})
+}
+
+func (r *tuidaohu) Name() string {
+	return "tuidaohu"
+}
+
+func (r *tuidaohu) Title() string {
+	return "推倒胡"
+}
+
+func (r *tuidaohu) TileCount(players int) int {
+	return SuitTileCount + HonorTileCount
+}
+
+func (r *tuidaohu) Tiles(players int, s *shuffle.Shuffler) Tiles {
+	return New(r.TileCount(players), s)
+}
+
+func (r *tuidaohu) AllowOp(op int) bool {
+	switch op {
+	case protocol.OptypeChi, protocol.OptypePeng, protocol.OptypeGang, protocol.OptypeHu:
+		return true
+	}
+	return false
+}
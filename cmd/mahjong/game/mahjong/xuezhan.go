@@ -0,0 +1,74 @@
+package mahjong
+
+import (
+	"github.com/lonng/nanoserver/pkg/shuffle"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// 四川血战到底: 四人108张(条筒万)需要定缺, 三人72张(条筒)不定缺
+type xuezhan struct {
+	indexes Indexes
+}
+
+func init() {
+	Register(&xuezhan{indexes: suitIndexes()})
+}
+
+func (r *xuezhan) Name() string {
+	return DefaultRuleSet
+}
+
+func (r *xuezhan) Title() string {
+	return "血战到底"
+}
+
+func (r *xuezhan) Normalize(opts *protocol.DeskOptions) {
+	// 四人模式，默认可以平胡
+	if opts.Mode == 4 {
+		opts.Pinghu = true
+	}
+}
+
+func (r *xuezhan) TileCount(players int) int {
+	if players == 4 {
+		return 108
+	}
+	return 72
+}
+
+func (r *xuezhan) Tiles(players int, s *shuffle.Shuffler) Tiles {
+	return New(r.TileCount(players), s)
+}
+
+func (r *xuezhan) Deal(tiles Tiles, players, banker int) []Tiles {
+	return deal(tiles, players, banker)
+}
+
+// 三人不需要定缺
+func (r *xuezhan) NeedQue(players int) bool {
+	return players == 4
+}
+
+func (r *xuezhan) AllowOp(op int) bool {
+	switch op {
+	case protocol.OptypePeng, protocol.OptypeGang, protocol.OptypeHu:
+		return true
+	}
+	return false
+}
+
+func (r *xuezhan) Indexes() Indexes {
+	return r.indexes
+}
+
+func (r *xuezhan) CheckWin(onHand Indexes) bool {
+	return CheckWin(onHand)
+}
+
+func (r *xuezhan) TingTiles(onHand Indexes) Indexes {
+	return tingTiles(r.indexes, onHand, CheckWin)
+}
+
+func (r *xuezhan) Multiple(ctx *Context, onHand, pongKong Indexes) int {
+	return Multiple(ctx, onHand, pongKong)
+}
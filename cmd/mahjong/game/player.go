@@ -2,11 +2,13 @@ package game
 
 import (
     "fmt"
+    "sync/atomic"
 
+    "github.com/lonng/nano"
     "github.com/lonng/nano/session"
     "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
     "github.com/lonng/nanoserver/db"
-    "github.com/lonng/nanoserver/db/model"
+    "github.com/lonng/nanoserver/pkg/constant"
     "github.com/lonng/nanoserver/pkg/async"
     "github.com/lonng/nanoserver/protocol"
     log "github.com/sirupsen/logrus"
@@ -31,15 +33,24 @@ type Player struct {
     // 游戏相关字段
     onHand   mahjong.Mahjong
     pongKong mahjong.Mahjong
+    chow     mahjong.Mahjong // 吃的牌, 同时记录在pongKong中
+    huTiles  mahjong.Mahjong // 血流成河模式下胡过的牌
     chupai   mahjong.Mahjong
     ctx      *mahjong.Context
 
     chOperation chan *protocol.OpChoosed
 
+    robot *robot // 机器人, 真实玩家为nil
+
+    trustee      int32 // 是否托管, 原子操作
+    timeoutCount int32 // 连续超时次数
+
     desk  *Desk //当前桌
     turn  int   //当前玩家在桌上的方位
     score int   //经过n局后,当前玩家余下的分值数,默认为1000
 
+    watching *Desk // 正在观战的房间
+
     logger *log.Entry // 日志
 }
 
@@ -82,34 +93,22 @@ func (p *Player) syncCoinFromDB() {
     })
 }
 
-// 异步扣除玩家金币
-func (p *Player) loseCoin(count int64, consume *model.CardConsume) {
+// 异步扣除玩家金币, 消费记录和扣除金币在同一个事务中写入
+func (p *Player) loseCoin(change *db.CoinChange) {
     async.Run(func() {
-        u, err := db.QueryUser(p.uid)
+        l, err := db.ChangeBalance(change)
         if err != nil {
-            p.logger.Errorf("扣除金币，查询玩家错误, Error=%v", err)
+            p.logger.Errorf("扣除金币错误, Error=%v Payload=%+v", err, change)
             return
         }
 
-        // 即使数据库不成功，玩家金币数量依然扣除
-        p.coin -= count
-        u.Coin = p.coin
-        if err := db.UpdateUser(u); err != nil {
-            p.logger.Errorf("扣除金币，更新金币数量错误, Error=%v", err)
-            return
-        }
-
-        if u.Coin != p.coin {
-            p.logger.Errorf("玩家扣除金币，同步到数据库后，发现金币数量不一致，玩家数量=%d，数据库数量=%d", p.coin, u.Coin)
-        }
-
-        if err := db.Insert(consume); err != nil {
-            p.logger.Errorf("新增消费数据错误，Error=%v Payload=%+v", err, consume)
-        }
-
-        if s := p.session; s != nil {
-            s.Push("onCoinChange", &protocol.CoinChangeInformation{p.coin})
-        }
+        // 玩家数据只能在逻辑线程中修改
+        nano.Invoke(func() {
+            p.coin = l.Balance
+            if s := p.session; s != nil {
+                s.Push("onCoinChange", &protocol.CoinChangeInformation{p.coin})
+            }
+        })
     })
 }
 
@@ -123,6 +122,10 @@ func (p *Player) setDesk(d *Desk, turn int) {
     p.desk = d
     p.turn = turn
 
+    // 新的牌桌不继承之前的托管状态
+    atomic.StoreInt32(&p.trustee, 0)
+    atomic.StoreInt32(&p.timeoutCount, 0)
+
     p.logger = log.WithFields(log.Fields{fieldDesk: p.desk.roomNo, fieldPlayer: p.uid})
 
     //全、半频道
@@ -158,30 +161,35 @@ func (p *Player) duanPai(ids mahjong.Tiles) {
 }
 
 func (p *Player) chuPai() int {
+    // 血流成河模式下已经胡牌的玩家手牌不能改变, 摸什么打什么
+    if p.desk.wonPlayers[p.Uid()] {
+        return p.discard(p.ctx.NewDrawingID)
+    }
+
     var tid int
 
 ctrl:
     p.hint([]protocol.Op{{Type: protocol.OptypeChu}}, p.tingTiles())
-    select {
-    case op, ok := <-p.chOperation:
-        if !ok {
-            return deskDissolved
-        }
-
-        if op.Type != protocol.OptypeChu {
-            p.logger.Errorf("玩家操作异常，期待操作出牌，获取操作=%+v", op)
-            goto ctrl
-        }
+    op, dissolved := p.waitOperation(chuPaiTimeout, autoChuPai(p))
+    if dissolved {
+        return deskDissolved
+    }
 
-        tid = op.TileID
-        if tid < 0 {
-            p.logger.Debugf("玩家读取到一个非法的麻将ID: ID=%+v", op)
-        }
+    if op.Type != protocol.OptypeChu {
+        p.logger.Errorf("玩家操作异常，期待操作出牌，获取操作=%+v", op)
+        goto ctrl
+    }
 
-    case <-p.desk.die:
-        return deskDissolved
+    tid = op.TileID
+    if tid < 0 {
+        p.logger.Debugf("玩家读取到一个非法的麻将ID: ID=%+v", op)
     }
 
+    return p.discard(tid)
+}
+
+// 从手牌中打出一张牌
+func (p *Player) discard(tid int) int {
     // 删掉已经出过的牌
     for j, mj := range p.onHand {
         if mj.Id == tid {
@@ -213,32 +221,22 @@ func (p *Player) hu(tileID int, hasHint bool) int {
 			{Type: protocol.OptypePass},
 		})
 	}
-	select {
-	case op, ok := <-p.chOperation:
-		if !ok {
-			return deskDissolved
-		}
-
-		p.ctx.SetPrevOp(op.Type)
-		return op.Type
-
-	case <-p.desk.die:
+	op, dissolved := p.waitOperation(huTimeout, autoHu(tileID))
+	if dissolved {
 		return deskDissolved
 	}
 
-	p.logger.Debugf("玩家胡牌: 麻将=%d", tileID)
-	return protocol.OptypeHu
+	p.ctx.SetPrevOp(op.Type)
+	return op.Type
 }
 
-// 让玩家选择碰杠
+// 让玩家选择吃碰杠
 // @param: hasHint 之前是否已经发送了碰杠牌的提示, 这种情况出现在玩家同时可以碰杠胡的情况
-func (p *Player) pengOrGang(tileID int, ops []protocol.Op, hasHint bool) (isPeng, isGang, isDissolve bool) {
-	isPeng = false
-	isGang = false
-	isDissolve = false
-
+// 返回玩家选择的操作(吃/碰/杠/过), 第二个返回值表示房间是否解散
+func (p *Player) claim(tileID int, ops []protocol.Op, hasHint bool) (int, bool) {
 	var (
 		opType = p.ctx.PrevOp
+		choice = tileID // 吃牌时为选择的顺子的第一张牌
 		mjs    mahjong.Tiles
 	)
 
@@ -247,43 +245,62 @@ func (p *Player) pengOrGang(tileID int, ops []protocol.Op, hasHint bool) (isPeng
 		hints := []protocol.Op{{Type: protocol.OptypePass}}
 		for _, op := range ops {
 			opInfo := protocol.Op{Type: op.Type, TileIDs: []int{tileID}}
+			// 吃牌可能有多种组合, 下发整个顺子
+			if op.Type == protocol.OptypeChi {
+				opInfo.TileIDs = op.TileIDs
+			}
 			hints = append(hints, opInfo)
 		}
-		//碰、杠、过
+		//吃、碰、杠、过
 		p.hint(hints)
 
-		select {
-		case op, ok := <-p.chOperation:
-			if !ok {
-				isDissolve = true
-				return
-			}
+		op, dissolved := p.waitOperation(pengGangTimeout, autoPass(tileID))
+		if dissolved {
+			return protocol.OptypePass, true
+		}
 
-			tileID = op.TileID
-			opType = op.Type
+		choice = op.TileID
+		opType = op.Type
+	}
 
-		case <-p.desk.die:
-			isDissolve = true
-			return
-		}
+	// 只接受提示过的操作, 否则视为过
+	if opType != protocol.OptypePass && !offered(ops, opType, choice) {
+		p.logger.Warnf("玩家选择了没有提示的操作, 视为过: 操作=%d 麻将=%d 选择=%d", opType, tileID, choice)
+		return protocol.OptypePass, false
 	}
 
 	switch opType {
 	case protocol.OptypeGang:
 		mjs = p.brotherTiles(tileID, 4)
 		p.gang(tileID)
-		isGang = true
 	case protocol.OptypePeng:
 		mjs = p.brotherTiles(tileID, 3)
 		p.peng(tileID)
-		isPeng = true
-	case protocol.OptypePass:
+	case protocol.OptypeChi:
+		if mjs = p.chi(tileID, choice); len(mjs) == 0 {
+			p.logger.Warnf("玩家不能吃牌, 麻将: %d 选择: %d", tileID, choice)
+			return protocol.OptypePass, false
+		}
+	default:
 		p.logger.Debugf("玩家选择过, 麻将: %d", tileID)
-		return
+		return protocol.OptypePass, false
 	}
 
 	p.action(opType, mjs)
-	return isPeng, isGang, isDissolve
+	return opType, false
+}
+
+// 操作是否在提示中, 吃牌时还需要是提示过的顺子
+func offered(ops []protocol.Op, opType, choice int) bool {
+	for _, op := range ops {
+		if op.Type != opType {
+			continue
+		}
+		if opType != protocol.OptypeChi || (len(op.TileIDs) > 0 && op.TileIDs[0] == choice) {
+			return true
+		}
+	}
+	return false
 }
 
 func (p *Player) moPai() {
@@ -305,10 +322,10 @@ func (p *Player) moPai() {
 	// 保存快照
 	p.desk.snapshot.PushAction(record)
 
-	// 这里如果返回错误, 可能是有玩家的socket关掉了, 玩家掉线, 可能需要把玩家标记为托管
-	if err := p.desk.group.Broadcast("onMoPai", mo); err != nil {
-		log.Error(err)
-	}
+	// 其他玩家只能看到摸牌动作, 看不到摸到的牌
+	p.desk.multicastView("onMoPai", func(viewer int64) interface{} {
+		return moPaiView(mo, viewer)
+	})
 
 	// TODO: 确认海底捞是否是最后一个摸牌的, 其他人摸最后一张牌, 点炮是否算海底捞
 	p.ctx.IsLastTile = p.desk.noMoreTile()
@@ -327,7 +344,7 @@ func (p *Player) chuTiles() mahjong.Mahjong {
 
 // 检查是否有叫
 func (p *Player) isTing() bool {
-	return mahjong.IsTing(p.handTiles().Indexes())
+	return len(p.desk.rule.TingTiles(p.handTiles().Indexes())) > 0
 }
 
 func (p *Player) tileIDWithIndex(index int) int {
@@ -371,7 +388,7 @@ func (p *Player) canWin() bool {
 		}
 	}
 
-	canWin := mahjong.CheckWin(p.handTiles().Indexes())
+	canWin := p.desk.rule.CheckWin(p.handTiles().Indexes())
 
 	p.logger.Infof("玩家计算是否可以胡牌: 手牌=%+v, 新上手=%v, 是否可以胡=%t",
 		p.handTiles(), newTile, canWin)
@@ -407,8 +424,17 @@ func (p *Player) allGang() []protocol.Op {
 		ops = append(ops, op)
 	}
 
+	chow := map[int]bool{}
+	for _, t := range p.chow {
+		chow[t.Id] = true
+	}
+
 	pgTileGroup := map[int][]*mahjong.Tile{}
 	for _, pg := range pgTiles {
+		// 吃的牌不能巴杠
+		if chow[pg.Id] {
+			continue
+		}
 		pgTileGroup[pg.Index] = append(pgTileGroup[pg.Index], pg)
 	}
 
@@ -472,7 +498,7 @@ func (p *Player) tingTiles() protocol.Tings {
 	for index := range distinct {
 		rest := exclude(index)
 		//log.Debugf("去除：%v，剩余：%+v", index, rest)
-		if ting := mahjong.TingTiles(rest); len(ting) > 0 {
+		if ting := p.desk.rule.TingTiles(rest); len(ting) > 0 {
 			tings = append(tings, protocol.Ting{Index: index, Hu: ting})
 		}
 	}
@@ -536,13 +562,14 @@ func (p *Player) doCheckHandTiles(isNewRound bool) (int, int) {
 		p.onHand = append(p.onHand, mahjong.TileFromID(p.ctx.NewDrawingID))
 	}
 
-	canWin = p.canWin()
+	canWin = p.desk.rule.AllowOp(protocol.OptypeHu) && p.canWin()
 
 	//机器人如果能和能杠,则直接和,而玩家则给他两个选择
 	ops := []protocol.Op{}
 
 	//最后一张牌,不可杠
-	if !p.desk.noMoreTile() {
+	// 血流成河模式下已经胡牌的玩家手牌不能改变, 不能再杠
+	if !p.desk.noMoreTile() && p.desk.rule.AllowOp(protocol.OptypeGang) && !p.desk.wonPlayers[p.Uid()] {
 		// 检查暗杠和刮风
 		ops = p.allGang()
 	}
@@ -568,50 +595,49 @@ func (p *Player) doCheckHandTiles(isNewRound bool) (int, int) {
 
 	p.hint(ops)
 
-	select {
-	case op, ok := <-p.chOperation:
-		if !ok {
-			return protocol.OptypePass, deskDissolved
-		}
+	// 超时能胡则胡, 否则过; 可以胡牌时使用胡牌选择的超时时间
+	auto, timeout := autoPass(p.ctx.NewDrawingID), chuPaiTimeout
+	if canWin {
+		auto, timeout = autoHu(p.ctx.NewDrawingID), huTimeout
+	}
 
-		var mjs mahjong.Tiles
-		switch op.Type {
-		case protocol.OptypePass:
-			return op.Type, p.ctx.NewDrawingID
+	op, dissolved := p.waitOperation(timeout, auto)
+	if dissolved {
+		return protocol.OptypePass, deskDissolved
+	}
 
-		case protocol.OptypeGang:
+	var mjs mahjong.Tiles
+	switch op.Type {
+	case protocol.OptypePass:
+		return op.Type, p.ctx.NewDrawingID
 
-			//刮风的牌,是onHand里只可能有一张,而其他3张在"pongKong"里
-			mjs = p.allTileIDWithIndex(mahjong.TileFromID(op.TileID).Index)
-			//巴杠,抢杠
-			if len(mjs) == 1 {
-				// fixed: 巴杠也需要通知客户端
-				p.action(op.Type, mjs)
-				return protocol.OptypeBaGang, op.TileID //可能杠的并不是最后摸的那一张牌，即n把后才杠
-			}
+	case protocol.OptypeGang:
 
-		case protocol.OptypeHu:
-			mjs = []int{op.TileID}
+		//刮风的牌,是onHand里只可能有一张,而其他3张在"pongKong"里
+		mjs = p.allTileIDWithIndex(mahjong.TileFromID(op.TileID).Index)
+		//巴杠,抢杠
+		if len(mjs) == 1 {
+			// fixed: 巴杠也需要通知客户端
+			p.action(op.Type, mjs)
+			return protocol.OptypeBaGang, op.TileID //可能杠的并不是最后摸的那一张牌，即n把后才杠
 		}
 
-		return fn(p, op, mjs)
-
-	case <-p.desk.die:
-		return protocol.OptypePass, deskDissolved
+	case protocol.OptypeHu:
+		mjs = []int{op.TileID}
 	}
 
-	return protocol.OptypePass, p.ctx.NewDrawingID
+	return fn(p, op, mjs)
 }
 
 // 计算番数
 func (p *Player) scoring() int {
-	m := mahjong.Multiple(p.ctx, p.handTiles().Indexes(), p.pgTiles().Indexes())
+	m := p.desk.rule.Multiple(p.ctx, p.handTiles().Indexes(), p.pgTiles().Indexes())
 	p.ctx.Fan = m
 	return 1 << uint(m)
 }
 
 func (p *Player) maxTingScore() (int, int) {
-	m, idx := mahjong.MaxMultiple(p.desk.opts, p.handTiles().Indexes(), p.pgTiles().Indexes())
+	m, idx := mahjong.MaxMultiple(p.desk.rule, p.desk.opts, p.handTiles().Indexes(), p.pgTiles().Indexes())
 	p.ctx.Fan = m
 	return 1 << uint(m), idx
 }
@@ -627,11 +653,18 @@ func (p *Player) checkChi(tid int, chuPlayer *Player) []protocol.Op {
 		return ret
 	}
 
+	rule := p.desk.rule
+
 	// 检查胡牌
-	if p.checkHu(tid, chuPlayer.ctx.PrevOp == protocol.OptypeGang) {
+	if rule.AllowOp(protocol.OptypeHu) && p.checkHu(tid, chuPlayer.ctx.PrevOp == protocol.OptypeGang) {
 		ret = append(ret, protocol.Op{Type: protocol.OptypeHu, TileIDs: []int{tile.Id}})
 	}
 
+	// 血流成河模式下已经胡牌的玩家只能胡牌
+	if p.desk.wonPlayers[p.Uid()] {
+		return ret
+	}
+
 	sameTiles := mahjong.Mahjong{}
 	tiles := p.handTiles()
 	for _, sp := range tiles {
@@ -645,17 +678,54 @@ func (p *Player) checkChi(tid int, chuPlayer *Player) []protocol.Op {
 	// 明牌玩家直接检查扣牌是否可以杠
 
 	//检查碰、杠
-	if len(sameTiles) == 3 && !p.desk.noMoreTile() {
+	if len(sameTiles) == 3 && !p.desk.noMoreTile() && rule.AllowOp(protocol.OptypeGang) {
 		ret = append(ret, protocol.Op{Type: protocol.OptypeGang, TileIDs: mahjong.Tiles{sameTiles[0].Id}})
 	}
-	if len(sameTiles) == 2 {
+	if len(sameTiles) == 2 && rule.AllowOp(protocol.OptypePeng) {
 		ret = append(ret, protocol.Op{Type: protocol.OptypePeng, TileIDs: mahjong.Tiles{sameTiles[0].Id}})
 	}
 
+	// 只有出牌玩家的下家可以吃
+	if rule.AllowOp(protocol.OptypeChi) && p.turn == (chuPlayer.turn+1)%p.desk.totalPlayerCount() {
+		ret = append(ret, p.chowOps(tid)...)
+	}
+
 	p.logger.Debugf("计算杠牌完毕, 所有可用操作: %+v", ret)
 	return ret
 }
 
+// 所有可以吃的组合, 每个组合包含被吃的牌, 按照麻将从小到大排列
+func (p *Player) chowOps(tid int) []protocol.Op {
+	tile := mahjong.TileFromID(tid)
+	ops := []protocol.Op{}
+
+	// 字牌和缺的牌不能吃
+	if !mahjong.IsSuitIndex(tile.Index) || tile.Suit+1 == p.ctx.Que {
+		return ops
+	}
+
+	for start := tile.Index - 2; start <= tile.Index; start++ {
+		// 顺子必须是同一花色
+		if start%10 < 1 || start%10 > 7 || start/10 != tile.Index/10 {
+			continue
+		}
+
+		ids := []int{}
+		for index := start; index < start+3; index++ {
+			if index == tile.Index {
+				ids = append(ids, tid)
+			} else if id := p.tileIDWithIndex(index); id >= 0 {
+				ids = append(ids, id)
+			}
+		}
+
+		if len(ids) == 3 {
+			ops = append(ops, protocol.Op{Type: protocol.OptypeChi, TileIDs: ids})
+		}
+	}
+	return ops
+}
+
 // 是否胡牌, plus表示是不是额外有番(比如抢杠，别人杠上炮)
 func (p *Player) checkHu(tid int, plus bool) bool {
 	index := mahjong.IndexFromID(tid)
@@ -675,7 +745,7 @@ func (p *Player) checkHu(tid int, plus bool) bool {
 	}
 
 	// 检查胡牌
-	canHu := mahjong.CanHu(tiles.Indexes(), index)
+	canHu := p.desk.rule.CheckWin(append(tiles.Indexes(), index))
 	if !canHu {
 		return false
 	}
@@ -689,7 +759,7 @@ func (p *Player) checkHu(tid int, plus bool) bool {
 	onHand := append(p.handTiles().Indexes(), index)
 	old := p.ctx.NewOtherDiscardID
 	p.ctx.NewOtherDiscardID = tid
-	m := mahjong.Multiple(p.ctx, onHand, p.pgTiles().Indexes())
+	m := p.desk.rule.Multiple(p.ctx, onHand, p.pgTiles().Indexes())
 	p.ctx.NewOtherDiscardID = old
 
 	// 有番才能胡
@@ -756,6 +826,39 @@ func (p *Player) peng(id int) {
 	p.ctx.SetPrevOp(protocol.OptypePeng)
 }
 
+// 吃牌, first为玩家选择的顺子的第一张牌, 不能吃时返回nil
+func (p *Player) chi(tid, first int) mahjong.Tiles {
+	// 只有出牌玩家的下家可以吃
+	if p.turn != (p.desk.curTurn+1)%p.desk.totalPlayerCount() {
+		return nil
+	}
+
+	var ids []int
+	for _, op := range p.chowOps(tid) {
+		if op.TileIDs[0] == first {
+			ids = op.TileIDs
+			break
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	for _, id := range ids {
+		if id != tid {
+			mahjong.RemoveId(&p.onHand, id)
+		}
+		tile := mahjong.TileFromID(id)
+		p.pongKong = append(p.pongKong, tile)
+		p.chow = append(p.chow, tile)
+	}
+
+	p.logger.Debugf("玩家吃牌, 麻将=%v 顺子=%+v 手牌=%+v 碰杠=%+v", mahjong.TileFromID(tid), ids, p.handTiles(), p.pgTiles())
+
+	p.ctx.SetPrevOp(protocol.OptypeChi)
+	return ids
+}
+
 // 玩家操作
 func (p *Player) action(opType int, tiles mahjong.Tiles) {
 	p.logger.Debugf("玩家选择: OpType=%d Tiles=%+v", opType, tiles)
@@ -764,7 +867,7 @@ func (p *Player) action(opType int, tiles mahjong.Tiles) {
 		OpType:  opType,
 		TileIDs: tiles,
 	}
-	if err := p.desk.group.Broadcast(protocol.RouteTypeDo, do); err != nil {
+	if err := p.desk.broadcast(protocol.RouteTypeDo, do); err != nil {
 		log.Error(err)
 	}
 
@@ -799,6 +902,12 @@ func (p *Player) hint(ops []protocol.Op, args ...protocol.Tings) {
 	p.ctx.LastHint = hint
 	p.desk.lastHintUid = p.Uid()
 
+	// 机器人直接根据提示做出选择
+	if p.robot != nil {
+		p.robot.pending = p.robot.think(p, ops)
+		return
+	}
+
 	if p.session == nil {
 		p.logger.Warnf("玩家网络已经断开，不能通知出牌")
 		return
@@ -824,9 +933,68 @@ func (p *Player) selectDefaultQue() int {
 	return q + 1
 }
 
+// 换三张默认选择: 张数最少(至少三张)的花色中的三张牌
+func (p *Player) defaultExchange() mahjong.Tiles {
+	suits := map[int]mahjong.Tiles{}
+	for _, t := range p.onHand {
+		if mahjong.IsSuitIndex(t.Index) {
+			suits[t.Suit] = append(suits[t.Suit], t.Id)
+		}
+	}
+
+	best := -1
+	for suit := mahjong.SuitTiao; suit <= mahjong.SuitWan; suit++ {
+		if n := len(suits[suit]); n >= 3 && (best < 0 || n < len(suits[best])) {
+			best = suit
+		}
+	}
+
+	// 没有任何花色够三张时, 直接换最后三张
+	ids := p.onHand.Ids()
+	if best >= 0 {
+		ids = suits[best]
+	}
+	return mahjong.Tiles(ids[len(ids)-3:])
+}
+
+// 换出的牌必须是手里三张不同的同花色的牌
+func (p *Player) canExchange(ids []int) bool {
+	if len(ids) != 3 {
+		return false
+	}
+
+	suit := -1
+	for i, id := range ids {
+		for _, other := range ids[:i] {
+			if other == id {
+				return false
+			}
+		}
+
+		var tile *mahjong.Tile
+		for _, t := range p.onHand {
+			if t.Id == id {
+				tile = t
+				break
+			}
+		}
+		if tile == nil || !mahjong.IsSuitIndex(tile.Index) {
+			return false
+		}
+
+		if suit >= 0 && tile.Suit != suit {
+			return false
+		}
+		suit = tile.Suit
+	}
+	return true
+}
+
 func (p *Player) reset() {
 	p.onHand = mahjong.Mahjong{}
 	p.pongKong = mahjong.Mahjong{}
+	p.chow = mahjong.Mahjong{}
+	p.huTiles = mahjong.Mahjong{}
 	p.chupai = mahjong.Mahjong{}
 
 	// 重置channel
@@ -839,62 +1007,32 @@ func (p *Player) reset() {
 // TODO: 断线重连，已和牌玩家显示不正常
 func (p *Player) syncDeskData() error {
 	desk := p.desk
-	data := &protocol.SyncDesk{
-		Status:    desk.status(),
-		Players:   []protocol.DeskPlayerData{},
-		ScoreInfo: []protocol.ScoreInfo{},
-	}
-
-	markerUid := int64(0)
-	lastMoPaiUid := int64(0)
-	for i, player := range desk.players {
-		uid := player.Uid()
-		if i == desk.bankerTurn {
-			markerUid = uid
-		}
-		if i == desk.curTurn {
-			lastMoPaiUid = uid
-		}
-		// 有可能已经有玩家和牌
-		stats := desk.roundOverTilesForPlayer(player)
-		playerData := protocol.DeskPlayerData{
-			Uid:        uid,
-			HandTiles:  stats.Tiles,
-			PGTiles:    player.pgTiles().Ids(),
-			ChuTiles:   player.chuTiles().Ids(),
-			LatestTile: player.ctx.NewDrawingID,
-			HuPai:      player.ctx.WinningID,
-			HuType:     player.ctx.ResultType,
-			IsHu:       desk.wonPlayers[uid],
-			Que:        player.ctx.Que,
-			Score:      player.score,
-		}
+	syncUid := p.Uid()
+	data := desk.syncDeskView(syncUid)
 
-		// 如果自己断线重连，并且在定缺中，则发回提示，使用负数表示定缺建议选项
-		if p.Uid() == uid && p.ctx.Que < 1 {
-			playerData.Que = -player.selectDefaultQue()
+	// 如果自己断线重连，并且在定缺中，则发回提示，使用负数表示定缺建议选项
+	for i := range data.Players {
+		if data.Players[i].Uid == syncUid && p.ctx.Que < 1 && desk.status() != constant.DeskStatusExchange {
+			data.Players[i].Que = -p.selectDefaultQue()
 		}
+	}
 
-		data.Players = append(data.Players, playerData)
+	if data.LastMoPaiUid == syncUid || desk.lastHintUid == syncUid {
+		data.Hint = p.ctx.LastHint
+	}
 
-		score := protocol.ScoreInfo{
-			Uid:   uid,
-			Score: player.score,
+	// 换三张阶段, 发回自己已经选择的牌或者推荐换出的牌
+	if desk.status() == constant.DeskStatusExchange {
+		tiles, picked := desk.exchange.picks[syncUid]
+		if !picked {
+			tiles = p.defaultExchange()
+		}
+		data.Exchange = &protocol.ExchangeStatus{
+			Picked:  picked,
+			TileIDs: tiles,
+			Timeout: desk.exchange.restTime(),
 		}
-
-		data.ScoreInfo = append(data.ScoreInfo, score)
-	}
-	data.MarkerUid = markerUid
-	data.LastMoPaiUid = lastMoPaiUid
-	data.RestCount = desk.remainTileCount()
-	data.Dice1 = desk.dice.dice1
-	data.Dice2 = desk.dice.dice2
-	syncUid := p.Uid()
-	if lastMoPaiUid == syncUid || p.desk.lastHintUid == syncUid {
-		data.Hint = p.ctx.LastHint
 	}
-	data.LastTileId = p.desk.lastTileId
-	data.LastChuPaiUid = p.desk.lastChuPaiUid
 	p.logger.Debugf("同步房间数据: %+v", data)
 	return p.session.Push("onSyncDesk", data)
 }
@@ -1,6 +1,10 @@
 package game
 
 import (
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/async"
+	"github.com/lonng/nanoserver/pkg/errutil"
 	"github.com/lonng/nanoserver/protocol"
 
 	"time"
@@ -59,6 +63,7 @@ func (m *PlayerManager) AfterInit() {
 				p, ok := defaultPlayerManager.player(uid)
 				if !ok || p.session == nil {
 					logger.Errorf("玩家%d不在线", uid)
+					continue
 				}
 				p.session.Close()
 				logger.Infof("踢出玩家, UID=%d", uid)
@@ -91,13 +96,34 @@ func (m *PlayerManager) AfterInit() {
 
 //处理登录
 func (m *PlayerManager) Login(s *session.Session, req *protocol.LoginToGameServerRequest) error {
-	uid := req.Uid
+	mid := s.MID()
+	// 查询数据库不能阻塞逻辑线程
+	async.Run(func() {
+		u, err := authenticate(req.Token)
+		if err != nil {
+			log.Warnf("玩家: %d登录凭证验证失败: %v", req.Uid, err)
+			s.ResponseMID(mid, &protocol.LoginToGameServerResponse{Code: errorCode, Error: loginTokenMessage})
+			return
+		}
+		name, head, sex := profile(u)
+
+		// 玩家数据只能在逻辑线程中修改
+		nano.Invoke(func() {
+			m.login(s, mid, req, u, name, head, sex)
+		})
+	})
+	return nil
+}
+
+// 凭证验证通过后绑定session和玩家
+func (m *PlayerManager) login(s *session.Session, mid uint, req *protocol.LoginToGameServerRequest, u *model.User, name, head string, sex int) {
+	uid := u.Id
 	s.Bind(uid) //session绑定uid
 
 	log.Infof("玩家: %d登录: %+v", uid, req)
 	if p, ok := m.player(uid); !ok {
 		log.Infof("玩家: %d不在线，创建新的玩家", uid)
-		p = newPlayer(s, uid, req.Name, req.HeadUrl, req.IP, req.Sex)
+		p = newPlayer(s, uid, name, head, remoteIP(s), sex)
 		m.setPlayer(uid, p)
 	} else {
 		log.Infof("玩家: %d已经在线", uid)
@@ -123,15 +149,16 @@ func (m *PlayerManager) Login(s *session.Session, req *protocol.LoginToGameServe
 	m.group.Add(s)
 
 	res := &protocol.LoginToGameServerResponse{
-		Uid:      s.UID(),
-		Nickname: req.Name,
-		Sex:      req.Sex,
-		HeadUrl:  req.HeadUrl,
-		FangKa:   req.FangKa,
+		Uid:        s.UID(),
+		Nickname:   name,
+		Sex:        sex,
+		HeadUrl:    head,
+		FangKa:     int(u.Coin),
+		Serializer: serializer.Negotiate(s, req.Serializers),
 	}
 
 	//返回消息给client
-	return s.Response(res)
+	s.ResponseMID(mid, res)
 }
 
 func (m *PlayerManager) player(uid int64) (*Player, bool) {
@@ -147,12 +174,40 @@ func (m *PlayerManager) setPlayer(uid int64, p *Player) {
 	m.players[uid] = p
 }
 
+// CheckOrder 查询订单状态和玩家当前的房卡数量, 只能查询自己的订单
 func (m *PlayerManager) CheckOrder(s *session.Session, msg *protocol.CheckOrderReqeust) error {
-	log.Infof("%+v", msg)
+	p, err := playerWithSession(s)
+	if err != nil {
+		return err
+	}
+
+	mid := s.MID()
+	async.Run(func() {
+		order, err := db.QueryOrder(msg.OrderID)
+		if err == nil && order.Uid != p.Uid() {
+			err = errutil.ErrOrderNotFound
+		}
+		if err != nil {
+			s.ResponseMID(mid, &protocol.CheckOrderResponse{Code: -1, Error: err.Error()})
+			return
+		}
+
+		u, err := db.QueryUser(p.Uid())
+		if err != nil {
+			s.ResponseMID(mid, &protocol.CheckOrderResponse{Code: -1, Error: err.Error()})
+			return
+		}
 
-	return s.Response(&protocol.CheckOrderResponse{
-		FangKa: 20,
+		// 玩家数据只能在逻辑线程中修改
+		nano.Invoke(func() {
+			p.coin = u.Coin
+		})
+		s.ResponseMID(mid, &protocol.CheckOrderResponse{
+			Status: order.Status,
+			FangKa: int(u.Coin),
+		})
 	})
+	return nil
 }
 
 func (m *PlayerManager) sessionCount() int {
@@ -0,0 +1,119 @@
+package game
+
+import (
+    "github.com/lonng/nanoserver/protocol"
+)
+
+// 视角投影: 每个客户端只能看到自己的手牌, 其他玩家只下发手牌数量,
+// 完整的牌桌数据只保存在回放快照中
+
+const hiddenTile = -1 // 对观察者隐藏的麻将
+
+// 按观察者视角组播, project返回该观察者可见的数据, 不在牌桌上的观察者(包括观战者)看不到任何手牌
+func (d *Desk) multicastView(route string, project func(viewer int64) interface{}) {
+    for _, uid := range d.group.Members() {
+        s, err := d.group.Member(uid)
+        if err != nil {
+            continue
+        }
+        if err := s.Push(route, project(uid)); err != nil {
+            d.logger.Errorf("推送消息失败: Route=%s UID=%d Error=%s", route, uid, err.Error())
+        }
+    }
+    if d.watchers != nil {
+        d.watchers.Broadcast(route, project(spectatorViewer))
+    }
+}
+
+// 断牌数据: 只保留观察者自己的手牌
+func duanPaiView(duan *protocol.DuanPai, viewer int64) *protocol.DuanPai {
+    view := *duan
+    view.AccountInfo = make([]protocol.DuanPaiInfo, len(duan.AccountInfo))
+    for i, info := range duan.AccountInfo {
+        view.AccountInfo[i] = protocol.DuanPaiInfo{
+            Uid:   info.Uid,
+            Count: len(info.OnHand),
+        }
+        if info.Uid == viewer {
+            view.AccountInfo[i].OnHand = info.OnHand
+        } else {
+            view.AccountInfo[i].OnHand = []int{}
+        }
+    }
+    return &view
+}
+
+// 摸牌数据: 其他玩家只能看到摸了一张牌
+func moPaiView(mo *protocol.MoPai, viewer int64) *protocol.MoPai {
+    if mo.AccountID == viewer {
+        return mo
+    }
+
+    view := &protocol.MoPai{
+        AccountID: mo.AccountID,
+        TileIDs:   make([]int, len(mo.TileIDs)),
+    }
+    for i := range view.TileIDs {
+        view.TileIDs[i] = hiddenTile
+    }
+    return view
+}
+
+// 同步牌桌时的玩家数据: 隐藏其他玩家的手牌和最新上手的牌
+func deskPlayerView(data protocol.DeskPlayerData, viewer int64) protocol.DeskPlayerData {
+    data.HandCount = len(data.HandTiles)
+    if data.Uid == viewer {
+        return data
+    }
+
+    data.HandTiles = []int{}
+    data.LatestTile = hiddenTile
+    return data
+}
+
+// 按观察者视角生成牌桌同步数据, 观察者自己的提示、换牌等数据由调用者补充
+func (d *Desk) syncDeskView(viewer int64) *protocol.SyncDesk {
+    data := &protocol.SyncDesk{
+        Status:    d.status(),
+        Players:   []protocol.DeskPlayerData{},
+        ScoreInfo: []protocol.ScoreInfo{},
+    }
+
+    for i, player := range d.players {
+        uid := player.Uid()
+        if i == d.bankerTurn {
+            data.MarkerUid = uid
+        }
+        if i == d.curTurn {
+            data.LastMoPaiUid = uid
+        }
+        // 有可能已经有玩家和牌
+        stats := d.roundOverTilesForPlayer(player)
+        playerData := protocol.DeskPlayerData{
+            Uid:        uid,
+            HandTiles:  stats.Tiles,
+            PGTiles:    player.pgTiles().Ids(),
+            ChiTiles:   player.chow.Ids(),
+            ChuTiles:   player.chuTiles().Ids(),
+            LatestTile: player.ctx.NewDrawingID,
+            HuPai:      player.ctx.WinningID,
+            HuPais:     player.huTiles.Ids(),
+            HuType:     player.ctx.ResultType,
+            IsHu:       d.wonPlayers[uid],
+            Que:        player.ctx.Que,
+            Score:      player.score,
+            Trustee:    player.isTrustee(),
+        }
+        data.Players = append(data.Players, deskPlayerView(playerData, viewer))
+        data.ScoreInfo = append(data.ScoreInfo, protocol.ScoreInfo{
+            Uid:   uid,
+            Score: player.score,
+        })
+    }
+    data.RestCount = d.remainTileCount()
+    data.Dice1 = d.dice.dice1
+    data.Dice2 = d.dice.dice2
+    data.LastTileId = d.lastTileId
+    data.LastChuPaiUid = d.lastChuPaiUid
+    return data
+}
@@ -0,0 +1,438 @@
+package replay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/lonng/nanoserver/cmd/mahjong/game/history"
+	"github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+// 记录不一致时返回的错误, Step为出错的操作序号(从1开始), 0表示初始状态
+type InconsistentError struct {
+	Step   int
+	Reason string
+}
+
+func (e *InconsistentError) Error() string {
+	return fmt.Sprintf("replay: inconsistent history at step %d: %s", e.Step, e.Reason)
+}
+
+// 可以被别人碰/杠/吃/胡的牌: 别人打出的牌或者被抢杠的牌
+type claimable struct {
+	uid   int64
+	tile  int
+	taken bool // 已经从出牌(或手牌)中移除, 一炮多响时只移除一次
+}
+
+// 根据历史快照逐步重建牌桌状态
+type Replay struct {
+	snapshot *history.SnapShot
+	players  []*protocol.ReplayPlayer
+	index    map[int64]*protocol.ReplayPlayer
+	seen     map[int]bool // 所有已经出现过的牌, 用于检查重复
+	rest     int          // 牌墙剩余数量
+	step     int          // 已经执行的操作数量
+	gang     int          // 下一条杠分记录
+	hu       int          // 下一条胡分记录
+	claim    *claimable
+}
+
+// 从数据库记录中加载回放
+func Load(h *model.History) (*Replay, error) {
+	snapshot := &history.SnapShot{}
+	if err := json.Unmarshal([]byte(h.Snapshot), snapshot); err != nil {
+		return nil, err
+	}
+	return New(snapshot)
+}
+
+// 创建回放, 状态为发牌和换三张之后
+func New(snapshot *history.SnapShot) (*Replay, error) {
+	if snapshot.DuanPai == nil || len(snapshot.DuanPai.AccountInfo) == 0 {
+		return nil, &InconsistentError{Reason: "missing duan pai"}
+	}
+
+	rule, ok := mahjong.RuleSetByName(snapshot.Rule)
+	if !ok {
+		return nil, &InconsistentError{Reason: fmt.Sprintf("unknown rule %q", snapshot.Rule)}
+	}
+
+	count := len(snapshot.DuanPai.AccountInfo)
+	r := &Replay{
+		snapshot: snapshot,
+		players:  make([]*protocol.ReplayPlayer, 0, count),
+		index:    map[int64]*protocol.ReplayPlayer{},
+		seen:     map[int]bool{},
+		rest:     rule.TileCount(count),
+	}
+
+	for _, info := range snapshot.DuanPai.AccountInfo {
+		if _, ok := r.index[info.Uid]; ok {
+			return nil, r.inconsistent("duplicate player %d", info.Uid)
+		}
+		p := &protocol.ReplayPlayer{Uid: info.Uid}
+		for _, id := range info.OnHand {
+			if err := r.draw(p, id); err != nil {
+				return nil, err
+			}
+		}
+		r.players = append(r.players, p)
+		r.index[p.Uid] = p
+	}
+
+	// 换三张不改变牌墙, 只交换手牌
+	for _, e := range snapshot.Exchange {
+		p, ok := r.index[e.Uid]
+		if !ok {
+			return nil, r.inconsistent("exchange of unknown player %d", e.Uid)
+		}
+		for _, id := range e.Out {
+			if !remove(&p.OnHand, id) {
+				return nil, r.inconsistent("exchange tile %d not on hand of player %d", id, e.Uid)
+			}
+		}
+	}
+	for _, e := range snapshot.Exchange {
+		p := r.index[e.Uid]
+		p.OnHand = append(p.OnHand, e.In...)
+	}
+
+	return r, nil
+}
+
+// 当前的牌桌状态
+func (r *Replay) Frame() *protocol.ReplayFrame {
+	f := &protocol.ReplayFrame{
+		Step:      r.step,
+		RestCount: r.rest,
+		Players:   make([]protocol.ReplayPlayer, len(r.players)),
+	}
+	if r.step > 0 {
+		f.Action = r.snapshot.Do[r.step-1]
+	}
+
+	for i, p := range r.players {
+		c := protocol.ReplayPlayer{
+			Uid:      p.Uid,
+			OnHand:   append([]int{}, p.OnHand...),
+			Melds:    make([]protocol.ReplayMeld, len(p.Melds)),
+			Discards: append([]int{}, p.Discards...),
+			HuTiles:  append([]int{}, p.HuTiles...),
+			Score:    p.Score,
+		}
+		sort.Ints(c.OnHand)
+		for j, m := range p.Melds {
+			c.Melds[j] = protocol.ReplayMeld{OpType: m.OpType, TileIDs: append([]int{}, m.TileIDs...)}
+		}
+		f.Players[i] = c
+	}
+	return f
+}
+
+// 执行下一步操作并返回执行后的状态, 所有操作执行完后返回io.EOF
+func (r *Replay) Next() (*protocol.ReplayFrame, error) {
+	if r.step >= len(r.snapshot.Do) {
+		if err := r.finish(); err != nil {
+			return nil, err
+		}
+		return nil, io.EOF
+	}
+
+	r.step++
+	if err := r.apply(r.snapshot.Do[r.step-1]); err != nil {
+		return nil, err
+	}
+	return r.Frame(), nil
+}
+
+// 所有帧, 第一帧为初始状态
+func (r *Replay) Frames() ([]*protocol.ReplayFrame, error) {
+	frames := []*protocol.ReplayFrame{r.Frame()}
+	for {
+		f, err := r.Next()
+		if err == io.EOF {
+			return frames, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		frames = append(frames, f)
+	}
+}
+
+func (r *Replay) inconsistent(format string, args ...interface{}) error {
+	return &InconsistentError{Step: r.step, Reason: fmt.Sprintf(format, args...)}
+}
+
+func (r *Replay) draw(p *protocol.ReplayPlayer, id int) error {
+	if r.seen[id] {
+		return r.inconsistent("duplicate tile %d", id)
+	}
+	if r.rest < 1 {
+		return r.inconsistent("no more tile for player %d", p.Uid)
+	}
+	r.seen[id] = true
+	r.rest--
+	p.OnHand = append(p.OnHand, id)
+	return nil
+}
+
+func (r *Replay) apply(do *protocol.OpTypeDo) error {
+	if len(do.Uid) != 1 {
+		return r.inconsistent("expect one player, got %v", do.Uid)
+	}
+	p, ok := r.index[do.Uid[0]]
+	if !ok {
+		return r.inconsistent("unknown player %d", do.Uid[0])
+	}
+	if len(do.TileIDs) == 0 {
+		return r.inconsistent("empty tiles of optype %d", do.OpType)
+	}
+
+	// 一炮多响时, 同一张牌可以被多个玩家胡
+	claim := r.claim
+	if do.OpType != protocol.OptypeHu {
+		r.claim = nil
+	}
+
+	switch do.OpType {
+	case protocol.OptyMoPai:
+		return r.draw(p, do.TileIDs[0])
+
+	case protocol.OptypeChu:
+		id := do.TileIDs[0]
+		if !remove(&p.OnHand, id) {
+			return r.inconsistent("discard tile %d not on hand of player %d", id, p.Uid)
+		}
+		p.Discards = append(p.Discards, id)
+		r.claim = &claimable{uid: p.Uid, tile: id}
+		return nil
+
+	case protocol.OptypePeng:
+		return r.meld(p, claim, do, 3)
+
+	case protocol.OptypeChi:
+		return r.meld(p, claim, do, 3)
+
+	case protocol.OptypeGang:
+		return r.kong(p, claim, do)
+
+	case protocol.OptypeHu:
+		return r.win(p, claim, do.TileIDs[0])
+
+	default:
+		return r.inconsistent("unknown optype %d", do.OpType)
+	}
+}
+
+// 碰/吃/明杠: 拿走别人打出的牌, 其余的牌从手牌中移除
+func (r *Replay) meld(p *protocol.ReplayPlayer, claim *claimable, do *protocol.OpTypeDo, count int) error {
+	if claim == nil || claim.taken || claim.uid == p.Uid {
+		return r.inconsistent("nothing to claim for player %d", p.Uid)
+	}
+
+	claimed := false
+	ids := []int{}
+	for _, id := range do.TileIDs {
+		if id == claim.tile && !claimed {
+			claimed = true
+		} else {
+			ids = append(ids, id)
+		}
+	}
+	if !claimed {
+		return r.inconsistent("claimed tiles %v without discard %d", do.TileIDs, claim.tile)
+	}
+
+	// 碰杠时记录中可能包含多余的同样的牌
+	if len(ids) < count-1 {
+		return r.inconsistent("expect %d tiles, got %v", count, do.TileIDs)
+	}
+	ids = ids[:count-1]
+	for _, id := range ids {
+		if !remove(&p.OnHand, id) {
+			return r.inconsistent("tile %d not on hand of player %d", id, p.Uid)
+		}
+	}
+	if err := r.take(claim); err != nil {
+		return err
+	}
+
+	p.Melds = append(p.Melds, protocol.ReplayMeld{
+		OpType:  do.OpType,
+		TileIDs: append([]int{claim.tile}, ids...),
+	})
+	return nil
+}
+
+// 杠: 明杠、暗杠和巴杠, 被抢杠的巴杠没有杠分
+func (r *Replay) kong(p *protocol.ReplayPlayer, claim *claimable, do *protocol.OpTypeDo) error {
+	switch {
+	case claim != nil && !claim.taken && claim.uid != p.Uid && contains(do.TileIDs, claim.tile):
+		if err := r.meld(p, claim, do, 4); err != nil {
+			return err
+		}
+
+	case len(do.TileIDs) == 1:
+		id := do.TileIDs[0]
+		if !remove(&p.OnHand, id) {
+			return r.inconsistent("kong tile %d not on hand of player %d", id, p.Uid)
+		}
+
+		// 下一步是其他玩家胡这张牌, 说明被抢杠
+		if next := r.peek(); next != nil && next.OpType == protocol.OptypeHu &&
+			len(next.Uid) == 1 && next.Uid[0] != p.Uid && contains(next.TileIDs, id) {
+			r.claim = &claimable{uid: p.Uid, tile: id, taken: true}
+			return nil
+		}
+
+		index := mahjong.TileFromID(id).Index
+		pong := -1
+		for i, m := range p.Melds {
+			if m.OpType == protocol.OptypePeng && mahjong.TileFromID(m.TileIDs[0]).Index == index {
+				pong = i
+				break
+			}
+		}
+		if pong < 0 {
+			return r.inconsistent("kong tile %d without pong of player %d", id, p.Uid)
+		}
+		p.Melds[pong].OpType = protocol.OptypeGang
+		p.Melds[pong].TileIDs = append(p.Melds[pong].TileIDs, id)
+
+	default:
+		if len(do.TileIDs) != 4 {
+			return r.inconsistent("expect 4 tiles for kong, got %v", do.TileIDs)
+		}
+		for _, id := range do.TileIDs {
+			if !remove(&p.OnHand, id) {
+				return r.inconsistent("kong tile %d not on hand of player %d", id, p.Uid)
+			}
+		}
+		p.Melds = append(p.Melds, protocol.ReplayMeld{
+			OpType:  do.OpType,
+			TileIDs: append([]int{}, do.TileIDs...),
+		})
+	}
+
+	if r.gang >= len(r.snapshot.GangScoreChanges) {
+		return r.inconsistent("missing kong score change")
+	}
+	for _, c := range r.snapshot.GangScoreChanges[r.gang].Changes {
+		if err := r.score(c); err != nil {
+			return err
+		}
+	}
+	r.gang++
+	return nil
+}
+
+// 胡: 自摸、点炮和抢杠
+func (r *Replay) win(p *protocol.ReplayPlayer, claim *claimable, id int) error {
+	switch {
+	case remove(&p.OnHand, id):
+	case claim != nil && claim.tile == id && claim.uid != p.Uid:
+		if err := r.take(claim); err != nil {
+			return err
+		}
+	default:
+		return r.inconsistent("win tile %d neither on hand nor claimable for player %d", id, p.Uid)
+	}
+	p.HuTiles = append(p.HuTiles, id)
+
+	if r.hu >= len(r.snapshot.HuScoreChanges) {
+		return r.inconsistent("missing win score change")
+	}
+	hsc := r.snapshot.HuScoreChanges[r.hu]
+	if hsc.Uid != p.Uid {
+		return r.inconsistent("win score change of player %d, expect %d", hsc.Uid, p.Uid)
+	}
+	if err := r.huScore(hsc); err != nil {
+		return err
+	}
+	r.hu++
+	return nil
+}
+
+// 所有操作执行完后, 剩余的分数变化只能是查叫赔付和退税
+func (r *Replay) finish() error {
+	if r.gang < len(r.snapshot.GangScoreChanges) {
+		return r.inconsistent("%d unused kong score changes", len(r.snapshot.GangScoreChanges)-r.gang)
+	}
+	for ; r.hu < len(r.snapshot.HuScoreChanges); r.hu++ {
+		hsc := r.snapshot.HuScoreChanges[r.hu]
+		if hsc.HuPaiType != protocol.HuTypePei && hsc.HuPaiType != protocol.HuTypeTuiShui {
+			return r.inconsistent("unused win score change of player %d", hsc.Uid)
+		}
+		if err := r.huScore(hsc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Replay) huScore(hsc *protocol.HuInfo) error {
+	if err := r.score(protocol.ScoreInfo{Uid: hsc.Uid, Score: hsc.TotalWinScore}); err != nil {
+		return err
+	}
+	for _, c := range hsc.ScoreChange {
+		if err := r.score(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Replay) score(c protocol.ScoreInfo) error {
+	p, ok := r.index[c.Uid]
+	if !ok {
+		return r.inconsistent("score change of unknown player %d", c.Uid)
+	}
+	p.Score += c.Score
+	return nil
+}
+
+// 从出牌玩家的出牌中拿走被碰/杠/吃/胡的牌
+func (r *Replay) take(claim *claimable) error {
+	if claim.taken {
+		return nil
+	}
+	from := r.index[claim.uid]
+	if n := len(from.Discards); n == 0 || from.Discards[n-1] != claim.tile {
+		return r.inconsistent("tile %d is not the last discard of player %d", claim.tile, claim.uid)
+	}
+	from.Discards = from.Discards[:len(from.Discards)-1]
+	claim.taken = true
+	return nil
+}
+
+func (r *Replay) peek() *protocol.OpTypeDo {
+	if r.step >= len(r.snapshot.Do) {
+		return nil
+	}
+	return r.snapshot.Do[r.step]
+}
+
+func remove(ids *[]int, id int) bool {
+	for i, v := range *ids {
+		if v == id {
+			*ids = append((*ids)[:i], (*ids)[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func contains(ids []int, id int) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+package replay
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/lonng/nanoserver/cmd/mahjong/game/history"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func ids(from, to int) []int {
+	rts := []int{}
+	for i := from; i < to; i++ {
+		rts = append(rts, i)
+	}
+	return rts
+}
+
+func do(uid int64, op int, tiles ...int) *protocol.OpTypeDo {
+	return &protocol.OpTypeDo{Uid: []int64{uid}, OpType: op, TileIDs: tiles}
+}
+
+func testSnapshot() *history.SnapShot {
+	return &history.SnapShot{
+		Rule: "xuezhan",
+		DuanPai: &protocol.DuanPai{
+			MarkerID: 1,
+			AccountInfo: []protocol.DuanPaiInfo{
+				{Uid: 1, OnHand: ids(0, 14)},
+				{Uid: 2, OnHand: ids(14, 27)},
+				{Uid: 3, OnHand: ids(27, 40)},
+				{Uid: 4, OnHand: ids(40, 53)},
+			},
+		},
+		Do: []*protocol.OpTypeDo{
+			do(1, protocol.OptypeGang, 0, 1, 2, 3),
+			do(1, protocol.OptyMoPai, 53),
+			do(1, protocol.OptypeChu, 12),
+			do(2, protocol.OptypePeng, 12, 14, 15),
+			do(2, protocol.OptypeChu, 16),
+			do(3, protocol.OptyMoPai, 60),
+			do(3, protocol.OptypeChu, 60),
+			do(4, protocol.OptypeHu, 60),
+		},
+		GangScoreChanges: []*protocol.GangPaiScoreChange{
+			{Changes: []protocol.ScoreInfo{{Uid: 1, Score: 6}, {Uid: 2, Score: -2}, {Uid: 3, Score: -2}, {Uid: 4, Score: -2}}},
+		},
+		HuScoreChanges: []*protocol.HuInfo{
+			{Uid: 4, TotalWinScore: 4, ScoreChange: []protocol.ScoreInfo{{Uid: 3, Score: -4}}},
+		},
+	}
+}
+
+func TestReplayFrames(t *testing.T) {
+	data, err := json.Marshal(testSnapshot())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := Load(&model.History{Snapshot: string(data)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames, err := r.Frames()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 9 {
+		t.Fatalf("expect 9 frames, got: %d", len(frames))
+	}
+
+	if rest := frames[0].RestCount; rest != 108-53 {
+		t.Fatalf("expect rest count %d, got: %d", 108-53, rest)
+	}
+
+	last := frames[len(frames)-1]
+	if last.RestCount != 108-55 {
+		t.Fatalf("expect rest count %d, got: %d", 108-55, last.RestCount)
+	}
+
+	scores := []int{6, -2, -6, 2}
+	hands := []int{10, 10, 13, 13}
+	for i, p := range last.Players {
+		if p.Score != scores[i] {
+			t.Fatalf("player %d: expect score %d, got: %d", p.Uid, scores[i], p.Score)
+		}
+		if len(p.OnHand) != hands[i] {
+			t.Fatalf("player %d: expect %d tiles on hand, got: %d", p.Uid, hands[i], len(p.OnHand))
+		}
+	}
+
+	if melds := last.Players[1].Melds; len(melds) != 1 || !reflect.DeepEqual(melds[0].TileIDs, []int{12, 14, 15}) {
+		t.Fatalf("expect pong 12 14 15, got: %+v", melds)
+	}
+	if d := last.Players[0].Discards; len(d) != 0 {
+		t.Fatalf("expect claimed discard removed, got: %v", d)
+	}
+	if hu := last.Players[3].HuTiles; !reflect.DeepEqual(hu, []int{60}) {
+		t.Fatalf("expect hu tiles [60], got: %v", hu)
+	}
+}
+
+func TestReplayInconsistent(t *testing.T) {
+	s := testSnapshot()
+	s.Do[4] = do(2, protocol.OptypeChu, 0)
+	r, err := New(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = r.Frames()
+	if e, ok := err.(*InconsistentError); !ok || e.Step != 5 {
+		t.Fatalf("expect inconsistent error at step 5, got: %v", err)
+	}
+
+	s = testSnapshot()
+	s.GangScoreChanges = nil
+	r, _ = New(s)
+	if _, err = r.Frames(); err == nil {
+		t.Fatal("expect error for missing kong score change")
+	}
+}
@@ -0,0 +1,317 @@
+package game
+
+import (
+    "fmt"
+    "math/rand"
+    "sync/atomic"
+    "time"
+
+    "github.com/lonng/nanoserver/cmd/mahjong/game/history"
+    "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
+    "github.com/lonng/nanoserver/protocol"
+    log "github.com/sirupsen/logrus"
+)
+
+// 机器人难度
+const (
+    RobotEasy   = 1 // 简单: 只按向听数出牌, 不碰不杠
+    RobotNormal = 2 // 普通: 按向听数和进张数出牌, 有利时碰杠
+    RobotHard   = 3 // 困难: 听牌时选择番数和剩余张数最大的听牌
+)
+
+const robotDelay = 800 * time.Millisecond // 机器人操作延时, 保证客户端动画正常播放
+
+var robotUid int64 // 机器人UID, 使用负数以免和真实玩家冲突
+
+// 机器人没有session, 收到提示后直接做出选择, 在等待操作时返回
+type robot struct {
+    level   int
+    pending *protocol.OpChoosed // 根据最后一次提示做出的选择
+}
+
+func newRobot(level int) *Player {
+    return newRobotWithUid(atomic.AddInt64(&robotUid, -1), level)
+}
+
+func newRobotWithUid(uid int64, level int) *Player {
+    p := &Player{
+        uid:   uid,
+        name:  fmt.Sprintf("机器人%d", -uid),
+        ctx:   &mahjong.Context{Uid: uid},
+        score: 1000,
+        robot: &robot{level: level},
+
+        logger: log.WithField(fieldPlayer, uid),
+
+        chOperation: make(chan *protocol.OpChoosed, 1),
+    }
+
+    p.ctx.Reset()
+    return p
+}
+
+// 从检查点恢复机器人后, 新的机器人UID不能和恢复的机器人冲突
+func reserveRobotUid(uid int64) {
+    for {
+        cur := atomic.LoadInt64(&robotUid)
+        if cur <= uid || atomic.CompareAndSwapInt64(&robotUid, cur, uid) {
+            return
+        }
+    }
+}
+
+func (p *Player) isRobot() bool {
+    return p.robot != nil
+}
+
+// 等待机器人操作, 第二个返回值表示房间是否已经解散
+func (r *robot) operate(p *Player, auto *protocol.OpChoosed) (*protocol.OpChoosed, bool) {
+    select {
+    case <-time.After(robotDelay):
+    case <-p.desk.die:
+        return nil, true
+    }
+
+    op := r.pending
+    r.pending = nil
+    if op == nil {
+        op = auto
+    }
+    return op, false
+}
+
+// 根据提示选择操作: 能胡必胡, 然后是出牌、杠、碰, 都不合适则过
+func (r *robot) think(p *Player, ops []protocol.Op) *protocol.OpChoosed {
+    tileID := illegalTile
+    for _, op := range ops {
+        if len(op.TileIDs) > 0 {
+            tileID = op.TileIDs[0]
+        }
+        if op.Type == protocol.OptypeHu {
+            return autoHu(tileID)
+        }
+    }
+
+    for _, op := range ops {
+        switch op.Type {
+        case protocol.OptypeChu:
+            return &protocol.OpChoosed{Type: protocol.OptypeChu, TileID: r.discard(p)}
+
+        case protocol.OptypeGang:
+            if r.level > RobotEasy && len(op.TileIDs) > 0 && r.shouldGang(p, op.TileIDs[0]) {
+                return &protocol.OpChoosed{Type: protocol.OptypeGang, TileID: op.TileIDs[0]}
+            }
+
+        case protocol.OptypePeng:
+            if r.level > RobotEasy && len(op.TileIDs) > 0 && r.shouldPeng(p, op.TileIDs[0]) {
+                return &protocol.OpChoosed{Type: protocol.OptypePeng, TileID: op.TileIDs[0]}
+            }
+
+        case protocol.OptypeChi:
+            if r.level > RobotEasy && len(op.TileIDs) == 3 && r.shouldChi(p, op.TileIDs) {
+                return &protocol.OpChoosed{Type: protocol.OptypeChi, TileID: op.TileIDs[0]}
+            }
+        }
+    }
+
+    return autoPass(tileID)
+}
+
+// 杠牌后向听数不增加才杠, 不杠缺的牌
+func (r *robot) shouldGang(p *Player, tileID int) bool {
+    tile := mahjong.TileFromID(tileID)
+    if tile.Suit+1 == p.ctx.Que {
+        return false
+    }
+
+    hand := mahjong.Indexes(p.handTiles().Indexes())
+    return mahjong.Shanten(removeIndex(hand, tile.Index, 4)) <= bestShanten(hand)
+}
+
+// 碰牌后向听数减少才碰
+func (r *robot) shouldPeng(p *Player, tileID int) bool {
+    tile := mahjong.TileFromID(tileID)
+    hand := mahjong.Indexes(p.handTiles().Indexes())
+    return bestShanten(removeIndex(hand, tile.Index, 2)) < mahjong.Shanten(hand)
+}
+
+// 吃牌后向听数减少才吃, ids为整个顺子, 包含别人打出的牌
+func (r *robot) shouldChi(p *Player, ids []int) bool {
+    hand := mahjong.Indexes(p.handTiles().Indexes())
+    rest := hand
+    for _, t := range p.handTiles() {
+        for _, id := range ids {
+            if t.Id == id {
+                rest = removeIndex(rest, t.Index, 1)
+            }
+        }
+    }
+    return bestShanten(rest) < mahjong.Shanten(hand)
+}
+
+type discardCandidate struct {
+    id        int // 打出的麻将ID
+    shanten   int // 打出后的向听数
+    effective int // 进张数(听牌时为剩余可胡牌数量)
+    multiple  int // 听牌最大番数
+}
+
+// 选择出牌: 有缺先打缺, 否则打出后向听数最小的牌
+func (r *robot) discard(p *Player) int {
+    hand := p.handTiles()
+    if que := p.ctx.Que; que > 0 {
+        for i := len(hand) - 1; i >= 0; i-- {
+            if hand[i].Suit+1 == que {
+                return hand[i].Id
+            }
+        }
+    }
+
+    indexes := mahjong.Indexes(hand.Indexes())
+    visible := p.desk.visibleTiles(p)
+    rule := p.desk.rule
+    pongKong := mahjong.Indexes(p.pgTiles().Indexes())
+
+    var candidates []discardCandidate
+    seen := map[int]bool{}
+    for _, t := range hand {
+        if seen[t.Index] {
+            continue
+        }
+        seen[t.Index] = true
+
+        rest := removeIndex(indexes, t.Index, 1)
+        c := discardCandidate{id: t.Id, shanten: mahjong.Shanten(rest)}
+        if r.level > RobotEasy {
+            c.effective = effectiveCount(rule, rest, c.shanten, visible)
+        }
+        if r.level > RobotNormal && c.shanten == 0 {
+            c.multiple, _ = mahjong.MaxMultiple(p.desk.rule, p.desk.opts, rest, pongKong)
+        }
+        candidates = append(candidates, c)
+    }
+
+    if len(candidates) < 1 {
+        return p.autoDiscard()
+    }
+
+    best := []discardCandidate{candidates[0]}
+    for _, c := range candidates[1:] {
+        switch cmp := r.compare(c, best[0]); {
+        case cmp > 0:
+            best = []discardCandidate{c}
+        case cmp == 0:
+            best = append(best, c)
+        }
+    }
+
+    return best[rand.Intn(len(best))].id
+}
+
+// 比较两个出牌选择, 返回正数表示a更好
+func (r *robot) compare(a, b discardCandidate) int {
+    if a.shanten != b.shanten {
+        return b.shanten - a.shanten
+    }
+
+    switch r.level {
+    case RobotEasy:
+        return 0
+    case RobotHard:
+        if a.shanten == 0 {
+            return a.effective*(a.multiple+1) - b.effective*(b.multiple+1)
+        }
+    }
+
+    return a.effective - b.effective
+}
+
+// 进张数: 能使向听数减少的剩余麻将数量, 听牌时使用听牌数据计算
+func effectiveCount(rule mahjong.RuleSet, rest mahjong.Indexes, shanten int, visible map[int]int) int {
+    remain := func(index int) int {
+        if c := 4 - visible[index]; c > 0 {
+            return c
+        }
+        return 0
+    }
+
+    count := 0
+    if shanten == 0 {
+        for _, index := range rule.TingTiles(rest) {
+            count += remain(index)
+        }
+        return count
+    }
+
+    next := make(mahjong.Indexes, len(rest)+1)
+    for _, index := range rule.Indexes() {
+        if remain(index) == 0 {
+            continue
+        }
+        copy(next, rest)
+        next[len(rest)] = index
+        if mahjong.Shanten(next) < shanten {
+            count += remain(index)
+        }
+    }
+    return count
+}
+
+// 手牌为3n+2张时, 返回打出一张后的最小向听数
+func bestShanten(hand mahjong.Indexes) int {
+    if len(hand)%3 != 2 {
+        return mahjong.Shanten(hand)
+    }
+
+    best := 8
+    for _, index := range hand {
+        if s := mahjong.Shanten(removeIndex(hand, index, 1)); s < best {
+            best = s
+        }
+    }
+    return best
+}
+
+// 移除最多count张指定索引的麻将
+func removeIndex(indexes mahjong.Indexes, index, count int) mahjong.Indexes {
+    ret := make(mahjong.Indexes, 0, len(indexes))
+    for _, idx := range indexes {
+        if idx == index && count > 0 {
+            count--
+            continue
+        }
+        ret = append(ret, idx)
+    }
+    return ret
+}
+
+// 机器人能看到的麻将: 自己的手牌以及所有玩家的出牌和碰杠
+func (d *Desk) visibleTiles(p *Player) map[int]int {
+    visible := map[int]int{}
+    for _, t := range p.handTiles() {
+        visible[t.Index]++
+    }
+    for _, player := range d.players {
+        for _, t := range player.chuTiles() {
+            visible[t.Index]++
+        }
+        for _, t := range player.pgTiles() {
+            visible[t.Index]++
+        }
+    }
+    return visible
+}
+
+// 机器人加入牌桌, 机器人总是处于准备状态
+func (d *Desk) robotJoin(level int) *Player {
+    p := newRobot(level)
+    d.players = append(d.players, p)
+    for i, p := range d.players {
+        p.setDesk(d, i)
+    }
+    d.roundStats[p.Uid()] = &history.Record{}
+    d.prepare.ready(p.Uid())
+
+    p.logger.Infof("机器人加入房间: 难度=%d", level)
+    return p
+}
@@ -0,0 +1,188 @@
+package game
+
+import (
+    "fmt"
+
+    "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
+    "github.com/lonng/nanoserver/protocol"
+)
+
+// 查叫(默认规则): 没有胡牌也没有听牌的玩家按听牌玩家的最大番数赔付, 并且退还之前刮风下雨赢的分
+// 只剩一个人没有胡牌时不查叫
+func (d *Desk) chaJiao() {
+    if len(d.wonPlayers) == d.totalPlayerCount()-1 {
+        return
+    }
+
+    var pei, ting []*Player
+    for _, p := range d.players {
+        if d.wonPlayers[p.Uid()] {
+            continue
+        }
+        if p.isTing() {
+            ting = append(ting, p)
+        } else {
+            pei = append(pei, p)
+        }
+    }
+    if len(pei) == 0 {
+        return
+    }
+
+    // 有可能剩下的人都没叫, 只需要退还刮风下雨的分
+    d.refundGang(pei)
+    for _, w := range ting {
+        score, index := w.maxTingScore()
+        losers := []Loser{}
+        for _, p := range pei {
+            losers = append(losers, Loser{uid: p.Uid(), score: score})
+        }
+        d.scoreChangeForHu(w, losers, index, protocol.HuTypePei)
+    }
+}
+
+// 流局结算: 牌墙摸完后还没有胡牌的玩家
+// 1. 查花猪: 手里还有定缺花色的玩家, 按封顶赔付给所有非花猪玩家
+// 2. 查大叫: 没有听牌的玩家, 按听牌玩家的最大番数赔付
+// 3. 退税: 没有听牌的玩家(包括花猪), 退还之前刮风下雨赢的分
+// 返回每个玩家的结算描述
+func (d *Desk) settleNoMoreTile() map[int64][]string {
+    desc := map[int64][]string{}
+
+    var (
+        huaZhu  []*Player // 花猪
+        wuJiao  []*Player // 没有听牌
+        youJiao []*Player // 已经听牌, 血流成河模式下包括已经胡牌的玩家
+    )
+
+    for _, p := range d.players {
+        uid := p.Uid()
+        if d.wonPlayers[uid] {
+            // 血战到底模式下已经胡牌的玩家不参与结算
+            if d.opts.Xueliu {
+                youJiao = append(youJiao, p)
+            }
+            continue
+        }
+
+        switch {
+        case p.isHuaZhu():
+            huaZhu = append(huaZhu, p)
+        case p.isTing():
+            youJiao = append(youJiao, p)
+        default:
+            wuJiao = append(wuJiao, p)
+        }
+    }
+
+    // 只剩下一个人参与结算时不需要结算
+    if len(huaZhu)+len(wuJiao)+len(youJiao) < 2 {
+        return desc
+    }
+
+    d.logger.Debugf("流局结算: 花猪=%d 无叫=%d 有叫=%d", len(huaZhu), len(wuJiao), len(youJiao))
+
+    // 退税需要在赔付之前计算, 只退还本局之前的刮风下雨
+    for uid, refund := range d.refundGang(append(huaZhu, wuJiao...)) {
+        desc[uid] = append(desc[uid], fmt.Sprintf("退税%d", refund))
+    }
+
+    // 查花猪
+    max := d.maxScore()
+    winners := append(append([]*Player{}, wuJiao...), youJiao...)
+    if len(huaZhu) > 0 && len(winners) > 0 {
+        for _, p := range huaZhu {
+            for _, w := range winners {
+                d.scoreChangeForSettle(w.Uid(), []Loser{{uid: p.Uid(), score: max}}, ScoreChangeTypeHuaZhu, illegalTile, protocol.HuTypePei)
+            }
+            desc[p.Uid()] = append(desc[p.Uid()], "花猪")
+            p.ctx.ResultType = ResultPei
+        }
+        for _, w := range winners {
+            desc[w.Uid()] = append(desc[w.Uid()], "查花猪")
+        }
+    }
+
+    // 查大叫, 花猪已经按照封顶赔付, 不再重复赔付
+    for _, w := range youJiao {
+        score, _ := w.maxTingScore()
+        score = d.maxScoreCutter(score)
+        for _, p := range wuJiao {
+            d.scoreChangeForSettle(w.Uid(), []Loser{{uid: p.Uid(), score: score}}, ScoreChangeTypeChaJiao, illegalTile, protocol.HuTypePei)
+        }
+        if len(wuJiao) > 0 {
+            desc[w.Uid()] = append(desc[w.Uid()], "查大叫")
+        }
+    }
+    if len(youJiao) > 0 {
+        for _, p := range wuJiao {
+            desc[p.Uid()] = append(desc[p.Uid()], "被查大叫")
+            p.ctx.ResultType = ResultPei
+        }
+    }
+
+    return desc
+}
+
+// 手里还有定缺花色的牌
+func (p *Player) isHuaZhu() bool {
+    que := p.ctx.Que
+    if que < 1 {
+        return false
+    }
+    for _, t := range p.onHand {
+        if t.Suit+1 == que && mahjong.IsSuitIndex(t.Index) {
+            return true
+        }
+    }
+    return false
+}
+
+// 退还刮风下雨赢的分, 返回每个玩家退还的总分
+// 需要先收集所有玩家的流水再退还, 否则退还给另一个需要退税的玩家的分会被再次退还
+func (d *Desk) refundGang(ps []*Player) map[int64]int {
+    type refund struct {
+        uid    int64
+        change *scoreChangeInfo
+    }
+
+    refunds := []refund{}
+    for _, p := range ps {
+        for _, c := range d.scoreChanges[p.Uid()] {
+            if c.score > 0 && (c.typ == ScoreChangeTypeAnGang || c.typ == ScoreChangeTypeBaGang) {
+                refunds = append(refunds, refund{uid: p.Uid(), change: c})
+            }
+        }
+    }
+
+    total := map[int64]int{}
+    for _, r := range refunds {
+        c := r.change
+        d.scoreChangeForSettle(c.uid, []Loser{{uid: r.uid, score: c.score}}, c.typ, c.tileID, protocol.HuTypeTuiShui)
+        total[r.uid] += c.score
+    }
+
+    for uid, score := range total {
+        d.logger.Infof("流局退税: UID=%d 分数=%d", uid, score)
+    }
+    return total
+}
+
+// 流局结算的分值变化, 和查叫赔付一样记录到快照中, 回放时在所有操作之后计算
+// huType区分赔付(查花猪和查大叫)和退税
+func (d *Desk) scoreChangeForSettle(winner int64, losers []Loser, typ ScoreChangeType, tileID int, huType protocol.HuPaiType) {
+    d.scoreChangeHelper(winner, losers, typ, tileID)
+
+    hsc := &protocol.HuInfo{
+        Uid:         winner,
+        HuPaiType:   huType,
+        ScoreChange: []protocol.ScoreInfo{},
+    }
+    for _, l := range losers {
+        hsc.TotalWinScore += l.score
+        hsc.ScoreChange = append(hsc.ScoreChange, protocol.ScoreInfo{Uid: l.uid, Score: -l.score})
+    }
+    if d.snapshot != nil {
+        d.snapshot.PushHuScoreChange(hsc)
+    }
+}
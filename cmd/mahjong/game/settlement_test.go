@@ -0,0 +1,162 @@
+package game
+
+import (
+    "testing"
+
+    "github.com/lonng/nanoserver/cmd/mahjong/game/history"
+    "github.com/lonng/nanoserver/cmd/mahjong/game/mahjong"
+    "github.com/lonng/nanoserver/protocol"
+    log "github.com/sirupsen/logrus"
+)
+
+// 根据索引生成手牌, 相同索引依次使用不同的ID
+func testTiles(indexes ...int) mahjong.Mahjong {
+    used := map[int]int{}
+    tiles := mahjong.Mahjong{}
+    for _, idx := range indexes {
+        id := ((idx/10)*9+idx%10-1)*4 + used[idx]
+        used[idx]++
+        tiles = append(tiles, mahjong.TileFromID(id))
+    }
+    return tiles
+}
+
+func newTestDesk(opts *protocol.DeskOptions, hands ...mahjong.Mahjong) *Desk {
+    d := NewDesk("000000", opts, 0)
+    d.snapshot = &history.History{}
+    for i, hand := range hands {
+        uid := int64(i + 1)
+        p := &Player{
+            uid:    uid,
+            turn:   i,
+            desk:   d,
+            ctx:    &mahjong.Context{Uid: uid, Que: 3}, // 缺万
+            onHand: hand,
+            logger: log.WithField(fieldPlayer, uid),
+        }
+        d.players = append(d.players, p)
+        d.roundStats[uid] = &history.Record{}
+    }
+    return d
+}
+
+// 所有流水的总分
+func testTotal(d *Desk, uid int64) int {
+    hu, feng, yu := d.roundScoreForUid(uid)
+    return hu + feng + yu
+}
+
+// 快照中查叫赔付和退税的分数, 回放时在所有操作之后计算
+func testSnapshotTotal(d *Desk, uid int64) int {
+    total := 0
+    for _, hsc := range d.snapshot.HuScoreChanges {
+        if hsc.HuPaiType != protocol.HuTypePei && hsc.HuPaiType != protocol.HuTypeTuiShui {
+            continue
+        }
+        if hsc.Uid == uid {
+            total += hsc.TotalWinScore
+        }
+        for _, c := range hsc.ScoreChange {
+            if c.Uid == uid {
+                total += c.Score
+            }
+        }
+    }
+    return total
+}
+
+var (
+    tingHand   = []int{1, 1, 1, 2, 3, 4, 5, 6, 7, 11, 12, 13, 19}       // 单钓九筒
+    wuJiaoHand = []int{1, 3, 5, 7, 9, 11, 13, 15, 17, 19, 2, 4, 6}      // 没有听牌
+    huaZhuHand = []int{1, 2, 3, 11, 12, 13, 15, 16, 17, 19, 19, 21, 22} // 还有万
+)
+
+func TestSettleNoMoreTile(t *testing.T) {
+    opts := &protocol.DeskOptions{Mode: ModeFours, MaxFan: 3, Chajiao: true}
+    d := newTestDesk(opts, testTiles(tingHand...), testTiles(wuJiaoHand...), testTiles(huaZhuHand...), testTiles(tingHand...))
+    d.wonPlayers[4] = true
+
+    // 2号玩家下雨赢了1号玩家, 3号玩家刮风赢了2号玩家
+    d.scoreChangeHelper(2, []Loser{{uid: 1, score: 2}}, ScoreChangeTypeAnGang, 0)
+    d.scoreChangeHelper(3, []Loser{{uid: 2, score: 1}}, ScoreChangeTypeBaGang, 4)
+    before := map[int64]int{1: -2, 2: 1, 3: 1, 4: 0}
+
+    score, _ := d.players[0].maxTingScore()
+    score = d.maxScoreCutter(score)
+    max := d.maxScore()
+
+    desc := d.settleNoMoreTile()
+    expect := map[int64]int{
+        1: max + score, // 退还下雨 + 查花猪 + 查大叫
+        2: max - score, // 查花猪 - 被查大叫, 退还的刮风不能再次退还
+        3: -2 * max,    // 花猪赔付两个玩家
+        4: 0,           // 已经胡牌的玩家不参与结算
+    }
+    for uid, e := range expect {
+        if total := testTotal(d, uid); total != e {
+            t.Fatalf("uid %d, expect total %d, got %d", uid, e, total)
+        }
+        if total := testSnapshotTotal(d, uid); total != e-before[uid] {
+            t.Fatalf("uid %d, expect snapshot total %d, got %d", uid, e-before[uid], total)
+        }
+    }
+    if len(desc[3]) != 2 || desc[3][0] != "退税1" || desc[3][1] != "花猪" {
+        t.Fatalf("unexpected desc: %v", desc[3])
+    }
+}
+
+func TestRefundGang(t *testing.T) {
+    opts := &protocol.DeskOptions{Mode: ModeFours, MaxFan: 3}
+    d := newTestDesk(opts, testTiles(wuJiaoHand...), testTiles(wuJiaoHand...), testTiles(tingHand...), testTiles(tingHand...))
+
+    // 1号和2号玩家互相刮风下雨, 3号玩家下雨赢了所有人
+    d.scoreChangeHelper(2, []Loser{{uid: 1, score: 2}}, ScoreChangeTypeAnGang, 0)
+    d.scoreChangeHelper(1, []Loser{{uid: 2, score: 1}}, ScoreChangeTypeBaGang, 4)
+    d.scoreChangeHelper(3, []Loser{{uid: 1, score: 2}, {uid: 2, score: 2}, {uid: 4, score: 2}}, ScoreChangeTypeAnGang, 8)
+
+    refunds := d.refundGang([]*Player{d.players[0], d.players[1]})
+    if len(refunds) != 2 || refunds[1] != 1 || refunds[2] != 2 {
+        t.Fatalf("unexpected refunds: %v", refunds)
+    }
+
+    // 退税只退还自己赢的分, 输给其他玩家的分不变
+    expect := map[int64]int{1: -2, 2: -2, 3: 6, 4: -2}
+    for uid, e := range expect {
+        if total := testTotal(d, uid); total != e {
+            t.Fatalf("uid %d, expect total %d, got %d", uid, e, total)
+        }
+    }
+    if len(d.snapshot.HuScoreChanges) != 2 {
+        t.Fatalf("expect 2 score changes in snapshot, got %d", len(d.snapshot.HuScoreChanges))
+    }
+    // 退税和查叫赔付分开记录
+    for _, hsc := range d.snapshot.HuScoreChanges {
+        if hsc.HuPaiType != protocol.HuTypeTuiShui {
+            t.Fatalf("expect refund recorded as %d, got %d", protocol.HuTypeTuiShui, hsc.HuPaiType)
+        }
+    }
+}
+
+func TestChaJiao(t *testing.T) {
+    opts := &protocol.DeskOptions{Mode: ModeFours, MaxFan: 3}
+    d := newTestDesk(opts, testTiles(tingHand...), testTiles(wuJiaoHand...), testTiles(wuJiaoHand...), testTiles(tingHand...))
+    d.wonPlayers[4] = true
+
+    // 没有听牌的2号玩家下雨赢了1号玩家
+    d.scoreChangeHelper(2, []Loser{{uid: 1, score: 2}}, ScoreChangeTypeAnGang, 0)
+
+    score, _ := d.players[0].maxTingScore()
+    score = d.maxScoreCutter(score)
+
+    d.chaJiao()
+    expect := map[int64]int{1: 2 * score, 2: -score, 3: -score, 4: 0}
+    for uid, e := range expect {
+        if total := testTotal(d, uid); total != e {
+            t.Fatalf("uid %d, expect total %d, got %d", uid, e, total)
+        }
+    }
+    // 查叫赔付不是胡牌, 不记录胡牌
+    if len(d.huRecords) != 0 {
+        t.Fatalf("unexpected hu records: %v", d.huRecords)
+    }
+}
@@ -0,0 +1,139 @@
+package game
+
+import (
+    "sync/atomic"
+    "time"
+
+    "github.com/lonng/nano"
+    "github.com/lonng/nanoserver/pkg/async"
+    "github.com/lonng/nanoserver/pkg/constant"
+    "github.com/lonng/nanoserver/protocol"
+)
+
+// 停服流程:
+// 1. 不再创建和加入房间, 已经结束的牌局不再开始下一局
+// 2. 向所有在线玩家推送维护通知
+// 3. 等待进行中的牌局结束, 超时的牌局保留检查点, 重启后重新开始本局
+// 4. 关闭所有玩家的session, 写完检查点和异步任务
+
+const (
+    defaultDrainTimeout = 300 * time.Second // 默认等待牌局结束的最长时间
+    drainCheckInterval  = time.Second       // 检查牌局是否结束的间隔
+    flushTimeout        = 10 * time.Second  // 等待检查点和异步任务写完的最长时间
+)
+
+const maintenanceMessage = "服务器即将停服维护, 当前牌局结束后将暂停游戏"
+
+var (
+    draining     int32                 // 是否正在停服, 原子操作
+    drainTimeout = defaultDrainTimeout // 等待牌局结束的最长时间
+    stopped      = make(chan struct{}) // 停服完成后关闭
+)
+
+var (
+    maintenanceCreate = &protocol.CreateDeskResponse{Code: 30004, Error: maintenanceMessage}
+    maintenanceJoin   = &protocol.JoinDeskResponse{Code: errorCode, Error: maintenanceMessage}
+)
+
+func setupDrain(seconds int) {
+    if seconds > 0 {
+        drainTimeout = time.Duration(seconds) * time.Second
+    }
+}
+
+func isDraining() bool {
+    return atomic.LoadInt32(&draining) == 1
+}
+
+// WaitShutdown 等待游戏服务器停服完成, web服务器需要在游戏服务器写完数据以后才能关闭数据库
+func WaitShutdown() {
+    select {
+    case <-stopped:
+    case <-time.After(drainTimeout + 2*flushTimeout):
+        logger.Warn("等待游戏服务器停服超时")
+    }
+}
+
+// 在逻辑线程中执行并等待执行完成
+func invokeWait(fn func()) {
+    done := make(chan struct{})
+    nano.Invoke(func() {
+        defer close(done)
+        fn()
+    })
+    <-done
+}
+
+// 牌局是否正在进行中
+func (d *Desk) isPlaying() bool {
+    switch d.status() {
+    case constant.DeskStatusCreate,
+        constant.DeskStatusCleaned,
+        constant.DeskStatusInterruption,
+        constant.DeskStatusDestory:
+        return false
+    }
+    return true
+}
+
+// BeforeShutdown 停服前等待牌局结束, 在信号处理线程中执行, 此时逻辑线程仍在运行
+func (manager *DeskManager) BeforeShutdown() {
+    atomic.StoreInt32(&draining, 1)
+    deadline := time.Now().Add(drainTimeout)
+    logger.Infof("开始停服, 等待进行中的牌局结束, 最长等待时间: %s", drainTimeout)
+
+    invokeWait(func() {
+        defaultPlayerManager.group.Broadcast("onMaintenance", &protocol.MaintenanceNotice{
+            Message:  maintenanceMessage,
+            Deadline: deadline.Unix(),
+        })
+    })
+
+    for {
+        playing := 0
+        invokeWait(func() {
+            for _, d := range manager.desks {
+                if d.isPlaying() {
+                    playing++
+                }
+            }
+        })
+        if playing == 0 {
+            logger.Info("所有牌局已经结束")
+            break
+        }
+        if time.Now().After(deadline) {
+            logger.Warnf("等待牌局结束超时, 未结束的牌局数量: %d, 重启后从检查点恢复", playing)
+            break
+        }
+        time.Sleep(drainCheckInterval)
+    }
+
+    // 关闭所有玩家的连接
+    invokeWait(func() {
+        for _, p := range defaultPlayerManager.players {
+            if p.session != nil {
+                p.session.Close()
+            }
+        }
+    })
+}
+
+// Shutdown 写完检查点和异步任务
+func (manager *DeskManager) Shutdown() {
+    defer close(stopped)
+
+    done := make(chan struct{})
+    // 空房号排在所有已经加入的检查点之后
+    checkpoints.put("", func() { close(done) })
+    select {
+    case <-done:
+    case <-time.After(flushTimeout):
+        logger.Warn("等待检查点写入超时")
+    }
+
+    if !async.Wait(flushTimeout) {
+        logger.Warn("等待异步任务完成超时")
+    }
+    logger.Info("游戏服务器停服完成")
+}
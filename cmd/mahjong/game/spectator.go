@@ -0,0 +1,152 @@
+package game
+
+import (
+    "fmt"
+    "time"
+
+    "github.com/lonng/nano/session"
+    "github.com/lonng/nanoserver/db"
+    "github.com/lonng/nanoserver/pkg/errutil"
+    "github.com/lonng/nanoserver/pkg/room"
+    "github.com/lonng/nanoserver/pkg/watch"
+    "github.com/lonng/nanoserver/protocol"
+)
+
+// 观战: 观战者使用单独的组播通道, 只能收到出牌、碰杠吃胡、分数等公开数据, 看不到任何人的手牌,
+// 观战者不占用座位, 也不参与解散投票
+
+const (
+    maxWatchers   = 20  // 每个房间最多观战人数
+    maxWatchDelay = 300 // 观战最大延迟, 单位: 秒
+
+    spectatorViewer int64 = 0 // 观战者视角, 不是任何一个玩家
+)
+
+// 房间允许观战时创建观战分组
+func newWatchGroup(opts *protocol.DeskOptions) *watch.Group {
+    if !opts.Watch {
+        return nil
+    }
+    return watch.New(time.Duration(opts.WatchDelay)*time.Second, maxWatchers)
+}
+
+// 向牌桌上的玩家和观战者广播公开数据
+func (d *Desk) broadcast(route string, v interface{}) error {
+    if d.watchers != nil {
+        d.watchers.Broadcast(route, v)
+    }
+    return d.group.Broadcast(route, v)
+}
+
+func (d *Desk) watcherJoin(p *Player) error {
+    s := p.session
+    if err := d.watchers.Add(s); err != nil {
+        return err
+    }
+    p.watching = d
+    d.spectators[p.Uid()] = p
+    p.logger.Infof("玩家开始观战: 房号=%s 观战人数=%d", d.roomNo, d.watchers.Count())
+
+    // 进入时同步完整的牌桌数据, 和观战消息使用相同的延迟
+    d.watchers.Push(s, "onDeskBasicInfo", &protocol.DeskBasicInfo{
+        DeskID: d.roomNo.String(),
+        Title:  d.title(),
+        Desc:   d.desc(true),
+        Mode:   d.opts.Mode,
+    })
+    if d.latestEnter != nil {
+        d.watchers.Push(s, "onPlayerEnter", d.latestEnter)
+    }
+    if d.isPlaying() {
+        d.watchers.Push(s, "onWatchSync", d.syncDeskView(spectatorViewer))
+    }
+    return nil
+}
+
+func (d *Desk) watcherLeave(p *Player) {
+    if s := p.session; s != nil && d.watchers != nil {
+        d.watchers.Leave(s)
+    }
+    p.watching = nil
+    delete(d.spectators, p.Uid())
+    p.logger.Info("玩家退出观战")
+}
+
+// 房间解散时结束所有观战
+func (d *Desk) closeWatchers() {
+    if d.watchers == nil {
+        return
+    }
+    for _, p := range d.spectators {
+        p.watching = nil
+    }
+    d.spectators = map[int64]*Player{}
+    d.watchers.Close()
+}
+
+// 加入房间前退出观战
+func leaveWatching(s *session.Session) {
+    p, err := playerWithSession(s)
+    if err != nil || p.watching == nil {
+        return
+    }
+    p.watching.watcherLeave(p)
+}
+
+// 观战房间, 只能观战允许观战的房间, 俱乐部房间只有俱乐部成员可以观战
+func (manager *DeskManager) Watch(s *session.Session, data *protocol.WatchDeskRequest) error {
+    p, err := playerWithSession(s)
+    if err != nil {
+        return err
+    }
+    if p.desk != nil {
+        return s.Response(&protocol.WatchDeskResponse{Code: errorCode, Error: "你当前正在房间中"})
+    }
+
+    d, ok := manager.desk(room.Number(data.DeskNo))
+    if !ok || d.isDestroy() {
+        return s.Response(&protocol.WatchDeskResponse{Code: errutil.YXDeskNotFound, Error: deskNotFoundMessage})
+    }
+    if d.watchers == nil {
+        return s.Response(&protocol.WatchDeskResponse{Code: errorCode, Error: "当前房间不允许观战"})
+    }
+    if d.clubId > 0 && !db.IsClubMember(d.clubId, s.UID()) {
+        return s.Response(&protocol.WatchDeskResponse{
+            Code:  errorCode,
+            Error: fmt.Sprintf("当前房间是俱乐部[%d]专属房间，俱乐部成员才可观战", d.clubId),
+        })
+    }
+
+    // 切换观战的房间
+    if p.watching != nil && p.watching != d {
+        p.watching.watcherLeave(p)
+    }
+
+    if err := d.watcherJoin(p); err != nil {
+        msg := err.Error()
+        if err == watch.ErrWatchFull {
+            msg = "当前房间观战人数已满"
+        }
+        return s.Response(&protocol.WatchDeskResponse{Code: errorCode, Error: msg})
+    }
+
+    return s.Response(&protocol.WatchDeskResponse{
+        Delay: d.opts.WatchDelay,
+        TableInfo: protocol.TableInfo{
+            DeskNo:    d.roomNo.String(),
+            CreatedAt: d.createdAt,
+            Creator:   d.creator,
+            Title:     d.title(),
+            Desc:      d.desc(true),
+            Status:    d.status(),
+            Round:     d.round,
+            Mode:      d.opts.Mode,
+        },
+    })
+}
+
+// 退出观战
+func (manager *DeskManager) Unwatch(s *session.Session, _ []byte) error {
+    leaveWatching(s)
+    return s.Response(protocol.SuccessResponse)
+}
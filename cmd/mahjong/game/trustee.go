@@ -0,0 +1,143 @@
+package game
+
+import (
+    "sync/atomic"
+    "time"
+
+    "github.com/lonng/nanoserver/protocol"
+    "github.com/spf13/viper"
+)
+
+// 托管: 玩家操作超时后由服务器代替玩家操作, 连续超时多次后进入托管状态,
+// 托管状态下服务器直接代替玩家操作, 直到玩家主动取消托管
+
+var (
+    chuPaiTimeout    = 20 * time.Second // 出牌超时
+    huTimeout        = 15 * time.Second // 胡牌选择超时
+    pengGangTimeout  = 15 * time.Second // 碰杠选择超时
+    exchangeTimeout  = 20 * time.Second // 换三张选择超时
+    trusteeDelay     = time.Second      // 托管状态下的操作延时, 保证客户端动画正常播放
+    trusteeThreshold = 2                // 连续超时多少次进入托管
+)
+
+// 读取托管配置, 未配置时使用默认值
+func setupTrustee() {
+    seconds := func(key string, deflt time.Duration) time.Duration {
+        if v := viper.GetInt(key); v > 0 {
+            return time.Duration(v) * time.Second
+        }
+        return deflt
+    }
+
+    chuPaiTimeout = seconds("trustee.chupai", chuPaiTimeout)
+    huTimeout = seconds("trustee.hu", huTimeout)
+    pengGangTimeout = seconds("trustee.penggang", pengGangTimeout)
+    exchangeTimeout = seconds("trustee.exchange", exchangeTimeout)
+    if n := viper.GetInt("trustee.threshold"); n > 0 {
+        trusteeThreshold = n
+    }
+
+    logger.Infof("托管配置: 出牌超时=%s 胡牌超时=%s 碰杠超时=%s 换三张超时=%s 托管次数=%d",
+        chuPaiTimeout, huTimeout, pengGangTimeout, exchangeTimeout, trusteeThreshold)
+}
+
+func (p *Player) isTrustee() bool {
+    return atomic.LoadInt32(&p.trustee) == 1
+}
+
+func (p *Player) setTrustee(trustee bool) {
+    var v int32
+    if trustee {
+        v = 1
+    }
+    if atomic.SwapInt32(&p.trustee, v) == v {
+        return
+    }
+    if !trustee {
+        atomic.StoreInt32(&p.timeoutCount, 0)
+    }
+
+    p.logger.Infof("玩家托管状态变化: 托管=%t", trustee)
+    if d := p.desk; d != nil && d.group != nil {
+        d.broadcast("onTrustee", &protocol.TrusteeStatus{Uid: p.Uid(), Trustee: trustee})
+    }
+}
+
+// 等待玩家操作, 超时或托管时返回auto, 第二个返回值表示房间是否已经解散
+func (p *Player) waitOperation(timeout time.Duration, auto *protocol.OpChoosed) (*protocol.OpChoosed, bool) {
+    if p.robot != nil {
+        return p.robot.operate(p, auto)
+    }
+
+    if p.isTrustee() {
+        timeout = trusteeDelay
+    }
+
+    timer := time.NewTimer(timeout)
+    defer timer.Stop()
+
+    select {
+    case op, ok := <-p.chOperation:
+        if !ok {
+            return nil, true
+        }
+        atomic.StoreInt32(&p.timeoutCount, 0)
+        return op, false
+
+    case <-timer.C:
+        // 丢弃超时后才到达的操作
+        select {
+        case <-p.chOperation:
+        default:
+        }
+
+        if !p.isTrustee() {
+            count := atomic.AddInt32(&p.timeoutCount, 1)
+            p.logger.Infof("玩家操作超时, 服务器代替操作: 超时次数=%d 操作=%+v", count, auto)
+            if int(count) >= trusteeThreshold {
+                p.setTrustee(true)
+            }
+        }
+        return auto, false
+
+    case <-p.desk.die:
+        return nil, true
+    }
+}
+
+// 托管出牌: 手中有缺的牌时必须先打缺, 否则打最新上手的牌, 碰牌后没有新上手的牌则打最后一张
+func (p *Player) autoDiscard() int {
+    hand := p.handTiles()
+    if len(hand) < 1 {
+        return illegalTile
+    }
+
+    if que := p.ctx.Que; que > 0 {
+        for i := len(hand) - 1; i >= 0; i-- {
+            if hand[i].Suit+1 == que {
+                return hand[i].Id
+            }
+        }
+    }
+
+    for _, t := range hand {
+        if t.Id == p.ctx.NewDrawingID {
+            return t.Id
+        }
+    }
+
+    return hand[len(hand)-1].Id
+}
+
+func autoChuPai(p *Player) *protocol.OpChoosed {
+    return &protocol.OpChoosed{Type: protocol.OptypeChu, TileID: p.autoDiscard()}
+}
+
+func autoHu(tileID int) *protocol.OpChoosed {
+    return &protocol.OpChoosed{Type: protocol.OptypeHu, TileID: tileID}
+}
+
+func autoPass(tileID int) *protocol.OpChoosed {
+    return &protocol.OpChoosed{Type: protocol.OptypePass, TileID: tileID}
+}
+
@@ -15,6 +15,11 @@ type scoreChangeInfo struct {
 }
 
 func (s *scoreChangeInfo) String() string {
+    // 查花猪、查大叫没有对应的牌
+    tile := "无"
+    if s.tileID != illegalTile {
+        tile = mahjong.TileFromID(s.tileID).String()
+    }
     return fmt.Sprintf("Uid=%d, Score=%d, TileId=%s, Type=%s",
-        s.uid, s.score, mahjong.TileFromID(s.tileID).String(), s.typ.String())
+        s.uid, s.score, tile, s.typ.String())
 }
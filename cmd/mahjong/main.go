@@ -42,6 +42,28 @@ func main() {
     }
 
     app.Action = serve
+    app.Commands = []cli.Command{
+        {
+            Name:   "reconcile",
+            Usage:  "compare the payment statement with trades",
+            Action: reconcile,
+            Flags: []cli.Flag{
+                cli.StringFlag{
+                    Name:  "platform, p",
+                    Value: "wechat",
+                    Usage: "payment platform of the statement",
+                },
+                cli.StringFlag{
+                    Name:  "file, f",
+                    Usage: "statement `FILE` downloaded from the payment platform",
+                },
+                cli.StringFlag{
+                    Name:  "date, d",
+                    Usage: "statement date, e.g. 20061018",
+                },
+            },
+        },
+    }
     err := app.Run(os.Args)
     if err != nil {
         log.Fatal(err)
@@ -52,16 +74,7 @@ func serve(c *cli.Context) error {
     nano.EnableDebug()
 
     //c.Args().Get(0) 可以获得运行参数
-    //viper从命令行标志 环境变量 本地配置文件 远程配置系统etcd等读取配置信息
-    viper.SetConfigType("toml")
-    viper.SetConfigFile(c.String("config"))
-    viper.ReadInConfig()
-
-    //设置日志的输出格式 logrus.JSONFormatter{}和logrus.TextFormatter{}
-    log.SetFormatter(&log.TextFormatter{DisableColors: true})
-    if viper.GetBool("core.debug") {
-        log.SetLevel(log.DebugLevel) //设置最低的日志级别
-    }
+    loadConfig(c.String("config"))
 
     //运行时是否包含参数--cpuprofile
     if c.Bool("cpuprofile") {
@@ -83,3 +96,25 @@ func serve(c *cli.Context) error {
     wg.Wait()
     return nil
 }
+
+func loadConfig(file string) {
+    //viper从命令行标志 环境变量 本地配置文件 远程配置系统etcd等读取配置信息
+    viper.SetConfigType("toml")
+    viper.SetConfigFile(file)
+    viper.ReadInConfig()
+
+    //设置日志的输出格式 logrus.JSONFormatter{}和logrus.TextFormatter{}
+    log.SetFormatter(&log.TextFormatter{DisableColors: true})
+    if viper.GetBool("core.debug") {
+        log.SetLevel(log.DebugLevel) //设置最低的日志级别
+    }
+}
+
+// 支付对账: mahjong reconcile -p wechat -f statement.csv -d 20061018
+func reconcile(c *cli.Context) error {
+    loadConfig(c.GlobalString("config"))
+    if c.String("file") == "" || c.String("date") == "" {
+        return cli.ShowCommandHelp(c, "reconcile")
+    }
+    return web.ReconcileStatement(c.String("platform"), c.String("file"), c.String("date"))
+}
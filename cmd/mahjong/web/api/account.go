@@ -0,0 +1,166 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/security"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+const minPasswordLength = 6
+
+// 账号不能是手机号格式, 否则密码登录时无法区分账号和手机号
+func validateAccountName(name string) bool {
+	return security.ValidateName(name) && !security.ValidatePhone(name)
+}
+
+// 注册账号: 手机号注册需要验证码, 账号可选; 账号注册只需要账号和密码. 注册成功后直接登录
+func registerHandler(r *http.Request, data *protocol.RegisterUserRequest) (*protocol.LoginResponse, error) {
+	logger.Infof("注册账号: Type=%d, Name=%s, Phone=%s, AppID=%s", data.Type, data.Name, data.Phone, data.AppID)
+	if len(data.Password) < minPasswordLength {
+		return nil, errutil.ErrIllegalParameter
+	}
+	if data.Name != "" && !validateAccountName(data.Name) {
+		return nil, errutil.ErrIllegalName
+	}
+
+	switch data.Type {
+	case protocol.RegTypePhone:
+		if !security.ValidatePhone(data.Phone) {
+			return nil, errutil.ErrIllegalParameter
+		}
+		if err := checkVerification(data.VerifyID, data.VerifyCode, data.Phone, protocol.VerificationTypeRegister); err != nil {
+			return nil, err
+		}
+	case protocol.RegTypeAccount:
+		if data.Name == "" {
+			return nil, errutil.ErrIllegalName
+		}
+		// 绑定手机号需要验证码
+		data.Phone = ""
+	default:
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	hash, salt := algoutil.PasswordHash(data.Password)
+	u := &model.User{
+		Name:     data.Name,
+		Phone:    data.Phone,
+		Algo:     db.PasswordAlgoSHA1,
+		Hash:     hash,
+		Salt:     salt,
+		Status:   db.StatusNormal,
+		IsOnline: db.UserOffline,
+		Role:     db.RoleTypeAccount,
+		Coin:     defaultCoin,
+	}
+	if err := db.RegisterAccount(u); err != nil {
+		return nil, err
+	}
+	if data.Type == protocol.RegTypePhone {
+		consumeVerification(data.VerifyID)
+	}
+
+	db.RegisterUserLog(u, data.Device, data.AppID, data.ChannelID, data.Type) //注册记录
+	return accountLogin(r, u, data.Device, data.AppID, data.ChannelID)
+}
+
+// 账号或者手机号密码登录, 用户不存在和密码错误返回相同的错误
+func passwordLoginHandler(r *http.Request, data *protocol.PasswordLoginRequest) (*protocol.LoginResponse, error) {
+	logger.Infof("密码登录: Name=%s, AppID=%s", data.Name, data.AppID)
+
+	var (
+		u   *model.User
+		err error
+	)
+	if security.ValidatePhone(data.Name) {
+		u, err = db.QueryUserByPhone(data.Name)
+	} else {
+		u, err = db.QueryUserByName(data.Name)
+	}
+	if err == errutil.ErrUserNotFound || err == errutil.ErrUserNameNotFound {
+		return nil, errutil.ErrWrongPassword
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if u.Hash == "" || !algoutil.VerifyPassword(data.Password, u.Salt, u.Hash) {
+		return nil, errutil.ErrWrongPassword
+	}
+	if u.Status != db.StatusNormal {
+		return nil, errutil.ErrPermissionDenied
+	}
+
+	return accountLogin(r, u, data.Device, data.AppID, data.ChannelID)
+}
+
+// 使用手机验证码重置密码, 之前签发的登录凭证全部失效
+func resetPasswordHandler(data *protocol.ResetPasswordRequest) (*protocol.StringMessage, error) {
+	if !security.ValidatePhone(data.Phone) || len(data.Password) < minPasswordLength {
+		return nil, errutil.ErrIllegalParameter
+	}
+	if err := checkVerification(data.VerifyID, data.VerifyCode, data.Phone, protocol.VerificationTypeFindPW); err != nil {
+		return nil, err
+	}
+
+	hash, salt := algoutil.PasswordHash(data.Password)
+	u, err := db.ResetPassword(data.Phone, db.PasswordAlgoSHA1, hash, salt)
+	if err != nil {
+		return nil, err
+	}
+	consumeVerification(data.VerifyID)
+
+	logger.Infof("重置密码: Uid=%d, Phone=%s", u.Id, data.Phone)
+	onTokenRevoked(u.Id)
+	return protocol.SuccessMessage, nil
+}
+
+func accountLogin(r *http.Request, u *model.User, device protocol.Device, appID, channelID string) (*protocol.LoginResponse, error) {
+	name := u.Name
+	if name == "" {
+		name = fmt.Sprintf("U%d", u.Id)
+	}
+	return loginResponse(r, u, name, protocol.GuestHeadUrl, protocol.SexTypeMale, device, appID, channelID)
+}
+
+// 签发登录凭证并插入登录记录
+func loginResponse(r *http.Request, u *model.User, name, headUrl string, sex int, device protocol.Device, appID, channelID string) (*protocol.LoginResponse, error) {
+	checkSession(u.Id)
+
+	token, expire, err := issueToken(u, device.IMEI)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &protocol.LoginResponse{
+		Name:     name,
+		Uid:      u.Id,
+		HeadUrl:  headUrl,
+		Sex:      sex,
+		IP:       host,
+		Port:     port,
+		FangKa:   u.Coin,
+		PlayerIP: ip(r.RemoteAddr),
+		Config:   config,
+		Messages: messages,
+		ClubList: clubs(u.Id),
+		Debug:    0,
+		Token:    token,
+		ExpireAt: expire,
+	}
+
+	// 插入登陆记录
+	d := protocol.Device{
+		IP:     ip(r.RemoteAddr),
+		Remote: r.RemoteAddr,
+	}
+	db.InsertLoginLog(u.Id, d, appID, channelID)
+
+	return resp, nil
+}
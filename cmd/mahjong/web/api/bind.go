@@ -0,0 +1,114 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/security"
+	"github.com/lonng/nanoserver/protocol"
+	"gopkg.in/chanxuehong/wechat.v2/open/oauth2"
+)
+
+// 游客绑定微信或者手机号, 绑定后游客的房卡、俱乐部和战绩都保留. 微信或者手机号已经有自己的用户时,
+// merge为true则把游客合并到该用户并登录该用户, 否则返回错误
+func bindHandler(r *http.Request, data *protocol.BindRequest) (*protocol.LoginResponse, error) {
+	guest, _, err := db.VerifyToken(data.Token, tokenSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("游客绑定: Uid=%d, Type=%s, Merge=%t", guest.Id, data.Type, data.Merge)
+	switch data.Type {
+	case protocol.BindTypeWechat:
+		return bindWechat(r, guest, data)
+	case protocol.BindTypePhone:
+		return bindPhone(r, guest, data)
+	default:
+		return nil, errutil.ErrIllegalParameter
+	}
+}
+
+func bindWechat(r *http.Request, guest *model.User, data *protocol.BindRequest) (*protocol.LoginResponse, error) {
+	userInfo, err := oauth2.GetUserInfo(data.AccessToken, data.OpenID, "zh_CN", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	thirdUser := &model.ThirdAccount{
+		ThirdAccount: userInfo.OpenId,
+		ThirdName:    filterEmoji(userInfo.Nickname),
+		Platform:     data.Platform,
+		HeadUrl:      userInfo.HeadImageURL,
+		Sex:          userInfo.Sex,
+	}
+
+	u := guest
+	err = db.BindThirdAccount(guest.Id, thirdUser)
+	if err == errutil.ErrAccountExists && data.Merge {
+		var exist *model.ThirdAccount
+		if exist, err = db.QueryThirdAccount(thirdUser.ThirdAccount, thirdUser.Platform); err == nil {
+			u, err = mergeGuest(guest, exist.Uid, data.AppID)
+			// 更新微信昵称和头像
+			thirdUser.Id, thirdUser.Uid = exist.Id, exist.Uid
+			db.UpdateThirdAccount(thirdUser)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return loginResponse(r, u, thirdUser.ThirdName, thirdUser.HeadUrl, thirdUser.Sex, data.Device, data.AppID, data.ChannelID)
+}
+
+func bindPhone(r *http.Request, guest *model.User, data *protocol.BindRequest) (*protocol.LoginResponse, error) {
+	if !security.ValidatePhone(data.Phone) || len(data.Password) < minPasswordLength {
+		return nil, errutil.ErrIllegalParameter
+	}
+	if err := checkVerification(data.VerifyID, data.VerifyCode, data.Phone, protocol.VerificationTypeBind); err != nil {
+		return nil, err
+	}
+
+	u := guest
+	hash, salt := algoutil.PasswordHash(data.Password)
+	err := db.BindPhone(guest.Id, data.Phone, db.PasswordAlgoSHA1, hash, salt)
+	if err == errutil.ErrPhoneExists && data.Merge {
+		// 手机号已经注册, 验证码证明了手机号的所有权, 保留原来的密码
+		var exist *model.User
+		if exist, err = db.QueryUserByPhone(data.Phone); err == nil {
+			u, err = mergeGuest(guest, exist.Id, data.AppID)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	consumeVerification(data.VerifyID)
+
+	if u.Id == guest.Id {
+		// 重新查询绑定后的手机号
+		if u, err = db.QueryUser(guest.Id); err != nil {
+			return nil, err
+		}
+	}
+	return accountLogin(r, u, data.Device, data.AppID, data.ChannelID)
+}
+
+// 把游客合并到微信或者手机号所属的用户, 返回合并后的用户
+func mergeGuest(guest *model.User, uid int64, appID string) (*model.User, error) {
+	if err := db.MergeGuest(guest.Id, uid, appID); err != nil {
+		return nil, err
+	}
+	logger.Infof("游客合并: Guest=%d, Uid=%d, Coin=%d", guest.Id, uid, guest.Coin)
+
+	// 游客的凭证已经注销, 踢掉在线的连接
+	onTokenRevoked(guest.Id)
+
+	u, err := db.QueryUser(uid)
+	if err != nil {
+		return nil, err
+	}
+	onBalanceChanged(u.Id, u.Coin)
+	return u, nil
+}
@@ -3,9 +3,12 @@ package api
 import (
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/lonng/nanoserver/cmd/mahjong/game/replay"
 	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/pkg/serialize/protobuf"
 	"github.com/lonng/nanoserver/pkg/whitelist"
 	"github.com/lonng/nex"
 
@@ -17,15 +20,41 @@ import (
 
 const (
 	format = "01-02 15:04:05"
+
+	protobufContentType = "application/x-protobuf"
 )
 
 func MakeHistoryService() http.Handler {
 	router := mux.NewRouter()
 	router.Handle("/v1/history/lite/{desk_id}", nex.Handler(historyList)).Methods("GET") //获取历史列表(lite),参数为deskid
-	router.Handle("/v1/history/{id}", nex.Handler(historyByID)).Methods("GET")           //获取历史记录
+	router.Handle("/v1/history/{id}", protobufOr(historyByID)).Methods("GET")            //获取历史记录
+	router.Handle("/v1/history/{id}/replay", protobufOr(historyReplay)).Methods("GET")   //获取历史回放, 每一步操作后的牌桌状态
 	return router
 }
 
+// 请求头Accept包含application/x-protobuf时使用protobuf编码响应, 否则使用JSON
+func protobufOr(fn func(r *http.Request) (interface{}, error)) http.Handler {
+	h := nex.Handler(fn)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.Contains(r.Header.Get("Accept"), protobufContentType) {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		v, err := fn(r)
+		if err != nil {
+			v = &protocol.ErrorResponse{Code: errutil.Code(err), Error: err.Error()}
+		}
+		data, err := protobuf.Marshal(v)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", protobufContentType)
+		w.Write(data)
+	})
+}
+
 func HistoryByID(id int64) (*protocol.History, error) {
 	p, err := db.QueryHistory(id)
 	if err != nil {
@@ -53,6 +82,19 @@ func HistoryByID(id int64) (*protocol.History, error) {
 
 }
 
+// 根据历史快照重建每一步的牌桌状态
+func HistoryReplay(id int64) ([]*protocol.ReplayFrame, error) {
+	h, err := db.QueryHistory(id)
+	if err != nil {
+		return nil, err
+	}
+	r, err := replay.Load(h)
+	if err != nil {
+		return nil, err
+	}
+	return r.Frames()
+}
+
 func HistoryLiteList(deskId int64) ([]protocol.HistoryLite, int64, error) {
 	//默认全部
 	ps, total, err := db.QueryHistoriesByDeskID(deskId)
@@ -158,3 +200,25 @@ func historyByID(r *http.Request) (interface{}, error) {
 	}
 	return protocol.HistoryByIDResponse{Data: h}, nil
 }
+
+func historyReplay(r *http.Request) (interface{}, error) {
+	if !whitelist.VerifyIP(r.RemoteAddr) {
+		return nil, errutil.ErrPermissionDenied
+	}
+	vars := mux.Vars(r)
+	idStr, ok := vars["id"]
+	if !ok || idStr == "" {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 0)
+	if err != nil {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	frames, err := HistoryReplay(id)
+	if err != nil {
+		return nil, err
+	}
+	return protocol.HistoryReplayResponse{Data: frames}, nil
+}
@@ -75,6 +75,12 @@ func MakeLoginService() http.Handler {
 		config.Heartbeat = 5
 	}
 
+	// 登录凭证
+	setupToken()
+
+	// 短信验证码
+	setupVerification()
+
 	messages = viper.GetStringSlice("broadcast.message")
 	logger.Debugf("广播消息: %v", messages)
 
@@ -84,10 +90,17 @@ func MakeLoginService() http.Handler {
 	logger.Infof("是否强制更新: %t", config.ForceUpdate)
 
 	router := mux.NewRouter()
-	router.Handle("/v1/user/login/query", nex.Handler(queryHandler)).Methods("POST")        //三方登录
-	router.Handle("/v1/user/login/3rd", nex.Handler(thirdUserLoginHandler)).Methods("POST") //三方登录
-	router.Handle("/v1/user/login/guest", nex.Handler(guestLoginHandler)).Methods("POST")   //游客登录
-	router.Handle("/v1/user/club", nex.Handler(clubListHandler)).Methods("GET")             //获取俱乐部列表
+	router.Handle("/v1/user/login/query", nex.Handler(queryHandler)).Methods("POST")            //三方登录
+	router.Handle("/v1/user/login/3rd", nex.Handler(thirdUserLoginHandler)).Methods("POST")     //三方登录
+	router.Handle("/v1/user/login/guest", nex.Handler(guestLoginHandler)).Methods("POST")       //游客登录
+	router.Handle("/v1/user/login/password", nex.Handler(passwordLoginHandler)).Methods("POST") //密码登录
+	router.Handle("/v1/user/register", nex.Handler(registerHandler)).Methods("POST")            //注册账号
+	router.Handle("/v1/user/verification", nex.Handler(verificationHandler)).Methods("POST")    //获取短信验证码
+	router.Handle("/v1/user/password/reset", nex.Handler(resetPasswordHandler)).Methods("POST") //重置密码
+	router.Handle("/v1/user/bind", nex.Handler(bindHandler)).Methods("POST")                    //游客绑定微信或者手机号
+	router.Handle("/v1/user/token/refresh", nex.Handler(refreshTokenHandler)).Methods("POST")   //刷新登录凭证
+	router.Handle("/v1/user/token/revoke", nex.Handler(revokeTokenHandler)).Methods("POST")     //注销登录凭证
+	router.Handle("/v1/user/club", nex.Handler(clubListHandler)).Methods("GET")                 //获取俱乐部列表
 	return router
 }
 
@@ -130,6 +143,10 @@ func clubs(uid int64) []protocol.ClubItem {
 	if err != nil {
 		return []protocol.ClubItem{}
 	}
+	roles, err := db.ClubRoles(uid)
+	if err != nil {
+		return []protocol.ClubItem{}
+	}
 
 	ret := make([]protocol.ClubItem, len(list))
 	for i := range list {
@@ -139,6 +156,7 @@ func clubs(uid int64) []protocol.ClubItem {
 			Desc:      list[i].Desc,
 			Member:    list[i].Member,
 			MaxMember: list[i].MaxMember,
+			Role:      roles[list[i].ClubId],
 		}
 	}
 	return ret
@@ -207,6 +225,11 @@ func thirdUserLoginHandler(r *http.Request, data *protocol.ThirdUserLoginRequest
 
 	checkSession(u.Id)
 
+	token, expire, err := issueToken(u, data.Device.IMEI)
+	if err != nil {
+		return nil, err
+	}
+
 	resp := &protocol.LoginResponse{
 		Name:     thirdUser.ThirdName,
 		Uid:      u.Id, //注意此处是id而非uid
@@ -220,6 +243,8 @@ func thirdUserLoginHandler(r *http.Request, data *protocol.ThirdUserLoginRequest
 		Messages: messages,
 		ClubList: clubs(u.Id),
 		Debug:    0, //u.Debug,
+		Token:    token,
+		ExpireAt: expire,
 	}
 
 	// 插入登陆记录
@@ -238,6 +263,10 @@ func guestLoginHandler(r *http.Request, data *protocol.LoginRequest) (*protocol.
 	logger.Infof("游客登录IEMEI: %s", data.Device.IMEI)
 
 	user, err := db.QueryGuestUser(data.AppID, data.Device.IMEI)
+	if err == nil && user.Status == db.StatusBound {
+		// 游客已经合并到其他账号
+		return nil, errutil.ErrAccountBound
+	}
 	if err != nil {
 		// 生成一个新用户
 		user = &model.User{
@@ -257,9 +286,14 @@ func guestLoginHandler(r *http.Request, data *protocol.LoginRequest) (*protocol.
 
 	checkSession(user.Id)
 
+	token, expire, err := issueToken(user, data.Device.IMEI)
+	if err != nil {
+		return nil, err
+	}
+
 	resp := &protocol.LoginResponse{
 		Uid:      user.Id,
-		HeadUrl:  "http://wx.qlogo.cn/mmopen/s962LEwpLxhQSOnarDnceXjSxVGaibMRsvRM4EIWic0U6fQdkpqz4Vr8XS8D81QKfyYuwjwm2M2ibsFY8mia8ic51ww/0",
+		HeadUrl:  protocol.GuestHeadUrl,
 		Sex:      1,
 		IP:       host,
 		Port:     port,
@@ -269,6 +303,8 @@ func guestLoginHandler(r *http.Request, data *protocol.LoginRequest) (*protocol.
 		Messages: messages,
 		ClubList: clubs(user.Id),
 		Debug:    0, //user.Debug,
+		Token:    token,
+		ExpireAt: expire,
 	}
 	resp.Name = fmt.Sprintf("G%d", resp.Uid)
 
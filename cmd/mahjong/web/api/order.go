@@ -1,8 +1,6 @@
 package api
 
 import (
-	"encoding/xml"
-	"io/ioutil"
 	"net/http"
 	"strconv"
 	"strings"
@@ -14,7 +12,7 @@ import (
 	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nex"
 	"github.com/pborman/uuid"
-	"golang.org/x/net/context"
+	"github.com/spf13/viper"
 
 	"github.com/lonng/nanoserver/pkg/errutil"
 	"github.com/lonng/nanoserver/pkg/whitelist"
@@ -22,14 +20,48 @@ import (
 )
 
 func MakeOrderService() http.Handler {
+	// 没有配置时只启用微信支付
+	platforms := viper.GetStringSlice("payment.platforms")
+	if len(platforms) == 0 {
+		platforms = []string{provider.PlatformWechat}
+	}
+	provider.Setup(platforms)
+
 	router := mux.NewRouter()
-	router.Handle("/v1/order/console/", nex.Handler(orderList)).Methods("GET")            //订单列表
-	router.Handle("/v1/order/", nex.Handler(createOrder)).Methods("GET")                  //创建订单
-	router.Handle("/v1/order/notify/wechat", nex.Handler(wechatCallback)).Methods("POST") //微信订单回调
+	router.Handle("/v1/order/products", nex.Handler(productList)).Methods("GET")    //商品列表
+	router.Handle("/v1/order/console/", nex.Handler(orderList)).Methods("GET")      //订单列表
+	router.Handle("/v1/order/query", nex.Handler(queryOrder)).Methods("GET")        //查询订单状态
+	router.Handle("/v1/order/", nex.Handler(createOrder)).Methods("GET")            //创建订单
+	router.HandleFunc("/v1/order/notify/{platform}", notifyHandler).Methods("POST") //支付平台回调
 	return router
 }
 
+// SetupProducts 把配置中的商品写入商品目录
+func SetupProducts() {
+	products := []model.Product{}
+	if err := viper.UnmarshalKey("products", &products); err != nil {
+		logger.Fatalf("商品配置错误: %v", err)
+	}
+	if err := db.SyncProducts(products); err != nil {
+		logger.Fatalf("同步商品目录失败: %v", err)
+	}
+}
+
 func CreateOrder(r *protocol.CreateOrderRequest) (interface{}, error) {
+	payment, err := provider.Lookup(r.Platform)
+	if err != nil {
+		return nil, err
+	}
+
+	product, err := db.QueryProduct(r.Sku)
+	if err != nil {
+		return nil, err
+	}
+	if !db.ProductAvailable(product, r.ChannelID) {
+		return nil, errutil.ErrProductionNotFound
+	}
+
+	// 价格和房卡数量只以商品目录为准, 不使用客户端传入的值
 	order := &model.Order{
 		OrderId:      strings.Replace(uuid.New(), "-", "", -1),
 		AppId:        r.AppID,
@@ -37,8 +69,10 @@ func CreateOrder(r *protocol.CreateOrderRequest) (interface{}, error) {
 		ChannelId:    r.ChannelID,
 		PayPlatform:  r.Platform,
 		Extra:        r.Extra,
-		ProductName:  r.ProductionName,
-		ProductCount: r.ProductCount,
+		Money:        product.Price,
+		ProductId:    product.Sku,
+		ProductName:  product.Name,
+		ProductCount: product.Coin + product.Bonus,
 		CreatedAt:    time.Now().Unix(),
 		Status:       db.OrderStatusCreated,
 		Remote:       r.Device.Remote,
@@ -48,13 +82,14 @@ func CreateOrder(r *protocol.CreateOrderRequest) (interface{}, error) {
 		Os:           r.Device.OS,
 	}
 
-	resp, err := provider.Wechat.CreateOrderResponse(order)
-	if err != nil {
+	// 先保存订单, 支付通知可能比下单接口先返回, 下单失败的订单会过期
+	if err := db.InsertOrder(order); err != nil {
 		logger.Error(err.Error())
 		return nil, err
 	}
 
-	if err := db.InsertOrder(order); err != nil {
+	resp, err := payment.CreateOrderResponse(order)
+	if err != nil {
 		logger.Error(err.Error())
 		return nil, err
 	}
@@ -66,10 +101,6 @@ func createOrder(r *http.Request) (interface{}, error) {
 	if err := r.ParseForm(); err != nil {
 		return nil, err
 	}
-	count, err := strconv.Atoi(strings.TrimSpace(r.Form.Get("count")))
-	if err != nil {
-		return nil, err
-	}
 	uid, err := strconv.ParseInt(strings.TrimSpace(r.Form.Get("uid")), 10, 64)
 	if err != nil {
 		return nil, err
@@ -78,25 +109,44 @@ func createOrder(r *http.Request) (interface{}, error) {
 	channelId := strings.TrimSpace(r.Form.Get("channelId"))
 	platform := strings.TrimSpace(r.Form.Get("platform"))
 	extra := strings.TrimSpace(r.Form.Get("extra"))
-	name := strings.TrimSpace(r.Form.Get("name"))
-	if appId == "" || channelId == "" || platform == "" || count == 0 || name == "" {
+	sku := strings.TrimSpace(r.Form.Get("sku"))
+	if appId == "" || channelId == "" || platform == "" || sku == "" {
 		return nil, errutil.ErrIllegalParameter
 	}
 
 	request := &protocol.CreateOrderRequest{
-		AppID:          appId,
-		ChannelID:      channelId,
-		Platform:       platform,
-		ProductionName: name,
-		ProductCount:   count,
-		Extra:          extra,
-		Uid:            uid,
-		Device:         protocol.Device{Remote: r.RemoteAddr},
+		AppID:     appId,
+		ChannelID: channelId,
+		Platform:  platform,
+		Sku:       sku,
+		Extra:     extra,
+		Uid:       uid,
+		Device:    protocol.Device{Remote: r.RemoteAddr},
 	}
 
 	return CreateOrder(request)
 }
 
+//商品列表
+func productList(form *nex.Form) (*protocol.ProductListResponse, error) {
+	list, err := db.ProductList(form.Get("channelId"))
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]protocol.ProductInfo, len(list))
+	for i, p := range list {
+		result[i] = protocol.ProductInfo{
+			Sku:   p.Sku,
+			Name:  p.Name,
+			Price: p.Price,
+			Coin:  p.Coin,
+			Bonus: p.Bonus,
+		}
+	}
+	return &protocol.ProductListResponse{Data: result}, nil
+}
+
 func TradeList(r *protocol.TradeListRequest) ([]protocol.TradeInfo, int, error) {
 	if r == nil {
 		return nil, 0, errutil.ErrIllegalParameter
@@ -217,47 +267,83 @@ func orderList(r *http.Request, form *nex.Form) (*protocol.OrderListResponse, er
 	return &protocol.OrderListResponse{Data: list, Total: total}, nil
 }
 
-func WechatNotify(r *protocol.WechatOrderCallbackRequest) (resp interface{}, err error) {
-	var trade *model.Trade
-	var order *model.Order
-	if trade, resp, err = provider.Wechat.Notify(r); err != nil {
-		logger.Error(err.Error())
-		return nil, err
+// Notify 处理支付平台的支付通知, 返回需要响应给支付平台的内容
+func Notify(platform string, r *http.Request) (string, error) {
+	payment, err := provider.Lookup(platform)
+	if err != nil {
+		return "", err
 	}
 
-	if order, err = db.QueryOrder(trade.OrderId); err != nil {
-		logger.Error(err.Error())
-		return nil, err
+	n, err := payment.Notify(r)
+	if err != nil {
+		return "", err
+	}
+	if err := settle(platform, n); err != nil {
+		return "", err
 	}
+	return n.Reply, nil
+}
 
-	if err := db.InsertTrade(trade); err != nil {
-		//如果是重复通知,直接忽略之
-		if err == errutil.ErrTradeExisted {
-			return resp, nil
+// 根据支付结果修改订单, 交易记录、订单状态和房卡在同一个事务中修改, 重复的结果直接返回成功
+func settle(platform string, n *provider.Notification) error {
+	switch n.Result {
+	case provider.PayResultFailed:
+		if _, err := db.TransitOrder(n.OrderId, db.OrderStatusFailed); err != nil && err != errutil.ErrIllegalOrderStatus {
+			return err
+		}
+	case provider.PayResultPaid:
+		if _, err := db.FulfilOrder(n.Trade, n.Fee); err != nil && err != errutil.ErrTradeExisted {
+			return err
+		}
+	case provider.PayResultRefunded:
+		refund, l, err := db.ProviderRefund(n.OrderId, n.Refund.PayRefundId, n.Refund.Fee, platform)
+		if err != nil {
+			return err
+		}
+		if l != nil {
+			logger.Infof("支付平台退款: OrderId=%s, RefundId=%s, Coin=%d, Debt=%d", refund.OrderId, refund.RefundId, refund.Coin, refund.Debt)
+			onBalanceChanged(refund.Uid, l.Balance)
 		}
-
-		logger.Error(err.Error())
-		return nil, err
 	}
+	return nil
+}
 
-	if err := db.UserAddCoin(order.Uid, int64(10)); err != nil {
-		logger.Error(err.Error())
-		return nil, err
+// 支付通知的响应格式由支付平台决定, 不使用nex
+func notifyHandler(w http.ResponseWriter, r *http.Request) {
+	platform := mux.Vars(r)["platform"]
+	reply, err := Notify(platform, r)
+	if err != nil {
+		logger.Errorf("支付通知处理失败: Platform=%s, Error=%v", platform, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	return resp, nil
+	w.Write([]byte(reply))
 }
 
-func wechatCallback(_ context.Context, r *http.Request) (interface{}, error) {
-	request := &protocol.WechatOrderCallbackRequest{}
-
-	data, err := ioutil.ReadAll(r.Body)
+// 查询订单状态, 还没有收到支付通知的订单主动向支付平台查询, 用于处理丢失的支付通知
+func queryOrder(form *nex.Form) (*protocol.OrderStatusResponse, error) {
+	order, err := db.QueryOrder(form.Get("orderId"))
 	if err != nil {
 		return nil, err
 	}
 
-	if err := xml.Unmarshal(data, request); err != nil {
-		return nil, err
+	if order.Status == db.OrderStatusCreated || order.Status == db.OrderStatusExpired {
+		payment, err := provider.Lookup(order.PayPlatform)
+		if err != nil {
+			return nil, err
+		}
+		n, err := payment.Query(order)
+		if err != nil {
+			logger.Errorf("查询订单失败: OrderId=%s, Error=%v", order.OrderId, err)
+			return nil, err
+		}
+		if err := settle(order.PayPlatform, n); err != nil {
+			return nil, err
+		}
+		if order, err = db.QueryOrder(order.OrderId); err != nil {
+			return nil, err
+		}
 	}
 
-	return WechatNotify(request)
+	return &protocol.OrderStatusResponse{Status: order.Status}, nil
 }
@@ -0,0 +1,284 @@
+package provider
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/crypto"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const PlatformAlipay = "alipay"
+
+const alipayTimeFormat = "2006-01-02 15:04:05"
+
+type alipay struct {
+	appId      string
+	gateway    string
+	notifyURL  string
+	privateKey *rsa.PrivateKey // 应用私钥
+	publicKey  *rsa.PublicKey  // 支付宝公钥
+}
+
+var Alipay = &alipay{}
+
+func init() {
+	Register(PlatformAlipay, Alipay)
+}
+
+func (ap *alipay) Setup() error {
+	log.Info("pay_provider: alipay setup")
+
+	var (
+		appId      = viper.GetString("alipay.appid")
+		gateway    = viper.GetString("alipay.gateway")
+		notifyURL  = viper.GetString("alipay.notify_url")
+		privateKey = viper.GetString("alipay.private_key")
+		publicKey  = viper.GetString("alipay.public_key")
+	)
+	if appId == "" || gateway == "" || notifyURL == "" || privateKey == "" || publicKey == "" {
+		return errors.New("the alipay's config is invalid")
+	}
+
+	priv, err := crypto.LoadPrivateKey(privateKey)
+	if err != nil {
+		return err
+	}
+	pub, err := crypto.LoadPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	ap.appId = appId
+	ap.gateway = gateway
+	ap.notifyURL = notifyURL
+	ap.privateKey = priv
+	ap.publicKey = pub
+	return nil
+}
+
+// 公共请求参数并签名
+func (ap *alipay) sign(method string, biz interface{}) (url.Values, error) {
+	content, err := json.Marshal(biz)
+	if err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{
+		"app_id":      ap.appId,
+		"method":      method,
+		"charset":     "utf-8",
+		"sign_type":   "RSA2",
+		"timestamp":   time.Now().Format(alipayTimeFormat),
+		"version":     "1.0",
+		"biz_content": string(content),
+	}
+	if method == "alipay.trade.app.pay" {
+		params["notify_url"] = ap.notifyURL
+	}
+
+	sign, err := crypto.SignSHA256(ap.privateKey, []byte(signContent(params)))
+	if err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	values.Set("sign", sign)
+	return values, nil
+}
+
+// CreateOrderResponse App支付, 客户端使用返回的orderString调起支付宝
+// refs: https://opendocs.alipay.com/open/204/105465
+func (ap *alipay) CreateOrderResponse(order *model.Order) (interface{}, error) {
+	values, err := ap.sign("alipay.trade.app.pay", map[string]string{
+		"subject":      order.ProductName,
+		"out_trade_no": order.OrderId,
+		"total_amount": fenToYuan(order.Money),
+		"product_code": "QUICK_MSECURITY_PAY",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return protocol.CreateOrderAlipayResponse{
+		OrderId:     order.OrderId,
+		OrderString: values.Encode(),
+		Extra:       order.Extra,
+	}, nil
+}
+
+// Notify 支付宝异步通知, 处理完成后返回success
+// refs: https://opendocs.alipay.com/open/204/105301
+func (ap *alipay) Notify(r *http.Request) (*Notification, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	params := map[string]string{}
+	for k := range r.PostForm {
+		params[k] = r.PostForm.Get(k)
+	}
+	if err := crypto.VerifySHA256(ap.publicKey, []byte(signContent(params)), params["sign"]); err != nil {
+		log.Errorf("alipay notify verify sign failed: out_trade_no=%s", params["out_trade_no"])
+		return nil, errutil.ErrVerifyFailed
+	}
+	if params["app_id"] != ap.appId {
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	// 退款也会发送异步通知, 包含累计退款金额
+	if params["refund_fee"] != "" {
+		fee, err := yuanToFen(params["refund_fee"])
+		if err != nil {
+			return nil, err
+		}
+		return &Notification{
+			OrderId: params["out_trade_no"],
+			Result:  PayResultRefunded,
+			Refund:  &RefundInfo{PayRefundId: params["out_biz_no"], Fee: fee},
+			Reply:   "success",
+		}, nil
+	}
+
+	n, err := ap.result(params["out_trade_no"], params)
+	if err != nil {
+		return nil, err
+	}
+	if n.Trade != nil {
+		n.Trade.Raw = r.PostForm.Encode()
+	}
+	n.Reply = "success"
+	return n, nil
+}
+
+// 通知和查询的参数名相同, 转换为支付结果
+func (ap *alipay) result(orderId string, params map[string]string) (*Notification, error) {
+	n := &Notification{OrderId: orderId}
+	switch params["trade_status"] {
+	case "TRADE_SUCCESS", "TRADE_FINISHED":
+		n.Result = PayResultPaid
+	case "TRADE_CLOSED":
+		n.Result = PayResultFailed
+		return n, nil
+	default:
+		n.Result = PayResultPending
+		return n, nil
+	}
+
+	fee, err := yuanToFen(params["total_amount"])
+	if err != nil {
+		return nil, err
+	}
+	n.Fee = fee
+
+	payAt, err := time.ParseInLocation(alipayTimeFormat, params["gmt_payment"], time.Local)
+	if err != nil {
+		payAt = time.Now()
+	}
+	createAt, err := time.ParseInLocation(alipayTimeFormat, params["gmt_create"], time.Local)
+	if err != nil {
+		createAt = payAt
+	}
+	n.Trade = &model.Trade{
+		OrderId:       orderId,
+		PayOrderId:    params["trade_no"],
+		PayPlatform:   PlatformAlipay,
+		PayAt:         payAt.Unix(),
+		PayCreateAt:   createAt.Unix(),
+		MerchantId:    params["seller_id"],
+		ComsumerId:    params["buyer_id"],
+		ComsumerEmail: params["buyer_logon_id"],
+	}
+	return n, nil
+}
+
+// Query 查询订单
+// refs: https://opendocs.alipay.com/apis/api_1/alipay.trade.query
+func (ap *alipay) Query(order *model.Order) (*Notification, error) {
+	resp, err := ap.request("alipay.trade.query", map[string]string{"out_trade_no": order.OrderId})
+	if err == errAlipayTradeNotExist {
+		return &Notification{OrderId: order.OrderId, Result: PayResultPending}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// 查询接口没有gmt_payment, 使用send_pay_date
+	resp["gmt_payment"] = resp["send_pay_date"]
+	resp["buyer_id"] = resp["buyer_user_id"]
+	return ap.result(order.OrderId, resp)
+}
+
+// Refund 申请退款, 相同的out_request_no只会退款一次
+// refs: https://opendocs.alipay.com/apis/api_1/alipay.trade.refund
+func (ap *alipay) Refund(order *model.Order, refundId string, fee int, reason string) error {
+	_, err := ap.request("alipay.trade.refund", map[string]string{
+		"out_trade_no":   order.OrderId,
+		"refund_amount":  fenToYuan(fee),
+		"out_request_no": refundId,
+		"refund_reason":  reason,
+	})
+	return err
+}
+
+var errAlipayTradeNotExist = errors.New("alipay: trade not exist")
+
+// 请求支付宝网关, 验证响应的签名后返回响应内容
+func (ap *alipay) request(method string, biz map[string]string) (map[string]string, error) {
+	values, err := ap.sign(method, biz)
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := http.PostForm(ap.gateway, values)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	// 签名的内容是响应节点的原始JSON, 例如: {"alipay_trade_query_response":{...},"sign":"..."}
+	body := map[string]json.RawMessage{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	node := body[strings.Replace(method, ".", "_", -1)+"_response"]
+	var sign string
+	if err := json.Unmarshal(body["sign"], &sign); err != nil {
+		return nil, errutil.ErrVerifyFailed
+	}
+	if err := crypto.VerifySHA256(ap.publicKey, node, sign); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(node, &fields); err != nil {
+		return nil, err
+	}
+	resp := make(map[string]string, len(fields))
+	for k, v := range fields {
+		if s, ok := v.(string); ok {
+			resp[k] = s
+		}
+	}
+
+	if resp["code"] != "10000" {
+		if resp["sub_code"] == "ACQ.TRADE_NOT_EXIST" {
+			return nil, errAlipayTradeNotExist
+		}
+		return nil, fmt.Errorf("alipay: %s %s", resp["sub_code"], resp["sub_msg"])
+	}
+	return resp, nil
+}
@@ -0,0 +1,164 @@
+package provider
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// 支付结果
+const (
+	PayResultPending  = 0 //等待支付
+	PayResultPaid     = 1 //支付成功
+	PayResultFailed   = 2 //支付失败
+	PayResultRefunded = 3 //已退款, 只有退款通知
+)
+
+// Notification 支付平台的支付结果, 来自支付通知或者主动查询
+type Notification struct {
+	OrderId string
+	Result  int          //支付结果
+	Fee     int          //实际支付金额, 单位: 分
+	Trade   *model.Trade //支付成功时的交易记录
+	Refund  *RefundInfo  //退款通知的退款信息
+	Reply   string       //处理完成后返回给支付平台的响应, 主动查询时为空
+}
+
+// RefundInfo 支付平台通知的退款, 可能是GM申请的退款, 也可能是在商户后台直接发起的退款
+type RefundInfo struct {
+	PayRefundId string //支付平台的退款单号
+	Fee         int    //退款金额, 单位: 分
+}
+
+// PaymentProvider 支付平台, 使用Register注册, 订单的PayPlatform决定使用哪个支付平台
+type PaymentProvider interface {
+	// Setup 从配置中读取商户信息, 失败时该支付平台不可用
+	Setup() error
+
+	// CreateOrderResponse 向支付平台下单, 返回客户端调起支付需要的参数
+	CreateOrderResponse(order *model.Order) (interface{}, error)
+
+	// Notify 验证支付平台的支付通知, 签名错误时返回ErrVerifyFailed
+	Notify(r *http.Request) (*Notification, error)
+
+	// Query 主动查询订单的支付结果, 用于处理丢失的支付通知
+	Query(order *model.Order) (*Notification, error)
+
+	// Refund 申请退款, refundId为退款单号, 相同的退款单号重复申请只会退款一次
+	Refund(order *model.Order, refundId string, fee int, reason string) error
+}
+
+// StatementParser 支持对账单对账的支付平台
+type StatementParser interface {
+	ParseStatement(r io.Reader) ([]db.StatementItem, error)
+}
+
+var (
+	mu        sync.RWMutex
+	providers = map[string]PaymentProvider{} // 所有注册的支付平台
+	enabled   = map[string]PaymentProvider{} // 配置启用并且初始化成功的支付平台
+)
+
+// Register 注册支付平台
+func Register(platform string, p PaymentProvider) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := providers[platform]; ok {
+		log.Warnf("pay_provider: %s has been registered", platform)
+	}
+	providers[platform] = p
+}
+
+// Setup 初始化配置中启用的支付平台, 初始化失败的支付平台不可用
+func Setup(platforms []string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	enabled = map[string]PaymentProvider{}
+	for _, platform := range platforms {
+		p, ok := providers[platform]
+		if !ok {
+			log.Errorf("pay_provider: unknown platform %s", platform)
+			continue
+		}
+		if err := p.Setup(); err != nil {
+			log.Errorf("pay_provider: %s setup failed: %v", platform, err)
+			continue
+		}
+		enabled[platform] = p
+	}
+}
+
+// Lookup 查找已经启用的支付平台
+func Lookup(platform string) (PaymentProvider, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := enabled[platform]
+	if !ok {
+		return nil, errutil.ErrProviderNotFound
+	}
+	return p, nil
+}
+
+// Statement 查找支持对账单对账的支付平台, 不需要启用
+func Statement(platform string) (StatementParser, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	p, ok := providers[platform].(StatementParser)
+	if !ok {
+		return nil, errutil.ErrProviderNotFound
+	}
+	return p, nil
+}
+
+// 待签名字符串: 除sign和sign_type之外的非空参数按照参数名排序, 格式: k1=v1&k2=v2
+func signContent(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k, v := range params {
+		if k == "sign" || k == "sign_type" || v == "" {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + params[k]
+	}
+	return strings.Join(parts, "&")
+}
+
+// 金额从元转换为分, 例如: 6.00 -> 600
+func yuanToFen(s string) (int, error) {
+	parts := strings.SplitN(s, ".", 2)
+	yuan, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, err
+	}
+	fen := 0
+	if len(parts) == 2 {
+		dec := (parts[1] + "00")[:2]
+		if fen, err = strconv.Atoi(dec); err != nil {
+			return 0, err
+		}
+	}
+	return yuan*100 + fen, nil
+}
+
+// 金额从分转换为元, 例如: 600 -> 6.00
+func fenToYuan(fen int) string {
+	return fmt.Sprintf("%d.%02d", fen/100, fen%100)
+}
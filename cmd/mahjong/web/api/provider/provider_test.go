@@ -0,0 +1,144 @@
+package provider
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/crypto"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/spf13/viper"
+)
+
+func postForm(values url.Values) *http.Request {
+	r := httptest.NewRequest("POST", "/v1/order/notify/test", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestSandbox(t *testing.T) {
+	viper.Set("sandbox.secret", "test")
+	viper.Set("sandbox.notify_url", "http://127.0.0.1:0/v1/order/notify/sandbox")
+	viper.Set("sandbox.delay", 3600)
+	Setup([]string{PlatformSandbox, "unknown"})
+
+	if _, err := Lookup(PlatformAlipay); err != errutil.ErrProviderNotFound {
+		t.Fatalf("expect provider not found, got: %v", err)
+	}
+	p, err := Lookup(PlatformSandbox)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	order := &model.Order{OrderId: "0123456789abcdef", Money: 600, RealMoney: 600}
+	resp, err := p.CreateOrderResponse(order)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, _ := url.ParseQuery(resp.(protocol.CreateOrderSandboxResponse).Notify)
+
+	n, err := p.Notify(postForm(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Result != PayResultPaid || n.Fee != 600 || n.Trade.OrderId != order.OrderId || n.Reply != "success" {
+		t.Fatalf("unexpected notification: %+v", n)
+	}
+
+	// 篡改金额
+	values.Set("total_fee", "1")
+	if _, err := p.Notify(postForm(values)); err != errutil.ErrVerifyFailed {
+		t.Fatalf("expect verify failed, got: %v", err)
+	}
+
+	if n, _ := p.Query(order); n.Result != PayResultPaid {
+		t.Fatalf("expect paid, got: %+v", n)
+	}
+	if n, _ := p.Query(&model.Order{OrderId: "other"}); n.Result != PayResultPending {
+		t.Fatalf("expect pending, got: %+v", n)
+	}
+
+	if err := p.Refund(order, "r1", 400, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Refund(order, "r1", 400, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Refund(order, "r2", 400, "test"); err != errutil.ErrPayAmountMismatch {
+		t.Fatalf("expect amount mismatch, got: %v", err)
+	}
+
+	// 商户后台直接退款的通知
+	refund := url.Values{}
+	refund.Set("out_trade_no", order.OrderId)
+	refund.Set("refund_no", "sandbox-refund")
+	refund.Set("refund_fee", "600")
+	refund.Set("result", "REFUND")
+	refund.Set("sign", Sandbox.sign(refund))
+	n, err = p.Notify(postForm(refund))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Result != PayResultRefunded || n.Refund.PayRefundId != "sandbox-refund" || n.Refund.Fee != 600 {
+		t.Fatalf("unexpected refund notification: %+v", n)
+	}
+}
+
+func TestAlipayNotify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ap := &alipay{appId: "2021000000000000", publicKey: &key.PublicKey}
+
+	params := map[string]string{
+		"app_id":       ap.appId,
+		"out_trade_no": "0123456789abcdef",
+		"trade_no":     "2026101822001400000000000001",
+		"trade_status": "TRADE_SUCCESS",
+		"total_amount": "18.00",
+		"gmt_payment":  "2026-10-18 12:00:00",
+		"buyer_id":     "2088000000000000",
+	}
+	sign, err := crypto.SignSHA256(key, []byte(signContent(params)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := url.Values{}
+	for k, v := range params {
+		values.Set(k, v)
+	}
+	values.Set("sign", sign)
+	values.Set("sign_type", "RSA2")
+
+	n, err := ap.Notify(postForm(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Result != PayResultPaid || n.Fee != 1800 || n.Trade.PayOrderId != params["trade_no"] || n.Reply != "success" {
+		t.Fatalf("unexpected notification: %+v", n)
+	}
+
+	values.Set("total_amount", "0.01")
+	if _, err := ap.Notify(postForm(values)); err != errutil.ErrVerifyFailed {
+		t.Fatalf("expect verify failed, got: %v", err)
+	}
+}
+
+func TestAmount(t *testing.T) {
+	cases := map[string]int{"6.00": 600, "0.5": 50, "18": 1800, "0.01": 1}
+	for s, fen := range cases {
+		if v, err := yuanToFen(s); err != nil || v != fen {
+			t.Fatalf("yuanToFen(%s) = %d, %v", s, v, err)
+		}
+		if s == "6.00" && fenToYuan(fen) != s {
+			t.Fatalf("fenToYuan(%d) = %s", fen, fenToYuan(fen))
+		}
+	}
+}
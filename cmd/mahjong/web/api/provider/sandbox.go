@@ -0,0 +1,205 @@
+package provider
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+const PlatformSandbox = "sandbox"
+
+// 本地模拟的支付平台: 下单后延迟一段时间向自己发送签名的支付通知, 不需要商户号就可以测试完整的
+// 购买流程. 通知使用HMAC-SHA256签名, 只能在测试环境启用
+type sandbox struct {
+	secret    []byte
+	notifyURL string
+	delay     int
+
+	mu      sync.Mutex
+	trades  map[string]url.Values     // 已经支付的订单, 订单号 -> 支付通知
+	refunds map[string]map[string]int // 订单号 -> 退款单号 -> 退款金额
+}
+
+var Sandbox = &sandbox{}
+
+func init() {
+	Register(PlatformSandbox, Sandbox)
+}
+
+func (sb *sandbox) Setup() error {
+	log.Warn("pay_provider: sandbox setup, DO NOT enable it in production")
+
+	var (
+		secret    = viper.GetString("sandbox.secret")
+		notifyURL = viper.GetString("sandbox.notify_url")
+	)
+	if secret == "" || notifyURL == "" {
+		return errors.New("the sandbox's config is invalid")
+	}
+
+	sb.secret = []byte(secret)
+	sb.notifyURL = notifyURL
+	sb.delay = viper.GetInt("sandbox.delay")
+	sb.trades = map[string]url.Values{}
+	sb.refunds = map[string]map[string]int{}
+	return nil
+}
+
+func (sb *sandbox) sign(values url.Values) string {
+	params := map[string]string{}
+	for k := range values {
+		params[k] = values.Get(k)
+	}
+	mac := hmac.New(sha256.New, sb.secret)
+	mac.Write([]byte(signContent(params)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateOrderResponse 模拟用户立即支付成功, 延迟delay秒后发送支付通知
+func (sb *sandbox) CreateOrderResponse(order *model.Order) (interface{}, error) {
+	now := time.Now().Unix()
+	values := url.Values{}
+	values.Set("out_trade_no", order.OrderId)
+	values.Set("trade_no", "sandbox"+strconv.FormatInt(now, 10)+order.OrderId[:8])
+	values.Set("total_fee", strconv.Itoa(order.Money))
+	values.Set("result", "SUCCESS")
+	values.Set("time", strconv.FormatInt(now, 10))
+	values.Set("sign", sb.sign(values))
+
+	sb.mu.Lock()
+	sb.trades[order.OrderId] = values
+	sb.mu.Unlock()
+
+	time.AfterFunc(time.Duration(sb.delay)*time.Second, func() {
+		resp, err := http.PostForm(sb.notifyURL, values)
+		if err != nil {
+			log.Errorf("sandbox notify failed: out_trade_no=%s, error=%v", order.OrderId, err)
+			return
+		}
+		resp.Body.Close()
+		log.Infof("sandbox notify: out_trade_no=%s, status=%d", order.OrderId, resp.StatusCode)
+	})
+
+	return protocol.CreateOrderSandboxResponse{
+		OrderId: order.OrderId,
+		Fee:     order.Money,
+		Notify:  values.Encode(),
+		Delay:   sb.delay,
+		Extra:   order.Extra,
+	}, nil
+}
+
+// Notify 验证模拟的支付通知
+func (sb *sandbox) Notify(r *http.Request) (*Notification, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, err
+	}
+
+	values := url.Values{}
+	for k := range r.PostForm {
+		if k != "sign" {
+			values.Set(k, r.PostForm.Get(k))
+		}
+	}
+	if !hmac.Equal([]byte(sb.sign(values)), []byte(r.PostForm.Get("sign"))) {
+		log.Errorf("sandbox notify verify sign failed: out_trade_no=%s", values.Get("out_trade_no"))
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	n, err := sb.result(values)
+	if err != nil {
+		return nil, err
+	}
+	if n.Trade != nil {
+		n.Trade.Raw = r.PostForm.Encode()
+	}
+	n.Reply = "success"
+	return n, nil
+}
+
+func (sb *sandbox) result(values url.Values) (*Notification, error) {
+	n := &Notification{OrderId: values.Get("out_trade_no"), Result: PayResultFailed}
+	switch values.Get("result") {
+	case "SUCCESS":
+	case "REFUND":
+		// 模拟在商户后台直接退款
+		fee, err := strconv.Atoi(values.Get("refund_fee"))
+		if err != nil {
+			return nil, err
+		}
+		n.Result = PayResultRefunded
+		n.Refund = &RefundInfo{PayRefundId: values.Get("refund_no"), Fee: fee}
+		return n, nil
+	default:
+		return n, nil
+	}
+
+	fee, err := strconv.Atoi(values.Get("total_fee"))
+	if err != nil {
+		return nil, err
+	}
+	payAt, _ := strconv.ParseInt(values.Get("time"), 10, 64)
+
+	n.Result = PayResultPaid
+	n.Fee = fee
+	n.Trade = &model.Trade{
+		OrderId:     n.OrderId,
+		PayOrderId:  values.Get("trade_no"),
+		PayPlatform: PlatformSandbox,
+		PayAt:       payAt,
+		PayCreateAt: payAt,
+		MerchantId:  PlatformSandbox,
+	}
+	return n, nil
+}
+
+// Query 查询本地记录的支付结果, 服务器重启之后的订单都是等待支付
+func (sb *sandbox) Query(order *model.Order) (*Notification, error) {
+	sb.mu.Lock()
+	values, ok := sb.trades[order.OrderId]
+	sb.mu.Unlock()
+
+	if !ok {
+		return &Notification{OrderId: order.OrderId, Result: PayResultPending}, nil
+	}
+	return sb.result(values)
+}
+
+// Refund 记录退款, 退款总金额不能超过支付金额
+func (sb *sandbox) Refund(order *model.Order, refundId string, fee int, reason string) error {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	refunds, ok := sb.refunds[order.OrderId]
+	if !ok {
+		refunds = map[string]int{}
+		sb.refunds[order.OrderId] = refunds
+	}
+	if _, ok := refunds[refundId]; ok {
+		return nil
+	}
+
+	total := fee
+	for _, f := range refunds {
+		total += f
+	}
+	if total > order.RealMoney {
+		return errutil.ErrPayAmountMismatch
+	}
+
+	refunds[refundId] = fee
+	log.Infof("sandbox refund: out_trade_no=%s, refund_id=%s, fee=%d, reason=%s", order.OrderId, refundId, fee, reason)
+	return nil
+}
@@ -2,17 +2,24 @@ package provider
 
 import (
 	"bytes"
+	"crypto/aes"
 	"crypto/md5"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/csv"
 	"encoding/hex"
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/lonng/nanoserver/db"
 	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nanoserver/pkg/algoutil"
 	"github.com/lonng/nanoserver/pkg/errutil"
@@ -21,16 +28,28 @@ import (
 	"github.com/spf13/viper"
 )
 
+const PlatformWechat = "wechat"
+
+const (
+	wechatQueryURL  = "https://api.mch.weixin.qq.com/pay/orderquery"
+	wechatRefundURL = "https://api.mch.weixin.qq.com/secapi/pay/refund"
+)
+
 type wechat struct {
 	appkey        string
 	appId         string
 	merId         string
 	unifyOrderURL string
 	callbackURL   string
+	certClient    *http.Client // 使用商户证书的客户端, 退款接口需要
 }
 
 var Wechat = &wechat{}
 
+func init() {
+	Register(PlatformWechat, Wechat)
+}
+
 // 请求https://api.mch.weixin.qq.com/pay/unifiedorder需要填入的参数
 // refs: https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_1
 type UnifyOrderReq struct {
@@ -116,7 +135,7 @@ func (wc *wechat) CreateOrderResponse(order *model.Order) (interface{}, error) {
 		NotifyURL:      wc.callbackURL,
 		TradeType:      "APP",
 		SpbillCreateIP: strings.Split(order.Ip, ":")[0],
-		TotalFee:       order.ProductCount * 1,
+		TotalFee:       order.Money, //单位: 分
 		OutTradeNo:     order.OrderId,
 	}
 
@@ -210,71 +229,124 @@ func (wc *wechat) CreateOrderResponse(order *model.Order) (interface{}, error) {
 
 const format = "20060102150405"
 
-func (wc *wechat) Notify(request *protocol.WechatOrderCallbackRequest) (*model.Trade, interface{}, error) {
-	var reqMap map[string]interface{}
-	reqMap = make(map[string]interface{}, 0)
-
-	reqMap["return_code"] = request.ReturnCode
-	reqMap["return_msg"] = request.ReturnMsg
-	reqMap["appid"] = request.Appid
-	reqMap["mch_id"] = request.MchID
-	reqMap["device_info"] = request.DeviceInfo
-	reqMap["nonce_str"] = request.Nonce
-	//sign
-	reqMap["result_code"] = request.ResultCode
-	reqMap["err_code"] = request.ErrCode
-	reqMap["err_code_des"] = request.ErrCodeDes
-
-	reqMap["openid"] = request.Openid
-	reqMap["is_subscribe"] = request.IsSubscribe
-	reqMap["trade_type"] = request.TradeType
-	reqMap["bank_type"] = request.BankType
-	reqMap["total_fee"] = request.TotalFee
-	reqMap["fee_type"] = request.FeeType
-	reqMap["cash_fee"] = request.CashFee
-	reqMap["cash_fee_type"] = request.CashFeeType
-
-	reqMap["coupon_fee"] = request.CouponFee
-	reqMap["coupon_count"] = request.CouponCount
-	reqMap["coupon_id_$n"] = request.CouponIDDollarN
-	reqMap["coupon_fee_$n"] = request.CouponFeeDollarN
-
-	reqMap["transaction_id"] = request.TransactionID
-	reqMap["out_trade_no"] = request.OutTradeNo
-	reqMap["attach"] = request.Attach
-	reqMap["time_end"] = request.TimeEnd
+// Notify 微信支付结果通知
+// refs: https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_7
+func (wc *wechat) Notify(r *http.Request) (*Notification, error) {
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
 
-	var resp protocol.WechatOrderCallbackResponse
-	if verify(reqMap, wc.appkey, request.Sign) {
-		resp.ReturnCode = "SUCCESS"
-		resp.ReturnMsg = "OK"
-	} else {
-		resp.ReturnCode = "FAIL"
-		resp.ReturnMsg = "failed to verify sign, please retry!"
+	request := &protocol.WechatOrderCallbackRequest{}
+	if err := xml.Unmarshal(data, request); err != nil {
+		return nil, err
+	}
+	request.Raw = string(data)
+	if request.ReqInfo != "" {
+		return wc.refundNotify(request)
+	}
+	return wc.notify(request)
+}
+
+// 退款结果通知没有签名, 使用商户密钥的MD5解密req_info, 解密成功即验证通过
+// refs: https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_16
+func (wc *wechat) refundNotify(request *protocol.WechatOrderCallbackRequest) (*Notification, error) {
+	if request.ReturnCode != "SUCCESS" || request.Appid != wc.appId || request.MchID != wc.merId {
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	info, err := decryptReqInfo(request.ReqInfo, wc.appkey)
+	if err != nil {
+		log.Errorf("wechat refund notify decrypt failed: %v", err)
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	const reply = "<xml><return_code><![CDATA[SUCCESS]]></return_code><return_msg><![CDATA[OK]]></return_msg></xml>"
+	n := &Notification{OrderId: info["out_trade_no"], Result: PayResultPending, Reply: reply}
+	if info["refund_status"] != "SUCCESS" {
+		log.Warnf("wechat refund not success: out_trade_no=%s, refund_status=%s", info["out_trade_no"], info["refund_status"])
+		return n, nil
+	}
+
+	fee, err := strconv.Atoi(info["refund_fee"])
+	if err != nil {
+		return nil, err
+	}
+	n.Result = PayResultRefunded
+	n.Refund = &RefundInfo{PayRefundId: info["refund_id"], Fee: fee}
+	return n, nil
+}
+
+// req_info: base64(AES-256-ECB(xml)), 密钥为商户密钥MD5的小写十六进制字符串
+func decryptReqInfo(reqInfo, appkey string) (map[string]string, error) {
+	data, err := base64.StdEncoding.DecodeString(reqInfo)
+	if err != nil {
+		return nil, err
+	}
+	sum := md5.Sum([]byte(appkey))
+	block, err := aes.NewCipher([]byte(hex.EncodeToString(sum[:])))
+	if err != nil {
+		return nil, err
+	}
+
+	size := block.BlockSize()
+	if len(data) == 0 || len(data)%size != 0 {
+		return nil, errutil.ErrIllegalParameter
+	}
+	plain := make([]byte, len(data))
+	for i := 0; i < len(data); i += size {
+		block.Decrypt(plain[i:i+size], data[i:i+size])
 	}
 
+	// PKCS7
+	pad := int(plain[len(plain)-1])
+	if pad == 0 || pad > size {
+		return nil, errutil.ErrIllegalParameter
+	}
+	return decodeXMLMap(bytes.NewReader(plain[:len(plain)-pad]))
+}
+
+func (wc *wechat) notify(request *protocol.WechatOrderCallbackRequest) (*Notification, error) {
+	fields, err := decodeXMLMap(strings.NewReader(request.Raw))
+	if err != nil {
+		return nil, err
+	}
+
+	// 签名验证失败时不能处理订单, 否则伪造的通知也可以加房卡
+	// 需要使用通知中的所有字段计算签名, 例如多张代金券时的coupon_id_0、coupon_id_1
+	if !verify(unsigned(fields), wc.appkey, fields["sign"]) {
+		log.Errorf("wechat notify verify sign failed: out_trade_no=%s", request.OutTradeNo)
+		return nil, errutil.ErrVerifyFailed
+	}
+
+	var resp protocol.WechatOrderCallbackResponse
+	resp.ReturnCode = "SUCCESS"
+	resp.ReturnMsg = "OK"
+
 	//bytes, err := xml.Marshal(resp)
 	//cbResp := strings.Replace(string(bytes), "WechatOrderCallbackResponse", "xml", -1)
 	//if err != nil {
 	//	return nil, nil, err
 	//}
 
-	format := "<xml><return_code><![CDATA[%s]]></return_code><return_msg><![CDATA[%s]]></return_msg></xml>"
+	respFormat := "<xml><return_code><![CDATA[%s]]></return_code><return_msg><![CDATA[%s]]></return_msg></xml>"
 
-	cbResp := fmt.Sprintf(format, resp.ReturnCode, resp.ReturnMsg)
+	cbResp := fmt.Sprintf(respFormat, resp.ReturnCode, resp.ReturnMsg)
 
 	fmt.Println("response: ", cbResp)
 	trade := &model.Trade{}
 	trade.PayOrderId = request.TransactionID
 	trade.OrderId = request.OutTradeNo
+	trade.PayPlatform = PlatformWechat
 
-	createAt, err := time.Parse(format, request.TimeEnd)
+	// 微信返回的时间为北京时间
+	createAt, err := time.ParseInLocation(format, request.TimeEnd, time.Local)
 	if err != nil {
 		createAt = time.Now()
 	}
 	trade.PayCreateAt = createAt.Unix()
 
-	payAt, err := time.Parse(format, request.TimeEnd)
+	payAt, err := time.ParseInLocation(format, request.TimeEnd, time.Local)
 	if err != nil {
 		payAt = time.Now()
 	}
@@ -283,7 +355,168 @@ func (wc *wechat) Notify(request *protocol.WechatOrderCallbackRequest) (*model.T
 	trade.MerchantId = request.MchID
 	trade.ComsumerId = request.Openid
 	trade.Raw = request.Raw
-	return trade, cbResp, nil
+
+	n := &Notification{
+		OrderId: request.OutTradeNo,
+		Result:  PayResultPaid,
+		Fee:     request.TotalFee,
+		Trade:   trade,
+		Reply:   cbResp,
+	}
+	if request.ResultCode != "SUCCESS" {
+		log.Warnf("wechat pay failed: out_trade_no=%s, err_code=%s, err_code_des=%s", request.OutTradeNo, request.ErrCode, request.ErrCodeDes)
+		n.Result = PayResultFailed
+		n.Trade = nil
+	}
+	return n, nil
+}
+
+// Query 查询订单
+// refs: https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_2
+func (wc *wechat) Query(order *model.Order) (*Notification, error) {
+	resp, err := wc.request(http.DefaultClient, wechatQueryURL, map[string]interface{}{
+		"appid":        wc.appId,
+		"mch_id":       wc.merId,
+		"out_trade_no": order.OrderId,
+		"nonce_str":    algoutil.RandStr(32),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	n := &Notification{OrderId: order.OrderId}
+	switch resp["trade_state"] {
+	case "SUCCESS":
+		n.Result = PayResultPaid
+	case "NOTPAY", "USERPAYING":
+		n.Result = PayResultPending
+		return n, nil
+	case "REFUND":
+		// 已经转入退款, 查询结果中没有退款信息, 不能按已支付处理, 等待退款通知或者对账处理
+		log.Warnf("wechat order refunded: out_trade_no=%s", order.OrderId)
+		n.Result = PayResultPending
+		return n, nil
+	default:
+		n.Result = PayResultFailed
+		return n, nil
+	}
+
+	n.Fee, _ = strconv.Atoi(resp["total_fee"])
+	payAt, err := time.ParseInLocation(format, resp["time_end"], time.Local)
+	if err != nil {
+		payAt = time.Now()
+	}
+	n.Trade = &model.Trade{
+		OrderId:     order.OrderId,
+		PayOrderId:  resp["transaction_id"],
+		PayPlatform: PlatformWechat,
+		PayAt:       payAt.Unix(),
+		PayCreateAt: payAt.Unix(),
+		MerchantId:  resp["mch_id"],
+		ComsumerId:  resp["openid"],
+	}
+	return n, nil
+}
+
+// Refund 申请退款, 需要配置商户证书
+// refs: https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_4
+func (wc *wechat) Refund(order *model.Order, refundId string, fee int, reason string) error {
+	if wc.certClient == nil {
+		return errors.New("wechat refund: merchant certificate not configured")
+	}
+
+	_, err := wc.request(wc.certClient, wechatRefundURL, map[string]interface{}{
+		"appid":         wc.appId,
+		"mch_id":        wc.merId,
+		"nonce_str":     algoutil.RandStr(32),
+		"out_trade_no":  order.OrderId,
+		"out_refund_no": refundId,
+		"total_fee":     order.RealMoney,
+		"refund_fee":    fee,
+		"refund_desc":   reason,
+	})
+	return err
+}
+
+// 签名后请求微信支付接口, 返回验证签名后的响应
+func (wc *wechat) request(client *http.Client, url string, params map[string]interface{}) (map[string]string, error) {
+	sign, err := signCalculator(params, wc.appkey)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString("<xml>")
+	for k, v := range params {
+		buf.WriteString("<" + k + ">")
+		xml.EscapeText(buf, []byte(fmt.Sprint(v)))
+		buf.WriteString("</" + k + ">")
+	}
+	buf.WriteString("<sign>" + sign + "</sign></xml>")
+
+	response, err := client.Post(url, "application/xml;charset=utf-8", buf)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	resp, err := decodeXMLMap(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp["return_code"] != "SUCCESS" {
+		return nil, fmt.Errorf("wechat: %s", resp["return_msg"])
+	}
+
+	if !verify(unsigned(resp), wc.appkey, resp["sign"]) {
+		return nil, errutil.ErrVerifyFailed
+	}
+	if resp["result_code"] != "SUCCESS" {
+		return nil, fmt.Errorf("wechat: %s %s", resp["err_code"], resp["err_code_des"])
+	}
+	return resp, nil
+}
+
+// 除了签名以外所有参与签名的字段
+func unsigned(m map[string]string) map[string]interface{} {
+	ret := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		if k != "sign" {
+			ret[k] = v
+		}
+	}
+	return ret
+}
+
+// 微信支付接口的响应都是一层的xml, 例如: <xml><return_code>SUCCESS</return_code></xml>
+func decodeXMLMap(r io.Reader) (map[string]string, error) {
+	m := map[string]string{}
+	decoder := xml.NewDecoder(r)
+	depth, key := 0, ""
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return m, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if depth == 2 {
+				key = t.Name.Local
+				m[key] = ""
+			}
+		case xml.CharData:
+			if depth == 2 {
+				m[key] += string(t)
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
 }
 
 func (wc *wechat) Setup() error {
@@ -309,5 +542,72 @@ func (wc *wechat) Setup() error {
 	wc.merId = merId
 	wc.callbackURL = callbackURL
 	wc.unifyOrderURL = unifyOrderURL
+
+	// 没有配置商户证书时不能退款
+	if certFile, keyFile := viper.GetString("wechat.cert_file"), viper.GetString("wechat.key_file"); certFile != "" && keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return err
+		}
+		wc.certClient = &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{Certificates: []tls.Certificate{cert}}},
+		}
+	}
 	return nil
 }
+
+// ParseStatement 解析微信支付对账单(下载对账单接口返回的文本), 只返回支付成功的交易
+// refs: https://pay.weixin.qq.com/wiki/doc/api/app/app.php?chapter=9_6
+func (wc *wechat) ParseStatement(r io.Reader) ([]db.StatementItem, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	index := map[string]int{}
+	for i, name := range rows[0] {
+		index[strings.TrimPrefix(strings.TrimSpace(name), "\ufeff")] = i
+	}
+	var cols []int
+	for _, name := range []string{"商户订单号", "微信订单号", "交易状态", "应结订单总金额"} {
+		i, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("对账单缺少字段: %s", name)
+		}
+		cols = append(cols, i)
+	}
+
+	items := []db.StatementItem{}
+	for _, row := range rows[1:] {
+		field := func(i int) string {
+			if i >= len(row) {
+				return ""
+			}
+			// 微信对账单的每个字段都以`开头
+			return strings.TrimPrefix(strings.TrimSpace(row[i]), "`")
+		}
+		// 明细之后是汇总数据
+		if strings.HasPrefix(field(0), "总交易单数") {
+			break
+		}
+		if field(cols[2]) != "SUCCESS" {
+			continue
+		}
+
+		fee, err := yuanToFen(field(cols[3]))
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, db.StatementItem{
+			OrderId:    field(cols[0]),
+			PayOrderId: field(cols[1]),
+			Fee:        fee,
+		})
+	}
+	return items, nil
+}
@@ -0,0 +1,119 @@
+package provider
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+const statement = "交易时间,公众账号ID,商户号,特约商户号,设备号,微信订单号,商户订单号,用户标识,交易类型,交易状态,付款银行,货币种类,应结订单总金额,代金券金额\n" +
+	"`2026-10-17 12:00:01,`wx01,`1900000001,`0,`,`4200000001,`a1,`o1,`APP,`SUCCESS,`CFT,`CNY,`6.00,`0.00\n" +
+	"`2026-10-17 12:10:01,`wx01,`1900000001,`0,`,`4200000002,`a2,`o2,`APP,`REFUND,`CFT,`CNY,`18.00,`0.00\n" +
+	"`2026-10-17 12:20:01,`wx01,`1900000001,`0,`,`4200000003,`a3,`o3,`APP,`SUCCESS,`CFT,`CNY,`0.5,`0.00\n" +
+	"总交易单数,应结订单总金额,退款总金额,充值券退款总金额,手续费总金额,订单总金额,申请退款总金额\n" +
+	"`3,`24.50,`18.00,`0.00,`0.00,`24.50,`18.00\n"
+
+func TestParseStatement(t *testing.T) {
+	items, err := Wechat.ParseStatement(strings.NewReader(statement))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 {
+		t.Fatalf("expect 2 items, got: %+v", items)
+	}
+	if items[0].OrderId != "a1" || items[0].PayOrderId != "4200000001" || items[0].Fee != 600 {
+		t.Fatalf("unexpected item: %+v", items[0])
+	}
+	if items[1].OrderId != "a3" || items[1].Fee != 50 {
+		t.Fatalf("unexpected item: %+v", items[1])
+	}
+
+	if _, err := Wechat.ParseStatement(strings.NewReader("交易时间,商户订单号\n")); err == nil {
+		t.Fatal("expect missing column error")
+	}
+}
+
+func TestDecryptReqInfo(t *testing.T) {
+	const appkey = "0123456789abcdef0123456789abcdef"
+	plain := []byte("<root><out_trade_no><![CDATA[a1]]></out_trade_no><refund_id><![CDATA[5000000001]]></refund_id>" +
+		"<refund_fee><![CDATA[600]]></refund_fee><refund_status><![CDATA[SUCCESS]]></refund_status></root>")
+
+	// AES-256-ECB, PKCS7
+	sum := md5.Sum([]byte(appkey))
+	block, err := aes.NewCipher([]byte(hex.EncodeToString(sum[:])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	plain = append(plain, bytes.Repeat([]byte{byte(pad)}, pad)...)
+	data := make([]byte, len(plain))
+	for i := 0; i < len(plain); i += aes.BlockSize {
+		block.Encrypt(data[i:i+aes.BlockSize], plain[i:i+aes.BlockSize])
+	}
+	reqInfo := base64.StdEncoding.EncodeToString(data)
+
+	info, err := decryptReqInfo(reqInfo, appkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info["out_trade_no"] != "a1" || info["refund_id"] != "5000000001" || info["refund_fee"] != "600" || info["refund_status"] != "SUCCESS" {
+		t.Fatalf("unexpected req_info: %+v", info)
+	}
+
+	if _, err := decryptReqInfo(reqInfo, "wrong key"); err == nil {
+		t.Fatal("expect decrypt failed with wrong key")
+	}
+}
+
+func TestWechatNotify(t *testing.T) {
+	wc := &wechat{appkey: "0123456789abcdef0123456789abcdef"}
+	fields := map[string]interface{}{
+		"return_code":    "SUCCESS",
+		"result_code":    "SUCCESS",
+		"appid":          "wx01",
+		"mch_id":         "1900000001",
+		"nonce_str":      "5K8264ILTKCH16CQ2502SI8ZNMTM67VS",
+		"out_trade_no":   "a1",
+		"transaction_id": "4200000001",
+		"total_fee":      "600",
+		"coupon_count":   "2",
+		"coupon_id_0":    "10001",
+		"coupon_id_1":    "10002",
+		"time_end":       "20261017120001",
+	}
+	sign, err := signCalculator(fields, wc.appkey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body := func(fields map[string]interface{}, sign string) string {
+		buf := &bytes.Buffer{}
+		buf.WriteString("<xml>")
+		for k, v := range fields {
+			buf.WriteString("<" + k + "><![CDATA[" + v.(string) + "]]></" + k + ">")
+		}
+		buf.WriteString("<sign>" + sign + "</sign></xml>")
+		return buf.String()
+	}
+
+	n, err := wc.Notify(httptest.NewRequest("POST", "/v1/order/notify/wechat", strings.NewReader(body(fields, sign))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.OrderId != "a1" || n.Result != PayResultPaid || n.Fee != 600 {
+		t.Fatalf("unexpected notification: %+v", n)
+	}
+
+	// 篡改没有在结构体中定义的字段也需要验证失败
+	fields["coupon_id_1"] = "10003"
+	if _, err := wc.Notify(httptest.NewRequest("POST", "/v1/order/notify/wechat", strings.NewReader(body(fields, sign)))); err != errutil.ErrVerifyFailed {
+		t.Fatalf("expect verify failed, got: %v", err)
+	}
+}
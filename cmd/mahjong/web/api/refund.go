@@ -0,0 +1,52 @@
+package api
+
+import (
+	"github.com/lonng/nanoserver/cmd/mahjong/web/api/provider"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/spf13/viper"
+)
+
+var onBalanceChanged = func(uid, coin int64) {} // 房卡变化后通知在线的玩家
+
+// OnBalanceChanged 设置玩家房卡变化后的回调
+func OnBalanceChanged(fn func(uid, coin int64)) {
+	onBalanceChanged = fn
+}
+
+// Refund GM申请退款: 支付平台退款成功后扣回充值的房卡, 失败时记录错误, 可以使用相同的订单号重试
+func Refund(orderID, reason, operator string) (*model.Refund, error) {
+	policy := viper.GetString("refund.policy")
+	if policy == "" {
+		policy = db.RefundPolicyBlock
+	}
+
+	refund, order, err := db.BeginRefund(orderID, reason, operator, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	payment, err := provider.Lookup(order.PayPlatform)
+	if err == nil {
+		err = payment.Refund(order, refund.RefundId, refund.Fee, reason)
+	}
+	if err != nil {
+		logger.Errorf("申请退款失败: OrderId=%s, RefundId=%s, Error=%v", orderID, refund.RefundId, err)
+		if ferr := db.FailRefund(refund.RefundId, err); ferr != nil {
+			logger.Error(ferr)
+		}
+		return nil, err
+	}
+
+	refund, l, err := db.CompleteRefund(refund.RefundId, "")
+	if err != nil {
+		return nil, err
+	}
+	if l != nil {
+		onBalanceChanged(refund.Uid, l.Balance)
+	}
+
+	logger.Infof("退款成功: OrderId=%s, RefundId=%s, Fee=%d, Coin=%d, Debt=%d, Operator=%s",
+		orderID, refund.RefundId, refund.Fee, refund.Coin, refund.Debt, operator)
+	return refund, nil
+}
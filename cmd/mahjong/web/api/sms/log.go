@@ -0,0 +1,24 @@
+package sms
+
+import (
+	log "github.com/sirupsen/logrus"
+)
+
+const SenderLog = "log"
+
+// 只把短信内容输出到日志, 用于开发和测试环境
+type logSender struct{}
+
+func init() {
+	Register(SenderLog, logSender{})
+}
+
+func (logSender) Setup() error {
+	log.Warn("sms: log sender setup, DO NOT enable it in production")
+	return nil
+}
+
+func (logSender) Send(phone, content string) error {
+	log.Infof("sms: phone=%s, content=%s", phone, content)
+	return nil
+}
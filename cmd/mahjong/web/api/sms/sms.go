@@ -0,0 +1,60 @@
+package sms
+
+import (
+	"sync"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+	log "github.com/sirupsen/logrus"
+)
+
+// Sender 短信通道, 不同的短信服务商实现这个接口并在init中注册
+type Sender interface {
+	Setup() error
+	Send(phone, content string) error
+}
+
+var (
+	mu      sync.RWMutex
+	senders = map[string]Sender{} // 已经注册的短信通道
+	current Sender                // 配置中启用的短信通道
+)
+
+// Register 注册短信通道
+func Register(name string, s Sender) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, ok := senders[name]; ok {
+		log.Warnf("sms: %s has been registered", name)
+	}
+	senders[name] = s
+}
+
+// Setup 初始化配置中启用的短信通道, 初始化失败时不能发送短信
+func Setup(name string) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current = nil
+	s, ok := senders[name]
+	if !ok {
+		return errutil.ErrProviderNotFound
+	}
+	if err := s.Setup(); err != nil {
+		return err
+	}
+	current = s
+	return nil
+}
+
+// Send 使用启用的短信通道发送短信
+func Send(phone, content string) error {
+	mu.RLock()
+	s := current
+	mu.RUnlock()
+
+	if s == nil {
+		return errutil.ErrProviderNotFound
+	}
+	return s.Send(phone, content)
+}
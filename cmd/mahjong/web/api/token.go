@@ -0,0 +1,81 @@
+package api
+
+import (
+	"time"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/spf13/viper"
+)
+
+var (
+	tokenSecret  []byte        // 登录凭证签名密钥, 和游戏服务器使用同一个配置
+	tokenExpires time.Duration // 登录凭证有效期
+
+	onTokenRevoked = func(uid int64) {} // 注销凭证后踢掉在线的连接
+)
+
+// OnTokenRevoked 设置注销登录凭证后的回调
+func OnTokenRevoked(fn func(uid int64)) {
+	onTokenRevoked = fn
+}
+
+func setupToken() {
+	secret := viper.GetString("token.secret")
+	if secret == "" {
+		logger.Fatal("没有配置登录凭证的签名密钥token.secret, 请使用随机生成的密钥")
+	}
+	tokenSecret = []byte(secret)
+
+	tokenExpires = time.Duration(viper.GetInt64("token.expires")) * time.Second
+	if tokenExpires <= 0 {
+		tokenExpires = 6 * time.Hour
+	}
+	logger.Infof("登录凭证有效期: %s", tokenExpires)
+}
+
+// 签发登录凭证, 返回凭证和过期时间
+func issueToken(u *model.User, device string) (string, int64, error) {
+	t := &algoutil.Token{
+		Uid:     u.Id,
+		Device:  device,
+		Version: u.TokenVersion,
+		Expire:  time.Now().Add(tokenExpires).Unix(),
+	}
+	token, err := algoutil.SignToken(t, tokenSecret)
+	if err != nil {
+		return "", 0, err
+	}
+	return token, t.Expire, nil
+}
+
+// 使用未过期的凭证换取新的凭证
+func refreshTokenHandler(data *protocol.TokenRequest) (*protocol.TokenResponse, error) {
+	u, t, err := db.VerifyToken(data.Token, tokenSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	token, expire, err := issueToken(u, t.Device)
+	if err != nil {
+		return nil, err
+	}
+	return &protocol.TokenResponse{Token: token, ExpireAt: expire}, nil
+}
+
+// 注销用户所有的凭证, 例如账号被盗或者在其他设备退出
+func revokeTokenHandler(data *protocol.TokenRequest) (*protocol.StringMessage, error) {
+	u, _, err := db.VerifyToken(data.Token, tokenSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.RevokeToken(u.Id); err != nil {
+		return nil, err
+	}
+	logger.Infof("注销登录凭证: Uid=%d", u.Id)
+	onTokenRevoked(u.Id)
+	return protocol.SuccessMessage, nil
+}
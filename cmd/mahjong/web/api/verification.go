@@ -0,0 +1,215 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lonng/nanoserver/cmd/mahjong/web/api/sms"
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/pkg/security"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/pborman/uuid"
+	"github.com/spf13/viper"
+)
+
+const maxVerifyAttempts = 5 // 同一个验证码最多尝试的次数
+
+type (
+	// 已经发送的验证码
+	verification struct {
+		phone    string
+		typ      string
+		code     string
+		expireAt time.Time
+		attempts int
+	}
+
+	// 发送频率限制
+	sendLimiter struct {
+		interval    time.Duration // 同一个手机号两次发送的最小间隔
+		phoneDaily  int           // 同一个手机号每天最多发送的次数
+		ipHourly    int           // 同一个IP每小时最多请求的次数
+		phoneLastAt map[string]time.Time
+		phoneCount  map[string]int // 手机号当天发送的次数
+		ipCount     map[string]int // IP当前小时请求的次数
+		day, hour   string
+	}
+)
+
+var (
+	verifyMu      sync.Mutex
+	verifications = map[string]*verification{} // 验证码ID -> 验证码
+	verifyExpire  = 5 * time.Minute
+	limiter       = newSendLimiter(time.Minute, 10, 30)
+)
+
+func newSendLimiter(interval time.Duration, phoneDaily, ipHourly int) *sendLimiter {
+	return &sendLimiter{
+		interval:    interval,
+		phoneDaily:  phoneDaily,
+		ipHourly:    ipHourly,
+		phoneLastAt: map[string]time.Time{},
+		phoneCount:  map[string]int{},
+		ipCount:     map[string]int{},
+	}
+}
+
+// 检查是否可以发送, 可以发送时记录本次发送
+func (l *sendLimiter) allow(phone, ip string, now time.Time) bool {
+	if day := now.Format("20060102"); day != l.day {
+		l.day = day
+		l.phoneCount = map[string]int{}
+		l.phoneLastAt = map[string]time.Time{}
+	}
+	if hour := now.Format("2006010215"); hour != l.hour {
+		l.hour = hour
+		l.ipCount = map[string]int{}
+	}
+
+	if now.Sub(l.phoneLastAt[phone]) < l.interval {
+		return false
+	}
+	if l.phoneCount[phone] >= l.phoneDaily || l.ipCount[ip] >= l.ipHourly {
+		return false
+	}
+
+	l.phoneLastAt[phone] = now
+	l.phoneCount[phone]++
+	l.ipCount[ip]++
+	return true
+}
+
+func setupVerification() {
+	name := viper.GetString("sms.sender")
+	if name == "" {
+		name = sms.SenderLog
+	}
+	if err := sms.Setup(name); err != nil {
+		logger.Errorf("短信通道初始化失败: Sender=%s, Error=%v", name, err)
+	}
+
+	if expire := viper.GetInt64("sms.expire"); expire > 0 {
+		verifyExpire = time.Duration(expire) * time.Second
+	}
+
+	interval := time.Duration(viper.GetInt64("sms.interval")) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	phoneDaily := viper.GetInt("sms.phone_daily")
+	if phoneDaily <= 0 {
+		phoneDaily = 10
+	}
+	ipHourly := viper.GetInt("sms.ip_hourly")
+	if ipHourly <= 0 {
+		ipHourly = 30
+	}
+	limiter = newSendLimiter(interval, phoneDaily, ipHourly)
+	logger.Infof("短信通道: %s, 验证码有效期: %s, 发送间隔: %s, 每天: %d次, 每个IP每小时: %d次",
+		name, verifyExpire, interval, phoneDaily, ipHourly)
+}
+
+func randomCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
+
+// 发送验证码, 注册时手机号不能已经绑定, 找回密码时手机号必须已经绑定, 游客绑定时不限制
+func verificationHandler(r *http.Request, data *protocol.VerificationRequest) (*protocol.VerificationResponse, error) {
+	if !security.ValidatePhone(data.Phone) {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	exists, err := db.IsPhoneExists(data.Phone)
+	if err != nil {
+		return nil, err
+	}
+	switch data.Type {
+	case protocol.VerificationTypeRegister:
+		if exists {
+			return nil, errutil.ErrPhoneExists
+		}
+	case protocol.VerificationTypeFindPW:
+		if !exists {
+			return nil, errutil.ErrUserNotFound
+		}
+	case protocol.VerificationTypeBind:
+		// 手机号已经注册时可以选择合并
+	default:
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	code, err := randomCode()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	verifyMu.Lock()
+	if !limiter.allow(data.Phone, ip(r.RemoteAddr), now) {
+		verifyMu.Unlock()
+		logger.Warnf("验证码请求过于频繁: Phone=%s, IP=%s", data.Phone, ip(r.RemoteAddr))
+		return nil, errutil.ErrFrequencyLimited
+	}
+	for id, v := range verifications {
+		if now.After(v.expireAt) {
+			delete(verifications, id)
+		}
+	}
+	id := strings.Replace(uuid.New(), "-", "", -1)
+	verifications[id] = &verification{
+		phone:    data.Phone,
+		typ:      data.Type,
+		code:     code,
+		expireAt: now.Add(verifyExpire),
+	}
+	verifyMu.Unlock()
+
+	content := fmt.Sprintf("您的验证码是%s, %d分钟内有效, 请勿告诉他人", code, int(verifyExpire.Minutes()))
+	if err := sms.Send(data.Phone, content); err != nil {
+		logger.Errorf("发送验证码失败: Phone=%s, Error=%v", data.Phone, err)
+		verifyMu.Lock()
+		delete(verifications, id)
+		verifyMu.Unlock()
+		return nil, errutil.ErrRequestFailed
+	}
+
+	logger.Infof("发送验证码: Phone=%s, Type=%s, AppID=%s", data.Phone, data.Type, data.AppID)
+	return &protocol.VerificationResponse{VerifyID: id, Expire: int64(verifyExpire.Seconds())}, nil
+}
+
+// 检查验证码, 错误次数过多时验证码失效. 检查通过后需要调用consumeVerification, 避免重复使用
+func checkVerification(id, code, phone, typ string) error {
+	verifyMu.Lock()
+	defer verifyMu.Unlock()
+
+	v, ok := verifications[id]
+	if !ok || v.phone != phone || v.typ != typ || time.Now().After(v.expireAt) {
+		return errutil.ErrVerifyFailed
+	}
+
+	v.attempts++
+	if subtle.ConstantTimeCompare([]byte(v.code), []byte(code)) != 1 {
+		if v.attempts >= maxVerifyAttempts {
+			delete(verifications, id)
+		}
+		return errutil.ErrVerifyFailed
+	}
+	return nil
+}
+
+func consumeVerification(id string) {
+	verifyMu.Lock()
+	delete(verifications, id)
+	verifyMu.Unlock()
+}
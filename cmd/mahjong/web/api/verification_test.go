@@ -0,0 +1,73 @@
+package api
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+func TestSendLimiter(t *testing.T) {
+	l := newSendLimiter(time.Minute, 2, 3)
+	now := time.Date(2026, 10, 18, 12, 0, 0, 0, time.Local)
+
+	if !l.allow("13800000000", "10.0.0.1", now) {
+		t.Fatal("first request should be allowed")
+	}
+	if l.allow("13800000000", "10.0.0.1", now.Add(30*time.Second)) {
+		t.Fatal("request within interval should be limited")
+	}
+	if !l.allow("13800000000", "10.0.0.1", now.Add(time.Minute)) {
+		t.Fatal("request after interval should be allowed")
+	}
+	if l.allow("13800000000", "10.0.0.1", now.Add(2*time.Minute)) {
+		t.Fatal("phone daily limit exceeded")
+	}
+	if !l.allow("13800000001", "10.0.0.1", now.Add(2*time.Minute)) {
+		t.Fatal("other phone should be allowed")
+	}
+	if l.allow("13800000002", "10.0.0.1", now.Add(2*time.Minute)) {
+		t.Fatal("ip hourly limit exceeded")
+	}
+
+	// 第二天重新计数
+	if !l.allow("13800000000", "10.0.0.1", now.Add(24*time.Hour)) {
+		t.Fatal("limit should be reset next day")
+	}
+}
+
+func TestCheckVerification(t *testing.T) {
+	const phone = "13800000000"
+	verifications["v1"] = &verification{
+		phone:    phone,
+		typ:      protocol.VerificationTypeRegister,
+		code:     "123456",
+		expireAt: time.Now().Add(time.Minute),
+	}
+
+	if err := checkVerification("v1", "123456", phone, protocol.VerificationTypeFindPW); err != errutil.ErrVerifyFailed {
+		t.Fatalf("expect verify failed with wrong type, got: %v", err)
+	}
+	if err := checkVerification("v1", "123456", phone, protocol.VerificationTypeRegister); err != nil {
+		t.Fatal(err)
+	}
+	consumeVerification("v1")
+	if err := checkVerification("v1", "123456", phone, protocol.VerificationTypeRegister); err != errutil.ErrVerifyFailed {
+		t.Fatalf("expect verify failed after consumed, got: %v", err)
+	}
+
+	// 错误次数过多时验证码失效
+	verifications["v2"] = &verification{
+		phone:    phone,
+		typ:      protocol.VerificationTypeRegister,
+		code:     "123456",
+		expireAt: time.Now().Add(time.Minute),
+	}
+	for i := 0; i < maxVerifyAttempts; i++ {
+		checkVerification("v2", "000000", phone, protocol.VerificationTypeRegister)
+	}
+	if err := checkVerification("v2", "123456", phone, protocol.VerificationTypeRegister); err != errutil.ErrVerifyFailed {
+		t.Fatalf("expect verify failed after too many attempts, got: %v", err)
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/lonng/nanoserver/pkg/errutil"
 	"github.com/lonng/nanoserver/protocol"
 	"github.com/lonng/nex"
+	"github.com/pborman/uuid"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -78,24 +79,92 @@ func rechargeHandler(data *protocol.RechargeRequest) (*protocol.StringMessage, e
 	if data.Uid < 1 || data.Count < 1 {
 		return nil, errutil.ErrIllegalParameter
 	}
-	u, err := db.QueryUser(data.Uid)
-	if err != nil {
-		return nil, err
+	key := data.Key
+	if key == "" {
+		key = strings.Replace(uuid.New(), "-", "", -1)
 	}
 
-	u.Coin += data.Count
-
-	if err := db.UpdateUser(u); err != nil {
+	l, err := db.ChangeBalance(&db.CoinChange{
+		Account: db.LedgerAccountUser,
+		Id:      data.Uid,
+		Amount:  data.Count,
+		Reason:  db.LedgerReasonRecharge,
+		Ref:     data.Operator,
+		Key:     "gm:" + key,
+	})
+	if err != nil {
 		return nil, err
 	}
 
 	// 通知客户端
-	game.Recharge(u.Id, u.Coin)
+	game.Recharge(data.Uid, l.Balance)
 
 	log.Infof("给玩家充值: Uid=%d, end=%d", data.Uid, data.Count)
 	return protocol.SuccessMessage, nil
 }
 
+// 退款, 支付平台退款成功后扣回充值的房卡
+func refundHandler(data *protocol.RefundRequest) (*protocol.StringMessage, error) {
+	if data.OrderId == "" || strings.TrimSpace(data.Reason) == "" {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	log.Infof("GM申请退款: OrderId=%s, Reason=%s, Operator=%s", data.OrderId, data.Reason, data.Operator)
+	if _, err := api.Refund(data.OrderId, strings.TrimSpace(data.Reason), data.Operator); err != nil {
+		return nil, err
+	}
+	return protocol.SuccessMessage, nil
+}
+
+// http://127.0.0.1:12307/v1/gm/refunds?uid=10001&offset=0&count=20, 不指定uid时查询所有退款
+func refundListHandler(query *nex.Form) (*protocol.RefundListResponse, error) {
+	uid := query.Int64OrDefault("uid", -1)
+	offset := query.IntOrDefault("offset", 0)
+	count := query.IntOrDefault("count", 20)
+	list, total, err := db.RefundList(uid, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.RefundInfo, len(list))
+	for i, r := range list {
+		data[i] = protocol.RefundInfo{
+			RefundId:    r.RefundId,
+			OrderId:     r.OrderId,
+			Uid:         r.Uid,
+			PayPlatform: r.PayPlatform,
+			PayRefundId: r.PayRefundId,
+			Fee:         r.Fee,
+			Coin:        r.Coin,
+			Debt:        r.Debt,
+			Source:      r.Source,
+			Reason:      r.Reason,
+			Operator:    r.Operator,
+			Status:      r.Status,
+			Error:       r.Error,
+			CreatedAt:   r.CreatedAt,
+			FinishedAt:  r.FinishedAt,
+		}
+	}
+	return &protocol.RefundListResponse{Data: data, Total: total}, nil
+}
+
+// 代理创建俱乐部, 指定的玩家成为部长
+func createClubHandler(data *protocol.CreateClubRequest) (*protocol.CreateClubResponse, error) {
+	name := strings.TrimSpace(data.Name)
+	if data.AgentId < 1 || data.Uid < 1 || name == "" || data.MaxMember < 0 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	c, err := db.CreateClub(data.AgentId, data.Uid, name, strings.TrimSpace(data.Desc), data.MaxMember)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("创建俱乐部: ClubId=%d, AgentId=%d, Owner=%d, Name=%s", c.ClubId, data.AgentId, data.Uid, name)
+	return &protocol.CreateClubResponse{ClubId: c.ClubId}, nil
+}
+
 // http://127.0.0.1:12306/v1/gm/consume?consume="4/1,8/1,16/2"
 func cardConsumeHandler(query *nex.Form) (*protocol.StringMessage, error) {
 	consume := query.Get("consume")
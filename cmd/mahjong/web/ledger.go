@@ -0,0 +1,78 @@
+package web
+
+import (
+	"time"
+
+	"github.com/lonng/nanoserver/db"
+	"github.com/lonng/nanoserver/pkg/errutil"
+	"github.com/lonng/nanoserver/protocol"
+	"github.com/lonng/nex"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// http://127.0.0.1:12307/v1/gm/ledger?uid=10001&offset=0&count=20, 俱乐部使用club=俱乐部ID
+func ledgerHandler(query *nex.Form) (*protocol.LedgerListResponse, error) {
+	account, id := db.LedgerAccountUser, query.Int64OrDefault("uid", -1)
+	if club := query.Int64OrDefault("club", -1); club > 0 {
+		account, id = db.LedgerAccountClub, club
+	}
+	if id <= 0 {
+		return nil, errutil.ErrIllegalParameter
+	}
+
+	offset := query.IntOrDefault("offset", 0)
+	count := query.IntOrDefault("count", 20)
+	list, total, err := db.LedgerList(account, id, offset, count)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]protocol.LedgerEntry, len(list))
+	for i, l := range list {
+		data[i] = protocol.LedgerEntry{
+			Id:        l.Id,
+			Amount:    l.Amount,
+			Balance:   l.Balance,
+			Reason:    l.Reason,
+			Ref:       l.Ref,
+			CreatedAt: l.CreatedAt,
+		}
+	}
+	return &protocol.LedgerListResponse{Data: data, Total: total}, nil
+}
+
+func reconcileHandler() ([]db.LedgerMismatch, error) {
+	return reconcile()
+}
+
+// 检查余额和流水合计是否一致, 不一致说明有绕过流水修改余额的地方
+func reconcile() ([]db.LedgerMismatch, error) {
+	list, err := db.ReconcileLedger()
+	if err != nil {
+		log.Errorf("余额对账失败: %v", err)
+		return nil, err
+	}
+
+	for _, m := range list {
+		log.Errorf("余额和流水不一致: Account=%d, Id=%d, 余额=%d, 流水合计=%d", m.Account, m.Id, m.Balance, m.Total)
+	}
+	log.Infof("余额对账完成, 不一致的账户数量: %d", len(list))
+	return list, nil
+}
+
+// 定时对账, 间隔为0时不执行
+func startReconcile() {
+	interval := viper.GetInt("ledger.reconcile")
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Duration(interval) * time.Second)
+		defer ticker.Stop()
+		for range ticker.C {
+			reconcile()
+		}
+	}()
+}
@@ -0,0 +1,72 @@
+package web
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lonng/nanoserver/cmd/mahjong/web/api/provider"
+	"github.com/lonng/nanoserver/db"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+// 定时把超时未支付的订单标记为过期, 过期时间为0时不执行
+func startExpireOrders() {
+	ttl := viper.GetInt64("order.expire")
+	if ttl <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := db.ExpireOrders(ttl)
+			if err != nil {
+				log.Errorf("订单过期处理失败: %v", err)
+				continue
+			}
+			if n > 0 {
+				log.Infof("过期订单数量: %d", n)
+			}
+		}
+	}()
+}
+
+// ReconcileStatement 比较支付平台的对账单和指定日期(格式: 20060102)的交易记录, 输出不一致的交易
+func ReconcileStatement(platform, file, date string) error {
+	day, err := time.ParseInLocation("20060102", date, time.Local)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	parser, err := provider.Statement(platform)
+	if err != nil {
+		return fmt.Errorf("不支持对账的支付平台: %s", platform)
+	}
+	items, err := parser.ParseStatement(f)
+	if err != nil {
+		return err
+	}
+
+	closer := dbStartup()
+	defer closer()
+
+	list, err := db.ReconcileTrades(platform, items, day.Unix(), day.AddDate(0, 0, 1).Unix())
+	if err != nil {
+		return err
+	}
+
+	for _, m := range list {
+		fmt.Printf("type=%d order_id=%s pay_order_id=%s fee=%d money=%d\n", m.Type, m.OrderId, m.PayOrderId, m.Fee, m.Money)
+	}
+	fmt.Printf("对账完成: 对账单交易数量=%d, 不一致的交易数量=%d\n", len(items), len(list))
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/lonng/nanoserver/cmd/mahjong/game"
 	"github.com/lonng/nanoserver/cmd/mahjong/web/api"
 	"github.com/lonng/nanoserver/db"
 	"github.com/lonng/nanoserver/pkg/algoutil"
@@ -70,6 +71,8 @@ func startupService() http.Handler {
 	)
 
 	nex.Before(logRequest)
+	api.OnTokenRevoked(func(uid int64) { game.Kick(uid) })
+	api.OnBalanceChanged(game.Recharge)
 	mux.Handle("/v1/user/", api.MakeLoginService())
 	mux.Handle("/v1/order/", api.MakeOrderService())
 	mux.Handle("/v1/history/", api.MakeHistoryService())
@@ -77,13 +80,18 @@ func startupService() http.Handler {
 	mux.Handle("/v1/version", nex.Handler(version))
 
 	// GM系统命令
-	mux.Handle("/v1/gm/reset", nex.Handler(resetPlayerHandler).Before(authFilter))   // 重置玩家未完成房间状态
-	mux.Handle("/v1/gm/consume", nex.Handler(cardConsumeHandler).Before(authFilter)) // 设置房卡消耗
-	mux.Handle("/v1/gm/broadcast", nex.Handler(broadcast).Before(authFilter))        // 消息广播
-	mux.Handle("/v1/gm/kick", nex.Handler(kickHandler).Before(authFilter))           // 踢人
-	mux.Handle("/v1/gm/online", nex.Handler(onlineHandler).Before(authFilter))       // 在线信息
-	mux.Handle("/v1/gm/recharge", nex.Handler(rechargeHandler).Before(authFilter))   // 玩家充值
-	mux.Handle("/v1/gm/query/user/", nex.Handler(userInfoHandler))                   // 玩家信息查询
+	mux.Handle("/v1/gm/reset", nex.Handler(resetPlayerHandler).Before(authFilter))          // 重置玩家未完成房间状态
+	mux.Handle("/v1/gm/consume", nex.Handler(cardConsumeHandler).Before(authFilter))        // 设置房卡消耗
+	mux.Handle("/v1/gm/broadcast", nex.Handler(broadcast).Before(authFilter))               // 消息广播
+	mux.Handle("/v1/gm/kick", nex.Handler(kickHandler).Before(authFilter))                  // 踢人
+	mux.Handle("/v1/gm/online", nex.Handler(onlineHandler).Before(authFilter))              // 在线信息
+	mux.Handle("/v1/gm/recharge", nex.Handler(rechargeHandler).Before(authFilter))          // 玩家充值
+	mux.Handle("/v1/gm/refund", nex.Handler(refundHandler).Before(authFilter))              // 退款
+	mux.Handle("/v1/gm/refunds", nex.Handler(refundListHandler).Before(authFilter))         // 退款记录
+	mux.Handle("/v1/gm/club/create", nex.Handler(createClubHandler).Before(authFilter))     // 创建俱乐部
+	mux.Handle("/v1/gm/query/user/", nex.Handler(userInfoHandler))                          // 玩家信息查询
+	mux.Handle("/v1/gm/ledger", nex.Handler(ledgerHandler).Before(authFilter))              // 余额流水
+	mux.Handle("/v1/gm/ledger/reconcile", nex.Handler(reconcileHandler).Before(authFilter)) // 余额对账
 
 	//统计后台
 	mux.Handle("/v1/stats/user/register", nex.Handler(registerUsersHandler).Before(authFilter))     // 注册人数
@@ -106,6 +114,15 @@ func Startup() {
 	// enable white list
 	enableWhiteList()
 
+	// 同步商品目录
+	api.SetupProducts()
+
+	// 定时对账
+	startReconcile()
+
+	// 定时过期未支付的订单
+	startExpireOrders()
+
 	var (
 		addr      = viper.GetString("webserver.addr")
 		cert      = viper.GetString("webserver.certificates.cert")
@@ -133,4 +150,7 @@ func Startup() {
 	case s := <-sg:
 		log.Infof("got signal: %s", s.String())
 	}
+
+	// 游戏服务器停服时需要等待牌局结束并写完数据, 之后才能关闭数据库
+	game.WaitShutdown()
 }
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+// QueryUserByName 使用账号查询用户
+func QueryUserByName(name string) (*model.User, error) {
+	if name == "" {
+		return nil, errutil.ErrUserNameNotFound
+	}
+	u := &model.User{Name: name}
+	has, err := database.Get(u)
+	if err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+	if !has {
+		return nil, errutil.ErrUserNameNotFound
+	}
+	return u, nil
+}
+
+// QueryUserByPhone 使用绑定的手机号查询用户
+func QueryUserByPhone(phone string) (*model.User, error) {
+	if phone == "" {
+		return nil, errutil.ErrUserNotFound
+	}
+	u := &model.User{Phone: phone}
+	has, err := database.Get(u)
+	if err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+	if !has {
+		return nil, errutil.ErrUserNotFound
+	}
+	return u, nil
+}
+
+// IsPhoneExists 手机号是否已经绑定
+func IsPhoneExists(phone string) (bool, error) {
+	return database.Exist(&model.User{Phone: phone})
+}
+
+// RegisterAccount 注册账号, 账号和手机号不能和已有的用户重复
+func RegisterAccount(u *model.User) error {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	if u.Name != "" {
+		has, err := session.Exist(&model.User{Name: u.Name})
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+		if has {
+			session.Rollback()
+			return errutil.ErrUserNameExists
+		}
+	}
+	if u.Phone != "" {
+		has, err := session.Exist(&model.User{Phone: u.Phone})
+		if err != nil {
+			session.Rollback()
+			return err
+		}
+		if has {
+			session.Rollback()
+			return errutil.ErrPhoneExists
+		}
+	}
+
+	// 上面的检查没有加锁, 并发注册时由唯一索引保证不重复
+	if err := insertUser(session, u); err != nil {
+		session.Rollback()
+		return duplicateError(err)
+	}
+	return session.Commit()
+}
+
+// 是否唯一索引冲突
+func isDuplicate(err error) bool {
+	e, ok := err.(*mysql.MySQLError)
+	return ok && e.Number == mysqlErrDupEntry
+}
+
+// 唯一索引冲突转换为对应的错误
+func duplicateError(err error) error {
+	if !isDuplicate(err) {
+		return err
+	}
+	e := err.(*mysql.MySQLError)
+	switch {
+	case strings.Contains(e.Message, "UQE_user_name"):
+		return errutil.ErrUserNameExists
+	case strings.Contains(e.Message, "UQE_user_phone"):
+		return errutil.ErrPhoneExists
+	}
+	return err
+}
+
+// ResetPassword 重置手机号绑定账号的密码, 同时注销之前签发的登录凭证
+func ResetPassword(phone, algo, hash, salt string) (*model.User, error) {
+	u, err := QueryUserByPhone(phone)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = database.Id(u.Id).Cols("algo", "hash", "salt").Incr("token_version").
+		Update(&model.User{Algo: algo, Hash: hash, Salt: salt})
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
@@ -0,0 +1,224 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-xorm/xorm"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+// BindThirdAccount 把三方账号绑定到游客, 游客的房卡、俱乐部和战绩保持不变. 三方账号已经属于
+// 其他用户时返回ErrAccountExists
+func BindThirdAccount(uid int64, account *model.ThirdAccount) error {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	if _, err := lockGuest(session, uid); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	has, err := session.Exist(&model.ThirdAccount{ThirdAccount: account.ThirdAccount, Platform: account.Platform})
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	if has {
+		session.Rollback()
+		return errutil.ErrAccountExists
+	}
+
+	account.Uid = uid
+	if _, err := session.Insert(account); err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// BindPhone 把手机号和密码绑定到游客, 手机号已经属于其他用户时返回ErrPhoneExists
+func BindPhone(uid int64, phone, algo, hash, salt string) error {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	if _, err := lockGuest(session, uid); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	has, err := session.Exist(&model.User{Phone: phone})
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	if has {
+		session.Rollback()
+		return errutil.ErrPhoneExists
+	}
+
+	_, err = session.Id(uid).Cols("phone", "algo", "hash", "salt").
+		Update(&model.User{Phone: phone, Algo: algo, Hash: hash, Salt: salt})
+	if err != nil {
+		session.Rollback()
+		return duplicateError(err)
+	}
+	return session.Commit()
+}
+
+// MergeGuest 把游客合并到已经存在的用户: 房卡通过流水转入, 俱乐部成员资格转移, 战绩通过Uuid表
+// 关联到新用户. 合并后游客标记为已绑定并注销登录凭证, 不能再登录
+func MergeGuest(guestID, uid int64, appID string) error {
+	if guestID == uid {
+		return errutil.ErrIllegalParameter
+	}
+
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	guest, err := lockGuest(session, guestID)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+
+	for _, c := range mergeCoinChanges(guest, uid) {
+		if _, err := changeBalance(session, c); err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+
+	if err := mergeClubs(session, guestID, uid); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	if _, err := session.Insert(&model.Uuid{UidInUse: uid, UidOrigin: guestID, Appid: appID}); err != nil {
+		session.Rollback()
+		return err
+	}
+
+	_, err = session.Id(guestID).Cols("status").Incr("token_version").Update(&model.User{Status: StatusBound})
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// 游客的房卡转移到新用户, 退款欠下的房卡(负数余额)同样转移, 新用户的余额可以因此变为负数
+func mergeCoinChanges(guest *model.User, uid int64) []*CoinChange {
+	if guest.Coin == 0 {
+		return nil
+	}
+	changes := []*CoinChange{
+		{Id: guest.Id, Amount: -guest.Coin, Ref: strconv.FormatInt(uid, 10), Key: fmt.Sprintf("merge:out:%d", guest.Id)},
+		{Id: uid, Amount: guest.Coin, Ref: strconv.FormatInt(guest.Id, 10), Key: fmt.Sprintf("merge:in:%d", guest.Id)},
+	}
+	for _, c := range changes {
+		c.Account = LedgerAccountUser
+		c.Reason = LedgerReasonMerge
+		c.Overdraft = guest.Coin < 0
+	}
+	return changes
+}
+
+// 锁定游客, 已经绑定过的用户返回ErrAccountBound
+func lockGuest(session *xorm.Session, uid int64) (*model.User, error) {
+	u := &model.User{}
+	has, err := session.Id(uid).ForUpdate().Get(u)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errutil.ErrUserNotFound
+	}
+	if u.Status != StatusNormal || u.Name != "" || u.Phone != "" {
+		return nil, errutil.ErrAccountBound
+	}
+	has, err = session.Exist(&model.ThirdAccount{Uid: uid})
+	if err != nil {
+		return nil, err
+	}
+	if has {
+		return nil, errutil.ErrAccountBound
+	}
+	return u, nil
+}
+
+// 游客的俱乐部转移到新用户, 新用户已经在俱乐部中时保留状态和角色更好的一条记录
+func mergeClubs(session *xorm.Session, guestID, uid int64) error {
+	list := []model.UserClub{}
+	if err := session.Where("uid=?", guestID).Find(&list); err != nil {
+		return err
+	}
+
+	for _, uc := range list {
+		exist := &model.UserClub{}
+		has, err := session.Where("uid=? AND club_id=?", uid, uc.ClubId).Get(exist)
+		if err != nil {
+			return err
+		}
+
+		if !has {
+			if _, err := session.Id(uc.Id).Cols("uid").Update(&model.UserClub{Uid: uid}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if uc.Status == model.UserClubStatusAgree {
+			if exist.Status != model.UserClubStatusAgree {
+				// 新用户只是在申请中, 使用游客的成员资格, 成员数量不变
+				exist.Status, exist.Role = uc.Status, uc.Role
+			} else {
+				// 两个账号都是成员, 保留更高的角色, 成员数量减1
+				if uc.Role < exist.Role {
+					exist.Role = uc.Role
+				}
+				c, err := lockClub(session, uc.ClubId)
+				if err != nil {
+					return err
+				}
+				if err := changeClubMember(session, c, -1); err != nil {
+					return err
+				}
+			}
+			if _, err := session.Id(exist.Id).Cols("status", "role").Update(exist); err != nil {
+				return err
+			}
+		}
+		if _, err := session.Id(uc.Id).Delete(&model.UserClub{}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MergedUids 用户和合并到该用户的游客ID, 用于查询战绩
+func MergedUids(uid int64) ([]int64, error) {
+	list := []model.Uuid{}
+	if err := database.Where("uid_in_use=?", uid).Find(&list); err != nil {
+		return nil, err
+	}
+
+	uids := []int64{uid}
+	for _, u := range list {
+		uids = append(uids, u.UidOrigin)
+	}
+	return uids, nil
+}
@@ -0,0 +1,36 @@
+package db
+
+import (
+	"testing"
+
+	"github.com/lonng/nanoserver/db/model"
+)
+
+func TestMergeCoinChanges(t *testing.T) {
+	if changes := mergeCoinChanges(&model.User{Id: 1}, 2); len(changes) != 0 {
+		t.Fatalf("expect no changes for empty balance, got %d", len(changes))
+	}
+
+	// 游客退款欠下的房卡转移到新用户
+	changes := mergeCoinChanges(&model.User{Id: 1, Coin: -3}, 2)
+	if len(changes) != 2 {
+		t.Fatalf("expect 2 changes, got %d", len(changes))
+	}
+	out, in := changes[0], changes[1]
+	if out.Id != 1 || out.Amount != 3 || in.Id != 2 || in.Amount != -3 {
+		t.Fatalf("unexpected changes: %+v %+v", out, in)
+	}
+	if !in.Overdraft {
+		t.Fatal("expect overdraft for the debt moved to the new user")
+	}
+
+	changes = mergeCoinChanges(&model.User{Id: 1, Coin: 5}, 2)
+	if len(changes) != 2 || changes[0].Amount != -5 || changes[1].Amount != 5 || changes[1].Overdraft {
+		t.Fatalf("unexpected changes: %+v %+v", changes[0], changes[1])
+	}
+	for _, c := range changes {
+		if c.Account != LedgerAccountUser || c.Reason != LedgerReasonMerge {
+			t.Fatalf("unexpected ledger account or reason: %+v", c)
+		}
+	}
+}
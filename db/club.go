@@ -3,9 +3,28 @@ package db
 import (
 	"errors"
 	"fmt"
+	"math/rand"
 	"time"
 
+	"github.com/go-xorm/xorm"
 	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/protocol"
+)
+
+const (
+	minClubId        = 100000
+	maxClubId        = 1000000
+	defaultMaxMember = 500
+)
+
+var (
+	errClubNotFound       = errors.New("俱乐部不存在")
+	errClubFull           = errors.New("俱乐部人数已满")
+	errClubPermission     = errors.New("没有权限执行该操作")
+	errClubMemberNotFound = errors.New("该玩家不是俱乐部成员")
+	errClubApplyNotFound  = errors.New("没有找到该玩家的申请")
+	errClubOwnerLeave     = errors.New("部长不能退出俱乐部")
+	errClubApplied        = errors.New("你已申请加入该俱乐部，等待部长同意")
 )
 
 func IsClubMember(clubId, uid int64) bool {
@@ -35,7 +54,7 @@ func IsBalanceEnough(clubId int64) bool {
 }
 
 func ApplyClub(uid, clubId int64) error {
-	if clubId < 100000 || clubId >= 1000000 {
+	if clubId < minClubId || clubId >= maxClubId {
 		return fmt.Errorf("俱乐部ID%d错误，请输入正确的俱乐部ID", clubId)
 	}
 
@@ -48,14 +67,12 @@ func ApplyClub(uid, clubId int64) error {
 	if !ok {
 		return fmt.Errorf("ID为%d的俱乐部不存在，请检查是否输入错误", clubId)
 	}
-
-	uc := &model.UserClub{
-		Uid:       uid,
-		ClubId:    clubId,
-		CreatedAt: time.Now().Unix(),
+	if c.Member >= c.MaxMember {
+		return errClubFull
 	}
 
-	ok, err = database.Get(uc)
+	uc := &model.UserClub{}
+	ok, err = database.Where("uid=? AND club_id=?", uid, clubId).Get(uc)
 	if err != nil {
 		return err
 	}
@@ -64,14 +81,20 @@ func ApplyClub(uid, clubId int64) error {
 		if uc.Status == model.UserClubStatusAgree {
 			return errors.New("你已加入该俱乐部，无需申请")
 		}
-
-		if uc.Status == model.UserClubStatusApply {
-			return errors.New("你已申请加入该俱乐部，等待部长同意")
-		}
+		return errClubApplied
 	}
 
-	uc.Status = model.UserClubStatusApply
-	_, err = database.Insert(uc)
+	uc = &model.UserClub{
+		Uid:       uid,
+		ClubId:    clubId,
+		CreatedAt: time.Now().Unix(),
+		Status:    model.UserClubStatusApply,
+		Role:      model.UserClubRoleMember,
+	}
+	// 同时提交的申请由唯一索引保证只有一条记录
+	if _, err = database.Insert(uc); isDuplicate(err) {
+		return errClubApplied
+	}
 	return err
 }
 
@@ -101,36 +124,356 @@ func ClubList(uid int64) ([]model.Club, error) {
 	return ret, nil
 }
 
-func ClubLoseBalance(clubId, balance int64, consume *model.CardConsume) error {
+// ClubRoles 玩家在已经加入的俱乐部中的角色, 俱乐部ID -> 角色
+func ClubRoles(uid int64) (map[int64]int, error) {
+	list := []model.UserClub{}
+	if err := database.Find(&list, &model.UserClub{Uid: uid, Status: model.UserClubStatusAgree}); err != nil {
+		return nil, err
+	}
+
+	roles := make(map[int64]int, len(list))
+	for _, uc := range list {
+		roles[uc.ClubId] = uc.Role
+	}
+	return roles, nil
+}
+
+// CreateClub 代理创建俱乐部, 俱乐部ID随机生成, 指定的玩家成为部长
+func CreateClub(agentId, owner int64, name, desc string, maxMember int) (*model.Club, error) {
+	if maxMember <= 0 {
+		maxMember = defaultMaxMember
+	}
+
+	if has, err := database.Exist(&model.Agent{Id: agentId}); err != nil || !has {
+		return nil, fmt.Errorf("代理%d不存在", agentId)
+	}
+	if !IsUserExists(owner) {
+		return nil, fmt.Errorf("玩家%d不存在", owner)
+	}
+
 	session := database.NewSession()
 	defer session.Close()
 
 	if err := session.Begin(); err != nil {
-		return err
+		return nil, err
 	}
 
-	c := &model.Club{ClubId: clubId}
-	has, err := session.Get(c)
+	c := &model.Club{
+		AgentId:   agentId,
+		Name:      name,
+		Desc:      desc,
+		Member:    1,
+		MaxMember: maxMember,
+		CreatedAt: time.Now().Unix(),
+	}
+	for i := 0; ; i++ {
+		if i >= 10 {
+			session.Rollback()
+			return nil, errors.New("生成俱乐部ID失败")
+		}
+		c.ClubId = minClubId + rand.Int63n(maxClubId-minClubId)
+		has, err := session.Exist(&model.Club{ClubId: c.ClubId})
+		if err != nil {
+			session.Rollback()
+			return nil, err
+		}
+		if !has {
+			break
+		}
+	}
+
+	if _, err := session.Insert(c); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	uc := &model.UserClub{
+		Uid:       owner,
+		ClubId:    c.ClubId,
+		CreatedAt: c.CreatedAt,
+		Status:    model.UserClubStatusAgree,
+		Role:      model.UserClubRoleOwner,
+	}
+	if _, err := session.Insert(uc); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	return c, session.Commit()
+}
+
+// ApproveClub 管理员同意申请, 成员数量达到上限时不能同意
+func ApproveClub(operator, clubId, uid int64) (*model.Club, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	c, apply, err := checkClubOperation(session, operator, clubId, uid, model.UserClubRoleAdmin)
+	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if apply.Status != model.UserClubStatusApply {
+		session.Rollback()
+		return nil, errClubApplyNotFound
+	}
+	if c.Member >= c.MaxMember {
+		session.Rollback()
+		return nil, errClubFull
+	}
+
+	apply.Status = model.UserClubStatusAgree
+	apply.Role = model.UserClubRoleMember
+	if _, err := session.Id(apply.Id).Cols("status", "role").Update(apply); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if err := changeClubMember(session, c, 1); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	return c, session.Commit()
+}
+
+// RejectClub 管理员拒绝申请, 删除申请记录, 玩家可以重新申请
+func RejectClub(operator, clubId, uid int64) (*model.Club, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	c, apply, err := checkClubOperation(session, operator, clubId, uid, model.UserClubRoleAdmin)
+	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if apply.Status != model.UserClubStatusApply {
+		session.Rollback()
+		return nil, errClubApplyNotFound
+	}
+
+	if _, err := session.Id(apply.Id).Delete(&model.UserClub{}); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	return c, session.Commit()
+}
+
+// KickClub 踢出成员, 只能踢出角色比自己低的成员
+func KickClub(operator, clubId, uid int64) (*model.Club, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	c, member, err := checkClubOperation(session, operator, clubId, uid, model.UserClubRoleAdmin)
 	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if member.Status != model.UserClubStatusAgree {
+		session.Rollback()
+		return nil, errClubMemberNotFound
+	}
+
+	if _, err := session.Id(member.Id).Delete(&model.UserClub{}); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if err := changeClubMember(session, c, -1); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	return c, session.Commit()
+}
+
+// LeaveClub 退出俱乐部或者取消申请, 部长不能退出
+func LeaveClub(uid, clubId int64) error {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
 		return err
 	}
 
+	c, err := lockClub(session, clubId)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
+	uc := &model.UserClub{}
+	has, err := session.Where("uid=? AND club_id=?", uid, clubId).Get(uc)
+	if err != nil {
+		session.Rollback()
+		return err
+	}
 	if !has {
-		return fmt.Errorf("俱乐部不存在，ID=%d", clubId)
+		session.Rollback()
+		return errClubMemberNotFound
+	}
+	if uc.Status == model.UserClubStatusAgree && uc.Role == model.UserClubRoleOwner {
+		session.Rollback()
+		return errClubOwnerLeave
 	}
 
-	c.Balance -= balance
-
-	//FIXED: 用户剩余1的时候, 扣除不成功
-	if _, err := session.Cols("balance").Where("club_id=?", clubId).Update(c); err != nil {
+	if _, err := session.Id(uc.Id).Delete(&model.UserClub{}); err != nil {
 		session.Rollback()
 		return err
 	}
+	if uc.Status == model.UserClubStatusAgree {
+		if err := changeClubMember(session, c, -1); err != nil {
+			session.Rollback()
+			return err
+		}
+	}
+	return session.Commit()
+}
+
+// SetClubRole 部长设置或者取消管理员
+func SetClubRole(operator, clubId, uid int64, role int) error {
+	if role != model.UserClubRoleAdmin && role != model.UserClubRoleMember {
+		return errClubPermission
+	}
 
-	if _, err := session.Insert(consume); err != nil {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	_, member, err := checkClubOperation(session, operator, clubId, uid, model.UserClubRoleOwner)
+	if err != nil {
 		session.Rollback()
 		return err
 	}
+	if member.Status != model.UserClubStatusAgree {
+		session.Rollback()
+		return errClubMemberNotFound
+	}
 
+	if _, err := session.Id(member.Id).Cols("role").Update(&model.UserClub{Role: role}); err != nil {
+		session.Rollback()
+		return err
+	}
 	return session.Commit()
 }
+
+// ClubMembers 俱乐部成员或者申请列表, 只有管理员可以查看申请列表
+func ClubMembers(operator, clubId int64, status int) ([]protocol.ClubMember, error) {
+	self := &model.UserClub{}
+	has, err := database.Where("uid=? AND club_id=? AND status=?", operator, clubId, model.UserClubStatusAgree).Get(self)
+	if err != nil {
+		return nil, err
+	}
+	if !has || (status == model.UserClubStatusApply && self.Role > model.UserClubRoleAdmin) {
+		return nil, errClubPermission
+	}
+
+	list := []model.UserClub{}
+	if err := database.Where("club_id=? AND status=?", clubId, status).Asc("role", "id").Find(&list); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return []protocol.ClubMember{}, nil
+	}
+
+	uids := make([]int64, len(list))
+	for i, uc := range list {
+		uids[i] = uc.Uid
+	}
+	thirds := []model.ThirdAccount{}
+	if err := database.In("uid", uids).Find(&thirds); err != nil {
+		return nil, err
+	}
+	users := []model.User{}
+	if err := database.In("id", uids).Cols("id", "name").Find(&users); err != nil {
+		return nil, err
+	}
+
+	names := map[int64]string{}
+	for _, u := range users {
+		if u.Name != "" {
+			names[u.Id] = u.Name
+		}
+	}
+	heads := map[int64]string{}
+	for _, t := range thirds {
+		names[t.Uid], heads[t.Uid] = t.ThirdName, t.HeadUrl
+	}
+
+	members := make([]protocol.ClubMember, len(list))
+	for i, uc := range list {
+		m := protocol.ClubMember{
+			Uid:       uc.Uid,
+			Name:      names[uc.Uid],
+			HeadUrl:   heads[uc.Uid],
+			Role:      uc.Role,
+			Status:    uc.Status,
+			CreatedAt: uc.CreatedAt,
+		}
+		if m.Name == "" {
+			m.Name = fmt.Sprintf("G%d", uc.Uid)
+		}
+		if m.HeadUrl == "" {
+			m.HeadUrl = protocol.GuestHeadUrl
+		}
+		members[i] = m
+	}
+	return members, nil
+}
+
+func lockClub(session *xorm.Session, clubId int64) (*model.Club, error) {
+	c := &model.Club{}
+	has, err := session.Where("club_id=?", clubId).ForUpdate().Get(c)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errClubNotFound
+	}
+	return c, nil
+}
+
+// 锁定俱乐部并检查操作者的权限, 操作者的角色至少为role并且高于目标玩家, 返回目标玩家的记录
+func checkClubOperation(session *xorm.Session, operator, clubId, uid int64, role int) (*model.Club, *model.UserClub, error) {
+	c, err := lockClub(session, clubId)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	self := &model.UserClub{}
+	has, err := session.Where("uid=? AND club_id=? AND status=?", operator, clubId, model.UserClubStatusAgree).Get(self)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !has || self.Role > role {
+		return nil, nil, errClubPermission
+	}
+
+	target := &model.UserClub{}
+	has, err = session.Where("uid=? AND club_id=?", uid, clubId).Get(target)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !has {
+		return nil, nil, errClubMemberNotFound
+	}
+	if target.Status == model.UserClubStatusAgree && target.Role <= self.Role {
+		return nil, nil, errClubPermission
+	}
+	return c, target, nil
+}
+
+func changeClubMember(session *xorm.Session, c *model.Club, delta int) error {
+	c.Member += delta
+	_, err := session.Id(c.Id).Cols("member").Update(&model.Club{Member: c.Member})
+	return err
+}
@@ -10,8 +10,9 @@ const (
 
 // Users表中role字段的取值
 const (
-	RoleTypeAdmin = 1 //管理员账号
-	RoleTypeThird = 2 //三方平台账号
+	RoleTypeAdmin   = 1 //管理员账号
+	RoleTypeThird   = 2 //三方平台账号
+	RoleTypeAccount = 3 //账号密码注册
 )
 
 const (
@@ -21,6 +22,9 @@ const (
 	OpActionDelete    = 4 //账号删除
 )
 
+// 密码散列算法, 保存在Users表中的algo字段
+const PasswordAlgoSHA1 = "sha1"
+
 const (
 	UserOffline = 1 //离线
 	UserOnline  = 2 //在线
@@ -33,11 +37,15 @@ const (
 	StatusBound   = 4 //绑定
 )
 
-// 订单状态
+// 订单状态, 只能按照orderTransitions中的顺序变化:
+// 创建 -> 已支付 -> 已发货 -> 已退款, 创建 -> 已过期/支付失败
 const (
-	OrderStatusCreated  = 1 //创建
-	OrderStatusPayed    = 2 //完成
-	OrderStatusNotified = 3 //已确认订单
+	OrderStatusCreated   = 1 //创建
+	OrderStatusPaid      = 2 //已支付, 还没有发放房卡
+	OrderStatusFulfilled = 3 //已发放房卡
+	OrderStatusExpired   = 4 //超时未支付
+	OrderStatusFailed    = 5 //支付失败
+	OrderStatusRefunded  = 6 //已退款
 )
 
 const (
@@ -48,6 +56,49 @@ const (
 	OrderTypeTest         //支付测试
 )
 
+// 余额流水的账户类型
+const (
+	LedgerAccountUser = 1 //玩家房卡
+	LedgerAccountClub = 2 //俱乐部余额
+)
+
+// 余额变化原因
+const (
+	LedgerReasonOpening  = 1 //期初余额, 启用流水之前的余额
+	LedgerReasonRegister = 2 //注册赠送
+	LedgerReasonRecharge = 3 //GM充值
+	LedgerReasonPay      = 4 //支付购买
+	LedgerReasonConsume  = 5 //开房消耗
+	LedgerReasonRefund   = 6 //退款扣回
+	LedgerReasonMerge    = 7 //合并游客账号
+)
+
+// 退款状态
+const (
+	RefundStatusPending   = 1 //已申请, 等待支付平台退款
+	RefundStatusSucceeded = 2 //已退款并扣回房卡
+	RefundStatusFailed    = 3 //支付平台退款失败, 可以重试
+)
+
+// 退款发起方
+const (
+	RefundSourceGM       = 1 //GM后台
+	RefundSourceProvider = 2 //支付平台通知, 例如在商户后台直接退款
+)
+
+// 玩家已经消耗了房卡时的退款策略
+const (
+	RefundPolicyBlock = "block" //房卡不足时不允许退款
+	RefundPolicyDebt  = "debt"  //允许退款, 房卡余额为负数, 之后充值时先还清欠款
+)
+
+// 支付对账不一致的类型
+const (
+	TradeMismatchMissing = 1 //对账单中有, 交易记录中没有, 可能丢失了支付通知
+	TradeMismatchUnknown = 2 //交易记录中有, 对账单中没有
+	TradeMismatchAmount  = 3 //金额不一致
+)
+
 const (
 	NotifyResultSuccess = 1 //通知成功
 	NotifyResultFailed  = 2 //通知失败
@@ -72,3 +123,6 @@ const (
 const (
 	DefaultTopN = 10
 )
+
+// MySQL唯一索引冲突的错误码
+const mysqlErrDupEntry = 1062
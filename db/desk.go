@@ -1,6 +1,9 @@
 package db
 
 import (
+	"fmt"
+	"strings"
+
 	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nanoserver/pkg/errutil"
 )
@@ -64,12 +67,64 @@ func DeskList(player int64) ([]model.Desk, int, error) {
 	const (
 		limit = 15
 	)
+	// 包含合并到该玩家的游客账号的战绩
+	uids, err := MergedUids(player)
+	if err != nil {
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	in := strings.TrimSuffix(strings.Repeat("?,", len(uids)), ",")
+	cond := fmt.Sprintf("(player0 IN (%[1]s) OR player1 IN (%[1]s) OR player2 IN (%[1]s) OR player3 IN (%[1]s)) AND round > 0", in)
+	args := make([]interface{}, 0, 4*len(uids))
+	for i := 0; i < 4; i++ {
+		for _, uid := range uids {
+			args = append(args, uid)
+		}
+	}
+
 	result := make([]model.Desk, 0)
-	err := database.Where("(player0 = ? OR player1 = ? OR player2 = ? OR player3 = ? ) AND round > 0",
-		player, player, player, player).Desc("created_at").Limit(limit, 0).Find(&result)
+	err = database.Where(cond, args...).Desc("created_at").Limit(limit, 0).Find(&result)
 
 	if err != nil {
 		return nil, 0, errutil.ErrDBOperation
 	}
 	return result, len(result), nil
 }
+
+// 保存牌桌检查点, 每个房间号只保留最新的一条
+func SaveDeskCheckpoint(c *model.DeskCheckpoint) error {
+	if c == nil || c.DeskNo == "" {
+		return errutil.ErrInvalidParameter
+	}
+
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+	if _, err := session.Where("desk_no = ?", c.DeskNo).Delete(&model.DeskCheckpoint{}); err != nil {
+		session.Rollback()
+		return err
+	}
+	if _, err := session.Insert(c); err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
+
+// 删除牌桌检查点, 房间解散后调用
+func DeleteDeskCheckpoint(no string) error {
+	_, err := database.Where("desk_no = ?", no).Delete(&model.DeskCheckpoint{})
+	return err
+}
+
+// 所有未完成牌桌的检查点
+func QueryDeskCheckpoints() ([]model.DeskCheckpoint, error) {
+	list := make([]model.DeskCheckpoint, 0)
+	if err := database.Find(&list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
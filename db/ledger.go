@@ -0,0 +1,302 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-xorm/xorm"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+// CoinChange 一次余额变化
+type CoinChange struct {
+	Account int    // 账户类型: LedgerAccountUser, LedgerAccountClub
+	Id      int64  // 玩家ID或者俱乐部ID
+	Amount  int64  // 变化数量, 扣除时为负数
+	Reason  int    // 变化原因
+	Ref     string // 关联的订单号、房间ID或者GM账号
+	Key     string // 幂等键, 例如: pay:<订单号>, 相同的键只会生效一次
+
+	Overdraft bool // 允许玩家余额为负数, 例如退款时玩家已经消耗了房卡
+
+	Records []interface{} // 和余额变化在同一个事务中插入的记录, 例如开房消耗记录
+}
+
+// LedgerMismatch 余额和流水合计不一致的账户
+type LedgerMismatch struct {
+	Account int   `json:"account"`
+	Id      int64 `json:"id"`
+	Balance int64 `json:"balance"` //账户余额
+	Total   int64 `json:"total"`   //流水合计
+}
+
+// ChangeBalance 修改余额并追加流水, 两者在同一个事务中完成. 玩家房卡不足时返回ErrCoinNotEnough,
+// 俱乐部余额和设置了Overdraft的玩家余额允许透支. 幂等键已经存在时不做任何修改, 直接返回之前的流水
+func ChangeBalance(c *CoinChange) (*model.Ledger, error) {
+	if c == nil || c.Key == "" || c.Amount == 0 {
+		return nil, errutil.ErrInvalidParameter
+	}
+
+	if l, err := queryLedger(c.Key); err != nil || l != nil {
+		return l, err
+	}
+
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	l, err := changeBalance(session, c)
+	if err != nil {
+		session.Rollback()
+		// 并发的重复请求, 返回先完成的流水
+		if exist, qerr := queryLedger(c.Key); qerr == nil && exist != nil {
+			return exist, nil
+		}
+		return nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// 在调用者的事务中修改余额并追加流水, 例如订单完成时和订单状态一起修改
+func changeBalance(session *xorm.Session, c *CoinChange) (*model.Ledger, error) {
+	balance, err := updateBalance(session, c.Account, c.Id, c.Amount, c.Overdraft)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := openLedger(session, c.Account, c.Id, balance-c.Amount); err != nil {
+		return nil, err
+	}
+
+	l := &model.Ledger{
+		Account:   c.Account,
+		AccountId: c.Id,
+		Amount:    c.Amount,
+		Balance:   balance,
+		Reason:    c.Reason,
+		Ref:       c.Ref,
+		Key:       c.Key,
+		CreatedAt: time.Now().Unix(),
+	}
+	if _, err := session.Insert(l); err != nil {
+		return nil, err
+	}
+
+	for _, r := range c.Records {
+		if _, err := session.Insert(r); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func queryLedger(key string) (*model.Ledger, error) {
+	l := &model.Ledger{Key: key}
+	has, err := database.Get(l)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, nil
+	}
+	return l, nil
+}
+
+// 修改余额并返回修改后的余额, 使用条件更新代替先查询后修改, 并发修改同一个账户不会丢失
+func updateBalance(session *xorm.Session, account int, id, amount int64, overdraft bool) (int64, error) {
+	switch account {
+	case LedgerAccountUser:
+		query := session.Id(id).Incr("coin", amount)
+		if amount < 0 && !overdraft {
+			query = query.Where("coin >= ?", -amount)
+		}
+		n, err := query.Update(&model.User{})
+		if err != nil {
+			return 0, err
+		}
+
+		u := &model.User{}
+		has, err := session.Id(id).Cols("coin").Get(u)
+		if err != nil {
+			return 0, err
+		}
+		if !has {
+			return 0, errutil.ErrUserNotFound
+		}
+		if n == 0 {
+			return 0, errutil.ErrCoinNotEnough
+		}
+		return u.Coin, nil
+
+	case LedgerAccountClub:
+		n, err := session.Where("club_id=?", id).Incr("balance", amount).Update(&model.Club{})
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, fmt.Errorf("俱乐部不存在，ID=%d", id)
+		}
+
+		c := &model.Club{}
+		if _, err := session.Where("club_id=?", id).Cols("balance").Get(c); err != nil {
+			return 0, err
+		}
+		return c.Balance, nil
+	}
+	return 0, errutil.ErrInvalidParameter
+}
+
+// 账户第一次写流水时先写入期初余额, 保证流水合计和余额一致, 调用前必须已经锁定账户
+func openLedger(session *xorm.Session, account int, id, balance int64) error {
+	n, err := session.Where("account=? AND account_id=?", account, id).Count(&model.Ledger{})
+	if err != nil {
+		return err
+	}
+	if n > 0 || balance == 0 {
+		return nil
+	}
+
+	_, err = session.Insert(&model.Ledger{
+		Account:   account,
+		AccountId: id,
+		Amount:    balance,
+		Balance:   balance,
+		Reason:    LedgerReasonOpening,
+		Key:       fmt.Sprintf("opening:%d:%d", account, id),
+		CreatedAt: time.Now().Unix(),
+	})
+	return err
+}
+
+// 新用户的赠送房卡写入流水, 没有账号和手机号时写入NULL, 否则唯一索引会冲突
+func insertUser(session *xorm.Session, u *model.User) error {
+	if _, err := session.Nullable("name", "phone").Insert(u); err != nil {
+		return err
+	}
+	if u.Coin == 0 {
+		return nil
+	}
+
+	_, err := session.Insert(&model.Ledger{
+		Account:   LedgerAccountUser,
+		AccountId: u.Id,
+		Amount:    u.Coin,
+		Balance:   u.Coin,
+		Reason:    LedgerReasonRegister,
+		Key:       fmt.Sprintf("register:%d", u.Id),
+		CreatedAt: time.Now().Unix(),
+	})
+	return err
+}
+
+// LedgerList 查询账户的流水, 按时间倒序
+func LedgerList(account int, id int64, offset, count int) ([]model.Ledger, int, error) {
+	bean := &model.Ledger{Account: account, AccountId: id}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	result := make([]model.Ledger, 0)
+	if count == noLimitFlag {
+		err = database.Desc("id").Find(&result, bean)
+	} else {
+		err = database.Desc("id").Limit(count, offset).Find(&result, bean)
+	}
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	return result, int(total), nil
+}
+
+// ReconcileLedger 检查所有账户的余额和流水合计是否一致, 启用流水之前的账户会写入期初余额
+func ReconcileLedger() ([]LedgerMismatch, error) {
+	mismatches := []LedgerMismatch{}
+	accounts := []struct {
+		account int
+		sql     string
+	}{
+		{LedgerAccountUser, "SELECT a.id AS id, a.coin AS balance, COALESCE(SUM(l.amount), 0) AS total, COUNT(l.id) AS entries " +
+			"FROM user a LEFT JOIN ledger l ON l.account=? AND l.account_id=a.id GROUP BY a.id, a.coin"},
+		{LedgerAccountClub, "SELECT a.club_id AS id, a.balance AS balance, COALESCE(SUM(l.amount), 0) AS total, COUNT(l.id) AS entries " +
+			"FROM club a LEFT JOIN ledger l ON l.account=? AND l.account_id=a.club_id GROUP BY a.club_id, a.balance"},
+	}
+
+	for _, a := range accounts {
+		rows, err := database.Query(a.sql, a.account)
+		if err != nil {
+			logger.Error(err)
+			return nil, errutil.ErrDBOperation
+		}
+
+		for _, row := range rows {
+			id, _ := strconv.ParseInt(string(row["id"]), 10, 64)
+			balance, _ := strconv.ParseInt(string(row["balance"]), 10, 64)
+			total, _ := strconv.ParseInt(string(row["total"]), 10, 64)
+			entries, _ := strconv.ParseInt(string(row["entries"]), 10, 64)
+
+			if entries == 0 {
+				if balance != 0 {
+					if err := openAccount(a.account, id); err != nil {
+						logger.Errorf("写入期初余额失败: Account=%d, Id=%d, Error=%v", a.account, id, err)
+					}
+				}
+				continue
+			}
+
+			if balance != total {
+				mismatches = append(mismatches, LedgerMismatch{Account: a.account, Id: id, Balance: balance, Total: total})
+			}
+		}
+	}
+	return mismatches, nil
+}
+
+// 锁定账户后写入期初余额, 和ChangeBalance并发执行时不会重复写入
+func openAccount(account int, id int64) error {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return err
+	}
+
+	var balance int64
+	switch account {
+	case LedgerAccountUser:
+		u := &model.User{}
+		if _, err := session.Id(id).Cols("coin").ForUpdate().Get(u); err != nil {
+			session.Rollback()
+			return err
+		}
+		balance = u.Coin
+	case LedgerAccountClub:
+		c := &model.Club{}
+		if _, err := session.Where("club_id=?", id).Cols("balance").ForUpdate().Get(c); err != nil {
+			session.Rollback()
+			return err
+		}
+		balance = c.Balance
+	default:
+		session.Rollback()
+		return errutil.ErrInvalidParameter
+	}
+
+	if err := openLedger(session, account, id, balance); err != nil {
+		session.Rollback()
+		return err
+	}
+	return session.Commit()
+}
@@ -19,6 +19,8 @@ var (
 	logger   *log.Entry
 	chWrite  chan interface{} // async write channel
 	chUpdate chan interface{} // async update channel
+	ready    = make(chan struct{})
+	flushed  = make(chan struct{}) // 异步队列写完后关闭
 )
 
 type options struct {
@@ -52,13 +54,17 @@ func ShowSQL(show bool) ModelOption {
 }
 
 func envInit() {
-	// async task
+	// async task, 两个队列都关闭并且写完后才退出
 	go func() {
-		for {
+		defer close(flushed)
+
+		write, update := chWrite, chUpdate
+		for write != nil || update != nil {
 			select {
-			case t, ok := <-chWrite:
+			case t, ok := <-write:
 				if !ok {
-					return
+					write = nil
+					continue
 				}
 
 				//insert
@@ -66,9 +72,10 @@ func envInit() {
 					logger.Error(err)
 				}
 
-			case t, ok := <-chUpdate:
+			case t, ok := <-update:
 				if !ok {
-					return
+					update = nil
+					continue
 				}
 
 				//update
@@ -136,11 +143,13 @@ func MustStartup(dsn string, opts ...ModelOption) func() {
 
 	//异步任务处理数据库的insert和update 和连接测试
 	envInit()
+	close(ready)
 
 	//闭包写法
 	closer := func() {
 		close(chWrite)
 		close(chUpdate)
+		<-flushed
 		database.Close()
 		logger.Info("stopped")
 	}
@@ -148,6 +157,11 @@ func MustStartup(dsn string, opts ...ModelOption) func() {
 	return closer
 }
 
+// Ready 数据库初始化完成后关闭, 游戏服务器和web服务器并行启动, 依赖数据库的初始化需要等待
+func Ready() <-chan struct{} {
+	return ready
+}
+
 func syncSchema() {
 	/* Sync2
 	 * 自动检测和创建表，这个检测是根据表的名字
@@ -156,15 +170,21 @@ func syncSchema() {
 	 * 自动转换varchar字段类型到text字段类型
 	 * 自动警告字段的默认值，是否为空信息在模型和数据库之间不匹配的情况
 	 */
+	migrateUser()
+	migrateUserClub()
 	database.StoreEngine("InnoDB").Sync2(
 		new(model.Agent),
 		new(model.CardConsume),
 		new(model.Desk),
+		new(model.DeskCheckpoint),
 		new(model.History),
+		new(model.Ledger),
 		new(model.Login),
 		new(model.Online),
 		new(model.Order),
+		new(model.Product),
 		new(model.Recharge),
+		new(model.Refund),
 		new(model.Register),
 		new(model.ThirdAccount),
 		new(model.Trade),
@@ -174,3 +194,51 @@ func syncSchema() {
 		new(model.UserClub),
 	)
 }
+
+// 账号和手机号改为唯一索引之前, 没有值时保存为空字符串, 需要先改为NULL, 否则无法创建唯一索引
+// 已经存在的重复账号或手机号需要手动处理
+func migrateUser() {
+	for col, typ := range map[string]string{"name": "VARCHAR(32)", "phone": "VARCHAR(16)"} {
+		exist, err := database.Dialect().IsColumnExist("user", col)
+		if err != nil {
+			logger.Errorf("检查user表字段%s失败: %v", col, err)
+			continue
+		}
+		if !exist {
+			continue
+		}
+		sqls := []string{
+			"ALTER TABLE `user` MODIFY `" + col + "` " + typ + " NULL",
+			"UPDATE `user` SET `" + col + "`=NULL WHERE `" + col + "`=''",
+		}
+		for _, sql := range sqls {
+			if _, err := database.Exec(sql); err != nil {
+				logger.Errorf("迁移user表字段%s失败: %s, %v", col, sql, err)
+				break
+			}
+		}
+	}
+}
+
+// 玩家和俱乐部改为唯一索引之前可能有重复的申请记录, 保留状态最好的一条, 否则无法创建唯一索引
+// 重复的成员记录会多计算成员数量, 删除后重新统计
+func migrateUserClub() {
+	exist, err := database.IsTableExist(new(model.UserClub))
+	if err != nil || !exist {
+		return
+	}
+	res, err := database.Exec("DELETE a FROM `user_club` a JOIN `user_club` b ON a.`uid`=b.`uid` AND a.`club_id`=b.`club_id` " +
+		"AND (a.`status`<b.`status` OR (a.`status`=b.`status` AND a.`id`>b.`id`))")
+	if err != nil {
+		logger.Errorf("删除重复的俱乐部成员记录失败: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return
+	}
+	_, err = database.Exec("UPDATE `club` SET `member`=(SELECT COUNT(*) FROM `user_club` WHERE `user_club`.`club_id`=`club`.`club_id` AND `user_club`.`status`=?)",
+		model.UserClubStatusAgree)
+	if err != nil {
+		logger.Errorf("重新统计俱乐部成员数量失败: %v", err)
+	}
+}
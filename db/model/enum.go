@@ -4,3 +4,10 @@ const (
 	UserClubStatusApply = 1
 	UserClubStatusAgree = 2
 )
+
+// 俱乐部成员角色, 数值越小权限越大
+const (
+	UserClubRoleOwner  = 1 //部长, 创建俱乐部时指定, 不能退出
+	UserClubRoleAdmin  = 2 //管理员, 可以审核申请和踢出普通成员
+	UserClubRoleMember = 3 //普通成员
+)
@@ -78,6 +78,16 @@ type Desk struct {
 	Extras       string `xorm:"not null TEXT default"`
 }
 
+// 进行中的牌桌检查点, 用于服务器重启后恢复牌桌
+type DeskCheckpoint struct {
+	Id        int64
+	DeskNo    string `xorm:"not null unique VARCHAR(6) default"`
+	DeskId    int64  `xorm:"not null index BIGINT(20) default 0"`
+	Round     int    `xorm:"not null INT(11) default 0"`
+	Data      string `xorm:"not null TEXT default"`
+	UpdatedAt int64  `xorm:"not null BIGINT(20) default 0"`
+}
+
 type History struct {
 	Id           int64
 	DeskId       int64  `xorm:"not null index BIGINT(20) default 0"`
@@ -140,6 +150,9 @@ type Order struct {
 	ProductExtra   string `xorm:"not null VARCHAR(255) default"`
 	NotifyUrl      string `xorm:"not null VARCHAR(2048) default"`
 	Status         int    `xorm:"not null TINYINT(2) default 1"`
+	PaidAt         int64  `xorm:"not null BIGINT(11) default"`
+	FulfilledAt    int64  `xorm:"not null BIGINT(11) default"`
+	ClosedAt       int64  `xorm:"not null BIGINT(11) default"` //过期、支付失败或者退款的时间
 	Remote         string `xorm:"not null VARCHAR(40) default"`
 	Ip             string `xorm:"not null VARCHAR(40) default"`
 	Imei           string `xorm:"not null VARCHAR(64) default"`
@@ -197,6 +210,8 @@ type Trade struct {
 
 type User struct {
 	Id              int64
+	Name            string `xorm:"null unique VARCHAR(32)"` //账号, 三方平台和游客为NULL
+	Phone           string `xorm:"null unique VARCHAR(16)"` //绑定的手机号, 没有绑定时为NULL
 	Algo            string `xorm:"not null VARCHAR(16) default"`
 	Hash            string `xorm:"not null VARCHAR(64) default"`
 	Salt            string `xorm:"not null VARCHAR(64) default"`
@@ -210,6 +225,7 @@ type User struct {
 	RegisterAt      int64  `xorm:"not null index BIGINT(20) default 0"`
 	FirstRechargeAt int64  `xorm:"not null index BIGINT(20) default 0"`
 	Debug           int    `xorm:"not null index TINYINT(1) default 0"`
+	TokenVersion    int64  `xorm:"not null BIGINT(20) default 0"` //登录凭证版本, 注销时加1
 }
 
 type Uuid struct {
@@ -227,15 +243,63 @@ type Club struct {
 	AgentId   int64  `xorm:"not null index BIGINT(20) default 0"`
 	Name      string `xorm:"not null VARCHAR(128) default"`
 	Desc      string `xorm:"not null VARCHAR(512) default"`
-	Member    int    `xorm:"not null INT(11) default"`
+	Member    int    `xorm:"not null INT(11) default"` //已经加入的成员数量, 不包括申请中的玩家
 	MaxMember int    `xorm:"not null INT(11) default 500"`
 	CreatedAt int64  `xorm:"not null BIGINT(20) default"`
 }
 
 type UserClub struct {
 	Id        int64
-	Uid       int64 `xorm:"not null index BIGINT(20) default"`
-	ClubId    int64 `xorm:"not null index BIGINT(20) default"`
+	Uid       int64 `xorm:"not null unique(uid_club) BIGINT(20) default"` //每个玩家在一个俱乐部中只有一条记录
+	ClubId    int64 `xorm:"not null unique(uid_club) index BIGINT(20) default"`
 	CreatedAt int64 `xorm:"not null BIGINT(20) default"`
 	Status    int   `xorm:"not null TINYINT(3) default 1"`
+	Role      int   `xorm:"not null TINYINT(3) default 3"` //成员角色: 部长, 管理员, 普通成员
+}
+
+// Ledger 余额流水, 只追加不修改, 每次余额变化和流水在同一个事务中写入
+type Ledger struct {
+	Id        int64
+	Account   int    `xorm:"not null index(account) TINYINT(3) default 1"`   //账户类型: 玩家, 俱乐部
+	AccountId int64  `xorm:"not null index(account) BIGINT(20) default 0"`   //玩家ID或者俱乐部ID
+	Amount    int64  `xorm:"not null BIGINT(20) default 0"`                  //变化数量, 扣除时为负数
+	Balance   int64  `xorm:"not null BIGINT(20) default 0"`                  //变化后的余额
+	Reason    int    `xorm:"not null index TINYINT(3) default 0"`            //变化原因
+	Ref       string `xorm:"not null VARCHAR(64) default"`                   //关联的订单号、房间ID或者GM账号
+	Key       string `xorm:"'idempotency_key' not null unique VARCHAR(128)"` //幂等键, 相同的键只会生效一次
+	CreatedAt int64  `xorm:"not null index BIGINT(20) default 0"`
+}
+
+// Product 商品, 订单价格和到账房卡数量以商品为准
+type Product struct {
+	Id        int64
+	Sku       string `xorm:"not null unique VARCHAR(32)"`
+	Name      string `xorm:"not null VARCHAR(64) default"`
+	Price     int    `xorm:"not null INT(11) default 0"`    //价格, 单位: 分
+	Coin      int    `xorm:"not null INT(11) default 0"`    //房卡数量
+	Bonus     int    `xorm:"not null INT(11) default 0"`    //赠送房卡数量
+	Channels  string `xorm:"not null VARCHAR(512) default"` //可以购买的渠道, 逗号隔开, 为空时所有渠道都可以购买
+	Enabled   bool   `xorm:"not null TINYINT(1) default 1"` //是否上架
+	Sort      int    `xorm:"not null INT(11) default 0"`    //显示顺序
+	CreatedAt int64  `xorm:"not null BIGINT(20) default 0"`
+}
+
+// Refund 退款记录, 每个订单只能退款一次, 退款原因和操作人用于审计
+type Refund struct {
+	Id          int64
+	RefundId    string `xorm:"not null unique VARCHAR(64)"` //退款单号, 向支付平台申请退款时使用
+	OrderId     string `xorm:"not null unique VARCHAR(32)"` //订单号
+	Uid         int64  `xorm:"not null index BIGINT(20) default 0"`
+	PayPlatform string `xorm:"not null VARCHAR(32) default"`
+	PayRefundId string `xorm:"not null VARCHAR(64) default"`  //支付平台的退款单号
+	Fee         int    `xorm:"not null INT(11) default 0"`    //退款金额, 单位: 分
+	Coin        int64  `xorm:"not null BIGINT(20) default 0"` //扣回的房卡数量
+	Debt        int64  `xorm:"not null BIGINT(20) default 0"` //扣回房卡后玩家欠的房卡数量
+	Source      int    `xorm:"not null TINYINT(3) default 0"` //发起方: GM, 支付平台
+	Reason      string `xorm:"not null VARCHAR(255) default"` //退款原因
+	Operator    string `xorm:"not null VARCHAR(64) default"`  //GM账号或者支付平台
+	Status      int    `xorm:"not null TINYINT(3) default 1"` //退款状态
+	Error       string `xorm:"not null VARCHAR(255) default"` //支付平台返回的错误
+	CreatedAt   int64  `xorm:"not null index BIGINT(20) default 0"`
+	FinishedAt  int64  `xorm:"not null BIGINT(20) default 0"`
 }
@@ -2,7 +2,9 @@ package db
 
 import (
 	"strings"
+	"time"
 
+	"github.com/go-xorm/xorm"
 	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nanoserver/pkg/algoutil"
 	"github.com/lonng/nanoserver/pkg/errutil"
@@ -25,6 +27,98 @@ func QueryOrder(orderID string) (*model.Order, error) {
 	return order, nil
 }
 
+// 订单状态允许的变化
+var orderTransitions = map[int][]int{
+	OrderStatusCreated: {OrderStatusPaid, OrderStatusExpired, OrderStatusFailed},
+	// 过期之后才收到支付通知时, 玩家已经付款, 依然需要发货
+	OrderStatusExpired:   {OrderStatusPaid, OrderStatusFailed},
+	OrderStatusPaid:      {OrderStatusFulfilled, OrderStatusRefunded},
+	OrderStatusFulfilled: {OrderStatusRefunded},
+}
+
+// CanTransit 订单状态是否可以从from变为to
+func CanTransit(from, to int) bool {
+	for _, s := range orderTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// 在调用者的事务中修改订单状态并记录时间, cols为需要一起修改的其他字段. 使用状态作为更新条件,
+// 并发修改同一个订单时只有一个能成功
+func transitOrder(session *xorm.Session, order *model.Order, to int, cols ...string) error {
+	if !CanTransit(order.Status, to) {
+		return errutil.ErrIllegalOrderStatus
+	}
+
+	now := time.Now().Unix()
+	switch to {
+	case OrderStatusPaid:
+		order.PaidAt = now
+		cols = append(cols, "paid_at")
+	case OrderStatusFulfilled:
+		order.FulfilledAt = now
+		cols = append(cols, "fulfilled_at")
+	default:
+		order.ClosedAt = now
+		cols = append(cols, "closed_at")
+	}
+
+	from := order.Status
+	order.Status = to
+	n, err := session.Cols(append(cols, "status")...).
+		Where("order_id=? AND status=?", order.OrderId, from).Update(order)
+	if err != nil {
+		order.Status = from
+		return err
+	}
+	if n == 0 {
+		order.Status = from
+		return errutil.ErrIllegalOrderStatus
+	}
+	return nil
+}
+
+// TransitOrder 修改订单状态, 不允许的状态变化返回ErrIllegalOrderStatus
+func TransitOrder(orderID string, to int) (*model.Order, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
+	}
+
+	order, err := lockOrder(session, orderID)
+	if err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	if err := transitOrder(session, order, to); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return order, nil
+}
+
+// ExpireOrders 把创建时间超过ttl秒还没有支付的订单标记为过期, 返回过期的订单数量
+func ExpireOrders(ttl int64) (int64, error) {
+	now := time.Now().Unix()
+	bean := &model.Order{Status: OrderStatusExpired, ClosedAt: now}
+	n, err := database.Cols("status", "closed_at").
+		Where("status=? AND created_at<?", OrderStatusCreated, now-ttl).Update(bean)
+	if err != nil {
+		logger.Error(err)
+		return 0, errutil.ErrDBOperation
+	}
+	return n, nil
+}
+
 func InsertOrder(order *model.Order) error {
 	if order == nil {
 		return errutil.ErrInvalidParameter
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"strings"
+	"time"
+
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+// QueryProduct 根据SKU查询商品
+func QueryProduct(sku string) (*model.Product, error) {
+	p := &model.Product{Sku: sku}
+	has, err := database.Get(p)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errutil.ErrProductionNotFound
+	}
+	return p, nil
+}
+
+// ProductAvailable 商品是否上架并且指定的渠道可以购买
+func ProductAvailable(p *model.Product, channel string) bool {
+	if !p.Enabled {
+		return false
+	}
+	if strings.TrimSpace(p.Channels) == "" {
+		return true
+	}
+	for _, c := range strings.Split(p.Channels, ",") {
+		if strings.TrimSpace(c) == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductList 指定渠道可以购买的商品
+func ProductList(channel string) ([]model.Product, error) {
+	list := []model.Product{}
+	if err := database.Where("enabled=?", true).Asc("sort").Find(&list); err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+
+	ret := make([]model.Product, 0, len(list))
+	for i := range list {
+		if ProductAvailable(&list[i], channel) {
+			ret = append(ret, list[i])
+		}
+	}
+	return ret, nil
+}
+
+// SyncProducts 写入配置中数据库不存在的商品, 已经存在的商品以数据库为准, 不会被配置覆盖
+func SyncProducts(list []model.Product) error {
+	for i := range list {
+		p := list[i]
+		has, err := database.Exist(&model.Product{Sku: p.Sku})
+		if err != nil {
+			return err
+		}
+		if has {
+			continue
+		}
+
+		p.CreatedAt = time.Now().Unix()
+		if _, err := database.Insert(&p); err != nil {
+			return err
+		}
+		logger.Infof("新增商品: %+v", p)
+	}
+	return nil
+}
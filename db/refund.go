@@ -0,0 +1,264 @@
+package db
+
+import (
+	"time"
+
+	"github.com/go-xorm/xorm"
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+const refundReasonProvider = "支付平台退款"
+
+// BeginRefund GM申请退款: 检查订单状态, 按照退款策略检查玩家的房卡, 写入等待退款的记录. 之前失败或者
+// 没有完成的退款返回原来的记录, 使用相同的退款单号重试, 支付平台只会退款一次, 重试时同样需要检查房卡.
+// block策略只在申请时检查房卡, 申请之后到支付平台退款成功之间玩家用掉的房卡在CompleteRefund中记为欠款
+func BeginRefund(orderID, reason, operator, policy string) (*model.Refund, *model.Order, error) {
+	if orderID == "" || reason == "" {
+		return nil, nil, errutil.ErrIllegalParameter
+	}
+
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, nil, err
+	}
+
+	order, err := lockOrder(session, orderID)
+	if err != nil {
+		session.Rollback()
+		return nil, nil, err
+	}
+	if order.Status != OrderStatusFulfilled {
+		session.Rollback()
+		return nil, nil, errutil.ErrIllegalOrderStatus
+	}
+
+	refund := &model.Refund{OrderId: orderID}
+	has, err := session.Get(refund)
+	if err != nil {
+		session.Rollback()
+		return nil, nil, err
+	}
+
+	coin := refundCoin(order, order.RealMoney)
+	if has {
+		coin = refund.Coin
+	}
+	if policy != RefundPolicyDebt {
+		u := &model.User{}
+		if _, err := session.Id(order.Uid).Cols("coin").Get(u); err != nil {
+			session.Rollback()
+			return nil, nil, err
+		}
+		if u.Coin < coin {
+			session.Rollback()
+			return nil, nil, errutil.ErrCoinNotEnough
+		}
+	}
+
+	if has {
+		refund.Status = RefundStatusPending
+		refund.Error = ""
+		if _, err := session.Id(refund.Id).Cols("status", "error").Update(refund); err != nil {
+			session.Rollback()
+			return nil, nil, err
+		}
+		return refund, order, session.Commit()
+	}
+
+	refund = &model.Refund{
+		RefundId:    "R" + order.OrderId,
+		OrderId:     order.OrderId,
+		Uid:         order.Uid,
+		PayPlatform: order.PayPlatform,
+		Fee:         order.RealMoney,
+		Coin:        coin,
+		Source:      RefundSourceGM,
+		Reason:      reason,
+		Operator:    operator,
+		Status:      RefundStatusPending,
+		CreatedAt:   time.Now().Unix(),
+	}
+	if _, err := session.Insert(refund); err != nil {
+		session.Rollback()
+		return nil, nil, err
+	}
+	return refund, order, session.Commit()
+}
+
+// FailRefund 支付平台退款失败, 记录错误信息, 可以重新申请
+func FailRefund(refundID string, cause error) error {
+	msg := cause.Error()
+	if len(msg) > 255 {
+		msg = msg[:255]
+	}
+	_, err := database.Cols("status", "error").Where("refund_id=? AND status=?", refundID, RefundStatusPending).
+		Update(&model.Refund{Status: RefundStatusFailed, Error: msg})
+	return err
+}
+
+// CompleteRefund 支付平台退款成功后扣回房卡并把订单标记为已退款, 在同一个事务中完成. 钱已经退还给玩家,
+// 房卡不足时也必须扣回, 不足的部分记为欠款(余额为负数), block策略下申请退款之后用掉的房卡也是如此.
+// 已经完成的退款直接返回
+func CompleteRefund(refundID, payRefundID string) (*model.Refund, *model.Ledger, error) {
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, nil, err
+	}
+
+	refund := &model.Refund{RefundId: refundID}
+	has, err := session.ForUpdate().Get(refund)
+	if err != nil {
+		session.Rollback()
+		return nil, nil, err
+	}
+	if !has {
+		session.Rollback()
+		return nil, nil, errutil.ErrOrderNotFound
+	}
+	if refund.Status == RefundStatusSucceeded {
+		session.Rollback()
+		return refund, nil, nil
+	}
+
+	order, err := lockOrder(session, refund.OrderId)
+	if err != nil {
+		session.Rollback()
+		return nil, nil, err
+	}
+
+	var l *model.Ledger
+	if refund.Coin > 0 {
+		l, err = changeBalance(session, &CoinChange{
+			Account:   LedgerAccountUser,
+			Id:        refund.Uid,
+			Amount:    -refund.Coin,
+			Reason:    LedgerReasonRefund,
+			Ref:       refund.RefundId,
+			Key:       "refund:" + refund.OrderId,
+			Overdraft: true,
+		})
+		if err != nil {
+			session.Rollback()
+			return nil, nil, err
+		}
+		if l.Balance < 0 {
+			refund.Debt = -l.Balance
+			if refund.Debt > refund.Coin {
+				refund.Debt = refund.Coin
+			}
+		}
+	}
+
+	if err := transitOrder(session, order, OrderStatusRefunded); err != nil {
+		session.Rollback()
+		return nil, nil, err
+	}
+
+	refund.Status = RefundStatusSucceeded
+	refund.Error = ""
+	refund.PayRefundId = payRefundID
+	refund.FinishedAt = time.Now().Unix()
+	if _, err := session.Id(refund.Id).Cols("status", "error", "pay_refund_id", "debt", "finished_at").Update(refund); err != nil {
+		session.Rollback()
+		return nil, nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, nil, err
+	}
+	return refund, l, nil
+}
+
+// ProviderRefund 支付平台通知的退款: GM申请的退款直接完成, 在支付平台直接发起的退款先写入退款记录,
+// 按照退款金额扣回房卡
+func ProviderRefund(orderID, payRefundID string, fee int, platform string) (*model.Refund, *model.Ledger, error) {
+	refund := &model.Refund{OrderId: orderID}
+	has, err := database.Get(refund)
+	if err != nil {
+		return nil, nil, err
+	}
+	if has {
+		return CompleteRefund(refund.RefundId, payRefundID)
+	}
+
+	order, err := QueryOrder(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if order.Status != OrderStatusFulfilled {
+		return nil, nil, errutil.ErrIllegalOrderStatus
+	}
+
+	refund = &model.Refund{
+		RefundId:    "R" + order.OrderId,
+		OrderId:     order.OrderId,
+		Uid:         order.Uid,
+		PayPlatform: platform,
+		Fee:         fee,
+		Coin:        refundCoin(order, fee),
+		Source:      RefundSourceProvider,
+		Reason:      refundReasonProvider,
+		Operator:    platform,
+		Status:      RefundStatusPending,
+		CreatedAt:   time.Now().Unix(),
+	}
+	// 并发的重复通知只有一个能写入, 失败的一方使用已经写入的记录
+	if _, err := database.Insert(refund); err != nil {
+		if has, qerr := database.Get(&model.Refund{OrderId: orderID}); qerr != nil || !has {
+			return nil, nil, err
+		}
+	}
+	return CompleteRefund(refund.RefundId, payRefundID)
+}
+
+// 按照退款金额占支付金额的比例扣回房卡, 不足一张按一张计算
+func refundCoin(order *model.Order, fee int) int64 {
+	count := int64(order.ProductCount)
+	if order.RealMoney <= 0 || fee >= order.RealMoney {
+		return count
+	}
+	return (count*int64(fee) + int64(order.RealMoney) - 1) / int64(order.RealMoney)
+}
+
+func lockOrder(session *xorm.Session, orderID string) (*model.Order, error) {
+	order := &model.Order{OrderId: orderID}
+	has, err := session.ForUpdate().Get(order)
+	if err != nil {
+		return nil, err
+	}
+	if !has {
+		return nil, errutil.ErrOrderNotFound
+	}
+	return order, nil
+}
+
+// RefundList 退款记录, uid小于等于0时查询所有玩家, 按时间倒序
+func RefundList(uid int64, offset, count int) ([]model.Refund, int, error) {
+	bean := &model.Refund{}
+	if uid > 0 {
+		bean.Uid = uid
+	}
+	total, err := database.Count(bean)
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	result := make([]model.Refund, 0)
+	if count == noLimitFlag {
+		err = database.Desc("id").Find(&result, bean)
+	} else {
+		err = database.Desc("id").Limit(count, offset).Find(&result, bean)
+	}
+	if err != nil {
+		logger.Error(err)
+		return nil, 0, errutil.ErrDBOperation
+	}
+
+	return result, int(total), nil
+}
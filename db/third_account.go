@@ -26,7 +26,7 @@ func InsertThirdAccount(account *model.ThirdAccount, u *model.User) error {
 	}
 	defer session.Close()
 
-	if _, err := session.Insert(u); err != nil {
+	if err := insertUser(session, u); err != nil {
 		session.Rollback()
 		return err
 	}
@@ -49,3 +49,17 @@ func UpdateThirdAccount(account *model.ThirdAccount) error {
 	_, err := database.Where("id=?", account.Id).Update(account)
 	return err
 }
+
+func QueryThirdAccountByUid(uid int64) (*model.ThirdAccount, error) {
+	t := &model.ThirdAccount{Uid: uid}
+	has, err := database.Get(t)
+	if err != nil {
+		return nil, err
+	}
+
+	if !has {
+		return nil, errutil.ErrThirdAccountNotFound
+	}
+
+	return t, nil
+}
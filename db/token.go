@@ -0,0 +1,33 @@
+package db
+
+import (
+	"github.com/lonng/nanoserver/db/model"
+	"github.com/lonng/nanoserver/pkg/algoutil"
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+// VerifyToken 验证登录凭证, 返回凭证对应的用户, 用户被冻结或者凭证已经注销时验证失败
+func VerifyToken(token string, secret []byte) (*model.User, *algoutil.Token, error) {
+	t, err := algoutil.ParseToken(token, secret)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	u, err := QueryUser(t.Uid)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Status != StatusNormal {
+		return nil, nil, errutil.ErrPermissionDenied
+	}
+	if u.TokenVersion != t.Version {
+		return nil, nil, errutil.ErrInvalidToken
+	}
+	return u, t, nil
+}
+
+// RevokeToken 注销用户之前签发的所有登录凭证
+func RevokeToken(uid int64) error {
+	_, err := database.Id(uid).Incr("token_version").Update(&model.User{})
+	return err
+}
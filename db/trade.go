@@ -1,61 +1,110 @@
 package db
 
 import (
+	"strconv"
+
 	"github.com/lonng/nanoserver/db/model"
 	"github.com/lonng/nanoserver/pkg/algoutil"
 	"github.com/lonng/nanoserver/pkg/errutil"
 )
 
-func InsertTrade(t *model.Trade) error {
-	logger.Info("insert trade, order id: " + t.OrderId)
+// StatementItem 支付平台对账单中的一笔成功交易
+type StatementItem struct {
+	OrderId    string // 商户订单号
+	PayOrderId string // 支付平台订单号
+	Fee        int    // 金额, 单位: 分
+}
 
-	trade := &model.Trade{OrderId: t.OrderId}
-	has, err := database.Get(trade)
-	if err != nil {
-		return err
-	}
-	if has {
-		return errutil.ErrTradeExisted
+// TradeMismatch 对账不一致的交易
+type TradeMismatch struct {
+	Type       int    `json:"type"` // 不一致的类型: TradeMismatchMissing, TradeMismatchUnknown, TradeMismatchAmount
+	OrderId    string `json:"orderId"`
+	PayOrderId string `json:"payOrderId"`
+	Fee        int    `json:"fee"`   // 对账单金额
+	Money      int    `json:"money"` // 订单金额
+}
+
+// FulfilOrder 支付成功后完成订单: 核对支付金额, 写入交易记录, 订单状态变为已支付, 给玩家加房卡后
+// 变为已发货, 全部在同一个事务中完成. 订单已经完成时(重复通知)返回ErrTradeExisted
+func FulfilOrder(t *model.Trade, fee int) (*model.Order, error) {
+	logger.Info("fulfil order, order id: " + t.OrderId)
+
+	session := database.NewSession()
+	defer session.Close()
+
+	if err := session.Begin(); err != nil {
+		return nil, err
 	}
-	order, err := QueryOrder(t.OrderId)
+
+	// 锁定订单, 并发的重复通知只有一个能完成
+	order, err := lockOrder(session, t.OrderId)
 	if err != nil {
-		return err
+		session.Rollback()
+		return nil, err
 	}
-	if order.Type == OrderTypeBuyToken {
-		order.Status = OrderStatusNotified
-	} else {
-		order.Status = OrderStatusPayed
+	switch order.Status {
+	case OrderStatusFulfilled, OrderStatusRefunded:
+		session.Rollback()
+		return order, errutil.ErrTradeExisted
+	case OrderStatusCreated, OrderStatusExpired:
+	default:
+		session.Rollback()
+		return order, errutil.ErrIllegalOrderStatus
 	}
-	sess := database.NewSession()
 
-	// 开始事务
-	sess.Begin()
-	defer sess.Close()
-	if _, err := sess.Insert(t); err != nil {
-		println(err.Error())
-		sess.Rollback()
-		return err
+	if order.Money != fee {
+		logger.Errorf("支付金额和订单金额不一致: OrderId=%s, 订单金额=%d, 支付金额=%d", order.OrderId, order.Money, fee)
+		// 金额不一致的订单标记为支付失败, 需要人工处理
+		if err := transitOrder(session, order, OrderStatusFailed); err != nil {
+			session.Rollback()
+			return nil, err
+		}
+		if err := session.Commit(); err != nil {
+			return nil, err
+		}
+		return order, errutil.ErrPayAmountMismatch
 	}
 
-	if _, err := sess.Where("order_id = ?", order.OrderId).Update(order); err != nil {
-		println(err.Error())
-		sess.Rollback()
-		return err
+	if _, err := session.Insert(t); err != nil {
+		session.Rollback()
+		return nil, err
 	}
 
-	u := &model.User{}
-	sess.Where("uid = ?", order.Uid).Get(u)
+	order.RealMoney = fee
+	if err := transitOrder(session, order, OrderStatusPaid, "real_money"); err != nil {
+		session.Rollback()
+		return nil, err
+	}
 
 	//添加首充时间
-	if u.FirstRechargeAt == 0 {
-		u.FirstRechargeAt = order.CreatedAt
-		if _, err = sess.Id(u.Id).Update(u); err != nil {
-			sess.Rollback()
-			return err
-		}
+	if _, err := session.Cols("first_recharge_at").Where("id = ? AND first_recharge_at = 0", order.Uid).
+		Update(&model.User{FirstRechargeAt: order.CreatedAt}); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	_, err = changeBalance(session, &CoinChange{
+		Account: LedgerAccountUser,
+		Id:      order.Uid,
+		Amount:  int64(order.ProductCount),
+		Reason:  LedgerReasonPay,
+		Ref:     order.OrderId,
+		Key:     "pay:" + order.OrderId,
+	})
+	if err != nil {
+		session.Rollback()
+		return nil, err
 	}
 
-	return sess.Commit()
+	if err := transitOrder(session, order, OrderStatusFulfilled); err != nil {
+		session.Rollback()
+		return nil, err
+	}
+
+	if err := session.Commit(); err != nil {
+		return nil, err
+	}
+	return order, nil
 }
 
 func TradeList(appid, channelID, orderID string, start, end int64, offset, count int) ([]ViewTrade, int, error) {
@@ -88,3 +137,66 @@ func TradeList(appid, channelID, orderID string, start, end int64, offset, count
 
 	return result, int(total), nil
 }
+
+// ReconcileTrades 比较支付平台对账单和[start, end)时间段内的交易记录, 返回不一致的交易
+func ReconcileTrades(platform string, items []StatementItem, start, end int64) ([]TradeMismatch, error) {
+	rows, err := database.Query("SELECT t.order_id AS order_id, t.pay_order_id AS pay_order_id, o.money AS money "+
+		"FROM trade t LEFT JOIN `order` o ON o.order_id=t.order_id "+
+		"WHERE t.pay_platform=? AND t.pay_at>=? AND t.pay_at<?", platform, start, end)
+	if err != nil {
+		logger.Error(err)
+		return nil, errutil.ErrDBOperation
+	}
+
+	trades := make(map[string]TradeMismatch, len(rows))
+	for _, row := range rows {
+		money, _ := strconv.Atoi(string(row["money"]))
+		trades[string(row["order_id"])] = TradeMismatch{
+			OrderId:    string(row["order_id"]),
+			PayOrderId: string(row["pay_order_id"]),
+			Money:      money,
+		}
+	}
+
+	mismatches := []TradeMismatch{}
+	for _, item := range items {
+		t, ok := trades[item.OrderId]
+		if !ok {
+			// 支付时间在边界附近的交易可能记录在前一天或者后一天
+			if t, ok = queryTradeMismatch(item.OrderId); !ok {
+				mismatches = append(mismatches, TradeMismatch{
+					Type:       TradeMismatchMissing,
+					OrderId:    item.OrderId,
+					PayOrderId: item.PayOrderId,
+					Fee:        item.Fee,
+				})
+				continue
+			}
+		}
+		delete(trades, item.OrderId)
+
+		if t.Money != item.Fee {
+			t.Type = TradeMismatchAmount
+			t.Fee = item.Fee
+			mismatches = append(mismatches, t)
+		}
+	}
+
+	for _, t := range trades {
+		t.Type = TradeMismatchUnknown
+		mismatches = append(mismatches, t)
+	}
+	return mismatches, nil
+}
+
+func queryTradeMismatch(orderID string) (TradeMismatch, bool) {
+	trade := &model.Trade{OrderId: orderID}
+	if has, err := database.Get(trade); err != nil || !has {
+		return TradeMismatch{}, false
+	}
+	t := TradeMismatch{OrderId: trade.OrderId, PayOrderId: trade.PayOrderId}
+	if order, err := QueryOrder(orderID); err == nil {
+		t.Money = order.Money
+	}
+	return t, true
+}
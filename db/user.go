@@ -46,92 +46,29 @@ func InsertUser(u *model.User) error {
 	if u == nil {
 		return nil
 	}
-	_, err := database.Insert(u)
-	return err
-}
-
-//DeleteUser delete the user
-func DeleteUser(uid int64) error {
-	u := model.User{
-		Status: StatusDeleted,
-	}
-	_, err := database.Where("uid=?", uid).Update(u)
-	return err
-}
-
-func UserAddCoin(uid int64, coin int64) error {
-	session := database.NewSession() //创建事务
-	defer session.Close()
-	err := session.Begin() //开始事务
-	if err != nil {
-		return errutil.ErrDBOperation
-	}
-	u := &model.User{Id: uid}
-	has, err := session.Get(u)
-	if err != nil {
-		return err
-	}
-	if !has {
-		return errutil.ErrNotFound
-	}
-	u.Coin += coin
-	_, err = session.Where("uid=?", uid).Update(u)
-	if err != nil {
-		session.Rollback() //回滚事务
-		return err
-	}
-	return session.Commit() //完成事务
-}
 
-func UserLoseCoin(id int64, coin int64) error {
-	user := &model.User{
-		Id: id,
-	}
-
-	has, err := database.Get(user)
-	if !has {
-		return errutil.ErrNotFound
-	}
-	if err != nil {
-		return err
-	}
-
-	return UserLoseCoinByUID(user.Id, coin)
-}
-
-func UserLoseCoinByUID(uid int64, coin int64) error {
 	session := database.NewSession()
 	defer session.Close()
 
 	if err := session.Begin(); err != nil {
-		logger.Error(err.Error())
-		return errutil.ErrDBOperation
-	}
-	u := &model.User{Id: uid}
-	has, err := session.Get(u)
-	if err != nil {
-		logger.Error(err.Error())
 		return err
 	}
-	if !has {
-		logger.Error("user not found")
-		return errutil.ErrNotFound
-	}
-	if u.Coin < coin {
-		logger.Error("coin not enough")
-		return errutil.ErrCoinNotEnough
-	}
-	u.Coin -= coin
-	//FIXED: 用户剩余1的时候, 扣除不成功
-	if _, err := session.Cols("coin").Where("id=?", uid).Update(u); err != nil {
+	if err := insertUser(session, u); err != nil {
 		session.Rollback()
-		logger.Error(err.Error())
 		return err
 	}
-
 	return session.Commit()
 }
 
+//DeleteUser delete the user
+func DeleteUser(uid int64) error {
+	u := model.User{
+		Status: StatusDeleted,
+	}
+	_, err := database.Where("uid=?", uid).Update(u)
+	return err
+}
+
 func InsertRegister(reg *model.Register) {
 	chWrite <- reg
 }
@@ -0,0 +1,61 @@
+package algoutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+// Token 登录凭证, web服务器登录成功后签发, 游戏服务器登录时验证
+type Token struct {
+	Uid     int64  `json:"uid"`
+	Device  string `json:"device"`
+	Version int64  `json:"ver"` // 签发时用户的凭证版本, 注销后版本加1, 之前签发的凭证全部失效
+	Expire  int64  `json:"exp"` // 过期时间(unix时间戳)
+}
+
+// SignToken 使用HMAC-SHA256签名, 格式: base64(JSON).base64(签名)
+func SignToken(t *Token, secret []byte) (string, error) {
+	payload, err := json.Marshal(t)
+	if err != nil {
+		return "", err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	return body + "." + base64.RawURLEncoding.EncodeToString(tokenMAC(body, secret)), nil
+}
+
+// ParseToken 验证签名和过期时间
+func ParseToken(token string, secret []byte) (*Token, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 2 {
+		return nil, errutil.ErrInvalidToken
+	}
+	sign, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sign, tokenMAC(parts[0], secret)) {
+		return nil, errutil.ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, errutil.ErrInvalidToken
+	}
+
+	t := &Token{}
+	if err := json.Unmarshal(payload, t); err != nil {
+		return nil, errutil.ErrInvalidToken
+	}
+	if t.Expire <= time.Now().Unix() {
+		return nil, errutil.ErrTokenExpired
+	}
+	return t, nil
+}
+
+func tokenMAC(body string, secret []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(body))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,45 @@
+package algoutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lonng/nanoserver/pkg/errutil"
+)
+
+func TestToken(t *testing.T) {
+	secret := []byte("secret")
+	token, err := SignToken(&Token{Uid: 10001, Device: "imei", Version: 2, Expire: time.Now().Add(time.Hour).Unix()}, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tk, err := ParseToken(token, secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tk.Uid != 10001 || tk.Device != "imei" || tk.Version != 2 {
+		t.Fatalf("unexpected token: %+v", tk)
+	}
+
+	if _, err := ParseToken(token, []byte("other")); err != errutil.ErrInvalidToken {
+		t.Fatalf("expect invalid token, got: %v", err)
+	}
+
+	// 修改uid后签名不匹配
+	forged, _ := SignToken(&Token{Uid: 10002, Expire: tk.Expire}, []byte("other"))
+	forged = strings.Split(forged, ".")[0] + "." + strings.Split(token, ".")[1]
+	if _, err := ParseToken(forged, secret); err != errutil.ErrInvalidToken {
+		t.Fatalf("expect invalid token, got: %v", err)
+	}
+
+	expired, _ := SignToken(&Token{Uid: 10001, Expire: time.Now().Add(-time.Second).Unix()}, secret)
+	if _, err := ParseToken(expired, secret); err != errutil.ErrTokenExpired {
+		t.Fatalf("expect expired token, got: %v", err)
+	}
+
+	if _, err := ParseToken("", secret); err != errutil.ErrInvalidToken {
+		t.Fatalf("expect invalid token, got: %v", err)
+	}
+}
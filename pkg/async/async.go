@@ -1,6 +1,14 @@
 package async
 
-import "github.com/sirupsen/logrus"
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// 所有正在执行的异步任务, 停服时等待完成
+var pending sync.WaitGroup
 
 //panic抛出异常，然后在defer中调用recover()捕获异常
 func pcall(fn func()) {
@@ -14,5 +22,25 @@ func pcall(fn func()) {
 }
 
 func Run(fn func()) {
-	go pcall(fn)
+	pending.Add(1)
+	go func() {
+		defer pending.Done()
+		pcall(fn)
+	}()
+}
+
+// Wait 等待所有异步任务完成, 超时返回false
+func Wait(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		pending.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
 }
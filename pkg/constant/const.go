@@ -29,6 +29,8 @@ const (
 	DeskStatusDestory
 	//已经清洗,即为下一轮准备好
 	DeskStatusCleaned
+	//换三张
+	DeskStatusExchange
 )
 
 var stringify = [...]string{
@@ -40,6 +42,7 @@ var stringify = [...]string{
 	DeskStatusInterruption: "游戏终/中止",
 	DeskStatusDestory:      "已销毁",
 	DeskStatusCleaned:      "已清洗",
+	DeskStatusExchange:     "换三张",
 }
 
 func (s DeskStatus) String() string {
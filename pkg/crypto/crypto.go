@@ -5,6 +5,7 @@ import (
 	"crypto/md5"
 	"crypto/rsa"
 	"crypto/sha1"
+	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/pem"
@@ -158,6 +159,31 @@ func Verify(pubKey *rsa.PublicKey, data []byte, sign string) error {
 	return nil
 }
 
+// SignSHA256 RSA2签名(SHA256WithRSA)
+func SignSHA256(priKey *rsa.PrivateKey, data []byte) (string, error) {
+	digest := sha256.Sum256(data)
+	bs, err := rsa.SignPKCS1v15(nil, priKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errutil.ErrSignFailed
+	}
+
+	return base64.StdEncoding.EncodeToString(bs), nil
+}
+
+// VerifySHA256 验证RSA2签名
+func VerifySHA256(pubKey *rsa.PublicKey, data []byte, sign string) error {
+	bs, err := base64.StdEncoding.DecodeString(sign)
+	if err != nil {
+		return errutil.ErrVerifyFailed
+	}
+
+	digest := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, digest[:], bs); err != nil {
+		return errutil.ErrVerifyFailed
+	}
+	return nil
+}
+
 func VerifyRSAWithMD5(pubKey *rsa.PublicKey, data []byte, sign string) error {
 	bs, err := base64.StdEncoding.DecodeString(sign)
 	if err != nil {
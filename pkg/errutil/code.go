@@ -50,6 +50,12 @@ const (
 	yxProductionNotFound
 	yxRequestPrePayIDFailed
 	YXDeskNotFound
+	yxTokenExpired
+	yxPayAmountMismatch
+	yxIllegalOrderStatus
+	yxPhoneExists
+	yxAccountExists
+	yxAccountBound
 )
 
 var errs = map[error]int{
@@ -96,4 +102,10 @@ var errs = map[error]int{
 	ErrProductionNotFound:    yxProductionNotFound,
 	ErrRequestPrePayIDFailed: yxRequestPrePayIDFailed,
 	ErrDeskNotFound:          YXDeskNotFound,
+	ErrTokenExpired:          yxTokenExpired,
+	ErrPayAmountMismatch:     yxPayAmountMismatch,
+	ErrIllegalOrderStatus:    yxIllegalOrderStatus,
+	ErrPhoneExists:           yxPhoneExists,
+	ErrAccountBound:          yxAccountBound,
+	ErrAccountExists:         yxAccountExists,
 }
@@ -25,6 +25,9 @@ var (
 	ErrUserNotFound          = errors.New("user not found")
 	ErrTokenNotFound         = errors.New("token not found")
 	ErrInvalidToken          = errors.New("invalid token")
+	ErrTokenExpired          = errors.New("token expired")
+	ErrPayAmountMismatch     = errors.New("pay amount mismatch")
+	ErrIllegalOrderStatus    = errors.New("illegal order status")
 	ErrIllegalName           = errors.New("illegal user name")
 	ErrTokenMismatchUser     = errors.New("token mismatch user")
 	ErrInvalidPayPlatform    = errors.New("invalid pay platform")
@@ -54,6 +57,8 @@ var (
 	ErrProductionNotFound    = errors.New("production not found")
 	ErrRequestPrePayIDFailed = errors.New("request prepay id failed")
 	ErrAccountExists         = errors.New("account exists")
+	ErrPhoneExists           = errors.New("phone exists")
+	ErrAccountBound          = errors.New("account has been bound")
 )
 
 //Code code for the error
@@ -0,0 +1,67 @@
+package secure
+
+import (
+	"encoding/base64"
+	"errors"
+
+	"github.com/xxtea/xxtea-go/xxtea"
+)
+
+const (
+	LegacyXXTEA = "xxtea" // 固定密钥的xxtea加密, base64编码
+	LegacyPlain = "plain" // 不加密
+)
+
+var ErrLegacyMode = errors.New("secure: 未知的旧加密方式")
+
+// Legacy 老版本客户端使用的加密方式
+type Legacy interface {
+	Encrypt(data []byte) []byte
+	Decrypt(data []byte) ([]byte, error)
+}
+
+// NewLegacy 根据配置创建旧的加密方式, mode为空时返回nil, 即不支持老版本客户端
+func NewLegacy(mode, key string) (Legacy, error) {
+	switch mode {
+	case "":
+		return nil, nil
+	case LegacyPlain:
+		return plain{}, nil
+	case LegacyXXTEA:
+		if key == "" {
+			return nil, ErrInvalidKey
+		}
+		return &xxteaLegacy{key: []byte(key)}, nil
+	}
+	return nil, ErrLegacyMode
+}
+
+type plain struct{}
+
+func (plain) Encrypt(data []byte) []byte {
+	return data
+}
+
+func (plain) Decrypt(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+type xxteaLegacy struct {
+	key []byte
+}
+
+func (x *xxteaLegacy) Encrypt(data []byte) []byte {
+	return []byte(base64.StdEncoding.EncodeToString(xxtea.Encrypt(data, x.key)))
+}
+
+func (x *xxteaLegacy) Decrypt(data []byte) ([]byte, error) {
+	out, err := base64.StdEncoding.DecodeString(string(data))
+	if err != nil {
+		return nil, err
+	}
+	out = xxtea.Decrypt(out, x.key)
+	if out == nil {
+		return nil, ErrDecrypt
+	}
+	return out, nil
+}
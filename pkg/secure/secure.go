@@ -0,0 +1,284 @@
+// Package secure 连接加密: 客户端内置服务器的X25519公钥, 连接建立后通过secure.Exchange
+// 交换临时公钥, 双方根据 静态密钥协商结果 + 临时密钥协商结果 派生出本连接独立的AES-GCM密钥,
+// 只有持有服务器私钥的一方才能得到相同的密钥. 每个加密消息都带有递增的序号, 重放、乱序
+// 或者篡改的消息会被拒绝并断开连接. 老版本客户端可以继续使用配置的旧加密方式.
+//
+// 加密消息格式: 序号(8字节, 大端) | AES-GCM密文, nonce为4字节0加上序号, 附加数据为消息路由
+package secure
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+
+	"github.com/lonng/nano"
+	"github.com/lonng/nano/component"
+	"github.com/lonng/nano/session"
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	Name  = "secure"          // 组件名
+	Route = "secure.Exchange" // 密钥交换的路由, 请求和响应都不加密
+)
+
+const (
+	keyConn = "secure"
+	seqSize = 8
+	kdfInfo = "nanoserver secure v1"
+)
+
+var (
+	ErrNotExchanged   = errors.New("secure: 没有完成密钥交换")
+	ErrExchanged      = errors.New("secure: 重复的密钥交换")
+	ErrSequence       = errors.New("secure: 消息序号错误, 可能是重放的消息")
+	ErrDecrypt        = errors.New("secure: 消息解密失败")
+	ErrLegacyDisabled = errors.New("secure: 不再支持老版本客户端的加密方式")
+	ErrInvalidKey     = errors.New("secure: 无效的密钥")
+)
+
+type ExchangeRequest struct {
+	PublicKey []byte `json:"publicKey" protobuf:"1"` //客户端临时公钥(X25519)
+}
+
+type ExchangeResponse struct {
+	Code      int    `json:"code" protobuf:"1"`
+	Error     string `json:"error" protobuf:"2"`
+	PublicKey []byte `json:"publicKey" protobuf:"3"` //服务器临时公钥(X25519)
+}
+
+type Cipher struct {
+	static *ecdh.PrivateKey
+	legacy Legacy
+}
+
+// New 使用服务器私钥(base64)创建加密管道, legacy为nil时不支持老版本客户端
+func New(privateKey string, legacy Legacy) (*Cipher, error) {
+	raw, err := base64.StdEncoding.DecodeString(privateKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	static, err := ecdh.X25519().NewPrivateKey(raw)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	return &Cipher{static: static, legacy: legacy}, nil
+}
+
+// GenerateKey 生成服务器私钥(base64), 用于配置crypto.private-key
+func GenerateKey() (string, error) {
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key.Bytes()), nil
+}
+
+// PublicKey 返回需要内置到客户端的服务器公钥(base64)
+func (c *Cipher) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(c.static.PublicKey().Bytes())
+}
+
+// 每个连接的加密状态, 读写分别在不同的线程中
+type conn struct {
+	sync.Mutex
+	legacy      bool
+	exchangeMid uint // 密钥交换请求的ID, 对应的响应不加密
+	recv        cipher.AEAD
+	send        cipher.AEAD
+	recvSeq     uint64
+	sendSeq     uint64
+}
+
+func connOf(s *session.Session) *conn {
+	c, _ := s.Value(keyConn).(*conn)
+	return c
+}
+
+// Inbound 接收管道, 解密失败的连接会被断开
+func (c *Cipher) Inbound(s *session.Session, msg nano.Message) error {
+	data, err := c.inbound(s, msg.Route, msg.ID, msg.Data)
+	if err != nil {
+		s.Close()
+		return err
+	}
+	msg.Data = data
+	return nil
+}
+
+// Outbound 发送管道
+func (c *Cipher) Outbound(s *session.Session, msg nano.Message) error {
+	data, err := c.outbound(s, msg.Route, msg.ID, msg.Data)
+	if err != nil {
+		return err
+	}
+	msg.Data = data
+	return nil
+}
+
+// 连接的第一个消息决定加密方式: 密钥交换请求使用新的加密方式, 其他消息使用旧的加密方式
+func (c *Cipher) inbound(s *session.Session, route string, mid uint, data []byte) ([]byte, error) {
+	st := connOf(s)
+	if route == Route {
+		if st != nil {
+			return nil, ErrExchanged
+		}
+		s.Set(keyConn, &conn{exchangeMid: mid})
+		return data, nil
+	}
+
+	if st == nil {
+		if c.legacy == nil {
+			return nil, ErrLegacyDisabled
+		}
+		st = &conn{legacy: true}
+		s.Set(keyConn, st)
+	}
+	if st.legacy {
+		return c.legacy.Decrypt(data)
+	}
+	return st.open(route, data)
+}
+
+func (c *Cipher) outbound(s *session.Session, route string, mid uint, data []byte) ([]byte, error) {
+	st := connOf(s)
+	if st == nil || st.legacy {
+		if c.legacy == nil {
+			return nil, ErrLegacyDisabled
+		}
+		return c.legacy.Encrypt(data), nil
+	}
+	return st.seal(route, mid, data)
+}
+
+// 协商本连接的密钥, 返回服务器临时公钥
+func (c *Cipher) exchange(s *session.Session, clientKey []byte) ([]byte, error) {
+	st := connOf(s)
+	if st == nil || st.legacy {
+		return nil, ErrNotExchanged
+	}
+
+	st.Lock()
+	defer st.Unlock()
+	if st.recv != nil {
+		return nil, ErrExchanged
+	}
+
+	pub, err := ecdh.X25519().NewPublicKey(clientKey)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	static, err := c.static.ECDH(pub)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+	ephemeral, err := eph.ECDH(pub)
+	if err != nil {
+		return nil, ErrInvalidKey
+	}
+
+	serverKey := eph.PublicKey().Bytes()
+	if st.recv, st.send, err = deriveKeys(static, ephemeral, clientKey, serverKey); err != nil {
+		return nil, err
+	}
+	return serverKey, nil
+}
+
+// 派生客户端->服务器和服务器->客户端两个方向的密钥
+func deriveKeys(static, ephemeral, clientKey, serverKey []byte) (c2s, s2c cipher.AEAD, err error) {
+	secret := append(append([]byte{}, static...), ephemeral...)
+	salt := append(append([]byte{}, clientKey...), serverKey...)
+	key := make([]byte, 64)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(kdfInfo)), key); err != nil {
+		return nil, nil, err
+	}
+	if c2s, err = newAEAD(key[:32]); err != nil {
+		return nil, nil, err
+	}
+	if s2c, err = newAEAD(key[32:]); err != nil {
+		return nil, nil, err
+	}
+	return c2s, s2c, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(seq uint64) []byte {
+	n := make([]byte, 12)
+	binary.BigEndian.PutUint64(n[4:], seq)
+	return n
+}
+
+// 解密消息, 序号必须是上一个消息的序号加1
+func (st *conn) open(route string, data []byte) ([]byte, error) {
+	st.Lock()
+	defer st.Unlock()
+	if st.recv == nil {
+		return nil, ErrNotExchanged
+	}
+	if len(data) < seqSize {
+		return nil, ErrDecrypt
+	}
+	seq := binary.BigEndian.Uint64(data)
+	if seq != st.recvSeq+1 {
+		return nil, ErrSequence
+	}
+	plain, err := st.recv.Open(nil, nonce(seq), data[seqSize:], []byte(route))
+	if err != nil {
+		return nil, ErrDecrypt
+	}
+	st.recvSeq = seq
+	return plain, nil
+}
+
+func (st *conn) seal(route string, mid uint, data []byte) ([]byte, error) {
+	st.Lock()
+	defer st.Unlock()
+	if mid != 0 && mid == st.exchangeMid {
+		st.exchangeMid = 0
+		return data, nil
+	}
+	if st.send == nil {
+		return nil, ErrNotExchanged
+	}
+	st.sendSeq++
+	out := make([]byte, seqSize, seqSize+len(data)+st.send.Overhead())
+	binary.BigEndian.PutUint64(out, st.sendSeq)
+	return st.send.Seal(out, nonce(st.sendSeq), data, []byte(route)), nil
+}
+
+// Handler 密钥交换组件, 注册时使用Name作为组件名
+type Handler struct {
+	component.Base
+	cipher *Cipher
+}
+
+func (c *Cipher) Handler() *Handler {
+	return &Handler{cipher: c}
+}
+
+// Exchange 密钥交换, 失败后客户端需要重新连接
+func (h *Handler) Exchange(s *session.Session, req *ExchangeRequest) error {
+	key, err := h.cipher.exchange(s, req.PublicKey)
+	if err != nil {
+		return s.Response(&ExchangeResponse{Code: -1, Error: err.Error()})
+	}
+	return s.Response(&ExchangeResponse{PublicKey: key})
+}
@@ -0,0 +1,213 @@
+package secure
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"testing"
+
+	"github.com/lonng/nano/session"
+)
+
+// 模拟客户端: 内置服务器公钥, 使用临时密钥完成交换
+type client struct {
+	eph     *ecdh.PrivateKey
+	send    cipher.AEAD
+	recv    cipher.AEAD
+	sendSeq uint64
+}
+
+func newClient(t *testing.T) *client {
+	eph, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &client{eph: eph}
+}
+
+func (cl *client) finish(t *testing.T, serverPublic string, serverKey []byte) {
+	raw, _ := base64.StdEncoding.DecodeString(serverPublic)
+	static, _ := ecdh.X25519().NewPublicKey(raw)
+	eph, err := ecdh.X25519().NewPublicKey(serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, _ := cl.eph.ECDH(static)
+	s2, _ := cl.eph.ECDH(eph)
+	if cl.send, cl.recv, err = deriveKeys(s1, s2, cl.eph.PublicKey().Bytes(), serverKey); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (cl *client) seal(route string, data []byte) []byte {
+	cl.sendSeq++
+	out := make([]byte, seqSize)
+	binary.BigEndian.PutUint64(out, cl.sendSeq)
+	return cl.send.Seal(out, nonce(cl.sendSeq), data, []byte(route))
+}
+
+func (cl *client) open(route string, data []byte) ([]byte, error) {
+	seq := binary.BigEndian.Uint64(data)
+	return cl.recv.Open(nil, nonce(seq), data[seqSize:], []byte(route))
+}
+
+func newCipher(t *testing.T, legacy Legacy) *Cipher {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := New(key, legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func handshake(t *testing.T, c *Cipher, s *session.Session) *client {
+	cl := newClient(t)
+	if _, err := c.inbound(s, Route, 1, []byte("exchange")); err != nil {
+		t.Fatal(err)
+	}
+	key, err := c.exchange(s, cl.eph.PublicKey().Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 交换的响应不加密
+	resp, err := c.outbound(s, "", 1, []byte("response"))
+	if err != nil || string(resp) != "response" {
+		t.Fatalf("expect plain exchange response, got: %q, %v", resp, err)
+	}
+	cl.finish(t, c.PublicKey(), key)
+	return cl
+}
+
+func TestExchange(t *testing.T) {
+	c := newCipher(t, nil)
+	s := session.New(nil)
+	cl := handshake(t, c, s)
+
+	for i := 0; i < 3; i++ {
+		data, err := c.inbound(s, "desk.Chupai", uint(i+2), cl.seal("desk.Chupai", []byte("ping")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != "ping" {
+			t.Fatalf("expect ping, got: %q", data)
+		}
+	}
+
+	out, err := c.outbound(s, "onPlayerEnter", 0, []byte("pong"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := cl.open("onPlayerEnter", out)
+	if err != nil || string(data) != "pong" {
+		t.Fatalf("expect pong, got: %q, %v", data, err)
+	}
+
+	// 重复交换
+	if _, err := c.inbound(s, Route, 9, nil); err != ErrExchanged {
+		t.Fatalf("expect exchanged error, got: %v", err)
+	}
+}
+
+func TestReject(t *testing.T) {
+	c := newCipher(t, nil)
+	s := session.New(nil)
+	cl := handshake(t, c, s)
+
+	first := cl.seal("desk.Chupai", []byte("ping"))
+	if _, err := c.inbound(s, "desk.Chupai", 2, first); err != nil {
+		t.Fatal(err)
+	}
+	// 重放
+	if _, err := c.inbound(s, "desk.Chupai", 3, first); err != ErrSequence {
+		t.Fatalf("expect sequence error, got: %v", err)
+	}
+	// 跳过序号
+	cl.seal("desk.Chupai", []byte("lost"))
+	if _, err := c.inbound(s, "desk.Chupai", 4, cl.seal("desk.Chupai", []byte("ping"))); err != ErrSequence {
+		t.Fatalf("expect sequence error, got: %v", err)
+	}
+
+	// 篡改路由或内容
+	s = session.New(nil)
+	cl = handshake(t, c, s)
+	if _, err := c.inbound(s, "desk.Hu", 2, cl.seal("desk.Chupai", []byte("ping"))); err != ErrDecrypt {
+		t.Fatalf("expect decrypt error, got: %v", err)
+	}
+	cl.sendSeq = 0
+	data := cl.seal("desk.Chupai", []byte("ping"))
+	data[len(data)-1] ^= 0xff
+	if _, err := c.inbound(s, "desk.Chupai", 2, data); err != ErrDecrypt {
+		t.Fatalf("expect decrypt error, got: %v", err)
+	}
+
+	// 没有交换并且不支持老版本客户端
+	if _, err := c.inbound(session.New(nil), "desk.Chupai", 1, []byte("ping")); err != ErrLegacyDisabled {
+		t.Fatalf("expect legacy disabled error, got: %v", err)
+	}
+
+	// 使用其他服务器的私钥
+	other := newCipher(t, nil)
+	s = session.New(nil)
+	cl = newClient(t)
+	c.inbound(s, Route, 1, nil)
+	key, _ := c.exchange(s, cl.eph.PublicKey().Bytes())
+	cl.finish(t, other.PublicKey(), key)
+	if _, err := c.inbound(s, "desk.Chupai", 2, cl.seal("desk.Chupai", []byte("ping"))); err != ErrDecrypt {
+		t.Fatalf("expect decrypt error, got: %v", err)
+	}
+}
+
+func TestLegacy(t *testing.T) {
+	legacy, err := NewLegacy(LegacyXXTEA, "7AEC4MA152BQE9HWQ7KB")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := newCipher(t, legacy)
+	s := session.New(nil)
+
+	data, err := c.inbound(s, "manager.Login", 1, legacy.Encrypt([]byte("login")))
+	if err != nil || string(data) != "login" {
+		t.Fatalf("expect login, got: %q, %v", data, err)
+	}
+	out, _ := c.outbound(s, "", 1, []byte("ok"))
+	if data, _ := legacy.Decrypt(out); string(data) != "ok" {
+		t.Fatalf("expect ok, got: %q", data)
+	}
+	// 使用旧加密方式的连接不能再交换密钥
+	if _, err := c.inbound(s, Route, 2, nil); err != ErrExchanged {
+		t.Fatalf("expect exchanged error, got: %v", err)
+	}
+
+	if _, err := NewLegacy(LegacyXXTEA, ""); err != ErrInvalidKey {
+		t.Fatalf("expect invalid key, got: %v", err)
+	}
+	if _, err := NewLegacy("des", ""); err != ErrLegacyMode {
+		t.Fatalf("expect legacy mode error, got: %v", err)
+	}
+	if p, _ := NewLegacy(LegacyPlain, ""); !bytes.Equal(p.Encrypt([]byte("a")), []byte("a")) {
+		t.Fatal("expect plain legacy")
+	}
+}
+
+var benchPayload = []byte(`[{"name":"test","length":1.06666672229767,"segments":[{"t":0.233333334326744,"v":4.44000005722046},{"t":0.200000002980232,"v":2.62499976158142},{"t":0.266666650772095,"v":0.686249911785126},{"t":0.166666686534882,"v":1.34915959835052},{"t":0.200000047683716,"v":2.28395414352417}]}]`)
+
+func BenchmarkLegacy_Decrypt(b *testing.B) {
+	legacy, _ := NewLegacy(LegacyXXTEA, "hKKJdfskj997sdSk")
+	test := legacy.Encrypt(benchPayload)
+	for i := 0; i < b.N; i++ {
+		legacy.Decrypt(test)
+	}
+}
+
+func BenchmarkLegacy_Encrypt(b *testing.B) {
+	legacy, _ := NewLegacy(LegacyXXTEA, "hKKJdfskj997sdSk")
+	for i := 0; i < b.N; i++ {
+		legacy.Encrypt(benchPayload)
+	}
+}
@@ -0,0 +1,593 @@
+// Package protobuf 按protobuf(proto3)编码格式序列化带有protobuf标签的结构体.
+// 字段编号由结构体标签指定, 例如: `json:"acId" protobuf:"1"`, 编号一旦发布不能修改,
+// 新增字段只能使用新的编号. 使用Schema可以根据结构体生成对应的.proto定义.
+package protobuf
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const tagName = "protobuf"
+
+var (
+	ErrWrongValueType = errors.New("protobuf: 只能序列化结构体")
+	ErrTruncated      = errors.New("protobuf: 数据不完整")
+	ErrWireType       = errors.New("protobuf: 字段编码类型不匹配")
+)
+
+// 结构体中缺少字段编号或者包含不支持的字段类型
+type UnsupportedError struct {
+	Type   reflect.Type
+	Reason string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("protobuf: 不支持的类型%s: %s", e.Type, e.Reason)
+}
+
+type Serializer struct{}
+
+// NewSerializer 返回实现了nano序列化接口的protobuf序列化器
+func NewSerializer() *Serializer {
+	return &Serializer{}
+}
+
+func (s *Serializer) Marshal(v interface{}) ([]byte, error) {
+	return Marshal(v)
+}
+
+func (s *Serializer) Unmarshal(data []byte, v interface{}) error {
+	return Unmarshal(data, v)
+}
+
+type field struct {
+	num   int
+	index int
+	name  string
+	typ   reflect.Type
+}
+
+type message struct {
+	fields []*field
+	byNum  map[int]*field
+}
+
+var (
+	mu    sync.RWMutex
+	infos = map[reflect.Type]*message{}
+)
+
+// 解析结构体的字段编号, 结果会被缓存
+func messageOf(t reflect.Type) (*message, error) {
+	mu.RLock()
+	m, ok := infos[t]
+	mu.RUnlock()
+	if ok {
+		return m, nil
+	}
+
+	m = &message{byNum: map[int]*field{}}
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get(tagName)
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			return nil, &UnsupportedError{t, fmt.Sprintf("字段%s没有编号", sf.Name)}
+		}
+		num, err := strconv.Atoi(tag)
+		if err != nil || num < 1 || num > 1<<29-1 {
+			return nil, &UnsupportedError{t, fmt.Sprintf("字段%s的编号无效: %s", sf.Name, tag)}
+		}
+		if _, dup := m.byNum[num]; dup {
+			return nil, &UnsupportedError{t, fmt.Sprintf("字段编号重复: %d", num)}
+		}
+		if err := checkType(sf.Type, false); err != nil {
+			return nil, &UnsupportedError{t, fmt.Sprintf("字段%s: %v", sf.Name, err)}
+		}
+		f := &field{num: num, index: i, name: sf.Name, typ: sf.Type}
+		m.fields = append(m.fields, f)
+		m.byNum[num] = f
+	}
+
+	mu.Lock()
+	infos[t] = m
+	mu.Unlock()
+	return m, nil
+}
+
+// 检查字段类型是否可以编码, 嵌套的结构体在编码时再检查
+func checkType(t reflect.Type, repeated bool) error {
+	if isScalar(t) {
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		return nil
+	case reflect.Ptr:
+		if t.Elem().Kind() == reflect.Struct {
+			return nil
+		}
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return nil
+		}
+		if !repeated {
+			return checkType(t.Elem(), true)
+		}
+	case reflect.Map:
+		if !repeated && isScalar(t.Key()) && t.Key().Kind() != reflect.Float32 && t.Key().Kind() != reflect.Float64 {
+			return checkType(t.Elem(), true)
+		}
+	}
+	return fmt.Errorf("不支持%s", t)
+}
+
+func isScalar(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Bool, reflect.String, reflect.Float32, reflect.Float64,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
+// 可以使用packed编码的数值类型
+func isPackable(t reflect.Type) bool {
+	return isScalar(t) && t.Kind() != reflect.String
+}
+
+// Marshal 序列化结构体或者结构体指针
+func Marshal(v interface{}) ([]byte, error) {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return []byte{}, nil
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, ErrWrongValueType
+	}
+	b, err := appendStruct(nil, rv)
+	if b == nil {
+		b = []byte{}
+	}
+	return b, err
+}
+
+// Unmarshal 反序列化到结构体指针, 未知的字段会被忽略
+func Unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return ErrWrongValueType
+	}
+	return decodeStruct(data, rv.Elem())
+}
+
+// Supported 检查类型是否可以按protobuf编码, 包括所有嵌套的结构体
+func Supported(t reflect.Type) error {
+	return walk(t, map[reflect.Type]bool{}, func(reflect.Type, *message) {})
+}
+
+// 遍历结构体及其引用的所有结构体
+func walk(t reflect.Type, seen map[reflect.Type]bool, fn func(reflect.Type, *message)) error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Map {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || seen[t] {
+		return nil
+	}
+	seen[t] = true
+	m, err := messageOf(t)
+	if err != nil {
+		return err
+	}
+	fn(t, m)
+	for _, f := range m.fields {
+		if err := walk(f.typ, seen, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 编码
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+func appendVarint(b []byte, x uint64) []byte {
+	for x >= 0x80 {
+		b = append(b, byte(x)|0x80)
+		x >>= 7
+	}
+	return append(b, byte(x))
+}
+
+func appendTag(b []byte, num, wire int) []byte {
+	return appendVarint(b, uint64(num)<<3|uint64(wire))
+}
+
+func appendFixed32(b []byte, x uint32) []byte {
+	return append(b, byte(x), byte(x>>8), byte(x>>16), byte(x>>24))
+}
+
+func appendFixed64(b []byte, x uint64) []byte {
+	return append(b, byte(x), byte(x>>8), byte(x>>16), byte(x>>24),
+		byte(x>>32), byte(x>>40), byte(x>>48), byte(x>>56))
+}
+
+func appendBytes(b []byte, num int, data []byte) []byte {
+	b = appendTag(b, num, wireBytes)
+	b = appendVarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+func appendStruct(b []byte, v reflect.Value) ([]byte, error) {
+	m, err := messageOf(v.Type())
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range m.fields {
+		if b, err = appendField(b, f.num, v.Field(f.index)); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+func appendField(b []byte, num int, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return b, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return appendBytes(b, num, v.Bytes()), nil
+		}
+		if isPackable(v.Type().Elem()) {
+			var packed []byte
+			for i := 0; i < v.Len(); i++ {
+				packed = appendScalar(packed, v.Index(i))
+			}
+			return appendBytes(b, num, packed), nil
+		}
+		var err error
+		for i := 0; i < v.Len(); i++ {
+			if b, err = appendValue(b, num, v.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool { return less(keys[i], keys[j]) })
+		for _, k := range keys {
+			entry, err := appendValue(nil, 1, k)
+			if err != nil {
+				return nil, err
+			}
+			if entry, err = appendValue(entry, 2, v.MapIndex(k)); err != nil {
+				return nil, err
+			}
+			b = appendBytes(b, num, entry)
+		}
+		return b, nil
+
+	case reflect.Ptr:
+		if v.IsNil() {
+			return b, nil
+		}
+		return appendValue(b, num, v)
+
+	case reflect.Struct:
+		inner, err := appendStruct(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		if len(inner) == 0 {
+			return b, nil
+		}
+		return appendBytes(b, num, inner), nil
+	}
+
+	// proto3标量字段的默认值不编码
+	if isZero(v) {
+		return b, nil
+	}
+	return appendValue(b, num, v)
+}
+
+// 编码一个值, 即使是默认值也会编码, 用于重复字段和map
+func appendValue(b []byte, num int, v reflect.Value) ([]byte, error) {
+	switch v.Kind() {
+	case reflect.String:
+		b = appendTag(b, num, wireBytes)
+		b = appendVarint(b, uint64(v.Len()))
+		return append(b, v.String()...), nil
+	case reflect.Slice:
+		return appendBytes(b, num, v.Bytes()), nil
+	case reflect.Ptr:
+		if v.IsNil() {
+			return appendBytes(b, num, nil), nil
+		}
+		return appendValue(b, num, v.Elem())
+	case reflect.Struct:
+		inner, err := appendStruct(nil, v)
+		if err != nil {
+			return nil, err
+		}
+		return appendBytes(b, num, inner), nil
+	case reflect.Float32:
+		b = appendTag(b, num, wireFixed32)
+	case reflect.Float64:
+		b = appendTag(b, num, wireFixed64)
+	default:
+		b = appendTag(b, num, wireVarint)
+	}
+	return appendScalar(b, v), nil
+}
+
+// 编码数值, 有符号整数和proto的int32/int64一样按补码编码
+func appendScalar(b []byte, v reflect.Value) []byte {
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			return append(b, 1)
+		}
+		return append(b, 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return appendVarint(b, uint64(v.Int()))
+	case reflect.Float32:
+		return appendFixed32(b, math.Float32bits(float32(v.Float())))
+	case reflect.Float64:
+		return appendFixed64(b, math.Float64bits(v.Float()))
+	}
+	return appendVarint(b, v.Uint())
+}
+
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.String:
+		return v.Len() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int() == 0
+	case reflect.Float32, reflect.Float64:
+		return v.Float() == 0
+	}
+	return v.Uint() == 0
+}
+
+func less(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	}
+	return a.Uint() < b.Uint()
+}
+
+// 解码
+func readVarint(data []byte) (uint64, int, error) {
+	var x uint64
+	for i := 0; i < len(data) && i < 10; i++ {
+		x |= uint64(data[i]&0x7f) << (7 * uint(i))
+		if data[i] < 0x80 {
+			return x, i + 1, nil
+		}
+	}
+	return 0, 0, ErrTruncated
+}
+
+// 读取一个字段的原始数据, 返回数据(变长整数时为整数值)和读取的长度
+func readField(data []byte, wire int) (uint64, []byte, int, error) {
+	switch wire {
+	case wireVarint:
+		x, n, err := readVarint(data)
+		return x, nil, n, err
+	case wireFixed32:
+		if len(data) < 4 {
+			return 0, nil, 0, ErrTruncated
+		}
+		return uint64(data[0]) | uint64(data[1])<<8 | uint64(data[2])<<16 | uint64(data[3])<<24, nil, 4, nil
+	case wireFixed64:
+		if len(data) < 8 {
+			return 0, nil, 0, ErrTruncated
+		}
+		var x uint64
+		for i := 7; i >= 0; i-- {
+			x = x<<8 | uint64(data[i])
+		}
+		return x, nil, 8, nil
+	case wireBytes:
+		l, n, err := readVarint(data)
+		if err != nil {
+			return 0, nil, 0, err
+		}
+		if uint64(len(data)-n) < l {
+			return 0, nil, 0, ErrTruncated
+		}
+		return 0, data[n : n+int(l)], n + int(l), nil
+	}
+	return 0, nil, 0, fmt.Errorf("protobuf: 不支持的编码类型: %d", wire)
+}
+
+func decodeStruct(data []byte, v reflect.Value) error {
+	m, err := messageOf(v.Type())
+	if err != nil {
+		return err
+	}
+	for len(data) > 0 {
+		key, n, err := readVarint(data)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+		num, wire := int(key>>3), int(key&7)
+
+		x, raw, n, err := readField(data, wire)
+		if err != nil {
+			return err
+		}
+		data = data[n:]
+
+		f, ok := m.byNum[num]
+		if !ok {
+			continue
+		}
+		if err := decodeField(v.Field(f.index), wire, x, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeField(v reflect.Value, wire int, x uint64, raw []byte) error {
+	switch v.Kind() {
+	case reflect.Slice:
+		elem := v.Type().Elem()
+		if elem.Kind() == reflect.Uint8 {
+			if wire != wireBytes {
+				return ErrWireType
+			}
+			v.SetBytes(append([]byte{}, raw...))
+			return nil
+		}
+		// 数值类型同时支持packed和非packed编码
+		if isPackable(elem) && wire == wireBytes {
+			ew := scalarWire(elem)
+			for len(raw) > 0 {
+				ex, _, n, err := readField(raw, ew)
+				if err != nil {
+					return err
+				}
+				raw = raw[n:]
+				e := reflect.New(elem).Elem()
+				setScalar(e, ex)
+				v.Set(reflect.Append(v, e))
+			}
+			return nil
+		}
+		e := reflect.New(elem).Elem()
+		if err := decodeValue(e, wire, x, raw); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, e))
+		return nil
+
+	case reflect.Map:
+		if wire != wireBytes {
+			return ErrWireType
+		}
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+		key := reflect.New(v.Type().Key()).Elem()
+		val := reflect.New(v.Type().Elem()).Elem()
+		for len(raw) > 0 {
+			k, n, err := readVarint(raw)
+			if err != nil {
+				return err
+			}
+			raw = raw[n:]
+			ex, eraw, n, err := readField(raw, int(k&7))
+			if err != nil {
+				return err
+			}
+			raw = raw[n:]
+			switch k >> 3 {
+			case 1:
+				err = decodeValue(key, int(k&7), ex, eraw)
+			case 2:
+				err = decodeValue(val, int(k&7), ex, eraw)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		v.SetMapIndex(key, val)
+		return nil
+	}
+	return decodeValue(v, wire, x, raw)
+}
+
+func decodeValue(v reflect.Value, wire int, x uint64, raw []byte) error {
+	switch v.Kind() {
+	case reflect.String:
+		if wire != wireBytes {
+			return ErrWireType
+		}
+		v.SetString(string(raw))
+		return nil
+	case reflect.Slice:
+		if wire != wireBytes {
+			return ErrWireType
+		}
+		v.SetBytes(append([]byte{}, raw...))
+		return nil
+	case reflect.Ptr:
+		if wire != wireBytes {
+			return ErrWireType
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return decodeStruct(raw, v.Elem())
+	case reflect.Struct:
+		if wire != wireBytes {
+			return ErrWireType
+		}
+		return decodeStruct(raw, v)
+	}
+	if wire != scalarWire(v.Type()) {
+		return ErrWireType
+	}
+	setScalar(v, x)
+	return nil
+}
+
+func scalarWire(t reflect.Type) int {
+	switch t.Kind() {
+	case reflect.Float32:
+		return wireFixed32
+	case reflect.Float64:
+		return wireFixed64
+	}
+	return wireVarint
+}
+
+func setScalar(v reflect.Value, x uint64) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(x != 0)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(int64(x))
+	case reflect.Float32:
+		v.SetFloat(float64(math.Float32frombits(uint32(x))))
+	case reflect.Float64:
+		v.SetFloat(math.Float64frombits(x))
+	default:
+		v.SetUint(x)
+	}
+}
@@ -0,0 +1,165 @@
+package protobuf
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type inner struct {
+	Uid  int64  `json:"uid" protobuf:"1"`
+	Name string `json:"name" protobuf:"2"`
+}
+
+type outer struct {
+	Status  int32            `json:"status" protobuf:"1"`
+	Score   int              `json:"score" protobuf:"2"`
+	Tiles   []int            `json:"tiles" protobuf:"3"`
+	Player  *inner           `json:"player" protobuf:"4"`
+	Players []inner          `json:"players" protobuf:"5"`
+	IsHu    bool             `json:"isHu" protobuf:"6"`
+	Rate    float64          `json:"rate" protobuf:"7"`
+	Names   []string         `json:"names" protobuf:"8"`
+	Data    []byte           `json:"data" protobuf:"9"`
+	Scores  map[int64]int    `json:"scores" protobuf:"10"`
+	Nested  inner            `json:"nested" protobuf:"11"`
+	Ptrs    []*inner         `json:"ptrs" protobuf:"12"`
+	Extra   map[string]inner `json:"extra" protobuf:"13"`
+	Ignored string           `json:"-" protobuf:"-"`
+}
+
+func TestRoundTrip(t *testing.T) {
+	in := &outer{
+		Status:  -3,
+		Score:   -1000,
+		Tiles:   []int{0, 1, 300, -1},
+		Player:  &inner{Uid: 10001, Name: "玩家"},
+		Players: []inner{{Uid: 1}, {}, {Name: "b"}},
+		IsHu:    true,
+		Rate:    1.5,
+		Names:   []string{"", "a"},
+		Data:    []byte{0, 1, 2},
+		Scores:  map[int64]int{1: -2, 2: 0},
+		Nested:  inner{Uid: 7},
+		Ptrs:    []*inner{{Uid: 3}},
+		Extra:   map[string]inner{"k": {Name: "v"}},
+		Ignored: "ignored",
+	}
+	data, err := Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &outer{}
+	if err := Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+	in.Ignored = ""
+	if !reflect.DeepEqual(in, out) {
+		t.Fatalf("expect %+v, got: %+v", in, out)
+	}
+
+	// 编码结果稳定, map按key排序
+	again, _ := Marshal(in)
+	if !bytes.Equal(data, again) {
+		t.Fatal("expect stable encoding")
+	}
+}
+
+func TestWireFormat(t *testing.T) {
+	// 和protoc生成的代码编码结果一致: uid=150, name="testing"
+	data, err := Marshal(&inner{Uid: 150, Name: "testing"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []byte{0x08, 0x96, 0x01, 0x12, 0x07, 't', 'e', 's', 't', 'i', 'n', 'g'}
+	if !bytes.Equal(data, expect) {
+		t.Fatalf("expect % x, got: % x", expect, data)
+	}
+
+	// 默认值不编码
+	if data, _ := Marshal(&outer{Tiles: []int{}}); len(data) != 0 {
+		t.Fatalf("expect empty encoding, got: % x", data)
+	}
+
+	// 未知字段会被忽略, 非packed编码的重复字段也可以解码
+	data = []byte{0x18, 0x05, 0x18, 0x06, 0xf8, 0x01, 0x01}
+	out := &outer{}
+	if err := Unmarshal(data, out); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out.Tiles, []int{5, 6}) {
+		t.Fatalf("expect tiles [5 6], got: %v", out.Tiles)
+	}
+
+	if err := Unmarshal([]byte{0x0a, 0x05, 0x01}, &inner{}); err != ErrTruncated {
+		t.Fatalf("expect truncated error, got: %v", err)
+	}
+}
+
+func TestUnsupported(t *testing.T) {
+	type untagged struct {
+		Uid int64 `json:"uid"`
+	}
+	if _, err := Marshal(&untagged{}); err == nil {
+		t.Fatal("expect error for untagged field")
+	}
+
+	type dynamic struct {
+		Data interface{} `protobuf:"1"`
+	}
+	if _, err := Marshal(&dynamic{}); err == nil {
+		t.Fatal("expect error for interface field")
+	}
+
+	if _, err := Marshal([]int{1}); err != ErrWrongValueType {
+		t.Fatalf("expect wrong value type, got: %v", err)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	schema, err := Schema("test", outer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"message outer {",
+		"  int32 status = 1;",
+		"  repeated int64 tiles = 3;",
+		"  inner player = 4;",
+		"  map<int64, int64> scores = 10;",
+		"  map<string, inner> extra = 13;",
+		"message inner {",
+	} {
+		if !strings.Contains(schema, line+"\n") {
+			t.Fatalf("expect %q in schema:\n%s", line, schema)
+		}
+	}
+	if strings.Contains(schema, "ignored") {
+		t.Fatal("expect ignored field omitted")
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	cases := map[string]string{
+		"MarkerID":     "marker_id",
+		"Uid":          "uid",
+		"HeadUrl":      "head_url",
+		"TileIDs":      "tile_ids",
+		"IP":           "ip",
+		"Player0":      "player0",
+		"ScoreInfo":    "score_info",
+		"HuPaiType":    "hu_pai_type",
+		"AccountID":    "account_id",
+		"RestCount":    "rest_count",
+		"IsHu":         "is_hu",
+		"DeskNo":       "desk_no",
+		"LastMoPaiUid": "last_mo_pai_uid",
+	}
+	for in, expect := range cases {
+		if out := snakeCase(in); out != expect {
+			t.Errorf("%s: expect %s, got: %s", in, expect, out)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package protobuf
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"unicode"
+)
+
+// Schema 根据结构体生成proto3定义, types为需要导出的消息, 引用的结构体会按顺序追加在后面
+func Schema(pkg string, types ...interface{}) (string, error) {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, "// Code generated by pkg/serialize/protobuf. DO NOT EDIT.\n\n")
+	fmt.Fprintf(buf, "syntax = \"proto3\";\n\npackage %s;\n", pkg)
+
+	seen := map[reflect.Type]bool{}
+	names := map[string]reflect.Type{}
+	var err error
+	for _, v := range types {
+		werr := walk(reflect.TypeOf(v), seen, func(t reflect.Type, m *message) {
+			if err != nil {
+				return
+			}
+			if t.Name() == "" {
+				err = &UnsupportedError{t, "匿名结构体没有消息名"}
+				return
+			}
+			if other, ok := names[t.Name()]; ok && other != t {
+				err = &UnsupportedError{t, "消息名重复"}
+				return
+			}
+			names[t.Name()] = t
+
+			fmt.Fprintf(buf, "\nmessage %s {\n", t.Name())
+			for _, f := range m.fields {
+				fmt.Fprintf(buf, "  %s %s = %d;\n", fieldType(f.typ), snakeCase(f.name), f.num)
+			}
+			fmt.Fprintf(buf, "}\n")
+		})
+		if werr != nil {
+			return "", werr
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return buf.String(), nil
+}
+
+func fieldType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() != reflect.Uint8 {
+			return "repeated " + scalarType(t.Elem())
+		}
+	case reflect.Map:
+		return fmt.Sprintf("map<%s, %s>", scalarType(t.Key()), scalarType(t.Elem()))
+	}
+	return scalarType(t)
+}
+
+func scalarType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bool"
+	case reflect.String:
+		return "string"
+	case reflect.Float32:
+		return "float"
+	case reflect.Float64:
+		return "double"
+	case reflect.Int, reflect.Int64:
+		return "int64"
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return "int32"
+	case reflect.Uint, reflect.Uint64:
+		return "uint64"
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return "uint32"
+	case reflect.Slice:
+		return "bytes"
+	case reflect.Ptr:
+		return scalarType(t.Elem())
+	}
+	return t.Name()
+}
+
+// 字段名转换为proto推荐的小写下划线风格, 例如: MarkerID -> marker_id
+func snakeCase(name string) string {
+	rs := []rune(name)
+	out := []rune{}
+	for i, r := range rs {
+		if unicode.IsUpper(r) && i > 0 {
+			prev := rs[i-1]
+			nextLower := i+1 < len(rs) && unicode.IsLower(rs[i+1])
+			// 缩写的复数形式, 例如: TileIDs -> tile_ids
+			if nextLower && rs[i+1] == 's' && (i+2 == len(rs) || unicode.IsUpper(rs[i+2])) {
+				nextLower = false
+			}
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || (unicode.IsUpper(prev) && nextLower) {
+				out = append(out, '_')
+			}
+		}
+		out = append(out, unicode.ToLower(r))
+	}
+	return string(out)
+}
@@ -0,0 +1,154 @@
+// Package serialize 提供游戏服务器的消息序列化, 支持JSON和protobuf两种格式.
+// 灰度期间(Mixed)每条消息同时编码两种格式, 发送时根据客户端登录时协商的格式选择,
+// 老版本的JSON客户端不需要任何修改.
+package serialize
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/lonng/nano"
+	"github.com/lonng/nano/serialize/json"
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/pkg/serialize/protobuf"
+)
+
+const (
+	JSON     = "json"     // 所有客户端使用JSON
+	Protobuf = "protobuf" // 所有客户端使用protobuf
+	Mixed    = "mixed"    // 灰度: 按客户端协商的格式, 没有协商的客户端使用JSON
+)
+
+const (
+	keyFormat  = "serializer"
+	frameMagic = 0x00 // 同时包含两种格式的消息, JSON不会以0x00开头
+)
+
+var (
+	ErrUnknownMode = errors.New("serialize: 未知的序列化格式")
+	ErrBadFrame    = errors.New("serialize: 消息格式错误")
+)
+
+type Serializer struct {
+	mode string
+	json *json.Serializer
+	pb   *protobuf.Serializer
+}
+
+func New(mode string) (*Serializer, error) {
+	switch mode {
+	case "":
+		mode = JSON
+	case JSON, Protobuf, Mixed:
+	default:
+		return nil, ErrUnknownMode
+	}
+	return &Serializer{
+		mode: mode,
+		json: json.NewSerializer(),
+		pb:   protobuf.NewSerializer(),
+	}, nil
+}
+
+func (s *Serializer) Mode() string {
+	return s.mode
+}
+
+// Marshal 灰度期间同时编码两种格式: 0x00 | JSON长度(varint) | JSON | protobuf,
+// 不支持protobuf的消息只编码JSON
+func (s *Serializer) Marshal(v interface{}) ([]byte, error) {
+	switch s.mode {
+	case JSON:
+		return s.json.Marshal(v)
+	case Protobuf:
+		return s.pb.Marshal(v)
+	}
+
+	j, err := s.json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	p, err := s.pb.Marshal(v)
+	if err != nil {
+		return j, nil
+	}
+
+	frame := make([]byte, 1, 1+binary.MaxVarintLen64+len(j)+len(p))
+	frame[0] = frameMagic
+	frame = binary.AppendUvarint(frame, uint64(len(j)))
+	frame = append(frame, j...)
+	return append(frame, p...), nil
+}
+
+// Unmarshal 灰度期间根据数据内容判断格式, JSON请求总是以'{'开头, protobuf消息
+// 不会以'{'开头(字段15的group编码, 协议中没有使用)
+func (s *Serializer) Unmarshal(data []byte, v interface{}) error {
+	switch s.mode {
+	case JSON:
+		return s.json.Unmarshal(data, v)
+	case Protobuf:
+		return s.pb.Unmarshal(data, v)
+	}
+
+	if trimmed := bytes.TrimLeft(data, " \t\r\n"); len(trimmed) > 0 && trimmed[0] == '{' {
+		return s.json.Unmarshal(data, v)
+	}
+	return s.pb.Unmarshal(data, v)
+}
+
+// Negotiate 根据客户端支持的格式(按优先级排序)选择本次连接使用的格式,
+// 登录响应已经使用协商后的格式编码, 客户端可以根据第一个字节是否为'{'判断
+func (s *Serializer) Negotiate(sess *session.Session, accepts []string) string {
+	format := s.mode
+	if s.mode == Mixed {
+		format = JSON
+		for _, a := range accepts {
+			if a == JSON || a == Protobuf {
+				format = a
+				break
+			}
+		}
+	}
+	sess.Set(keyFormat, format)
+	return format
+}
+
+// Format 返回连接协商的格式, 没有协商时为JSON
+func Format(sess *session.Session) string {
+	if format := sess.String(keyFormat); format != "" {
+		return format
+	}
+	return JSON
+}
+
+// Outbound 发送管道, 灰度期间根据连接协商的格式取出对应的数据, 必须在加密之前执行
+func (s *Serializer) Outbound(sess *session.Session, msg nano.Message) error {
+	if s.mode != Mixed {
+		return nil
+	}
+	data, err := pick(msg.Data, Format(sess))
+	if err != nil {
+		return fmt.Errorf("%v, Route=%s", err, msg.Route)
+	}
+	msg.Data = data
+	return nil
+}
+
+// 从同时包含两种格式的消息中取出指定格式的数据, 其他消息原样返回
+func pick(data []byte, format string) ([]byte, error) {
+	if len(data) == 0 || data[0] != frameMagic {
+		return data, nil
+	}
+
+	l, n := binary.Uvarint(data[1:])
+	if n <= 0 || uint64(len(data)-1-n) < l {
+		return nil, ErrBadFrame
+	}
+	body := data[1+n:]
+	if format == Protobuf {
+		return body[l:], nil
+	}
+	return body[:l], nil
+}
@@ -0,0 +1,93 @@
+package serialize
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/lonng/nano/session"
+	"github.com/lonng/nanoserver/pkg/serialize/protobuf"
+)
+
+type request struct {
+	Uid     int64  `json:"uid" protobuf:"1"`
+	Version string `json:"version" protobuf:"2"`
+}
+
+type untagged struct {
+	Uid int64 `json:"uid"`
+}
+
+func TestMixed(t *testing.T) {
+	s, err := New(Mixed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v := &request{Uid: 1, Version: "1.9.3"}
+	data, err := s.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	j, _ := json.Marshal(v)
+	p, _ := protobuf.Marshal(v)
+	if out, _ := pick(data, JSON); !bytes.Equal(out, j) {
+		t.Fatalf("expect json %s, got: %s", j, out)
+	}
+	if out, _ := pick(data, Protobuf); !bytes.Equal(out, p) {
+		t.Fatalf("expect protobuf % x, got: % x", p, out)
+	}
+
+	// 不支持protobuf的消息只编码JSON
+	data, err = s.Marshal(&untagged{Uid: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := pick(data, Protobuf); string(out) != `{"uid":1}` {
+		t.Fatalf("expect json fallback, got: %s", out)
+	}
+
+	if _, err := pick([]byte{frameMagic, 10, '{'}, JSON); err != ErrBadFrame {
+		t.Fatalf("expect bad frame, got: %v", err)
+	}
+
+	// 两种格式的请求都可以解析
+	for _, in := range [][]byte{j, p} {
+		out := &request{}
+		if err := s.Unmarshal(in, out); err != nil {
+			t.Fatal(err)
+		}
+		if *out != *v {
+			t.Fatalf("expect %+v, got: %+v", v, out)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	cases := []struct {
+		mode    string
+		accepts []string
+		expect  string
+	}{
+		{Mixed, nil, JSON},
+		{Mixed, []string{"msgpack", Protobuf, JSON}, Protobuf},
+		{Mixed, []string{JSON, Protobuf}, JSON},
+		{JSON, []string{Protobuf}, JSON},
+		{Protobuf, nil, Protobuf},
+	}
+	for _, c := range cases {
+		s, _ := New(c.mode)
+		sess := session.New(nil)
+		if Format(sess) != JSON {
+			t.Fatal("expect json before negotiation")
+		}
+		if format := s.Negotiate(sess, c.accepts); format != c.expect || Format(sess) != c.expect {
+			t.Fatalf("mode %s accepts %v: expect %s, got: %s", c.mode, c.accepts, c.expect, format)
+		}
+	}
+
+	if _, err := New("xml"); err != ErrUnknownMode {
+		t.Fatalf("expect unknown mode, got: %v", err)
+	}
+}
@@ -0,0 +1,99 @@
+// Package shuffle 提供可以复现的洗牌: 每局使用密码学安全的32字节随机数作为种子,
+// 通过ChaCha8生成随机序列, 同一个种子总是产生相同的随机序列, 保存种子后可以重建完全相同的牌局
+package shuffle
+
+import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+)
+
+// 洗牌种子, 保存时使用十六进制字符串
+type Seed [32]byte
+
+var ErrInvalidSeed = errors.New("invalid shuffle seed")
+
+type Shuffler struct {
+	seed Seed
+	r    *rand.Rand
+}
+
+// 使用指定的种子创建洗牌器, 用于重建牌局
+func New(seed Seed) *Shuffler {
+	return &Shuffler{
+		seed: seed,
+		r:    rand.New(rand.NewChaCha8(seed)),
+	}
+}
+
+// 使用密码学安全的随机种子创建洗牌器
+func NewRandom() *Shuffler {
+	return New(NewSeed())
+}
+
+// 生成密码学安全的随机种子, 系统随机数不可用时不能继续洗牌
+func NewSeed() Seed {
+	var seed Seed
+	if _, err := cryptorand.Read(seed[:]); err != nil {
+		panic(err)
+	}
+	return seed
+}
+
+// 解析十六进制的种子
+func ParseSeed(s string) (Seed, error) {
+	var seed Seed
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != len(seed) {
+		return seed, ErrInvalidSeed
+	}
+	copy(seed[:], raw)
+	return seed, nil
+}
+
+func (s Seed) String() string {
+	return hex.EncodeToString(s[:])
+}
+
+func (s Seed) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// 老版本的记录中种子是整数, 新的洗牌算法不能使用, 忽略
+func (s *Seed) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil || str == "" {
+		return nil
+	}
+	seed, err := ParseSeed(str)
+	if err != nil {
+		return err
+	}
+	*s = seed
+	return nil
+}
+
+func (s *Shuffler) Seed() Seed {
+	return s.seed
+}
+
+// 返回[0, n)之间的随机数
+func (s *Shuffler) Intn(n int) int {
+	return s.r.IntN(n)
+}
+
+// Fisher-Yates洗牌, 每一种排列出现的概率相同
+func (s *Shuffler) Shuffle(n int, swap func(i, j int)) {
+	for i := n - 1; i > 0; i-- {
+		swap(i, s.r.IntN(i+1))
+	}
+}
+
+// 洗乱整数切片
+func (s *Shuffler) Ints(a []int) {
+	s.Shuffle(len(a), func(i, j int) {
+		a[i], a[j] = a[j], a[i]
+	})
+}
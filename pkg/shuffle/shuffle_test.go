@@ -0,0 +1,78 @@
+package shuffle
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func sequence(n int) []int {
+	a := make([]int, n)
+	for i := range a {
+		a[i] = i
+	}
+	return a
+}
+
+func TestSameSeed(t *testing.T) {
+	seed := NewSeed()
+	a, b := sequence(108), sequence(108)
+	New(seed).Ints(a)
+	New(seed).Ints(b)
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("same seed %s, different result: %v %v", seed, a, b)
+	}
+}
+
+func TestPermutation(t *testing.T) {
+	a := sequence(136)
+	NewRandom().Ints(a)
+
+	seen := map[int]bool{}
+	for _, v := range a {
+		if v < 0 || v >= len(a) || seen[v] {
+			t.Fatalf("not a permutation: %v", a)
+		}
+		seen[v] = true
+	}
+}
+
+func TestUniform(t *testing.T) {
+	// 三个元素共6种排列, 每种排列出现的次数应该接近
+	counts := map[[3]int]int{}
+	s := New(Seed{1})
+	for i := 0; i < 60000; i++ {
+		a := []int{0, 1, 2}
+		s.Ints(a)
+		counts[[3]int{a[0], a[1], a[2]}]++
+	}
+
+	if len(counts) != 6 {
+		t.Fatalf("expect 6 permutations, got: %d", len(counts))
+	}
+	for p, c := range counts {
+		if c < 9000 || c > 11000 {
+			t.Fatalf("biased permutation %v: %d", p, c)
+		}
+	}
+}
+
+func TestSeedJSON(t *testing.T) {
+	seed := NewSeed()
+	data, err := json.Marshal(struct{ Seed Seed }{seed})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct{ Seed Seed }
+	if err := json.Unmarshal(data, &v); err != nil || v.Seed != seed {
+		t.Fatalf("expect %s, got: %s, %v", seed, v.Seed, err)
+	}
+
+	// 老版本记录中的整数种子被忽略
+	if err := json.Unmarshal([]byte(`{"Seed":123}`), &v); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(`{"Seed":"12"}`), &v); err != ErrInvalidSeed {
+		t.Fatalf("expect invalid seed, got: %v", err)
+	}
+}
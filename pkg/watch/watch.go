@@ -0,0 +1,133 @@
+package watch
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/lonng/nano"
+	"github.com/lonng/nano/session"
+	"github.com/pborman/uuid"
+)
+
+// 观战分组: 观战者和牌桌上的玩家使用不同的组播通道, 观战者只能收到公开的数据,
+// 可以设置延迟推送, 防止观战者向牌桌上的玩家通风报信
+
+var (
+	ErrWatchFull      = errors.New("观战人数已满")
+	ErrAlreadyWatched = errors.New("已经在观战中")
+)
+
+// 检查延迟消息的间隔, 实际精度取决于nano定时器的精度
+const flushInterval = 100 * time.Millisecond
+
+type Group struct {
+	group *nano.Group
+	delay time.Duration // 推送延迟, 0表示不延迟
+	max   int           // 最多观战人数
+
+	mu      sync.Mutex
+	pending []delayed   // 等待推送的消息, 按照到期时间排序
+	timer   *nano.Timer // 有等待推送的消息时才启动
+}
+
+type delayed struct {
+	at time.Time
+	fn func()
+}
+
+func New(delay time.Duration, max int) *Group {
+	return &Group{
+		group: nano.NewGroup(uuid.New()),
+		delay: delay,
+		max:   max,
+	}
+}
+
+// 加入观战
+func (g *Group) Add(s *session.Session) error {
+	if g.group.Contains(s.UID()) {
+		return ErrAlreadyWatched
+	}
+	if g.group.Count() >= g.max {
+		return ErrWatchFull
+	}
+	return g.group.Add(s)
+}
+
+// 退出观战
+func (g *Group) Leave(s *session.Session) error {
+	return g.group.Leave(s)
+}
+
+// 是否正在观战
+func (g *Group) Contains(uid int64) bool {
+	return g.group.Contains(uid)
+}
+
+// 观战人数
+func (g *Group) Count() int {
+	return g.group.Count()
+}
+
+// 向所有观战者推送, 数据在调用时已经确定, 延迟后推送
+func (g *Group) Broadcast(route string, v interface{}) {
+	g.after(func() {
+		g.group.Broadcast(route, v)
+	})
+}
+
+// 向单个观战者推送, 和Broadcast使用相同的延迟, 保证消息顺序
+func (g *Group) Push(s *session.Session, route string, v interface{}) {
+	g.after(func() {
+		s.Push(route, v)
+	})
+}
+
+// 关闭观战分组, 等待延迟的消息推送完成后再关闭
+func (g *Group) Close() {
+	g.after(func() {
+		g.group.Close()
+	})
+}
+
+// 所有延迟的消息使用同一个队列和定时器, nano的定时器在同一个周期内到期时执行顺序是随机的,
+// 每条消息单独使用定时器会打乱出牌、碰杠和胡牌的顺序
+func (g *Group) after(fn func()) {
+	if g.delay <= 0 {
+		fn()
+		return
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// 延迟时间相同, 按照加入的顺序就是到期的顺序
+	g.pending = append(g.pending, delayed{at: time.Now().Add(g.delay), fn: fn})
+	if g.timer == nil {
+		g.timer = nano.NewTimer(flushInterval, g.flush)
+	}
+}
+
+// 按顺序推送所有到期的消息, 在逻辑线程中执行
+func (g *Group) flush() {
+	now := time.Now()
+
+	g.mu.Lock()
+	n := 0
+	for n < len(g.pending) && !g.pending[n].at.After(now) {
+		n++
+	}
+	due := g.pending[:n:n]
+	g.pending = g.pending[n:]
+	if len(g.pending) == 0 && g.timer != nil {
+		g.pending = nil
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.mu.Unlock()
+
+	for _, d := range due {
+		d.fn()
+	}
+}
@@ -0,0 +1,64 @@
+package watch
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lonng/nano/session"
+)
+
+func TestGroupAdd(t *testing.T) {
+	g := New(0, 2)
+
+	s1 := session.New(nil)
+	s1.Bind(1)
+	if err := g.Add(s1); err != nil {
+		t.Fatal(err)
+	}
+	if err := g.Add(s1); err != ErrAlreadyWatched {
+		t.Fatalf("expect %v, got: %v", ErrAlreadyWatched, err)
+	}
+
+	s2 := session.New(nil)
+	s2.Bind(2)
+	if err := g.Add(s2); err != nil {
+		t.Fatal(err)
+	}
+
+	s3 := session.New(nil)
+	s3.Bind(3)
+	if err := g.Add(s3); err != ErrWatchFull {
+		t.Fatalf("expect %v, got: %v", ErrWatchFull, err)
+	}
+
+	g.Leave(s1)
+	if g.Contains(1) || g.Count() != 1 {
+		t.Fatalf("expect only uid 2 watching, count: %d", g.Count())
+	}
+}
+
+func TestGroupDelayOrder(t *testing.T) {
+	g := New(10*time.Millisecond, 2)
+
+	got := []int{}
+	for i := 0; i < 100; i++ {
+		i := i
+		g.after(func() { got = append(got, i) })
+	}
+
+	g.flush()
+	if len(got) != 0 {
+		t.Fatalf("expect no message before delay, got: %v", got)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	g.flush()
+	for i := range got {
+		if got[i] != i {
+			t.Fatalf("unexpected order: %v", got)
+		}
+	}
+	if len(got) != 100 || g.timer != nil {
+		t.Fatalf("expect all messages flushed, got: %d", len(got))
+	}
+}
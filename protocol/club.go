@@ -2,19 +2,75 @@ package protocol
 
 type (
 	ClubItem struct {
-		Id        int64  `json:"id"`
-		Name      string `json:"name"`
-		Desc      string `json:"desc"`
-		Member    int    `json:"member"`
-		MaxMember int    `json:"maxMember"`
+		Id        int64  `json:"id" protobuf:"1"`
+		Name      string `json:"name" protobuf:"2"`
+		Desc      string `json:"desc" protobuf:"3"`
+		Member    int    `json:"member" protobuf:"4"`
+		MaxMember int    `json:"maxMember" protobuf:"5"`
+		Role      int    `json:"role" protobuf:"6"` //自己的角色: 1-部长 2-管理员 3-普通成员
 	}
 
 	ClubListResponse struct {
-		Code int        `json:"code"`
-		Data []ClubItem `json:"data"`
+		Code int        `json:"code" protobuf:"1"`
+		Data []ClubItem `json:"data" protobuf:"2"`
 	}
 
 	ApplyClubRequest struct {
+		ClubId int64 `json:"clubId" protobuf:"1"`
+	}
+
+	// 审核申请、踢出成员
+	ClubMemberRequest struct {
+		ClubId int64 `json:"clubId" protobuf:"1"`
+		Uid    int64 `json:"uid" protobuf:"2"`
+	}
+
+	// 部长设置管理员
+	ClubRoleRequest struct {
+		ClubId int64 `json:"clubId" protobuf:"1"`
+		Uid    int64 `json:"uid" protobuf:"2"`
+		Role   int   `json:"role" protobuf:"3"`
+	}
+
+	ClubMember struct {
+		Uid       int64  `json:"uid" protobuf:"1"`
+		Name      string `json:"name" protobuf:"2"`
+		HeadUrl   string `json:"headUrl" protobuf:"3"`
+		Role      int    `json:"role" protobuf:"4"`
+		Status    int    `json:"status" protobuf:"5"` //1-申请中 2-已加入
+		CreatedAt int64  `json:"createdAt" protobuf:"6"`
+	}
+
+	ClubMemberListResponse struct {
+		Code int          `json:"code" protobuf:"1"`
+		Data []ClubMember `json:"data" protobuf:"2"`
+	}
+
+	// 俱乐部通知, 申请通过、申请被拒绝或者被踢出时推送给玩家
+	ClubNotify struct {
+		ClubId int64  `json:"clubId" protobuf:"1"`
+		Name   string `json:"name" protobuf:"2"`
+		Type   int    `json:"type" protobuf:"3"`
+	}
+
+	// 代理创建俱乐部, 由GM接口调用
+	CreateClubRequest struct {
+		AgentId   int64  `json:"agentId"`
+		Uid       int64  `json:"uid"` //部长
+		Name      string `json:"name"`
+		Desc      string `json:"desc"`
+		MaxMember int    `json:"maxMember"` //为0时使用默认值
+	}
+
+	CreateClubResponse struct {
+		Code   int   `json:"code"`
 		ClubId int64 `json:"clubId"`
 	}
 )
+
+// ClubNotify.Type
+const (
+	ClubNotifyApproved = 1 //申请通过
+	ClubNotifyRejected = 2 //申请被拒绝
+	ClubNotifyKicked   = 3 //被踢出俱乐部
+)
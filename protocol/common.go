@@ -109,8 +109,8 @@ type Device struct {
 }
 
 type StringResponse struct {
-	Code int    `json:"code"` //状态码
-	Data string `json:"data"` //字符串数据
+	Code int    `json:"code" protobuf:"1"` //状态码
+	Data string `json:"data" protobuf:"2"` //字符串数据
 }
 
 type CommonResponse struct {
@@ -120,8 +120,11 @@ type CommonResponse struct {
 
 var SuccessResponse = StringResponse{0, "success"}
 
+// 注册方式, 同时也是RegisterUserRequest.Type的取值
 const (
-	RegTypeThird = 5 //三方平台添加账号
+	RegTypePhone   = 1 //手机号注册
+	RegTypeAccount = 2 //账号注册
+	RegTypeThird   = 5 //三方平台添加账号
 )
 
 var EmptyMessage = &None{}
@@ -133,18 +136,24 @@ var SuccessMessage = &StringMessage{Message: "success"}
 type None struct{}
 
 type StringMessage struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
+	Code    int    `json:"code" protobuf:"1"`
+	Message string `json:"message" protobuf:"2"`
+}
+
+// 停服维护通知
+type MaintenanceNotice struct {
+	Message  string `json:"message" protobuf:"1"`
+	Deadline int64  `json:"deadline" protobuf:"2"` //最迟停服时间(unix时间戳)
 }
 
 type ErrorResponse struct {
-	Code  int    `json:"code"`
-	Error string `json:"error"`
+	Code  int    `json:"code" protobuf:"1"`
+	Error string `json:"error" protobuf:"2"`
 }
 
 type ErrorMessage struct {
-	ErrorType int    `json:"errorType"`
-	Message   string `json:"msg"`
+	ErrorType int    `json:"errorType" protobuf:"1"`
+	Message   string `json:"msg" protobuf:"2"`
 }
 
 type DailyMatchProgressInfo struct {
@@ -160,13 +169,13 @@ type DailyMatchProgressInfo struct {
 }
 
 type PlayerReady struct {
-	Account int64 `json:"account"`
+	Account int64 `json:"account" protobuf:"1"`
 }
 
 //听牌信息
 type Ting struct {
-	Index int   `json:"index"`
-	Hu    []int `json:"hu"`
+	Index int   `json:"index" protobuf:"1"`
+	Hu    []int `json:"hu" protobuf:"2"`
 }
 
 //所有被听的牌
@@ -177,9 +186,9 @@ type Ops []Op
 
 //提示
 type Hint struct {
-	Ops   Ops   `json:"ops"`
-	Tings Tings `json:"tings"`
-	Uid   int64 `json:"uid"`
+	Ops   Ops   `json:"ops" protobuf:"1"`
+	Tings Tings `json:"tings" protobuf:"2"`
+	Uid   int64 `json:"uid" protobuf:"3"`
 }
 
 func (h *Hint) String() string {
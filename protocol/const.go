@@ -27,6 +27,7 @@ const (
 const (
 	VerificationTypeRegister = "register"
 	VerificationTypeFindPW   = "findPW"
+	VerificationTypeBind     = "bind"
 )
 
 // 匹配类型
@@ -83,6 +84,7 @@ const (
 	HuTypeDianPao HuPaiType = iota
 	HuTypeZiMo
 	HuTypePei
+	HuTypeTuiShui // 流局退还刮风下雨的分, 不是胡牌
 )
 
 const (
@@ -123,6 +125,7 @@ const (
 	OptypeGang    = 3
 	OptypeHu      = 4
 	OptypePass    = 5
+	OptypeChi     = 6
 
 	OptyMoPai = 500 //摸牌
 	//以下三种杠的分类主要用以解决上面的 OptypeGang分类不细致,导致抢杠等操作处理麻烦的问题
@@ -5,296 +5,371 @@ import (
 )
 
 type EnterDeskInfo struct {
-	DeskPos  int    `json:"deskPos"`
-	Uid      int64  `json:"acId"`
-	Nickname string `json:"nickname"`
-	IsReady  bool   `json:"isReady"`
-	Sex      int    `json:"sex"`
-	IsExit   bool   `json:"isExit"`
-	HeadUrl  string `json:"headURL"`
-	Score    int    `json:"score"`
-	IP       string `json:"ip"`
-	Offline  bool   `json:"offline"`
+	DeskPos  int    `json:"deskPos" protobuf:"1"`
+	Uid      int64  `json:"acId" protobuf:"2"`
+	Nickname string `json:"nickname" protobuf:"3"`
+	IsReady  bool   `json:"isReady" protobuf:"4"`
+	Sex      int    `json:"sex" protobuf:"5"`
+	IsExit   bool   `json:"isExit" protobuf:"6"`
+	HeadUrl  string `json:"headURL" protobuf:"7"`
+	Score    int    `json:"score" protobuf:"8"`
+	IP       string `json:"ip" protobuf:"9"`
+	Offline  bool   `json:"offline" protobuf:"10"`
 }
 
 type ExitResponse struct {
-	AccountId int64 `json:"acid"`
-	IsExit    bool  `json:"isexit"`
-	ExitType  int   `json:"exitType"`
-	DeskPos   int   `json:"deskPos"`
+	AccountId int64 `json:"acid" protobuf:"1"`
+	IsExit    bool  `json:"isexit" protobuf:"2"`
+	ExitType  int   `json:"exitType" protobuf:"3"`
+	DeskPos   int   `json:"deskPos" protobuf:"4"`
 }
 
 type PlayerEnterDesk struct {
-	Data []EnterDeskInfo `json:"data"`
+	Data []EnterDeskInfo `json:"data" protobuf:"1"`
 }
 
 type ExitRequest struct {
-	IsDestroy bool `json:"isDestroy"`
+	IsDestroy bool `json:"isDestroy" protobuf:"1"`
 }
 
 type QueItem struct {
-	Uid int64 `json:"uid"`
-	Que int   `json:"que"`
+	Uid int64 `json:"uid" protobuf:"1"`
+	Que int   `json:"que" protobuf:"2"`
 }
 
 type DingQue struct {
-	Que int `json:"que"`
+	Que int `json:"que" protobuf:"1"`
+}
+
+// 换三张提示, TileIDs为推荐换出的三张牌
+type ExchangeHint struct {
+	TileIDs []int `json:"tileIds" protobuf:"1"`
+	Timeout int   `json:"timeout" protobuf:"2"` //剩余时间(秒)
+}
+
+type ExchangeRequest struct {
+	TileIDs []int `json:"tileIds" protobuf:"1"` //换出的三张牌, 必须是同一花色
+}
+
+// 玩家已经选好换出的牌, 不包含具体的牌
+type ExchangePicked struct {
+	Uid int64 `json:"acId" protobuf:"1"`
+}
+
+// 换三张结果, 每个玩家只能收到自己的
+type ExchangeResult struct {
+	Uid       int64 `json:"acId" protobuf:"1"`
+	Direction int   `json:"direction" protobuf:"2"` //1.顺时针 2.逆时针 3.对家
+	Out       []int `json:"out" protobuf:"3"`       //换出的牌
+	In        []int `json:"in" protobuf:"4"`        //换入的牌
+}
+
+// 断线重连时换三张的状态
+type ExchangeStatus struct {
+	Picked  bool  `json:"picked" protobuf:"1"`  //是否已经选好
+	TileIDs []int `json:"tileIds" protobuf:"2"` //已经选择的牌或者推荐换出的牌
+	Timeout int   `json:"timeout" protobuf:"3"` //剩余时间(秒)
 }
 
 type DeskBasicInfo struct {
-	DeskID string `json:"deskId"`
-	Title  string `json:"title"`
-	Desc   string `json:"desc"`
-	Mode   int    `json:"mode"`
+	DeskID string `json:"deskId" protobuf:"1"`
+	Title  string `json:"title" protobuf:"2"`
+	Desc   string `json:"desc" protobuf:"3"`
+	Mode   int    `json:"mode" protobuf:"4"`
 }
 
 type ScoreInfo struct {
-	Uid   int64 `json:"acId"`
-	Score int   `json:"score"`
+	Uid   int64 `json:"acId" protobuf:"1"`
+	Score int   `json:"score" protobuf:"2"`
 }
 
 type DuanPaiInfo struct {
-	Uid    int64 `json:"acId"`
-	OnHand []int `json:"mjs"`
+	Uid    int64 `json:"acId" protobuf:"1"`
+	OnHand []int `json:"mjs" protobuf:"2"`   //其他玩家的手牌不下发
+	Count  int   `json:"count" protobuf:"3"` //手牌数量
 }
 
 type DuanPai struct {
-	MarkerID    int64         `json:"markerId"` //庄家
-	Dice1       int           `json:"dice1"`
-	Dice2       int           `json:"dice2"`
-	AccountInfo []DuanPaiInfo `json:"accountInfo"`
+	MarkerID    int64         `json:"markerId" protobuf:"1"` //庄家
+	Dice1       int           `json:"dice1" protobuf:"2"`
+	Dice2       int           `json:"dice2" protobuf:"3"`
+	AccountInfo []DuanPaiInfo `json:"accountInfo" protobuf:"4"`
 }
 
 type Op struct {
-	Type    int   `json:"op"`
-	TileIDs []int `json:"mjidxs"` //
+	Type    int   `json:"op" protobuf:"1"`
+	TileIDs []int `json:"mjidxs" protobuf:"2"` //
 }
 
 type OpTypeDo struct {
-	Uid     []int64 `json:"uid"`
-	OpType  int     `json:"optype"`
-	HuType  int     `json:"hutype"`
-	TileIDs []int   `json:"mjs"`
+	Uid     []int64 `json:"uid" protobuf:"1"`
+	OpType  int     `json:"optype" protobuf:"2"`
+	HuType  int     `json:"hutype" protobuf:"3"`
+	TileIDs []int   `json:"mjs" protobuf:"4"`
 }
 
 type MoPai struct {
-	AccountID int64 `json:"acId"`
-	TileIDs   []int `json:"mjids"`
+	AccountID int64 `json:"acId" protobuf:"1"`
+	TileIDs   []int `json:"mjids" protobuf:"2"`
 }
 
 type GangPaiScoreChange struct {
-	IsXiaYu bool        `json:"isXiaYu"`
-	Changes []ScoreInfo `json:"changes"`
+	IsXiaYu bool        `json:"isXiaYu" protobuf:"1"`
+	Changes []ScoreInfo `json:"changes" protobuf:"2"`
 }
 
 type BeHuInfo struct {
-	AccountID int   `json:"acid"`
-	FanShu    int   `json:"fanshu"`
-	Coin      int64 `json:"coin"`
+	AccountID int   `json:"acid" protobuf:"1"`
+	FanShu    int   `json:"fanshu" protobuf:"2"`
+	Coin      int64 `json:"coin" protobuf:"3"`
 }
 
 type RoundStats struct {
-	FanNum     int    `json:"fanshu"`     //番数
-	Feng       int    `json:"feng"`       //刮风
-	Yu         int    `json:"yu"`         //下雨
-	Total      int    `json:"total"`      //总分
-	BannerType int    `json:"bannerType"` //显示[1]自摸,[2]胡,[3]点炮,[4]赔付图标
-	Desc       string `json:"desc"`
+	FanNum     int    `json:"fanshu" protobuf:"1"`     //番数
+	Feng       int    `json:"feng" protobuf:"2"`       //刮风
+	Yu         int    `json:"yu" protobuf:"3"`         //下雨
+	Total      int    `json:"total" protobuf:"4"`      //总分
+	BannerType int    `json:"bannerType" protobuf:"5"` //显示[1]自摸,[2]胡,[3]点炮,[4]赔付图标
+	Desc       string `json:"desc" protobuf:"6"`
 }
 
 type MatchStats struct {
-	ZiMoNum     int    `json:"ziMo"`        //自摸次数
-	HuNum       int    `json:"hu"`          //和数
-	PaoNum      int    `json:"pao"`         //炮数
-	AnGangNum   int    `json:"anGang"`      //暗杠数
-	MingGangNum int    `json:"mingGang"`    //明杠数
-	TotalScore  int    `json:"totalScore"`  //总分
-	Uid         int64  `json:"uid"`         //id
-	Account     string `json:"account"`     //名字
-	IsPaoWang   bool   `json:"isPaoWang"`   //是否是炮王
-	IsBigWinner bool   `json:"isBigWinner"` //是否是大赢家
-	IsCreator   bool   `json:"isCreator"`   //是否是房主
+	ZiMoNum     int    `json:"ziMo" protobuf:"1"`         //自摸次数
+	HuNum       int    `json:"hu" protobuf:"2"`           //和数
+	PaoNum      int    `json:"pao" protobuf:"3"`          //炮数
+	AnGangNum   int    `json:"anGang" protobuf:"4"`       //暗杠数
+	MingGangNum int    `json:"mingGang" protobuf:"5"`     //明杠数
+	TotalScore  int    `json:"totalScore" protobuf:"6"`   //总分
+	Uid         int64  `json:"uid" protobuf:"7"`          //id
+	Account     string `json:"account" protobuf:"8"`      //名字
+	IsPaoWang   bool   `json:"isPaoWang" protobuf:"9"`    //是否是炮王
+	IsBigWinner bool   `json:"isBigWinner" protobuf:"10"` //是否是大赢家
+	IsCreator   bool   `json:"isCreator" protobuf:"11"`   //是否是房主
 }
 
 type HuInfo struct {
-	Uid           int64       `json:"acId"`
-	HuPaiType     HuPaiType   `json:"huPaiType"`
-	ScoreChange   []ScoreInfo `json:"scoreChange"`
-	TotalWinScore int         `json:"totalWinScore"` //赢的所有输家的总分数
+	Uid           int64       `json:"acId" protobuf:"1"`
+	HuPaiType     HuPaiType   `json:"huPaiType" protobuf:"2"`
+	ScoreChange   []ScoreInfo `json:"scoreChange" protobuf:"3"`
+	TotalWinScore int         `json:"totalWinScore" protobuf:"4"` //赢的所有输家的总分数
 }
 
 type HandTilesInfo struct {
-	Uid    int64 `json:"acId"`
-	Tiles  []int `json:"shouPai"`
-	HuPai  int   `json:"huPai"`
-	IsTing bool  `json:"isTing"`
+	Uid    int64 `json:"acId" protobuf:"1"`
+	Tiles  []int `json:"shouPai" protobuf:"2"`
+	HuPai  int   `json:"huPai" protobuf:"3"`
+	IsTing bool  `json:"isTing" protobuf:"4"`
+	HuPais []int `json:"huPais" protobuf:"5"` //血流成河模式下所有胡过的牌
 }
 
 type GameEndScoreChange struct {
-	Uid    int64 `json:"acId"`
-	Score  int   `json:"score"`
-	Remain int   `json:"remain"`
+	Uid    int64 `json:"acId" protobuf:"1"`
+	Score  int   `json:"score" protobuf:"2"`
+	Remain int   `json:"remain" protobuf:"3"`
 }
 
 type RoundOverStats struct {
-	Title       string               `json:"title"`
-	Round       string               `json:"round"`
-	HandTiles   []*HandTilesInfo     `json:"tiles"`
-	Stats       []*RoundStats        `json:"stats"`
-	ScoreChange []GameEndScoreChange `json:"scoreChange"`
+	Title       string               `json:"title" protobuf:"1"`
+	Round       string               `json:"round" protobuf:"2"`
+	HandTiles   []*HandTilesInfo     `json:"tiles" protobuf:"3"`
+	Stats       []*RoundStats        `json:"stats" protobuf:"4"`
+	ScoreChange []GameEndScoreChange `json:"scoreChange" protobuf:"5"`
+	HuRecords   []*HuRecord          `json:"huRecords" protobuf:"6"` //本局所有的胡牌, 按胡牌顺序
+}
+
+// 单次胡牌记录, 血流成河模式下一个玩家一局可以胡多次
+type HuRecord struct {
+	Uid       int64     `json:"acId" protobuf:"1"`
+	HuPai     int       `json:"huPai" protobuf:"2"`
+	HuPaiType HuPaiType `json:"huPaiType" protobuf:"3"`
+	Losers    []int64   `json:"losers" protobuf:"4"`
+	FanNum    int       `json:"fanshu" protobuf:"5"`
+	Desc      string    `json:"desc" protobuf:"6"`
+	Score     int       `json:"score" protobuf:"7"` //赢的所有输家的总分数
 }
 
 type DeskPlayerData struct {
-	Uid        int64 `json:"acId"`
-	HandTiles  []int `json:"shouPaiIds"`
-	ChuTiles   []int `json:"chuPaiIds"`
-	PGTiles    []int `json:"gangInfos"`
-	LatestTile int   `json:"lastTile"`
-	IsHu       bool  `json:"isHu"`
-	HuPai      int   `json:"huPai"`
-	HuType     int   `json:"huType"`
-	Que        int   `json:"que"`
-	Score      int   `json:"score"`
+	Uid        int64 `json:"acId" protobuf:"1"`
+	HandTiles  []int `json:"shouPaiIds" protobuf:"2"` //其他玩家的手牌不下发
+	HandCount  int   `json:"shouPaiCount" protobuf:"3"`
+	ChuTiles   []int `json:"chuPaiIds" protobuf:"4"`
+	PGTiles    []int `json:"gangInfos" protobuf:"5"`
+	ChiTiles   []int `json:"chiTiles" protobuf:"6"` //吃的牌, 每三张一组
+	LatestTile int   `json:"lastTile" protobuf:"7"`
+	IsHu       bool  `json:"isHu" protobuf:"8"`
+	HuPai      int   `json:"huPai" protobuf:"9"`
+	HuPais     []int `json:"huPais" protobuf:"10"` //血流成河模式下所有胡过的牌
+	HuType     int   `json:"huType" protobuf:"11"`
+	Que        int   `json:"que" protobuf:"12"`
+	Score      int   `json:"score" protobuf:"13"`
+	Trustee    bool  `json:"trustee" protobuf:"14"` //是否托管
+}
+
+// 房主添加机器人
+type AddRobotRequest struct {
+	Count int `json:"count" protobuf:"1"` //机器人数量, 默认填满空位
+	Level int `json:"level" protobuf:"2"` //难度: 1.简单 2.普通 3.困难
+}
+
+type AddRobotResponse struct {
+	Code  int    `json:"code" protobuf:"1"`
+	Error string `json:"error" protobuf:"2"`
+}
+
+// 玩家托管状态变化
+type TrusteeStatus struct {
+	Uid     int64 `json:"acId" protobuf:"1"`
+	Trustee bool  `json:"trustee" protobuf:"2"`
 }
 
 type SyncDesk struct {
-	Status        constant.DeskStatus `json:"status"` //1,2,3,4,5
-	Players       []DeskPlayerData    `json:"players"`
-	ScoreInfo     []ScoreInfo         `json:"scoreInfo"`
-	MarkerUid     int64               `json:"markerAcId"`
-	LastMoPaiUid  int64               `json:"lastMoPaiAcId"`
-	RestCount     int                 `json:"restCnt"`
-	Dice1         int                 `json:"dice1"`
-	Dice2         int                 `json:"dice2"`
-	Hint          *Hint               `json:"hint"`
-	LastTileId    int                 `json:"lastChuPaiId"`
-	LastChuPaiUid int64               `json:"lastChuPaiUid"`
+	Status        constant.DeskStatus `json:"status" protobuf:"1"` //1,2,3,4,5
+	Players       []DeskPlayerData    `json:"players" protobuf:"2"`
+	ScoreInfo     []ScoreInfo         `json:"scoreInfo" protobuf:"3"`
+	MarkerUid     int64               `json:"markerAcId" protobuf:"4"`
+	LastMoPaiUid  int64               `json:"lastMoPaiAcId" protobuf:"5"`
+	RestCount     int                 `json:"restCnt" protobuf:"6"`
+	Dice1         int                 `json:"dice1" protobuf:"7"`
+	Dice2         int                 `json:"dice2" protobuf:"8"`
+	Hint          *Hint               `json:"hint" protobuf:"9"`
+	LastTileId    int                 `json:"lastChuPaiId" protobuf:"10"`
+	LastChuPaiUid int64               `json:"lastChuPaiUid" protobuf:"11"`
+	Exchange      *ExchangeStatus     `json:"exchange,omitempty" protobuf:"12"` //换三张阶段的状态
 }
 
 type DeskOptions struct {
-	Mode     int `json:"mode"`
-	MaxRound int `json:"round"`
-	MaxFan   int `json:"maxFan"`
+	Mode     int `json:"mode" protobuf:"1"`
+	MaxRound int `json:"round" protobuf:"2"`
+	MaxFan   int `json:"maxFan" protobuf:"3"`
 
-	Zimo string `json:"zimo"`
+	Zimo string `json:"zimo" protobuf:"4"`
 
 	// 玩法
-	Menqing  bool `json:"menqing"`  // 门清中张
-	Jiangdui bool `json:"jiangdui"` // 幺九将对
-	Jiaxin   bool `json:"jiaxin"`   // 夹心五
-	Pengpeng bool `json:"pengpeng"` // 碰碰胡两番
-	Pinghu   bool `json:"pinghu"`   // 点炮可平胡
-	Yaojiu   bool `json:"yaojiu"`   // 全幺九
+	Menqing  bool `json:"menqing" protobuf:"5"`   // 门清中张
+	Jiangdui bool `json:"jiangdui" protobuf:"6"`  // 幺九将对
+	Jiaxin   bool `json:"jiaxin" protobuf:"7"`    // 夹心五
+	Pengpeng bool `json:"pengpeng" protobuf:"8"`  // 碰碰胡两番
+	Pinghu   bool `json:"pinghu" protobuf:"9"`    // 点炮可平胡
+	Yaojiu   bool `json:"yaojiu" protobuf:"10"`   // 全幺九
+	Xueliu   bool `json:"xueliu" protobuf:"11"`   // 血流成河: 胡牌后继续游戏, 直到牌墙摸完
+	Exchange bool `json:"exchange" protobuf:"12"` // 换三张, 只在四人模式下有效
+	Chajiao  bool `json:"chajiao" protobuf:"13"`  // 流局查花猪、查大叫、退税
+
+	Watch      bool `json:"watch" protobuf:"14"`      // 允许观战
+	WatchDelay int  `json:"watchDelay" protobuf:"15"` // 观战延迟, 单位: 秒, 0表示不延迟
+
+	Rule string `json:"rule" protobuf:"16"` // 规则集, 为空时使用血战到底
 }
 
 type CreateDeskRequest struct {
-	Version  string       `json:"version"` //客户端版本
-	ClubId   int64        `json:"clubId"`  // 俱乐部ID
-	DeskOpts *DeskOptions `json:"options"` // 游戏额外选项
+	Version  string       `json:"version" protobuf:"1"` //客户端版本
+	ClubId   int64        `json:"clubId" protobuf:"2"`  // 俱乐部ID
+	DeskOpts *DeskOptions `json:"options" protobuf:"3"` // 游戏额外选项
 }
 
 type CreateDeskResponse struct {
-	Code      int       `json:"code"`
-	Error     string    `json:"error"`
-	TableInfo TableInfo `json:"tableInfo"`
+	Code      int       `json:"code" protobuf:"1"`
+	Error     string    `json:"error" protobuf:"2"`
+	TableInfo TableInfo `json:"tableInfo" protobuf:"3"`
 }
 
 type ReConnect struct {
-	Uid     int64  `json:"uid"`
-	Name    string `json:"name"`
-	HeadUrl string `json:"headUrl"`
-	Sex     int    `json:"sex"`
+	Uid     int64  `json:"uid" protobuf:"1"`
+	Name    string `json:"name" protobuf:"2"`
+	HeadUrl string `json:"headUrl" protobuf:"3"`
+	Sex     int    `json:"sex" protobuf:"4"`
+	Token   string `json:"token" protobuf:"5"` //登录凭证
 }
 
 type DeskListRequest struct {
-	Player int64 `json:"player"`
-	Offset int   `json:"offset"`
-	Count  int   `json:"count"`
+	Player int64 `json:"player" protobuf:"1"`
+	Offset int   `json:"offset" protobuf:"2"`
+	Count  int   `json:"count" protobuf:"3"`
 }
 
 type Desk struct {
-	Id           int64  `json:"id"`
-	Creator      int64  `json:"creator"`
-	Round        int    `json:"round"`
-	DeskNo       string `json:"desk_no"`
-	Mode         int    `json:"mode"`
-	Player0      int64  `json:"player0"`
-	Player1      int64  `json:"player1"`
-	Player2      int64  `json:"player2"`
-	Player3      int64  `json:"player3"`
-	PlayerName0  string `json:"player_name0"`
-	PlayerName1  string `json:"player_name1"`
-	PlayerName2  string `json:"player_name2"`
-	PlayerName3  string `json:"player_name3"`
-	ScoreChange0 int    `json:"score_change0"`
-	ScoreChange1 int    `json:"score_change1"`
-	ScoreChange2 int    `json:"score_change2"`
-	ScoreChange3 int    `json:"score_change3"`
-	CreatedAt    int64  `json:"created_at"`
-	CreatedAtStr string `json:"created_at_str"`
-	DismissAt    int64  `json:"dismiss_at"`
-	Extras       string `json:"extras"`
+	Id           int64  `json:"id" protobuf:"1"`
+	Creator      int64  `json:"creator" protobuf:"2"`
+	Round        int    `json:"round" protobuf:"3"`
+	DeskNo       string `json:"desk_no" protobuf:"4"`
+	Mode         int    `json:"mode" protobuf:"5"`
+	Player0      int64  `json:"player0" protobuf:"6"`
+	Player1      int64  `json:"player1" protobuf:"7"`
+	Player2      int64  `json:"player2" protobuf:"8"`
+	Player3      int64  `json:"player3" protobuf:"9"`
+	PlayerName0  string `json:"player_name0" protobuf:"10"`
+	PlayerName1  string `json:"player_name1" protobuf:"11"`
+	PlayerName2  string `json:"player_name2" protobuf:"12"`
+	PlayerName3  string `json:"player_name3" protobuf:"13"`
+	ScoreChange0 int    `json:"score_change0" protobuf:"14"`
+	ScoreChange1 int    `json:"score_change1" protobuf:"15"`
+	ScoreChange2 int    `json:"score_change2" protobuf:"16"`
+	ScoreChange3 int    `json:"score_change3" protobuf:"17"`
+	CreatedAt    int64  `json:"created_at" protobuf:"18"`
+	CreatedAtStr string `json:"created_at_str" protobuf:"19"`
+	DismissAt    int64  `json:"dismiss_at" protobuf:"20"`
+	Extras       string `json:"extras" protobuf:"21"`
 }
 
 type DestroyDeskResponse struct {
-	RoundStats       *RoundOverStats `json:"roundStats"`
-	MatchStats       []MatchStats    `json:"stats"`
-	Title            string          `json:"title"`
-	IsNormalFinished bool            `json:"isNormalFinished"`
+	RoundStats       *RoundOverStats `json:"roundStats" protobuf:"1"`
+	MatchStats       []MatchStats    `json:"stats" protobuf:"2"`
+	Title            string          `json:"title" protobuf:"3"`
+	IsNormalFinished bool            `json:"isNormalFinished" protobuf:"4"`
 }
 
 type DeskListResponse struct {
-	Code  int    `json:"code"`
-	Total int64  `json:"total"` //总数量
-	Data  []Desk `json:"data"`
+	Code  int    `json:"code" protobuf:"1"`
+	Total int64  `json:"total" protobuf:"2"` //总数量
+	Data  []Desk `json:"data" protobuf:"3"`
 }
 
 type DeleteDeskByIDRequest struct {
-	ID string `json:"id"` //房间ID
+	ID string `json:"id" protobuf:"1"` //房间ID
 }
 type DeskByIDRequest struct {
-	ID int64 `json:"id"` //房间ID
+	ID int64 `json:"id" protobuf:"1"` //房间ID
 }
 
 type DeskByIDResponse struct {
-	Code int   `json:"code"`
-	Data *Desk `json:"data"`
+	Code int   `json:"code" protobuf:"1"`
+	Data *Desk `json:"data" protobuf:"2"`
 }
 
 type LiangDaoHintMessage struct {
-	AccountId int64 `json:"acid"`
-	Tings     Tings `json:"tings"`
+	AccountId int64 `json:"acid" protobuf:"1"`
+	Tings     Tings `json:"tings" protobuf:"2"`
 }
 
 type LiangDaoMessage struct {
-	AccountId int64 `json:"acid"`
-	HuIndexs  []int `json:"hu"`
-	KouIndexs []int `json:"kou"`
+	AccountId int64 `json:"acid" protobuf:"1"`
+	HuIndexs  []int `json:"hu" protobuf:"2"`
+	KouIndexs []int `json:"kou" protobuf:"3"`
 }
 
 type RoundReady struct {
-	Multiple int `json:"multiple"`
+	Multiple int `json:"multiple" protobuf:"1"`
 }
 
 type JiangMa struct {
-	ID  int `json:"id"`
-	Fan int `json:"fan"`
+	ID  int `json:"id" protobuf:"1"`
+	Fan int `json:"fan" protobuf:"2"`
 }
 
 type UnCompleteDeskResponse struct {
-	Exist     bool      `json:"exist"`
-	TableInfo TableInfo `json:"tableInfo"`
+	Exist     bool      `json:"exist" protobuf:"1"`
+	TableInfo TableInfo `json:"tableInfo" protobuf:"2"`
 }
 
 type RecordingVoice struct {
-	FileId string `json:"fileId"`
+	FileId string `json:"fileId" protobuf:"1"`
 }
 
 type PlayRecordingVoice struct {
-	Uid    int64  `json:"uid"`
-	FileId string `json:"fileId"`
+	Uid    int64  `json:"uid" protobuf:"1"`
+	FileId string `json:"fileId" protobuf:"2"`
 }
 
 type ClientInitCompletedRequest struct {
-	IsReEnter bool `json:"isReenter"`
+	IsReEnter bool `json:"isReenter" protobuf:"1"`
 }
@@ -1,59 +1,88 @@
 package protocol
 
 type HistoryListRequest struct {
-	DeskID int64 `json:"desk_id"`
-	Offset int   `json:"offset"`
-	Count  int   `json:"count"`
+	DeskID int64 `json:"desk_id" protobuf:"1"`
+	Offset int   `json:"offset" protobuf:"2"`
+	Count  int   `json:"count" protobuf:"3"`
 }
 
 type DeleteHistoryRequest struct {
-	ID string `json:"id"` //历史ID
+	ID string `json:"id" protobuf:"1"` //历史ID
 }
 type HistoryByIDRequest struct {
-	ID int64 `json:"id"` //历史ID
+	ID int64 `json:"id" protobuf:"1"` //历史ID
 }
 
 type HistoryLiteListRequest struct {
-	DeskID int64 `json:"desk_id"`
-	Offset int   `json:"offset"`
-	Count  int   `json:"count"`
+	DeskID int64 `json:"desk_id" protobuf:"1"`
+	Offset int   `json:"offset" protobuf:"2"`
+	Count  int   `json:"count" protobuf:"3"`
 }
 
 type HistoryLite struct {
-	Id           int64  `json:"id"`
-	DeskId       int64  `json:"desk_id"`
-	Mode         int    `json:"mode"`
-	BeginAt      int64  `json:"begin_at"`
-	BeginAtStr   string `json:"begin_at_str"`
-	EndAt        int64  `json:"end_at"`
-	PlayerName0  string `json:"player_name0"`
-	PlayerName1  string `json:"player_name1"`
-	PlayerName2  string `json:"player_name2"`
-	PlayerName3  string `json:"player_name3"`
-	ScoreChange0 int    `json:"score_change0"`
-	ScoreChange1 int    `json:"score_change1"`
-	ScoreChange2 int    `json:"score_change2"`
-	ScoreChange3 int    `json:"score_change3"`
+	Id           int64  `json:"id" protobuf:"1"`
+	DeskId       int64  `json:"desk_id" protobuf:"2"`
+	Mode         int    `json:"mode" protobuf:"3"`
+	BeginAt      int64  `json:"begin_at" protobuf:"4"`
+	BeginAtStr   string `json:"begin_at_str" protobuf:"5"`
+	EndAt        int64  `json:"end_at" protobuf:"6"`
+	PlayerName0  string `json:"player_name0" protobuf:"7"`
+	PlayerName1  string `json:"player_name1" protobuf:"8"`
+	PlayerName2  string `json:"player_name2" protobuf:"9"`
+	PlayerName3  string `json:"player_name3" protobuf:"10"`
+	ScoreChange0 int    `json:"score_change0" protobuf:"11"`
+	ScoreChange1 int    `json:"score_change1" protobuf:"12"`
+	ScoreChange2 int    `json:"score_change2" protobuf:"13"`
+	ScoreChange3 int    `json:"score_change3" protobuf:"14"`
 }
 
 type History struct {
-	HistoryLite
-	Snapshot string `json:"snapshot"`
+	HistoryLite `protobuf:"1"`
+	Snapshot    string `json:"snapshot" protobuf:"2"`
 }
 
 type HistoryLiteListResponse struct {
-	Code  int           `json:"code"`
-	Total int64         `json:"total"` //总数量
-	Data  []HistoryLite `json:"data"`
+	Code  int           `json:"code" protobuf:"1"`
+	Total int64         `json:"total" protobuf:"2"` //总数量
+	Data  []HistoryLite `json:"data" protobuf:"3"`
 }
 
 type HistoryListResponse struct {
-	Code  int       `json:"code"`
-	Total int64     `json:"total"` //总数量
-	Data  []History `json:"data"`
+	Code  int       `json:"code" protobuf:"1"`
+	Total int64     `json:"total" protobuf:"2"` //总数量
+	Data  []History `json:"data" protobuf:"3"`
 }
 
 type HistoryByIDResponse struct {
-	Code int      `json:"code"`
-	Data *History `json:"data"`
+	Code int      `json:"code" protobuf:"1"`
+	Data *History `json:"data" protobuf:"2"`
+}
+
+// 回放中的一组碰/杠/吃
+type ReplayMeld struct {
+	OpType  int   `json:"optype" protobuf:"1"`
+	TileIDs []int `json:"mjs" protobuf:"2"`
+}
+
+// 回放中玩家的状态
+type ReplayPlayer struct {
+	Uid      int64        `json:"acId" protobuf:"1"`
+	OnHand   []int        `json:"shouPai" protobuf:"2"` //手牌
+	Melds    []ReplayMeld `json:"melds" protobuf:"3"`   //碰杠吃
+	Discards []int        `json:"chuPai" protobuf:"4"`  //打出去并且没有被别人拿走的牌
+	HuTiles  []int        `json:"huPais" protobuf:"5"`  //胡的牌
+	Score    int          `json:"score" protobuf:"6"`   //本局当前的输赢
+}
+
+// 回放的一帧, 每一步操作之后的完整牌桌状态, Step为0时是发牌(换三张)之后的状态
+type ReplayFrame struct {
+	Step      int            `json:"step" protobuf:"1"`
+	Action    *OpTypeDo      `json:"action" protobuf:"2"`
+	RestCount int            `json:"restCount" protobuf:"3"` //牌墙剩余数量
+	Players   []ReplayPlayer `json:"players" protobuf:"4"`
+}
+
+type HistoryReplayResponse struct {
+	Code int            `json:"code" protobuf:"1"`
+	Data []*ReplayFrame `json:"data" protobuf:"2"`
 }
@@ -10,6 +10,32 @@ type ThirdUserLoginRequest struct {
 	AccessToken string `json:"access_token"` //微信AccessToken
 }
 
+// 游客绑定微信或者手机号, 微信或者手机号已经属于其他用户时, Merge为true则把游客的房卡和俱乐部合并到该用户
+type BindRequest struct {
+	Token     string `json:"token"` //游客的登录凭证
+	Type      string `json:"type"`  //绑定类型: wechat, phone
+	AppID     string `json:"appId"`
+	ChannelID string `json:"channelId"`
+	Device    Device `json:"device"`
+	Merge     bool   `json:"merge"` //冲突时是否合并, 为false时返回错误
+
+	// 绑定微信
+	Platform    string `json:"platform"`
+	OpenID      string `json:"openid"`
+	AccessToken string `json:"access_token"`
+
+	// 绑定手机号
+	Phone      string `json:"phone"`
+	Password   string `json:"password"` //MD5后的密码, 用于手机号密码登录
+	VerifyID   string `json:"verify_id"`
+	VerifyCode string `json:"verify_code"`
+}
+
+const (
+	BindTypeWechat = "wechat"
+	BindTypePhone  = "phone"
+)
+
 type LoginInfo struct {
 	// 三方登录字段
 	Platform     string `json:"platform"`      //三方平台
@@ -55,6 +81,9 @@ type ClientConfig struct {
 	AppKey string `json:"appKey"`
 }
 
+// GuestHeadUrl 游客的默认头像
+const GuestHeadUrl = "http://wx.qlogo.cn/mmopen/s962LEwpLxhQSOnarDnceXjSxVGaibMRsvRM4EIWic0U6fQdkpqz4Vr8XS8D81QKfyYuwjwm2M2ibsFY8mia8ic51ww/0"
+
 type LoginResponse struct {
 	Code     int          `json:"code"`
 	Name     string       `json:"name"`
@@ -69,23 +98,41 @@ type LoginResponse struct {
 	Messages []string     `json:"messages"`
 	ClubList []ClubItem   `json:"clubList"`
 	Debug    int          `json:"debug"`
+	Token    string       `json:"token"`    //登录凭证, 登录游戏服务器时使用
+	ExpireAt int64        `json:"expireAt"` //登录凭证过期时间
+}
+
+// 刷新或者注销登录凭证
+type TokenRequest struct {
+	Token string `json:"token"`
+}
+
+type TokenResponse struct {
+	Code     int    `json:"code"`
+	Token    string `json:"token"`
+	ExpireAt int64  `json:"expireAt"`
 }
 
 type LoginToGameServerResponse struct {
-	Uid      int64  `json:"acId"`
-	Nickname string `json:"nickname"`
-	HeadUrl  string `json:"headURL"`
-	Sex      int    `json:"sex"`
-	FangKa   int    `json:"fangka"`
+	Uid        int64  `json:"acId" protobuf:"1"`
+	Nickname   string `json:"nickname" protobuf:"2"`
+	HeadUrl    string `json:"headURL" protobuf:"3"`
+	Sex        int    `json:"sex" protobuf:"4"`
+	FangKa     int    `json:"fangka" protobuf:"5"`
+	Serializer string `json:"serializer" protobuf:"6"` //协商后的消息格式, 登录响应已经使用这个格式编码
+	Code       int    `json:"code" protobuf:"7"`
+	Error      string `json:"error" protobuf:"8"`
 }
 
 type LoginToGameServerRequest struct {
-	Name    string `json:"name"`
-	Uid     int64  `json:"uid"`
-	HeadUrl string `json:"headUrl"`
-	Sex     int    `json:"sex"` //[0]未知 [1]男 [2]女
-	FangKa  int    `json:"fangka"`
-	IP      string `json:"ip"`
+	Name        string   `json:"name" protobuf:"1"`
+	Uid         int64    `json:"uid" protobuf:"2"`
+	HeadUrl     string   `json:"headUrl" protobuf:"3"`
+	Sex         int      `json:"sex" protobuf:"4"` //[0]未知 [1]男 [2]女
+	FangKa      int      `json:"fangka" protobuf:"5"`
+	IP          string   `json:"ip" protobuf:"6"`
+	Serializers []string `json:"serializers" protobuf:"7"` //客户端支持的消息格式, 按优先级排序, 老版本客户端为空
+	Token       string   `json:"token" protobuf:"8"`       //web登录时签发的凭证, 玩家信息以数据库为准, 其他字段不再使用
 }
 
 type EncryptTest struct {
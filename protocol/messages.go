@@ -0,0 +1,132 @@
+package protocol
+
+// 游戏服务器消息的protobuf定义, 字段编号见结构体的protobuf标签,
+// protocol.proto由这里的列表生成: go test ./protocol -run TestSchema -update
+var Messages = []interface{}{
+	// login.go
+	LoginToGameServerResponse{},
+	LoginToGameServerRequest{},
+
+	// common.go
+	None{},
+	EmptyRequest{},
+	StringResponse{},
+	StringMessage{},
+	MaintenanceNotice{},
+	ErrorResponse{},
+	ErrorMessage{},
+	PlayerReady{},
+	Ting{},
+	Hint{},
+
+	// desk.go
+	EnterDeskInfo{},
+	ExitResponse{},
+	PlayerEnterDesk{},
+	ExitRequest{},
+	QueItem{},
+	DingQue{},
+	ExchangeHint{},
+	ExchangeRequest{},
+	ExchangePicked{},
+	ExchangeResult{},
+	ExchangeStatus{},
+	DeskBasicInfo{},
+	ScoreInfo{},
+	DuanPaiInfo{},
+	DuanPai{},
+	Op{},
+	OpTypeDo{},
+	MoPai{},
+	GangPaiScoreChange{},
+	BeHuInfo{},
+	RoundStats{},
+	MatchStats{},
+	HuInfo{},
+	HandTilesInfo{},
+	GameEndScoreChange{},
+	RoundOverStats{},
+	HuRecord{},
+	DeskPlayerData{},
+	AddRobotRequest{},
+	AddRobotResponse{},
+	TrusteeStatus{},
+	SyncDesk{},
+	DeskOptions{},
+	CreateDeskRequest{},
+	CreateDeskResponse{},
+	ReConnect{},
+	DeskListRequest{},
+	Desk{},
+	DestroyDeskResponse{},
+	DeskListResponse{},
+	DeleteDeskByIDRequest{},
+	DeskByIDRequest{},
+	DeskByIDResponse{},
+	LiangDaoHintMessage{},
+	LiangDaoMessage{},
+	RoundReady{},
+	JiangMa{},
+	UnCompleteDeskResponse{},
+	RecordingVoice{},
+	PlayRecordingVoice{},
+	ClientInitCompletedRequest{},
+
+	// req.go
+	GetRankInfoRequest{},
+	MailOperateRequest{},
+	ApplyForDailyMatchRequest{},
+	JQToCoinRequest{},
+	BashiCoinOpRequest{},
+	ReJoinDeskRequest{},
+	ReJoinDeskResponse{},
+	ReEnterDeskRequest{},
+	ReEnterDeskResponse{},
+	JoinDeskRequest{},
+	TableInfo{},
+	JoinDeskResponse{},
+	WatchDeskRequest{},
+	WatchDeskResponse{},
+	DestoryDeskRequest{},
+	OpChoosed{},
+	MingAction{},
+	OpChooseRequest{},
+	ChooseOneScoreRequest{},
+	CheckOrderReqeust{},
+	CheckOrderResponse{},
+	FanPaiRequest{},
+	DissolveStatusItem{},
+	DissolveResponse{},
+	DissolveStatusRequest{},
+	DissolveStatusResponse{},
+	DissolveResult{},
+	CalcLastTingRequest{},
+	CalcLastTingResponse{},
+	PlayerOfflineStatus{},
+	CoinChangeInformation{},
+
+	// history.go
+	HistoryListRequest{},
+	DeleteHistoryRequest{},
+	HistoryByIDRequest{},
+	HistoryLiteListRequest{},
+	HistoryLite{},
+	History{},
+	HistoryLiteListResponse{},
+	HistoryListResponse{},
+	HistoryByIDResponse{},
+	ReplayMeld{},
+	ReplayPlayer{},
+	ReplayFrame{},
+	HistoryReplayResponse{},
+
+	// club.go
+	ClubItem{},
+	ClubListResponse{},
+	ApplyClubRequest{},
+	ClubMemberRequest{},
+	ClubRoleRequest{},
+	ClubMember{},
+	ClubMemberListResponse{},
+	ClubNotify{},
+}
@@ -1,14 +1,13 @@
 package protocol
 
 type CreateOrderRequest struct {
-	AppID          string //来自哪个应用的订单
-	ChannelID      string //来自哪个渠道的订单
-	Platform       string //支付平台
-	ProductionName string
-	ProductCount   int    //房卡数量
-	Extra          string //描述信息
-	Device         Device //设备信息
-	Uid            int64  //Token
+	AppID     string //来自哪个应用的订单
+	ChannelID string //来自哪个渠道的订单
+	Platform  string //支付平台
+	Sku       string //商品SKU, 价格和房卡数量以商品目录为准
+	Extra     string //描述信息
+	Device    Device //设备信息
+	Uid       int64  //Token
 }
 
 type CreateOrderByAdminRequest struct {
@@ -30,7 +29,7 @@ type BalanceListResponse struct {
 	Data map[string]string `json:"data"` //渠道列表
 }
 
-//OrderByAdminListRequest 由管理员创建的订单列表
+// OrderByAdminListRequest 由管理员创建的订单列表
 type OrderByAdminListRequest struct {
 	Offset    int    `json:"offset"`
 	Count     int    `json:"count"`
@@ -42,7 +41,7 @@ type OrderByAdminListRequest struct {
 	ChannelID string `json:"channel_id"` //来自哪个渠道的订单
 }
 
-//PayOrderListRequest 由管理员创建的订单列表
+// PayOrderListRequest 由管理员创建的订单列表
 type PayOrderListRequest struct {
 	Offset    int    `json:"offset"`
 	Count     int    `json:"count"`
@@ -55,7 +54,7 @@ type PayOrderListRequest struct {
 	ChannelID string `json:"channel_id"` //来自哪个渠道的订单
 }
 
-//OrderListRequest 订单列表
+// OrderListRequest 订单列表
 type OrderListRequest struct {
 	Offset    int    `json:"offset"`
 	Count     int    `json:"count"`
@@ -69,7 +68,7 @@ type OrderListRequest struct {
 	ChannelID string `json:"channel_id"` //来自哪个渠道的订单
 }
 
-//TradeListRequest 交易列表
+// TradeListRequest 交易列表
 type TradeListRequest struct {
 	Offset    int    `json:"offset"`
 	Count     int    `json:"count"`
@@ -125,6 +124,25 @@ type CreateOrderWechatReponse struct {
 	Extra     string `json:"extData"`
 }
 
+type CreateOrderAlipayResponse struct {
+	OrderId     string `json:"orderid"`
+	OrderString string `json:"orderString"` //客户端调起支付宝需要的参数, 已签名
+	Extra       string `json:"extData"`
+}
+
+type CreateOrderSandboxResponse struct {
+	OrderId string `json:"orderid"`
+	Fee     int    `json:"fee"`    //金额, 单位: 分
+	Notify  string `json:"notify"` //已签名的支付通知, 可以用来测试重复通知
+	Delay   int    `json:"delay"`  //自动通知的延迟, 单位: 秒
+	Extra   string `json:"extData"`
+}
+
+type OrderStatusResponse struct {
+	Code   int `json:"code"`
+	Status int `json:"status"` //订单状态
+}
+
 type UnifyOrderCallbackRequest struct {
 	PayPlatform string
 	RawRequest  interface{}
@@ -159,6 +177,8 @@ type WechatOrderCallbackRequest struct {
 	OutTradeNo    string `xml:"out_trade_no"`
 	TimeEnd       string `xml:"time_end"`
 
+	ReqInfo string `xml:"req_info,omitempty"` //退款通知的加密信息
+
 	Raw string
 }
 
@@ -167,7 +187,70 @@ type WechatOrderCallbackResponse struct {
 	ReturnMsg  string `xml:"return_msg,cdata"`
 }
 
+// 余额流水
+type LedgerEntry struct {
+	Id        int64  `json:"id"`
+	Amount    int64  `json:"amount"`    //变化数量, 扣除时为负数
+	Balance   int64  `json:"balance"`   //变化后的余额
+	Reason    int    `json:"reason"`    //变化原因
+	Ref       string `json:"ref"`       //关联的订单号、房间ID或者GM账号
+	CreatedAt int64  `json:"createdAt"` //时间
+}
+
+type LedgerListResponse struct {
+	Code  int           `json:"code"`
+	Data  []LedgerEntry `json:"data"`
+	Total int           `json:"total"`
+}
+
 type RechargeRequest struct {
-	Count int64 `json:"count"`
-	Uid   int64 `json:"uid"`
+	Count    int64  `json:"count"`
+	Uid      int64  `json:"uid"`
+	Operator string `json:"operator"` //GM账号
+	Key      string `json:"key"`      //幂等键, 重试时使用相同的值, 为空时每次请求都会充值
+}
+
+type RefundRequest struct {
+	OrderId  string `json:"orderId"`
+	Reason   string `json:"reason"`   //退款原因, 会发送给支付平台
+	Operator string `json:"operator"` //GM账号
+}
+
+// 退款记录
+type RefundInfo struct {
+	RefundId    string `json:"refundId"`
+	OrderId     string `json:"orderId"`
+	Uid         int64  `json:"uid"`
+	PayPlatform string `json:"payPlatform"`
+	PayRefundId string `json:"payRefundId"` //支付平台的退款单号
+	Fee         int    `json:"fee"`         //退款金额, 单位: 分
+	Coin        int64  `json:"coin"`        //扣回的房卡数量
+	Debt        int64  `json:"debt"`        //房卡不足时的欠款数量
+	Source      int    `json:"source"`      //1: GM申请, 2: 支付平台直接退款
+	Reason      string `json:"reason"`
+	Operator    string `json:"operator"`
+	Status      int    `json:"status"` //1: 等待退款, 2: 退款成功, 3: 退款失败
+	Error       string `json:"error"`
+	CreatedAt   int64  `json:"createdAt"`
+	FinishedAt  int64  `json:"finishedAt"`
+}
+
+type RefundListResponse struct {
+	Code  int          `json:"code"`
+	Data  []RefundInfo `json:"data"`
+	Total int          `json:"total"`
+}
+
+// 商品目录
+type ProductInfo struct {
+	Sku   string `json:"sku"`
+	Name  string `json:"name"`
+	Price int    `json:"price"` //价格, 单位: 分
+	Coin  int    `json:"coin"`  //房卡数量
+	Bonus int    `json:"bonus"` //赠送房卡数量
+}
+
+type ProductListResponse struct {
+	Code int           `json:"code"`
+	Data []ProductInfo `json:"data"`
 }
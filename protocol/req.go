@@ -5,150 +5,162 @@ import (
 )
 
 type GetRankInfoRequest struct {
-	IsSelf bool `json:"isself"`
-	Start  int  `json:"start"`
-	Len    int  `json:"len"`
+	IsSelf bool `json:"isself" protobuf:"1"`
+	Start  int  `json:"start" protobuf:"2"`
+	Len    int  `json:"len" protobuf:"3"`
 }
 
 type MailOperateRequest struct {
-	MailIDs []int64 `json:"mailids"`
+	MailIDs []int64 `json:"mailids" protobuf:"1"`
 }
 
 type ApplyForDailyMatchRequest struct {
-	Arg1           int `json:"arg1"`
-	DailyMatchType int `json:"dailyMatchType"`
-	Multiple       int `json:"multiple"`
+	Arg1           int `json:"arg1" protobuf:"1"`
+	DailyMatchType int `json:"dailyMatchType" protobuf:"2"`
+	Multiple       int `json:"multiple" protobuf:"3"`
 }
 
 type JQToCoinRequest struct {
-	Count int `json:"count"`
+	Count int `json:"count" protobuf:"1"`
 }
 
 type BashiCoinOpRequest struct {
-	Op   int `json:"op"`
-	Coin int `json:"coin"`
+	Op   int `json:"op" protobuf:"1"`
+	Coin int `json:"coin" protobuf:"2"`
 }
 
 type ReJoinDeskRequest struct {
-	DeskNo string `json:"deskId"`
+	DeskNo string `json:"deskId" protobuf:"1"`
 }
 
 type ReJoinDeskResponse struct {
-	Code  int    `json:"code"`
-	Error string `json:"error"`
+	Code  int    `json:"code" protobuf:"1"`
+	Error string `json:"error" protobuf:"2"`
 }
 
 type ReEnterDeskRequest struct {
-	DeskNo string `json:"deskId"`
+	DeskNo string `json:"deskId" protobuf:"1"`
 }
 
 type ReEnterDeskResponse struct {
-	Code  int    `json:"code"`
-	Error string `json:"error"`
+	Code  int    `json:"code" protobuf:"1"`
+	Error string `json:"error" protobuf:"2"`
 }
 type JoinDeskRequest struct {
-	Version string `json:"version"`
+	Version string `json:"version" protobuf:"1"`
 	//AccountId int64         `json:"acId"`
-	DeskNo string `json:"deskId"`
+	DeskNo string `json:"deskId" protobuf:"2"`
 }
 
 type TableInfo struct {
-	DeskNo    string              `json:"deskId"`
-	CreatedAt int64               `json:"createdAt"`
-	Creator   int64               `json:"creator"`
-	Title     string              `json:"title"`
-	Desc      string              `json:"desc"`
-	Status    constant.DeskStatus `json:"status"`
-	Round     uint32              `json:"round"`
-	Mode      int                 `json:"mode"`
+	DeskNo    string              `json:"deskId" protobuf:"1"`
+	CreatedAt int64               `json:"createdAt" protobuf:"2"`
+	Creator   int64               `json:"creator" protobuf:"3"`
+	Title     string              `json:"title" protobuf:"4"`
+	Desc      string              `json:"desc" protobuf:"5"`
+	Status    constant.DeskStatus `json:"status" protobuf:"6"`
+	Round     uint32              `json:"round" protobuf:"7"`
+	Mode      int                 `json:"mode" protobuf:"8"`
 }
 
 type JoinDeskResponse struct {
-	Code      int       `json:"code"`
-	Error     string    `json:"error"`
-	TableInfo TableInfo `json:"tableInfo"`
+	Code      int       `json:"code" protobuf:"1"`
+	Error     string    `json:"error" protobuf:"2"`
+	TableInfo TableInfo `json:"tableInfo" protobuf:"3"`
+}
+
+type WatchDeskRequest struct {
+	DeskNo string `json:"deskId" protobuf:"1"`
+}
+
+type WatchDeskResponse struct {
+	Code      int       `json:"code" protobuf:"1"`
+	Error     string    `json:"error" protobuf:"2"`
+	Delay     int       `json:"delay" protobuf:"3"` //观战延迟, 单位: 秒
+	TableInfo TableInfo `json:"tableInfo" protobuf:"4"`
 }
 
 type DestoryDeskRequest struct {
-	DeskNo string `json:"deskId"`
+	DeskNo string `json:"deskId" protobuf:"1"`
 }
 
 //选择执行的动作
 type OpChoosed struct {
-	Type   int
-	TileID int
+	Type   int `protobuf:"1"`
+	TileID int `protobuf:"2"`
 }
 
 type MingAction struct {
-	KouIndexs []int `json:"kou"` //index
-	ChuPaiID  int   `json:"chu"`
-	HuIndexs  []int `json:"hu"`
+	KouIndexs []int `json:"kou" protobuf:"1"` //index
+	ChuPaiID  int   `json:"chu" protobuf:"2"`
+	HuIndexs  []int `json:"hu" protobuf:"3"`
 }
 
 type OpChooseRequest struct {
-	OpType int `json:"optype"`
-	Index  int `json:"idx"`
+	OpType int `json:"optype" protobuf:"1"`
+	Index  int `json:"idx" protobuf:"2"`
 }
 
 type ChooseOneScoreRequest struct {
-	Pos int `json:"pos"`
+	Pos int `json:"pos" protobuf:"1"`
 }
 
 type CheckOrderReqeust struct {
-	OrderID string `json:"orderid"`
+	OrderID string `json:"orderid" protobuf:"1"`
 }
 
 type CheckOrderResponse struct {
-	Code   int    `json:"code"`
-	Error  string `json:"error"`
-	FangKa int    `json:"fangka"`
+	Code   int    `json:"code" protobuf:"1"`
+	Error  string `json:"error" protobuf:"2"`
+	FangKa int    `json:"fangka" protobuf:"3"` //当前房卡数量
+	Status int    `json:"status" protobuf:"4"` //订单状态
 }
 type FanPaiRequest struct {
-	Pos        int  `json:"pos"`
-	IsUseCoin  bool `json:"isUseCoin"`
-	IsMultiple bool `json:"isMultiple"`
-	OpType     int  `json:"opType"`
+	Pos        int  `json:"pos" protobuf:"1"`
+	IsUseCoin  bool `json:"isUseCoin" protobuf:"2"`
+	IsMultiple bool `json:"isMultiple" protobuf:"3"`
+	OpType     int  `json:"opType" protobuf:"4"`
 }
 
 type DissolveStatusItem struct {
-	DeskPos int    `json:"deskPos"`
-	Status  string `json:"status"`
+	DeskPos int    `json:"deskPos" protobuf:"1"`
+	Status  string `json:"status" protobuf:"2"`
 }
 
 type DissolveResponse struct {
-	DissolveUid    int64                `json:"dissolveUid"`
-	DissolveStatus []DissolveStatusItem `json:"dissolveStatus"`
-	RestTime       int32                `json:"restTime"`
+	DissolveUid    int64                `json:"dissolveUid" protobuf:"1"`
+	DissolveStatus []DissolveStatusItem `json:"dissolveStatus" protobuf:"2"`
+	RestTime       int32                `json:"restTime" protobuf:"3"`
 }
 
 type DissolveStatusRequest struct {
-	Result bool `json:"result"`
+	Result bool `json:"result" protobuf:"1"`
 }
 
 type DissolveStatusResponse struct {
-	DissolveStatus []DissolveStatusItem `json:"dissolveStatus"`
-	RestTime       int32                `json:"restTime"`
+	DissolveStatus []DissolveStatusItem `json:"dissolveStatus" protobuf:"1"`
+	RestTime       int32                `json:"restTime" protobuf:"2"`
 }
 
 type DissolveResult struct {
-	DeskPos int `json:"deskPos"`
+	DeskPos int `json:"deskPos" protobuf:"1"`
 }
 
 type CalcLastTingRequest struct {
-	KouIndexs  []int `json:"kou"`
-	TingIndexs []int `json:"ting"`
+	KouIndexs  []int `json:"kou" protobuf:"1"`
+	TingIndexs []int `json:"ting" protobuf:"2"`
 }
 
 type CalcLastTingResponse struct {
-	ForbidIndexs []int `json:"forbid"`
-	Tings        Tings `json:"tings"`
+	ForbidIndexs []int `json:"forbid" protobuf:"1"`
+	Tings        Tings `json:"tings" protobuf:"2"`
 }
 
 type PlayerOfflineStatus struct {
-	Uid     int64 `json:"uid"`
-	Offline bool  `json:"offline"`
+	Uid     int64 `json:"uid" protobuf:"1"`
+	Offline bool  `json:"offline" protobuf:"2"`
 }
 
 type CoinChangeInformation struct {
-	Coin int64 `json:"coin"`
+	Coin int64 `json:"coin" protobuf:"1"`
 }
@@ -3,4 +3,5 @@ package protocol
 const (
 	RouteOpTypeHint = "onOpTypeHint"
 	RouteTypeDo     = "onOpTypeDo"
+	RouteClubNotify = "onClubNotify"
 )
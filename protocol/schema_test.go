@@ -0,0 +1,33 @@
+package protocol
+
+import (
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"github.com/lonng/nanoserver/pkg/serialize/protobuf"
+)
+
+var update = flag.Bool("update", false, "重新生成protocol.proto")
+
+// protocol.proto必须和结构体的protobuf标签保持一致
+func TestSchema(t *testing.T) {
+	schema, err := protobuf.Schema("protocol", Messages...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if *update {
+		if err := ioutil.WriteFile("protocol.proto", []byte(schema), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data, err := ioutil.ReadFile("protocol.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != schema {
+		t.Fatal("protocol.proto已经过期, 请执行: go test ./protocol -run TestSchema -update")
+	}
+}
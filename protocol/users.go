@@ -76,3 +76,33 @@ type QueryUserResponse struct {
 	Code int       `json:"code"`
 	Data QueryInfo `json:"data"`
 }
+
+// 获取短信验证码
+type VerificationRequest struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type"` //验证码用途: register-注册, findPW-找回密码
+	AppID string `json:"appid"`
+}
+
+type VerificationResponse struct {
+	Code     int    `json:"code"`
+	VerifyID string `json:"verify_id"` //验证码ID, 注册或者重置密码时和验证码一起提交
+	Expire   int64  `json:"expire"`    //验证码有效期, 单位: 秒
+}
+
+// 账号或者手机号密码登录
+type PasswordLoginRequest struct {
+	Name      string `json:"name"`     //账号或者手机号
+	Password  string `json:"password"` //MD5后的用户密码
+	AppID     string `json:"appid"`
+	ChannelID string `json:"channel_id"`
+	Device    Device `json:"device"`
+}
+
+// 使用手机验证码重置密码
+type ResetPasswordRequest struct {
+	Phone      string `json:"phone"`
+	Password   string `json:"password"`    //MD5后的新密码, 长度>=6
+	VerifyID   string `json:"verify_id"`   //验证码ID
+	VerifyCode string `json:"verify_code"` //验证码
+}